@@ -83,10 +83,37 @@ func (a *App) startup(ctx context.Context) {
 
 	// 创建代理服务器
 	a.proxyServer = proxycore.NewProxyServer(a.config.ProxyPort, a.certManager)
+	if a.config.SOCKS5Port > 0 {
+		a.proxyServer.EnableSOCKS5(a.config.SOCKS5Port, a.config.SOCKS5Username, a.config.SOCKS5Password)
+	}
+
+	// 反向代理监听器收到的请求同样经代理服务器处理
+	a.featureManager.ReverseProxy.SetProxyServer(a.proxyServer, a.certManager)
+
+	// 脚本试运行使用已捕获的Flow
+	a.featureManager.Scripting.SetFlowSource(a.proxyServer.GetFlow)
+
+	// 加载PAC脚本
+	if a.config.PACFile != "" {
+		if err := a.featureManager.Upstream.LoadPAC(a.config.PACFile); err != nil {
+			logger.Warn("Failed to load PAC file %s: %v", a.config.PACFile, err)
+		}
+	}
+
+	// 加载脚本目录
+	if a.config.ScriptsDir != "" {
+		if err := a.featureManager.Scripting.SetScriptsDir(a.config.ScriptsDir); err != nil {
+			logger.Warn("Failed to load scripts directory %s: %v", a.config.ScriptsDir, err)
+		}
+	}
 
 	// 设置拦截器
+	pacFileInterceptor := features.NewPACFileInterceptor(nil)
 	allowBlockInterceptor := features.NewAllowBlockInterceptor(a.featureManager.AllowBlock)
 	mapLocalInterceptor := features.NewMapLocalInterceptor(a.featureManager.MapLocal)
+	mapRemoteInterceptor := features.NewMapRemoteInterceptor(a.featureManager.MapRemote)
+	faultInterceptor := features.NewFaultInterceptor(a.featureManager.Fault)
+	rewriteInterceptor := features.NewRewriteInterceptor(a.featureManager.Rewrite)
 	breakpointInterceptor := features.NewBreakpointInterceptor(a.featureManager.Breakpoint)
 	scriptInterceptor := features.NewScriptInterceptor(a.featureManager.Scripting)
 
@@ -97,20 +124,35 @@ func (a *App) startup(ctx context.Context) {
 	})
 
 	// 创建更多拦截器
-	upstreamInterceptor := features.NewUpstreamInterceptor(a.featureManager.Upstream)
 	reverseProxyInterceptor := features.NewReverseProxyInterceptor(a.featureManager.ReverseProxy)
 
 	// 按顺序添加拦截器（顺序很重要）
+	a.proxyServer.AddRequestInterceptor(pacFileInterceptor)      // 直接请求代理的PAC文件
 	a.proxyServer.AddRequestInterceptor(allowBlockInterceptor)   // 首先检查允许/阻止
 	a.proxyServer.AddRequestInterceptor(reverseProxyInterceptor) // 然后检查反向代理
-	a.proxyServer.AddRequestInterceptor(upstreamInterceptor)     // 然后检查上游代理
+	a.proxyServer.AddRequestInterceptor(faultInterceptor)        // 然后注入故障
+	a.proxyServer.AddRequestInterceptor(mapRemoteInterceptor)    // 然后改写Map Remote目标
 	a.proxyServer.AddRequestInterceptor(mapLocalInterceptor)     // 然后检查Map Local
+	a.proxyServer.AddRequestInterceptor(rewriteInterceptor)      // 然后应用改写规则
 	a.proxyServer.AddRequestInterceptor(breakpointInterceptor)   // 然后检查断点
 	a.proxyServer.AddRequestInterceptor(scriptInterceptor)       // 最后执行脚本
 
+	// 所有拦截器都没有处理的请求按上游代理、代理组或PAC选择最后一跳
+	a.proxyServer.SetUpstreamSelector(a.featureManager.Upstream)
+
+	a.proxyServer.AddResponseInterceptor(rewriteInterceptor)    // 响应改写
 	a.proxyServer.AddResponseInterceptor(breakpointInterceptor) // 响应断点
 	a.proxyServer.AddResponseInterceptor(scriptInterceptor)     // 响应脚本
 
+	a.proxyServer.AddConnectInterceptor(allowBlockInterceptor) // 建立HTTPS隧道前检查阻止规则
+	a.proxyServer.AddConnectInterceptor(faultInterceptor)      // 然后注入故障
+
+	// CONNECT时决定是否解密HTTPS
+	a.proxyServer.SetTLSInterceptionPolicy(a.featureManager.TLSIntercept)
+
+	// 网络条件模拟
+	a.proxyServer.SetNetworkConditioner(a.featureManager.Throttle)
+
 	// 设置流量处理回调
 	a.proxyServer.SetFlowHandler(func(flow *proxycore.Flow) {
 		// 通过Wails事件系统发送新的流量到前端
@@ -133,6 +175,11 @@ func (a *App) StartProxy() error {
 		return fmt.Errorf("failed to start proxy server: %v", err)
 	}
 
+	// 启动反向代理监听器
+	if err := a.featureManager.ReverseProxy.StartListeners(); err != nil {
+		logger.Warn("Reverse proxy listeners: %v", err)
+	}
+
 	// 设置系统代理
 	if err := a.systemManager.SetSystemProxy(a.config.ProxyPort); err != nil {
 		// 如果设置系统代理失败，仍然继续运行，但记录错误
@@ -156,6 +203,9 @@ func (a *App) StopProxy() error {
 		fmt.Printf("Warning: failed to disable system proxy: %v\n", err)
 	}
 
+	// 停止反向代理监听器
+	a.featureManager.ReverseProxy.StopListeners()
+
 	// 停止代理服务器
 	if err := a.proxyServer.Stop(); err != nil {
 		logger.Error("Failed to stop proxy server: %v", err)
@@ -206,6 +256,11 @@ func (a *App) GetProxyPort() int {
 	return a.config.ProxyPort
 }
 
+// GetSOCKS5Port 获取SOCKS5监听端口（0表示未启用）
+func (a *App) GetSOCKS5Port() int {
+	return a.config.SOCKS5Port
+}
+
 // PinFlow 钉住/取消钉住流量
 func (a *App) PinFlow(flowID string) error {
 	if a.proxyServer == nil {
@@ -233,8 +288,8 @@ func (a *App) GetFlowByID(flowID string) (*proxycore.Flow, error) {
 // Map Local 相关方法
 
 // AddMapLocalRule 添加Map Local规则
-func (a *App) AddMapLocalRule(rule *features.MapLocalRule) {
-	a.featureManager.MapLocal.AddRule(rule)
+func (a *App) AddMapLocalRule(rule *features.MapLocalRule) error {
+	return a.featureManager.MapLocal.AddRule(rule)
 }
 
 // RemoveMapLocalRule 移除Map Local规则
@@ -252,6 +307,105 @@ func (a *App) UpdateMapLocalRule(rule *features.MapLocalRule) error {
 	return a.featureManager.MapLocal.UpdateRule(rule)
 }
 
+// AddRewriteRule 添加或更新改写规则
+func (a *App) AddRewriteRule(rule *features.RewriteRule) error {
+	return a.featureManager.Rewrite.AddRule(rule)
+}
+
+// RemoveRewriteRule 移除改写规则
+func (a *App) RemoveRewriteRule(ruleID string) error {
+	return a.featureManager.Rewrite.RemoveRule(ruleID)
+}
+
+// GetRewriteRules 获取所有改写规则
+func (a *App) GetRewriteRules() []*features.RewriteRule {
+	return a.featureManager.Rewrite.GetAllRules()
+}
+
+// AddMapRemoteRule 添加Map Remote规则
+func (a *App) AddMapRemoteRule(rule *features.MapRemoteRule) error {
+	return a.featureManager.MapRemote.AddRule(rule)
+}
+
+// UpdateMapRemoteRule 更新Map Remote规则
+func (a *App) UpdateMapRemoteRule(rule *features.MapRemoteRule) error {
+	return a.featureManager.MapRemote.UpdateRule(rule)
+}
+
+// RemoveMapRemoteRule 移除Map Remote规则
+func (a *App) RemoveMapRemoteRule(ruleID string) {
+	a.featureManager.MapRemote.RemoveRule(ruleID)
+}
+
+// GetMapRemoteRules 获取所有Map Remote规则
+func (a *App) GetMapRemoteRules() []*features.MapRemoteRule {
+	return a.featureManager.MapRemote.GetAllRules()
+}
+
+// 网络条件模拟相关方法
+
+// GetNetworkProfiles 获取所有网络条件配置
+func (a *App) GetNetworkProfiles() []*proxycore.NetworkProfile {
+	return a.featureManager.Throttle.GetProfiles()
+}
+
+// SaveNetworkProfile 添加或更新自定义网络条件配置
+func (a *App) SaveNetworkProfile(profile *proxycore.NetworkProfile) error {
+	return a.featureManager.Throttle.SaveProfile(profile)
+}
+
+// RemoveNetworkProfile 删除自定义网络条件配置
+func (a *App) RemoveNetworkProfile(profileID string) error {
+	return a.featureManager.Throttle.RemoveProfile(profileID)
+}
+
+// SetGlobalNetworkProfile 设置全局网络条件配置，为空时关闭
+func (a *App) SetGlobalNetworkProfile(profileID string) error {
+	return a.featureManager.Throttle.SetGlobalProfile(profileID)
+}
+
+// GetGlobalNetworkProfile 获取全局网络条件配置ID
+func (a *App) GetGlobalNetworkProfile() string {
+	return a.featureManager.Throttle.GetGlobalProfile()
+}
+
+// AddThrottleRule 添加按主机匹配的网络条件规则
+func (a *App) AddThrottleRule(rule *features.ThrottleRule) error {
+	return a.featureManager.Throttle.AddRule(rule)
+}
+
+// RemoveThrottleRule 移除网络条件规则
+func (a *App) RemoveThrottleRule(ruleID string) {
+	a.featureManager.Throttle.RemoveRule(ruleID)
+}
+
+// GetThrottleRules 获取所有网络条件规则
+func (a *App) GetThrottleRules() []*features.ThrottleRule {
+	return a.featureManager.Throttle.GetAllRules()
+}
+
+// 故障注入相关方法
+
+// AddFaultRule 添加故障注入规则
+func (a *App) AddFaultRule(rule *features.FaultRule) error {
+	return a.featureManager.Fault.AddRule(rule)
+}
+
+// UpdateFaultRule 更新故障注入规则
+func (a *App) UpdateFaultRule(rule *features.FaultRule) error {
+	return a.featureManager.Fault.UpdateRule(rule)
+}
+
+// RemoveFaultRule 移除故障注入规则
+func (a *App) RemoveFaultRule(ruleID string) {
+	a.featureManager.Fault.RemoveRule(ruleID)
+}
+
+// GetFaultRules 获取所有故障注入规则
+func (a *App) GetFaultRules() []*features.FaultRule {
+	return a.featureManager.Fault.GetAllRules()
+}
+
 // 断点相关方法
 
 // AddBreakpointRule 添加断点规则
@@ -274,9 +428,44 @@ func (a *App) GetBreakpointRules() []*features.BreakpointRule {
 	return a.featureManager.Breakpoint.GetAllRules()
 }
 
-// ResumeBreakpoint 恢复断点
-func (a *App) ResumeBreakpoint(sessionID string) error {
-	return a.featureManager.Breakpoint.ResumeBreakpoint(sessionID, nil, nil)
+// ResumeBreakpoint 恢复断点，edit为nil时原样放行
+func (a *App) ResumeBreakpoint(sessionID string, edit *features.BreakpointEdit) error {
+	return a.featureManager.Breakpoint.ResumeBreakpoint(sessionID, edit)
+}
+
+// ApplyBreakpointAction 对暂停中的断点执行操作（继续、直接响应、断开连接、延迟继续）
+func (a *App) ApplyBreakpointAction(sessionID string, action *features.BreakpointAction) error {
+	return a.featureManager.Breakpoint.ApplyAction(sessionID, action)
+}
+
+// ResumeAllBreakpoints 以同一操作恢复指定规则的所有断点，ruleID为空时恢复全部
+func (a *App) ResumeAllBreakpoints(ruleID string, action *features.BreakpointAction) (int, error) {
+	return a.featureManager.Breakpoint.ResumeAllMatching(ruleID, action)
+}
+
+// ResetBreakpointHits 清零断点规则的命中计数，ruleID为空时清零所有规则
+func (a *App) ResetBreakpointHits(ruleID string) error {
+	return a.featureManager.Breakpoint.ResetHits(ruleID)
+}
+
+// PauseAllBreakpoints 全局暂停所有请求
+func (a *App) PauseAllBreakpoints() {
+	a.featureManager.Breakpoint.PauseAll()
+}
+
+// ReleaseAllBreakpoints 取消全局暂停并放行所有暂停中的请求
+func (a *App) ReleaseAllBreakpoints() int {
+	return a.featureManager.Breakpoint.ReleaseAll()
+}
+
+// SetBreakpointConcurrencyLimit 设置同时暂停的会话上限及溢出策略（queue/pass）
+func (a *App) SetBreakpointConcurrencyLimit(maxHeld int, overflow string) error {
+	return a.featureManager.Breakpoint.SetConcurrencyLimit(maxHeld, overflow)
+}
+
+// GetBreakpointStatus 获取断点运行状态
+func (a *App) GetBreakpointStatus() features.BreakpointStatus {
+	return a.featureManager.Breakpoint.GetStatus()
 }
 
 // CancelBreakpoint 取消断点
@@ -346,11 +535,46 @@ func (a *App) ValidateScript(content string) error {
 	return a.featureManager.Scripting.ValidateScript(content)
 }
 
+// DryRunScript 在已捕获Flow的副本上试运行脚本，source不为空时试运行未保存的内容
+func (a *App) DryRunScript(scriptID string, source string, scriptType string, flowID string) (*features.ScriptDryRunResult, error) {
+	target := features.ScriptDryRunTarget{ScriptID: scriptID, Source: source, Type: scriptType}
+	return a.featureManager.Scripting.DryRun(target, flowID)
+}
+
+// SetScriptsDir 从目录加载脚本并监视变化，并保存到配置；dir为空时停止使用脚本目录
+func (a *App) SetScriptsDir(dir string) error {
+	if err := a.featureManager.Scripting.SetScriptsDir(dir); err != nil {
+		return err
+	}
+	a.config.ScriptsDir = a.featureManager.Scripting.GetScriptsDir()
+	return a.config.SaveConfig()
+}
+
+// GetScriptsDir 获取当前的脚本目录
+func (a *App) GetScriptsDir() string {
+	return a.featureManager.Scripting.GetScriptsDir()
+}
+
+// ExportScripts 把数据库中的脚本导出为脚本目录中的.js文件，返回写入的文件路径
+func (a *App) ExportScripts(dir string) ([]string, error) {
+	return a.featureManager.Scripting.ExportScriptsToDir(dir)
+}
+
+// SetScriptLimits 设置脚本执行限制（超时、调用栈深度、进程堆增长）
+func (a *App) SetScriptLimits(limits features.ScriptLimits) error {
+	return a.featureManager.Scripting.SetLimits(limits)
+}
+
+// GetScriptLimits 获取脚本执行限制
+func (a *App) GetScriptLimits() features.ScriptLimits {
+	return a.featureManager.Scripting.GetLimits()
+}
+
 // 允许/阻止列表相关方法
 
 // AddAllowBlockRule 添加允许/阻止规则
-func (a *App) AddAllowBlockRule(rule *features.AllowBlockRule) {
-	a.featureManager.AllowBlock.AddRule(rule)
+func (a *App) AddAllowBlockRule(rule *features.AllowBlockRule) error {
+	return a.featureManager.AllowBlock.AddRule(rule)
 }
 
 // RemoveAllowBlockRule 移除允许/阻止规则
@@ -378,6 +602,83 @@ func (a *App) GetAllowBlockMode() string {
 	return a.featureManager.AllowBlock.GetMode()
 }
 
+// GetBlockedRequestsCount 获取被阻止的请求数量，ruleID为空时返回总数
+func (a *App) GetBlockedRequestsCount(ruleID string) int {
+	return a.featureManager.AllowBlock.GetBlockedRequestsCount(ruleID)
+}
+
+// GetAllowedRequestsCount 获取被允许的请求数量，ruleID为空时返回总数
+func (a *App) GetAllowedRequestsCount(ruleID string) int {
+	return a.featureManager.AllowBlock.GetAllowedRequestsCount(ruleID)
+}
+
+// ResetAllowBlockCounters 清零允许/阻止统计
+func (a *App) ResetAllowBlockCounters() {
+	a.featureManager.AllowBlock.ResetCounters()
+}
+
+// SelectBlocklistFile 选择要导入的阻止列表文件，取消时返回空字符串
+func (a *App) SelectBlocklistFile() (string, error) {
+	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "选择阻止列表",
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: "阻止列表 (*.txt, hosts)",
+				Pattern:     "*.txt;*.list;hosts",
+			},
+			{
+				DisplayName: "所有文件",
+				Pattern:     "*",
+			},
+		},
+	})
+}
+
+// ImportBlocklist 从本地文件导入阻止列表（hosts、domains、adblock或auto）
+func (a *App) ImportBlocklist(id, name, path, format string) (*features.Blocklist, error) {
+	return a.featureManager.AllowBlock.ImportBlocklist(id, name, path, format)
+}
+
+// ReloadBlocklist 重新读取阻止列表文件
+func (a *App) ReloadBlocklist(id string) (*features.Blocklist, error) {
+	return a.featureManager.AllowBlock.ReloadBlocklist(id)
+}
+
+// SetBlocklistEnabled 启用或停用阻止列表
+func (a *App) SetBlocklistEnabled(id string, enabled bool) error {
+	return a.featureManager.AllowBlock.SetBlocklistEnabled(id, enabled)
+}
+
+// RemoveBlocklist 删除阻止列表
+func (a *App) RemoveBlocklist(id string) {
+	a.featureManager.AllowBlock.RemoveBlocklist(id)
+}
+
+// GetBlocklists 获取所有阻止列表
+func (a *App) GetBlocklists() []*features.Blocklist {
+	return a.featureManager.AllowBlock.GetBlocklists()
+}
+
+// SetTLSInterceptionMode 设置HTTPS解密模式（all、exclude、include）
+func (a *App) SetTLSInterceptionMode(mode string) error {
+	return a.featureManager.TLSIntercept.SetMode(mode)
+}
+
+// GetTLSInterceptionMode 获取HTTPS解密模式
+func (a *App) GetTLSInterceptionMode() string {
+	return a.featureManager.TLSIntercept.GetMode()
+}
+
+// SetTLSInterceptionHosts 设置解密模式使用的主机列表
+func (a *App) SetTLSInterceptionHosts(hosts []string) {
+	a.featureManager.TLSIntercept.SetHosts(hosts)
+}
+
+// GetTLSInterceptionHosts 获取解密模式使用的主机列表
+func (a *App) GetTLSInterceptionHosts() []string {
+	return a.featureManager.TLSIntercept.GetHosts()
+}
+
 // HAR相关方法
 
 // ExportFlowsToHAR 导出Flows到HAR文件
@@ -413,6 +714,26 @@ func (a *App) GetReverseProxyRules() []*features.ReverseProxyRule {
 	return a.featureManager.ReverseProxy.GetAllRules()
 }
 
+// AddReverseProxyListener 添加反向代理监听器
+func (a *App) AddReverseProxyListener(listener *features.ReverseProxyListener) error {
+	return a.featureManager.ReverseProxy.AddListener(listener)
+}
+
+// UpdateReverseProxyListener 更新反向代理监听器
+func (a *App) UpdateReverseProxyListener(listener *features.ReverseProxyListener) error {
+	return a.featureManager.ReverseProxy.UpdateListener(listener)
+}
+
+// RemoveReverseProxyListener 移除反向代理监听器
+func (a *App) RemoveReverseProxyListener(listenerID string) error {
+	return a.featureManager.ReverseProxy.RemoveListener(listenerID)
+}
+
+// GetReverseProxyListeners 获取所有反向代理监听器
+func (a *App) GetReverseProxyListeners() []*features.ReverseProxyListener {
+	return a.featureManager.ReverseProxy.GetAllListeners()
+}
+
 // 上游代理相关方法
 
 // AddUpstreamProxy 添加上游代理
@@ -421,8 +742,8 @@ func (a *App) AddUpstreamProxy(proxy *features.UpstreamProxy) error {
 }
 
 // RemoveUpstreamProxy 移除上游代理
-func (a *App) RemoveUpstreamProxy(proxyID string) {
-	a.featureManager.Upstream.RemoveProxy(proxyID)
+func (a *App) RemoveUpstreamProxy(proxyID string) error {
+	return a.featureManager.Upstream.RemoveProxy(proxyID)
 }
 
 // UpdateUpstreamProxy 更新上游代理
@@ -440,6 +761,72 @@ func (a *App) TestUpstreamProxy(proxyID string) error {
 	return a.featureManager.Upstream.TestUpstreamProxy(proxyID)
 }
 
+// LoadPACFile 加载PAC脚本用于选择上游代理，并保存到配置
+func (a *App) LoadPACFile(source string) error {
+	if err := a.featureManager.Upstream.LoadPAC(source); err != nil {
+		return err
+	}
+	a.config.PACFile = source
+	return a.config.SaveConfig()
+}
+
+// ClearPACFile 停止使用PAC脚本
+func (a *App) ClearPACFile() error {
+	a.featureManager.Upstream.SetPAC(nil)
+	a.config.PACFile = ""
+	return a.config.SaveConfig()
+}
+
+// GetPACSource 获取当前PAC脚本来源
+func (a *App) GetPACSource() string {
+	return a.featureManager.Upstream.GetPACSource()
+}
+
+// GetPACFileURL 获取ProxyWoman自身提供的PAC文件地址，用于客户端自动配置
+func (a *App) GetPACFileURL() string {
+	return fmt.Sprintf("http://127.0.0.1:%d/proxy.pac", a.config.ProxyPort)
+}
+
+// GetUpstreamProxyStats 获取上游代理统计信息
+func (a *App) GetUpstreamProxyStats(proxyID string) map[string]interface{} {
+	return a.featureManager.Upstream.GetProxyStats(proxyID)
+}
+
+// AddUpstreamGroup 添加上游代理组
+func (a *App) AddUpstreamGroup(group *features.UpstreamGroup) error {
+	return a.featureManager.Upstream.AddGroup(group)
+}
+
+// UpdateUpstreamGroup 更新上游代理组
+func (a *App) UpdateUpstreamGroup(group *features.UpstreamGroup) error {
+	return a.featureManager.Upstream.UpdateGroup(group)
+}
+
+// RemoveUpstreamGroup 删除上游代理组
+func (a *App) RemoveUpstreamGroup(groupID string) error {
+	return a.featureManager.Upstream.RemoveGroup(groupID)
+}
+
+// GetUpstreamGroups 获取所有上游代理组
+func (a *App) GetUpstreamGroups() []*features.UpstreamGroup {
+	return a.featureManager.Upstream.GetAllGroups()
+}
+
+// SetUpstreamHealthCheck 设置上游代理健康检查
+func (a *App) SetUpstreamHealthCheck(config features.HealthCheckConfig) error {
+	return a.featureManager.Upstream.SetHealthCheckConfig(config)
+}
+
+// GetUpstreamHealthCheck 获取上游代理健康检查配置
+func (a *App) GetUpstreamHealthCheck() features.HealthCheckConfig {
+	return a.featureManager.Upstream.GetHealthCheckConfig()
+}
+
+// GetUpstreamHealth 获取上游代理健康状态
+func (a *App) GetUpstreamHealth() []features.UpstreamHealth {
+	return a.featureManager.Upstream.GetHealth()
+}
+
 // Shutdown 应用关闭时的清理工作
 func (a *App) Shutdown(ctx context.Context) {
 	// 停止代理
@@ -447,6 +834,12 @@ func (a *App) Shutdown(ctx context.Context) {
 		a.StopProxy()
 	}
 
+	// 停止上游健康检查
+	a.featureManager.Upstream.StopHealthChecks()
+
+	// 停止监视脚本目录
+	a.featureManager.Scripting.StopScriptsDirWatch()
+
 	// 保存配置
 	if err := a.config.SaveConfig(); err != nil {
 		logger.Error("Failed to save config: %v", err)
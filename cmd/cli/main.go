@@ -14,6 +14,7 @@ import (
 	"ProxyWoman/internal/features"
 	"ProxyWoman/internal/logger"
 	"ProxyWoman/internal/proxycore"
+	"ProxyWoman/internal/storage"
 	"ProxyWoman/internal/system"
 )
 
@@ -89,7 +90,16 @@ func (cli *CLI) init() {
 	cli.certManager.InitCA()
 
 	// 初始化功能管理器
-	cli.features = features.NewFeatureManager()
+	database, err := storage.NewDatabase()
+	if err != nil {
+		fmt.Printf("Failed to initialize database: %v\n", err)
+	}
+	cli.features = features.NewFeatureManager(database)
+	if cfg.ScriptsDir != "" {
+		if err := cli.features.Scripting.SetScriptsDir(cfg.ScriptsDir); err != nil {
+			fmt.Printf("Failed to load scripts directory: %v\n", err)
+		}
+	}
 
 	// 初始化代理服务器
 	cli.proxyServer = proxycore.NewProxyServer(cfg.ProxyPort, cli.certManager)
@@ -319,6 +329,8 @@ func (cli *CLI) manageScripts(args []string) {
 		cli.listScripts()
 	case "run":
 		cli.runScript(args[1:])
+	case "export":
+		cli.exportScripts(args[1:])
 	default:
 		fmt.Printf("Unknown scripts command: %s\n", args[0])
 	}
@@ -332,12 +344,111 @@ func (cli *CLI) listScripts() {
 		if script.Enabled {
 			status = "enabled"
 		}
-		fmt.Printf("  %d. %s (%s) - %s\n", i+1, script.Name, status, script.Type)
+		source := ""
+		if script.File != "" {
+			source = " [" + script.File + "]"
+		}
+		fmt.Printf("  %d. %s (%s) - %s%s\n", i+1, script.Name, status, script.Type, source)
 	}
 }
 
+// exportScripts 把数据库中的脚本导出为带元数据头的.js文件
+func (cli *CLI) exportScripts(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: proxywoman scripts export <dir>")
+		return
+	}
+
+	paths, err := cli.features.Scripting.ExportScriptsToDir(args[0])
+	if err != nil {
+		fmt.Printf("Failed to export scripts: %v\n", err)
+		os.Exit(1)
+	}
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	fmt.Printf("Exported %d scripts to %s\n", len(paths), args[0])
+}
+
+// runScript 对HAR文件中的每个请求试运行脚本，有脚本失败时以1退出
 func (cli *CLI) runScript(args []string) {
-	fmt.Println("Script execution via CLI not implemented yet")
+	fs := flag.NewFlagSet("scripts run", flag.ExitOnError)
+	harFile := fs.String("har", "", "HAR file to run the script against")
+	scriptType := fs.String("type", "both", "Script type when running a .js file (request, response, both)")
+	asJSON := fs.Bool("json", false, "Print results as JSON")
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("Usage: proxywoman scripts run <script-id|file.js> --har <file> [--type both] [--json]")
+		os.Exit(1)
+	}
+	fs.Parse(args[1:])
+	if *harFile == "" {
+		fmt.Println("Usage: proxywoman scripts run <script-id|file.js> --har <file> [--type both] [--json]")
+		os.Exit(1)
+	}
+
+	target := features.ScriptDryRunTarget{ScriptID: args[0], Type: *scriptType}
+	if filepath.Ext(args[0]) == ".js" {
+		content, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Printf("Failed to read script: %v\n", err)
+			os.Exit(1)
+		}
+		// 脚本文件可以require()同一目录中的模块
+		target = features.ScriptDryRunTarget{Source: string(content), Type: *scriptType, Dir: filepath.Dir(args[0])}
+	}
+
+	results, err := cli.features.Scripting.DryRunHAR(target, *harFile)
+	if err != nil {
+		fmt.Printf("Failed to run script: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		for i, result := range results {
+			status := "ok"
+			if !result.Success {
+				status = "FAILED"
+			}
+			fmt.Printf("%d. [%s] %s %s\n", i+1, status, result.Method, result.URL)
+			if result.Error != nil {
+				fmt.Printf("     %s: %s\n", result.Error.Phase, result.Error.Error())
+			}
+			for _, execution := range result.Executions {
+				for _, line := range execution.Logs {
+					fmt.Printf("     [%s] %s\n", execution.Phase, line)
+				}
+			}
+			if result.Action != "" {
+				fmt.Printf("     action: %s\n", result.Action)
+			}
+			for _, change := range result.Changes {
+				switch change.Type {
+				case "added":
+					fmt.Printf("     + %s: %s\n", change.Path, change.After)
+				case "removed":
+					fmt.Printf("     - %s: %s\n", change.Path, change.Before)
+				default:
+					fmt.Printf("     ~ %s: %s -> %s\n", change.Path, change.Before, change.After)
+				}
+			}
+		}
+		fmt.Printf("\n%d requests, %d failed\n", len(results), failed)
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
 }
 
 func (cli *CLI) manageConfig(args []string) {
@@ -386,6 +497,16 @@ func (cli *CLI) setConfig(args []string) {
 		cli.config.Theme = value
 	case "loglevel":
 		cli.config.LogLevel = value
+	case "scriptsdir":
+		if value != "" {
+			dir, err := filepath.Abs(value)
+			if err != nil {
+				fmt.Printf("Invalid directory: %s\n", value)
+				return
+			}
+			value = dir
+		}
+		cli.config.ScriptsDir = value
 	default:
 		fmt.Printf("Unknown config key: %s\n", key)
 		return
@@ -416,7 +537,10 @@ func printUsage() {
 	fmt.Println("  export <file>                   Export flows to HAR file")
 	fmt.Println("  import <file>                   Import flows from HAR file")
 	fmt.Println("  rules [list|add|remove]         Manage proxy rules")
-	fmt.Println("  scripts [list|run]              Manage scripts")
+	fmt.Println("  scripts [list|run|export]       Manage scripts")
+	fmt.Println("  scripts run <id|file.js> --har <file> [--json]")
+	fmt.Println("                                  Dry-run a script against a HAR file")
+	fmt.Println("  scripts export <dir>            Export scripts to .js files with metadata headers")
 	fmt.Println("  config [show|set]               Manage configuration")
 	fmt.Println("  help                            Show this help message")
 	fmt.Println()
@@ -424,4 +548,5 @@ func printUsage() {
 	fmt.Println("  proxywoman start --port=8080")
 	fmt.Println("  proxywoman export traffic.har")
 	fmt.Println("  proxywoman config set port 9090")
+	fmt.Println("  proxywoman scripts run rewrite.js --har traffic.har")
 }
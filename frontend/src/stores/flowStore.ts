@@ -5,6 +5,8 @@ import { detectApp } from '../utils/appDetector';
 export interface Flow {
   id: string;
   url: string;
+  mappedUrl?: string; // Map Remote改写后实际请求的URL
+  networkProfile?: string; // 应用的网络条件模拟配置
   method: string;
   statusCode: number;
   client: string;
@@ -8,26 +8,46 @@ export function AddAllowBlockRule(arg1:features.AllowBlockRule):Promise<void>;
 
 export function AddBreakpointRule(arg1:features.BreakpointRule):Promise<void>;
 
+export function AddFaultRule(arg1:features.FaultRule):Promise<void>;
+
 export function AddMapLocalRule(arg1:features.MapLocalRule):Promise<void>;
 
+export function AddMapRemoteRule(arg1:features.MapRemoteRule):Promise<void>;
+
+export function AddReverseProxyListener(arg1:features.ReverseProxyListener):Promise<void>;
+
 export function AddReverseProxyRule(arg1:features.ReverseProxyRule):Promise<void>;
 
+export function AddRewriteRule(arg1:features.RewriteRule):Promise<void>;
+
 export function AddScript(arg1:features.Script):Promise<void>;
 
+export function AddThrottleRule(arg1:features.ThrottleRule):Promise<void>;
+
+export function AddUpstreamGroup(arg1:features.UpstreamGroup):Promise<void>;
+
 export function AddUpstreamProxy(arg1:features.UpstreamProxy):Promise<void>;
 
+export function ApplyBreakpointAction(arg1:string,arg2:features.BreakpointAction):Promise<void>;
+
 export function CancelBreakpoint(arg1:string):Promise<void>;
 
 export function ClearFlows():Promise<void>;
 
+export function ClearPACFile():Promise<void>;
+
 export function DecryptRequestBody(arg1:Array<number>,arg2:Record<string, string>):Promise<Array<number>>;
 
 export function DecryptResponseBody(arg1:Array<number>,arg2:Record<string, string>):Promise<Array<number>>;
 
+export function DryRunScript(arg1:string,arg2:string,arg3:string,arg4:string):Promise<features.ScriptDryRunResult>;
+
 export function ExportFlows(arg1:export.ExportOptions):Promise<export.ExportResult>;
 
 export function ExportFlowsToHAR(arg1:string):Promise<void>;
 
+export function ExportScripts(arg1:string):Promise<Array<string>>;
+
 export function GetActiveBreakpoints():Promise<Array<features.BreakpointSession>>;
 
 export function GetAllScripts():Promise<Array<features.Script>>;
@@ -36,58 +56,154 @@ export function GetAllowBlockMode():Promise<string>;
 
 export function GetAllowBlockRules():Promise<Array<features.AllowBlockRule>>;
 
+export function GetAllowedRequestsCount(arg1:string):Promise<number>;
+
+export function GetBlockedRequestsCount(arg1:string):Promise<number>;
+
+export function GetBlocklists():Promise<Array<features.Blocklist>>;
+
 export function GetBreakpointRules():Promise<Array<features.BreakpointRule>>;
 
+export function GetBreakpointStatus():Promise<features.BreakpointStatus>;
+
 export function GetCACertInstallInstructions():Promise<string>;
 
 export function GetCACertPath():Promise<string>;
 
+export function GetFaultRules():Promise<Array<features.FaultRule>>;
+
 export function GetFlowByID(arg1:string):Promise<proxycore.Flow>;
 
 export function GetFlows():Promise<Array<proxycore.Flow>>;
 
+export function GetGlobalNetworkProfile():Promise<string>;
+
 export function GetMapLocalRules():Promise<Array<features.MapLocalRule>>;
 
+export function GetMapRemoteRules():Promise<Array<features.MapRemoteRule>>;
+
+export function GetNetworkProfiles():Promise<Array<proxycore.NetworkProfile>>;
+
+export function GetPACFileURL():Promise<string>;
+
+export function GetPACSource():Promise<string>;
+
 export function GetPinnedFlows():Promise<Array<proxycore.Flow>>;
 
 export function GetProxyPort():Promise<number>;
 
 export function GetResponseHexView(arg1:string):Promise<string>;
 
+export function GetReverseProxyListeners():Promise<Array<features.ReverseProxyListener>>;
+
 export function GetReverseProxyRules():Promise<Array<features.ReverseProxyRule>>;
 
+export function GetRewriteRules():Promise<Array<features.RewriteRule>>;
+
+export function GetSOCKS5Port():Promise<number>;
+
+export function GetScriptLimits():Promise<features.ScriptLimits>;
+
+export function GetScriptsDir():Promise<string>;
+
+export function GetTLSInterceptionHosts():Promise<Array<string>>;
+
+export function GetTLSInterceptionMode():Promise<string>;
+
+export function GetThrottleRules():Promise<Array<features.ThrottleRule>>;
+
+export function GetUpstreamGroups():Promise<Array<features.UpstreamGroup>>;
+
+export function GetUpstreamHealth():Promise<Array<features.UpstreamHealth>>;
+
+export function GetUpstreamHealthCheck():Promise<features.HealthCheckConfig>;
+
 export function GetUpstreamProxies():Promise<Array<features.UpstreamProxy>>;
 
+export function GetUpstreamProxyStats(arg1:string):Promise<Record<string, any>>;
+
+export function ImportBlocklist(arg1:string,arg2:string,arg3:string,arg4:string):Promise<features.Blocklist>;
+
 export function ImportHARToFlows(arg1:string):Promise<Array<proxycore.Flow>>;
 
 export function IsCACertInstalled():Promise<boolean>;
 
 export function IsProxyRunning():Promise<boolean>;
 
+export function LoadPACFile(arg1:string):Promise<void>;
+
 export function ModifyAndReplayFlow(arg1:string,arg2:Record<string, any>):Promise<features.ReplayResponse>;
 
+export function PauseAllBreakpoints():Promise<void>;
+
 export function PinFlow(arg1:string):Promise<void>;
 
+export function ReleaseAllBreakpoints():Promise<number>;
+
+export function ReloadBlocklist(arg1:string):Promise<features.Blocklist>;
+
 export function RemoveAllowBlockRule(arg1:string):Promise<void>;
 
+export function RemoveBlocklist(arg1:string):Promise<void>;
+
 export function RemoveBreakpointRule(arg1:string):Promise<void>;
 
+export function RemoveFaultRule(arg1:string):Promise<void>;
+
 export function RemoveMapLocalRule(arg1:string):Promise<void>;
 
+export function RemoveMapRemoteRule(arg1:string):Promise<void>;
+
+export function RemoveNetworkProfile(arg1:string):Promise<void>;
+
+export function RemoveReverseProxyListener(arg1:string):Promise<void>;
+
 export function RemoveReverseProxyRule(arg1:string):Promise<void>;
 
+export function RemoveRewriteRule(arg1:string):Promise<void>;
+
 export function RemoveScript(arg1:string):Promise<void>;
 
+export function RemoveThrottleRule(arg1:string):Promise<void>;
+
+export function RemoveUpstreamGroup(arg1:string):Promise<void>;
+
 export function RemoveUpstreamProxy(arg1:string):Promise<void>;
 
 export function ReplayFlow(arg1:string):Promise<features.ReplayResponse>;
 
-export function ResumeBreakpoint(arg1:string):Promise<void>;
+export function ResetAllowBlockCounters():Promise<void>;
+
+export function ResetBreakpointHits(arg1:string):Promise<void>;
+
+export function ResumeAllBreakpoints(arg1:string,arg2:features.BreakpointAction):Promise<number>;
+
+export function ResumeBreakpoint(arg1:string,arg2:features.BreakpointEdit):Promise<void>;
+
+export function SaveNetworkProfile(arg1:proxycore.NetworkProfile):Promise<void>;
+
+export function SelectBlocklistFile():Promise<string>;
 
 export function SendCustomRequest(arg1:features.ReplayRequest):Promise<features.ReplayResponse>;
 
 export function SetAllowBlockMode(arg1:string):Promise<void>;
 
+export function SetBlocklistEnabled(arg1:string,arg2:boolean):Promise<void>;
+
+export function SetBreakpointConcurrencyLimit(arg1:number,arg2:string):Promise<void>;
+
+export function SetGlobalNetworkProfile(arg1:string):Promise<void>;
+
+export function SetScriptLimits(arg1:features.ScriptLimits):Promise<void>;
+
+export function SetScriptsDir(arg1:string):Promise<void>;
+
+export function SetTLSInterceptionHosts(arg1:Array<string>):Promise<void>;
+
+export function SetTLSInterceptionMode(arg1:string):Promise<void>;
+
+export function SetUpstreamHealthCheck(arg1:features.HealthCheckConfig):Promise<void>;
+
 export function StartProxy():Promise<void>;
 
 export function StopProxy():Promise<void>;
@@ -98,14 +214,22 @@ export function UpdateAllowBlockRule(arg1:features.AllowBlockRule):Promise<void>
 
 export function UpdateBreakpointRuleStatus(arg1:string,arg2:boolean):Promise<void>;
 
+export function UpdateFaultRule(arg1:features.FaultRule):Promise<void>;
+
 export function UpdateMapLocalRule(arg1:features.MapLocalRule):Promise<void>;
 
+export function UpdateMapRemoteRule(arg1:features.MapRemoteRule):Promise<void>;
+
+export function UpdateReverseProxyListener(arg1:features.ReverseProxyListener):Promise<void>;
+
 export function UpdateReverseProxyRule(arg1:features.ReverseProxyRule):Promise<void>;
 
 export function UpdateScript(arg1:features.Script):Promise<void>;
 
 export function UpdateScriptStatus(arg1:string,arg2:boolean):Promise<void>;
 
+export function UpdateUpstreamGroup(arg1:features.UpstreamGroup):Promise<void>;
+
 export function UpdateUpstreamProxy(arg1:features.UpstreamProxy):Promise<void>;
 
 export function ValidateScript(arg1:string):Promise<void>;
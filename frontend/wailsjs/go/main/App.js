@@ -10,22 +10,50 @@ export function AddBreakpointRule(arg1) {
   return window['go']['main']['App']['AddBreakpointRule'](arg1);
 }
 
+export function AddFaultRule(arg1) {
+  return window['go']['main']['App']['AddFaultRule'](arg1);
+}
+
 export function AddMapLocalRule(arg1) {
   return window['go']['main']['App']['AddMapLocalRule'](arg1);
 }
 
+export function AddMapRemoteRule(arg1) {
+  return window['go']['main']['App']['AddMapRemoteRule'](arg1);
+}
+
+export function AddReverseProxyListener(arg1) {
+  return window['go']['main']['App']['AddReverseProxyListener'](arg1);
+}
+
 export function AddReverseProxyRule(arg1) {
   return window['go']['main']['App']['AddReverseProxyRule'](arg1);
 }
 
+export function AddRewriteRule(arg1) {
+  return window['go']['main']['App']['AddRewriteRule'](arg1);
+}
+
 export function AddScript(arg1) {
   return window['go']['main']['App']['AddScript'](arg1);
 }
 
+export function AddThrottleRule(arg1) {
+  return window['go']['main']['App']['AddThrottleRule'](arg1);
+}
+
+export function AddUpstreamGroup(arg1) {
+  return window['go']['main']['App']['AddUpstreamGroup'](arg1);
+}
+
 export function AddUpstreamProxy(arg1) {
   return window['go']['main']['App']['AddUpstreamProxy'](arg1);
 }
 
+export function ApplyBreakpointAction(arg1, arg2) {
+  return window['go']['main']['App']['ApplyBreakpointAction'](arg1, arg2);
+}
+
 export function CancelBreakpoint(arg1) {
   return window['go']['main']['App']['CancelBreakpoint'](arg1);
 }
@@ -34,6 +62,10 @@ export function ClearFlows() {
   return window['go']['main']['App']['ClearFlows']();
 }
 
+export function ClearPACFile() {
+  return window['go']['main']['App']['ClearPACFile']();
+}
+
 export function DecryptRequestBody(arg1, arg2) {
   return window['go']['main']['App']['DecryptRequestBody'](arg1, arg2);
 }
@@ -42,6 +74,10 @@ export function DecryptResponseBody(arg1, arg2) {
   return window['go']['main']['App']['DecryptResponseBody'](arg1, arg2);
 }
 
+export function DryRunScript(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['DryRunScript'](arg1, arg2, arg3, arg4);
+}
+
 export function ExportFlows(arg1) {
   return window['go']['main']['App']['ExportFlows'](arg1);
 }
@@ -50,6 +86,10 @@ export function ExportFlowsToHAR(arg1) {
   return window['go']['main']['App']['ExportFlowsToHAR'](arg1);
 }
 
+export function ExportScripts(arg1) {
+  return window['go']['main']['App']['ExportScripts'](arg1);
+}
+
 export function GetActiveBreakpoints() {
   return window['go']['main']['App']['GetActiveBreakpoints']();
 }
@@ -66,10 +106,26 @@ export function GetAllowBlockRules() {
   return window['go']['main']['App']['GetAllowBlockRules']();
 }
 
+export function GetAllowedRequestsCount(arg1) {
+  return window['go']['main']['App']['GetAllowedRequestsCount'](arg1);
+}
+
+export function GetBlockedRequestsCount(arg1) {
+  return window['go']['main']['App']['GetBlockedRequestsCount'](arg1);
+}
+
+export function GetBlocklists() {
+  return window['go']['main']['App']['GetBlocklists']();
+}
+
 export function GetBreakpointRules() {
   return window['go']['main']['App']['GetBreakpointRules']();
 }
 
+export function GetBreakpointStatus() {
+  return window['go']['main']['App']['GetBreakpointStatus']();
+}
+
 export function GetCACertInstallInstructions() {
   return window['go']['main']['App']['GetCACertInstallInstructions']();
 }
@@ -78,6 +134,10 @@ export function GetCACertPath() {
   return window['go']['main']['App']['GetCACertPath']();
 }
 
+export function GetFaultRules() {
+  return window['go']['main']['App']['GetFaultRules']();
+}
+
 export function GetFlowByID(arg1) {
   return window['go']['main']['App']['GetFlowByID'](arg1);
 }
@@ -86,10 +146,30 @@ export function GetFlows() {
   return window['go']['main']['App']['GetFlows']();
 }
 
+export function GetGlobalNetworkProfile() {
+  return window['go']['main']['App']['GetGlobalNetworkProfile']();
+}
+
 export function GetMapLocalRules() {
   return window['go']['main']['App']['GetMapLocalRules']();
 }
 
+export function GetMapRemoteRules() {
+  return window['go']['main']['App']['GetMapRemoteRules']();
+}
+
+export function GetNetworkProfiles() {
+  return window['go']['main']['App']['GetNetworkProfiles']();
+}
+
+export function GetPACFileURL() {
+  return window['go']['main']['App']['GetPACFileURL']();
+}
+
+export function GetPACSource() {
+  return window['go']['main']['App']['GetPACSource']();
+}
+
 export function GetPinnedFlows() {
   return window['go']['main']['App']['GetPinnedFlows']();
 }
@@ -102,14 +182,66 @@ export function GetResponseHexView(arg1) {
   return window['go']['main']['App']['GetResponseHexView'](arg1);
 }
 
+export function GetReverseProxyListeners() {
+  return window['go']['main']['App']['GetReverseProxyListeners']();
+}
+
 export function GetReverseProxyRules() {
   return window['go']['main']['App']['GetReverseProxyRules']();
 }
 
+export function GetRewriteRules() {
+  return window['go']['main']['App']['GetRewriteRules']();
+}
+
+export function GetSOCKS5Port() {
+  return window['go']['main']['App']['GetSOCKS5Port']();
+}
+
+export function GetScriptLimits() {
+  return window['go']['main']['App']['GetScriptLimits']();
+}
+
+export function GetScriptsDir() {
+  return window['go']['main']['App']['GetScriptsDir']();
+}
+
+export function GetTLSInterceptionHosts() {
+  return window['go']['main']['App']['GetTLSInterceptionHosts']();
+}
+
+export function GetTLSInterceptionMode() {
+  return window['go']['main']['App']['GetTLSInterceptionMode']();
+}
+
+export function GetThrottleRules() {
+  return window['go']['main']['App']['GetThrottleRules']();
+}
+
+export function GetUpstreamGroups() {
+  return window['go']['main']['App']['GetUpstreamGroups']();
+}
+
+export function GetUpstreamHealth() {
+  return window['go']['main']['App']['GetUpstreamHealth']();
+}
+
+export function GetUpstreamHealthCheck() {
+  return window['go']['main']['App']['GetUpstreamHealthCheck']();
+}
+
 export function GetUpstreamProxies() {
   return window['go']['main']['App']['GetUpstreamProxies']();
 }
 
+export function GetUpstreamProxyStats(arg1) {
+  return window['go']['main']['App']['GetUpstreamProxyStats'](arg1);
+}
+
+export function ImportBlocklist(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['ImportBlocklist'](arg1, arg2, arg3, arg4);
+}
+
 export function ImportHARToFlows(arg1) {
   return window['go']['main']['App']['ImportHARToFlows'](arg1);
 }
@@ -122,34 +254,82 @@ export function IsProxyRunning() {
   return window['go']['main']['App']['IsProxyRunning']();
 }
 
+export function LoadPACFile(arg1) {
+  return window['go']['main']['App']['LoadPACFile'](arg1);
+}
+
 export function ModifyAndReplayFlow(arg1, arg2) {
   return window['go']['main']['App']['ModifyAndReplayFlow'](arg1, arg2);
 }
 
+export function PauseAllBreakpoints() {
+  return window['go']['main']['App']['PauseAllBreakpoints']();
+}
+
 export function PinFlow(arg1) {
   return window['go']['main']['App']['PinFlow'](arg1);
 }
 
+export function ReleaseAllBreakpoints() {
+  return window['go']['main']['App']['ReleaseAllBreakpoints']();
+}
+
+export function ReloadBlocklist(arg1) {
+  return window['go']['main']['App']['ReloadBlocklist'](arg1);
+}
+
 export function RemoveAllowBlockRule(arg1) {
   return window['go']['main']['App']['RemoveAllowBlockRule'](arg1);
 }
 
+export function RemoveBlocklist(arg1) {
+  return window['go']['main']['App']['RemoveBlocklist'](arg1);
+}
+
 export function RemoveBreakpointRule(arg1) {
   return window['go']['main']['App']['RemoveBreakpointRule'](arg1);
 }
 
+export function RemoveFaultRule(arg1) {
+  return window['go']['main']['App']['RemoveFaultRule'](arg1);
+}
+
 export function RemoveMapLocalRule(arg1) {
   return window['go']['main']['App']['RemoveMapLocalRule'](arg1);
 }
 
+export function RemoveMapRemoteRule(arg1) {
+  return window['go']['main']['App']['RemoveMapRemoteRule'](arg1);
+}
+
+export function RemoveNetworkProfile(arg1) {
+  return window['go']['main']['App']['RemoveNetworkProfile'](arg1);
+}
+
+export function RemoveReverseProxyListener(arg1) {
+  return window['go']['main']['App']['RemoveReverseProxyListener'](arg1);
+}
+
 export function RemoveReverseProxyRule(arg1) {
   return window['go']['main']['App']['RemoveReverseProxyRule'](arg1);
 }
 
+export function RemoveRewriteRule(arg1) {
+  return window['go']['main']['App']['RemoveRewriteRule'](arg1);
+}
+
 export function RemoveScript(arg1) {
   return window['go']['main']['App']['RemoveScript'](arg1);
 }
 
+export function RemoveThrottleRule(arg1) {
+  return window['go']['main']['App']['RemoveThrottleRule'](arg1);
+}
+
+export function RemoveUpstreamGroup(arg1) {
+  return window['go']['main']['App']['RemoveUpstreamGroup'](arg1);
+}
+
 export function RemoveUpstreamProxy(arg1) {
   return window['go']['main']['App']['RemoveUpstreamProxy'](arg1);
 }
@@ -158,8 +338,28 @@ export function ReplayFlow(arg1) {
   return window['go']['main']['App']['ReplayFlow'](arg1);
 }
 
-export function ResumeBreakpoint(arg1) {
-  return window['go']['main']['App']['ResumeBreakpoint'](arg1);
+export function ResetAllowBlockCounters() {
+  return window['go']['main']['App']['ResetAllowBlockCounters']();
+}
+
+export function ResetBreakpointHits(arg1) {
+  return window['go']['main']['App']['ResetBreakpointHits'](arg1);
+}
+
+export function ResumeAllBreakpoints(arg1, arg2) {
+  return window['go']['main']['App']['ResumeAllBreakpoints'](arg1, arg2);
+}
+
+export function ResumeBreakpoint(arg1, arg2) {
+  return window['go']['main']['App']['ResumeBreakpoint'](arg1, arg2);
+}
+
+export function SaveNetworkProfile(arg1) {
+  return window['go']['main']['App']['SaveNetworkProfile'](arg1);
+}
+
+export function SelectBlocklistFile() {
+  return window['go']['main']['App']['SelectBlocklistFile']();
 }
 
 export function SendCustomRequest(arg1) {
@@ -170,6 +370,38 @@ export function SetAllowBlockMode(arg1) {
   return window['go']['main']['App']['SetAllowBlockMode'](arg1);
 }
 
+export function SetBlocklistEnabled(arg1, arg2) {
+  return window['go']['main']['App']['SetBlocklistEnabled'](arg1, arg2);
+}
+
+export function SetBreakpointConcurrencyLimit(arg1, arg2) {
+  return window['go']['main']['App']['SetBreakpointConcurrencyLimit'](arg1, arg2);
+}
+
+export function SetGlobalNetworkProfile(arg1) {
+  return window['go']['main']['App']['SetGlobalNetworkProfile'](arg1);
+}
+
+export function SetScriptLimits(arg1) {
+  return window['go']['main']['App']['SetScriptLimits'](arg1);
+}
+
+export function SetScriptsDir(arg1) {
+  return window['go']['main']['App']['SetScriptsDir'](arg1);
+}
+
+export function SetTLSInterceptionHosts(arg1) {
+  return window['go']['main']['App']['SetTLSInterceptionHosts'](arg1);
+}
+
+export function SetTLSInterceptionMode(arg1) {
+  return window['go']['main']['App']['SetTLSInterceptionMode'](arg1);
+}
+
+export function SetUpstreamHealthCheck(arg1) {
+  return window['go']['main']['App']['SetUpstreamHealthCheck'](arg1);
+}
+
 export function StartProxy() {
   return window['go']['main']['App']['StartProxy']();
 }
@@ -190,10 +422,22 @@ export function UpdateBreakpointRuleStatus(arg1, arg2) {
   return window['go']['main']['App']['UpdateBreakpointRuleStatus'](arg1, arg2);
 }
 
+export function UpdateFaultRule(arg1) {
+  return window['go']['main']['App']['UpdateFaultRule'](arg1);
+}
+
 export function UpdateMapLocalRule(arg1) {
   return window['go']['main']['App']['UpdateMapLocalRule'](arg1);
 }
 
+export function UpdateMapRemoteRule(arg1) {
+  return window['go']['main']['App']['UpdateMapRemoteRule'](arg1);
+}
+
+export function UpdateReverseProxyListener(arg1) {
+  return window['go']['main']['App']['UpdateReverseProxyListener'](arg1);
+}
+
 export function UpdateReverseProxyRule(arg1) {
   return window['go']['main']['App']['UpdateReverseProxyRule'](arg1);
 }
@@ -206,6 +450,10 @@ export function UpdateScriptStatus(arg1, arg2) {
   return window['go']['main']['App']['UpdateScriptStatus'](arg1, arg2);
 }
 
+export function UpdateUpstreamGroup(arg1) {
+  return window['go']['main']['App']['UpdateUpstreamGroup'](arg1);
+}
+
 export function UpdateUpstreamProxy(arg1) {
   return window['go']['main']['App']['UpdateUpstreamProxy'](arg1);
 }
@@ -70,6 +70,14 @@ export namespace features {
 	    enabled: boolean;
 	    isRegex: boolean;
 	    description: string;
+	    hostPattern?: string;
+	    action?: string;
+	    statusCode?: number;
+	    body?: string;
+	    contentType?: string;
+	    hangSeconds?: number;
+	    allowedCount: number;
+	    blockedCount: number;
 	
 	    static createFrom(source: any = {}) {
 	        return new AllowBlockRule(source);
@@ -85,6 +93,115 @@ export namespace features {
 	        this.enabled = source["enabled"];
 	        this.isRegex = source["isRegex"];
 	        this.description = source["description"];
+	        this.hostPattern = source["hostPattern"];
+	        this.action = source["action"];
+	        this.statusCode = source["statusCode"];
+	        this.body = source["body"];
+	        this.contentType = source["contentType"];
+	        this.hangSeconds = source["hangSeconds"];
+	        this.allowedCount = source["allowedCount"];
+	        this.blockedCount = source["blockedCount"];
+	    }
+	}
+	export class Blocklist {
+	    id: string;
+	    name: string;
+	    source: string;
+	    format: string;
+	    enabled: boolean;
+	    entryCount: number;
+	    skippedCount: number;
+	    blockedCount: number;
+	    // Go type: time
+	    loadedAt: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new Blocklist(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.source = source["source"];
+	        this.format = source["format"];
+	        this.enabled = source["enabled"];
+	        this.entryCount = source["entryCount"];
+	        this.skippedCount = source["skippedCount"];
+	        this.blockedCount = source["blockedCount"];
+	        this.loadedAt = this.convertValues(source["loadedAt"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class BreakpointAction {
+	    type: string;
+	    edit?: BreakpointEdit;
+	    delayMs?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BreakpointAction(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.type = source["type"];
+	        this.edit = this.convertValues(source["edit"], BreakpointEdit);
+	        this.delayMs = source["delayMs"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class BreakpointEdit {
+	    method?: string;
+	    url?: string;
+	    headers?: {[key: string]: string};
+	    body?: string;
+	    statusCode?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BreakpointEdit(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.method = source["method"];
+	        this.url = source["url"];
+	        this.headers = source["headers"];
+	        this.body = source["body"];
+	        this.statusCode = source["statusCode"];
 	    }
 	}
 	export class BreakpointRule {
@@ -96,6 +213,13 @@ export namespace features {
 	    isRegex: boolean;
 	    breakOnRequest: boolean;
 	    breakOnResponse: boolean;
+	    timeoutSeconds: number;
+	    timeoutAction: string;
+	    condition: string;
+	    conditionType: string;
+	    hitCount: number;
+	    requestHits: number;
+	    responseHits: number;
 	
 	    static createFrom(source: any = {}) {
 	        return new BreakpointRule(source);
@@ -111,6 +235,33 @@ export namespace features {
 	        this.isRegex = source["isRegex"];
 	        this.breakOnRequest = source["breakOnRequest"];
 	        this.breakOnResponse = source["breakOnResponse"];
+	        this.timeoutSeconds = source["timeoutSeconds"];
+	        this.timeoutAction = source["timeoutAction"];
+	        this.condition = source["condition"];
+	        this.conditionType = source["conditionType"];
+	        this.hitCount = source["hitCount"];
+	        this.requestHits = source["requestHits"];
+	        this.responseHits = source["responseHits"];
+	    }
+	}
+	export class BreakpointStatus {
+	    held: number;
+	    queued: number;
+	    maxHeld: number;
+	    overflow: string;
+	    paused: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new BreakpointStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.held = source["held"];
+	        this.queued = source["queued"];
+	        this.maxHeld = source["maxHeld"];
+	        this.overflow = source["overflow"];
+	        this.paused = source["paused"];
 	    }
 	}
 	export class BreakpointSession {
@@ -152,6 +303,62 @@ export namespace features {
 		    return a;
 		}
 	}
+	export class FaultRule {
+	    id: string;
+	    name: string;
+	    hostPattern: string;
+	    type: string;
+	    probability: number;
+	    statusCode?: number;
+	    headers?: Record<string, string>;
+	    body?: string;
+	    afterBytes?: number;
+	    dripBytes?: number;
+	    dripIntervalMs?: number;
+	    enabled: boolean;
+	    description: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new FaultRule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.hostPattern = source["hostPattern"];
+	        this.type = source["type"];
+	        this.probability = source["probability"];
+	        this.statusCode = source["statusCode"];
+	        this.headers = source["headers"];
+	        this.body = source["body"];
+	        this.afterBytes = source["afterBytes"];
+	        this.dripBytes = source["dripBytes"];
+	        this.dripIntervalMs = source["dripIntervalMs"];
+	        this.enabled = source["enabled"];
+	        this.description = source["description"];
+	    }
+	}
+	export class HealthCheckConfig {
+	    enabled: boolean;
+	    targetUrl: string;
+	    intervalSeconds: number;
+	    timeoutSeconds: number;
+	    failureThreshold: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HealthCheckConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.targetUrl = source["targetUrl"];
+	        this.intervalSeconds = source["intervalSeconds"];
+	        this.timeoutSeconds = source["timeoutSeconds"];
+	        this.failureThreshold = source["failureThreshold"];
+	    }
+	}
 	export class MapLocalRule {
 	    id: string;
 	    name: string;
@@ -160,6 +367,13 @@ export namespace features {
 	    contentType: string;
 	    enabled: boolean;
 	    isRegex: boolean;
+	    isDirectory: boolean;
+	    indexFile: string;
+	    fallbackToNetwork: boolean;
+	    statusCode: number;
+	    headers: Record<string, string>;
+	    delayMs: number;
+	    bodyTemplate: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new MapLocalRule(source);
@@ -174,7 +388,104 @@ export namespace features {
 	        this.contentType = source["contentType"];
 	        this.enabled = source["enabled"];
 	        this.isRegex = source["isRegex"];
+	        this.isDirectory = source["isDirectory"];
+	        this.indexFile = source["indexFile"];
+	        this.fallbackToNetwork = source["fallbackToNetwork"];
+	        this.statusCode = source["statusCode"];
+	        this.headers = source["headers"];
+	        this.delayMs = source["delayMs"];
+	        this.bodyTemplate = source["bodyTemplate"];
+	    }
+	}
+	export class MapRemoteRule {
+	    id: string;
+	    name: string;
+	    urlPattern: string;
+	    isRegex: boolean;
+	    targetUrl: string;
+	    preserveHost: boolean;
+	    enabled: boolean;
+	    description: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new MapRemoteRule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.urlPattern = source["urlPattern"];
+	        this.isRegex = source["isRegex"];
+	        this.targetUrl = source["targetUrl"];
+	        this.preserveHost = source["preserveHost"];
+	        this.enabled = source["enabled"];
+	        this.description = source["description"];
+	    }
+	}
+	export class RewriteOperation {
+	    type: string;
+	    name: string;
+	    value: string;
+	    match: string;
+	    isRegex: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new RewriteOperation(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.type = source["type"];
+	        this.name = source["name"];
+	        this.value = source["value"];
+	        this.match = source["match"];
+	        this.isRegex = source["isRegex"];
+	    }
+	}
+	export class RewriteRule {
+	    id: string;
+	    name: string;
+	    urlPattern: string;
+	    isRegex: boolean;
+	    phase: string;
+	    enabled: boolean;
+	    operations: RewriteOperation[];
+	    description: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new RewriteRule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.urlPattern = source["urlPattern"];
+	        this.isRegex = source["isRegex"];
+	        this.phase = source["phase"];
+	        this.enabled = source["enabled"];
+	        this.operations = this.convertValues(source["operations"], RewriteOperation);
+	        this.description = source["description"];
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 	export class ReplayRequest {
 	    method: string;
@@ -216,6 +527,32 @@ export namespace features {
 	        this.error = source["error"];
 	    }
 	}
+	export class ReverseProxyListener {
+	    id: string;
+	    name: string;
+	    port: number;
+	    tls: boolean;
+	    certFile: string;
+	    keyFile: string;
+	    enabled: boolean;
+	    description: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ReverseProxyListener(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.port = source["port"];
+	        this.tls = source["tls"];
+	        this.certFile = source["certFile"];
+	        this.keyFile = source["keyFile"];
+	        this.enabled = source["enabled"];
+	        this.description = source["description"];
+	    }
+	}
 	export class ReverseProxyRule {
 	    id: string;
 	    name: string;
@@ -226,6 +563,8 @@ export namespace features {
 	    stripPath: boolean;
 	    addHeaders: Record<string, string>;
 	    description: string;
+	    host: string;
+	    listenerId: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new ReverseProxyRule(source);
@@ -242,8 +581,126 @@ export namespace features {
 	        this.stripPath = source["stripPath"];
 	        this.addHeaders = source["addHeaders"];
 	        this.description = source["description"];
+	        this.host = source["host"];
+	        this.listenerId = source["listenerId"];
 	    }
 	}
+	export class ScriptLimits {
+	    timeoutMs: number;
+	    maxCallStackSize: number;
+	    maxHeapGrowthMB: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ScriptLimits(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.timeoutMs = source["timeoutMs"];
+	        this.maxCallStackSize = source["maxCallStackSize"];
+	        this.maxHeapGrowthMB = source["maxHeapGrowthMB"];
+	    }
+	}
+	export class ScriptChange {
+	    path: string;
+	    type: string;
+	    before?: string;
+	    after?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ScriptChange(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.type = source["type"];
+	        this.before = source["before"];
+	        this.after = source["after"];
+	    }
+	}
+	export class ScriptError {
+	    phase?: string;
+	    message: string;
+	    line?: number;
+	    column?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ScriptError(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.phase = source["phase"];
+	        this.message = source["message"];
+	        this.line = source["line"];
+	        this.column = source["column"];
+	    }
+	}
+	export class ScriptResponse {
+	    statusCode: number;
+	    status: string;
+	    headers: Record<string, string>;
+	    body: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ScriptResponse(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.statusCode = source["statusCode"];
+	        this.status = source["status"];
+	        this.headers = source["headers"];
+	        this.body = source["body"];
+	    }
+	}
+	export class ScriptDryRunResult {
+	    flowId: string;
+	    method: string;
+	    url: string;
+	    success: boolean;
+	    error?: ScriptError;
+	    executions: proxycore.ScriptExecution[];
+	    action?: string;
+	    mocked?: ScriptResponse;
+	    changes: ScriptChange[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ScriptDryRunResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.flowId = source["flowId"];
+	        this.method = source["method"];
+	        this.url = source["url"];
+	        this.success = source["success"];
+	        this.error = this.convertValues(source["error"], ScriptError);
+	        this.executions = this.convertValues(source["executions"], proxycore.ScriptExecution);
+	        this.action = source["action"];
+	        this.mocked = this.convertValues(source["mocked"], ScriptResponse);
+	        this.changes = this.convertValues(source["changes"], ScriptChange);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class Script {
 	    id: string;
 	    name: string;
@@ -251,6 +708,11 @@ export namespace features {
 	    enabled: boolean;
 	    type: string;
 	    description: string;
+	    urlPattern: string;
+	    isRegex: boolean;
+	    method: string;
+	    order: number;
+	    file: string;
 	    // Go type: time
 	    createdAt: any;
 	    // Go type: time
@@ -268,6 +730,11 @@ export namespace features {
 	        this.enabled = source["enabled"];
 	        this.type = source["type"];
 	        this.description = source["description"];
+	        this.urlPattern = source["urlPattern"];
+	        this.isRegex = source["isRegex"];
+	        this.method = source["method"];
+	        this.order = source["order"];
+	        this.file = source["file"];
 	        this.createdAt = this.convertValues(source["createdAt"], null);
 	        this.updatedAt = this.convertValues(source["updatedAt"], null);
 	    }
@@ -300,6 +767,7 @@ export namespace features {
 	    username?: string;
 	    password?: string;
 	    description: string;
+	    skipTlsVerify: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new UpstreamProxy(source);
@@ -316,9 +784,95 @@ export namespace features {
 	        this.username = source["username"];
 	        this.password = source["password"];
 	        this.description = source["description"];
+	        this.skipTlsVerify = source["skipTlsVerify"];
+	    }
+	}
+	export class UpstreamGroup {
+	    id: string;
+	    name: string;
+	    urlPattern: string;
+	    isRegex: boolean;
+	    enabled: boolean;
+	    strategy: string;
+	    proxyIds: string[];
+	    description: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new UpstreamGroup(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.urlPattern = source["urlPattern"];
+	        this.isRegex = source["isRegex"];
+	        this.enabled = source["enabled"];
+	        this.strategy = source["strategy"];
+	        this.proxyIds = source["proxyIds"];
+	        this.description = source["description"];
+	    }
+	}
+	export class UpstreamHealth {
+	    proxyId: string;
+	    healthy: boolean;
+	    consecutiveFailures: number;
+	    // Go type: time
+	    lastCheck: any;
+	    lastLatencyMs: number;
+	    lastError?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new UpstreamHealth(source);
 	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.proxyId = source["proxyId"];
+	        this.healthy = source["healthy"];
+	        this.consecutiveFailures = source["consecutiveFailures"];
+	        this.lastCheck = this.convertValues(source["lastCheck"], null);
+	        this.lastLatencyMs = source["lastLatencyMs"];
+	        this.lastError = source["lastError"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 
+	export class ThrottleRule {
+	    id: string;
+	    hostPattern: string;
+	    profileId: string;
+	    enabled: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ThrottleRule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.hostPattern = source["hostPattern"];
+	        this.profileId = source["profileId"];
+	        this.enabled = source["enabled"];
+	    }
+	}
 }
 
 export namespace http {
@@ -618,6 +1172,8 @@ export namespace proxycore {
 	    logs: string[];
 	    // Go type: time
 	    executedAt: any;
+	    durationMs: number;
+	    action?: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new ScriptExecution(source);
@@ -632,6 +1188,8 @@ export namespace proxycore {
 	        this.error = source["error"];
 	        this.logs = source["logs"];
 	        this.executedAt = this.convertValues(source["executedAt"], null);
+	        this.durationMs = source["durationMs"];
+	        this.action = source["action"];
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -713,6 +1271,8 @@ export namespace proxycore {
 	export class Flow {
 	    id: string;
 	    url: string;
+	    mappedUrl?: string;
+	    networkProfile?: string;
 	    method: string;
 	    statusCode: number;
 	    client: string;
@@ -742,6 +1302,8 @@ export namespace proxycore {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.id = source["id"];
 	        this.url = source["url"];
+	        this.mappedUrl = source["mappedUrl"];
+	        this.networkProfile = source["networkProfile"];
 	        this.method = source["method"];
 	        this.statusCode = source["statusCode"];
 	        this.client = source["client"];
@@ -783,6 +1345,34 @@ export namespace proxycore {
 	
 	
 
+	export class NetworkProfile {
+	    id: string;
+	    name: string;
+	    downloadKbps: number;
+	    uploadKbps: number;
+	    latencyMs: number;
+	    firstByteLatencyMs: number;
+	    jitterMs: number;
+	    failureRate: number;
+	    builtIn: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new NetworkProfile(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.downloadKbps = source["downloadKbps"];
+	        this.uploadKbps = source["uploadKbps"];
+	        this.latencyMs = source["latencyMs"];
+	        this.firstByteLatencyMs = source["firstByteLatencyMs"];
+	        this.jitterMs = source["jitterMs"];
+	        this.failureRate = source["failureRate"];
+	        this.builtIn = source["builtIn"];
+	    }
+	}
 }
 
 export namespace tls {
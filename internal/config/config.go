@@ -13,6 +13,17 @@ type Config struct {
 	AutoStart    bool   `json:"autoStart"`
 	Theme        string `json:"theme"`
 	LogLevel     string `json:"logLevel"`
+
+	// SOCKS5 入站监听，端口为0表示不启用
+	SOCKS5Port     int    `json:"socks5Port"`
+	SOCKS5Username string `json:"socks5Username,omitempty"`
+	SOCKS5Password string `json:"socks5Password,omitempty"`
+
+	// PACFile 用于选择上游代理的PAC脚本（本地路径或本地URL），为空表示不使用
+	PACFile string `json:"pacFile,omitempty"`
+
+	// ScriptsDir 加载并监视脚本文件的目录，为空表示不使用
+	ScriptsDir string `json:"scriptsDir,omitempty"`
 }
 
 // DefaultConfig 默认配置
@@ -1,39 +1,107 @@
 package features
 
 import (
+	"encoding/json"
 	"fmt"
+	"html"
+	"net"
 	"net/http"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"ProxyWoman/internal/proxycore"
 )
 
+// 阻止动作
+const (
+	BlockActionForbidden = "forbidden" // 403页面（默认），按客户端Accept返回HTML或JSON
+	BlockActionStatus    = "status"    // 自定义状态码和响应体
+	BlockActionEmpty     = "empty"     // 204空响应
+	BlockActionClose     = "close"     // 不返回响应直接断开连接
+	BlockActionHang      = "hang"      // 不返回响应，直到客户端超时断开
+)
+
+// defaultHangSeconds hang动作未设置时长时最多保持连接的时间
+const defaultHangSeconds = 300
+
 // AllowBlockRule 允许/阻止规则
 type AllowBlockRule struct {
 	ID          string `json:"id"`
 	Name        string `json:"name"`
 	URLPattern  string `json:"urlPattern"`
+	// HostPattern 按主机匹配，可带端口，如 example.com、*.example.com、example.com:8443、*:25。
+	// 只设置主机模式的规则在CONNECT时即可判断，被阻止的HTTPS主机不会进行证书签发和TLS握手
+	HostPattern string `json:"hostPattern,omitempty"`
 	Method      string `json:"method"`
 	Type        string `json:"type"` // "allow" or "block"
 	Enabled     bool   `json:"enabled"`
 	IsRegex     bool   `json:"isRegex"`
 	Description string `json:"description"`
+
+	// 阻止规则的动作，为空时为forbidden
+	Action      string `json:"action,omitempty"`
+	StatusCode  int    `json:"statusCode,omitempty"`  // status动作的状态码
+	Body        string `json:"body,omitempty"`        // status动作的响应体
+	ContentType string `json:"contentType,omitempty"` // status动作的内容类型
+	HangSeconds int    `json:"hangSeconds,omitempty"` // hang动作最多保持连接的秒数，为0时使用默认值
+
+	// 运行时统计，不持久化
+	AllowedCount int64 `json:"allowedCount"`
+	BlockedCount int64 `json:"blockedCount"`
+}
+
+// validate 检查规则的类型、动作和模式
+func (rule *AllowBlockRule) validate() error {
+	if rule.Type != "allow" && rule.Type != "block" {
+		return fmt.Errorf("invalid rule type: %s", rule.Type)
+	}
+	if rule.URLPattern == "" && rule.HostPattern == "" {
+		return fmt.Errorf("URL pattern or host pattern is required")
+	}
+	switch rule.Action {
+	case "", BlockActionForbidden, BlockActionEmpty, BlockActionClose:
+	case BlockActionStatus:
+		// 1xx是临时响应，客户端会继续等待最终响应，只允许最终响应的状态码
+		if rule.StatusCode < 200 || rule.StatusCode > 599 {
+			return fmt.Errorf("invalid status code: %d", rule.StatusCode)
+		}
+	case BlockActionHang:
+		if rule.HangSeconds < 0 {
+			return fmt.Errorf("hang seconds must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown block action: %s", rule.Action)
+	}
+	if rule.IsRegex {
+		if _, err := regexp.Compile(rule.URLPattern); err != nil {
+			return fmt.Errorf("invalid URL pattern: %v", err)
+		}
+	}
+	return nil
 }
 
 // AllowBlockManager 允许/阻止管理器
 type AllowBlockManager struct {
-	rules      map[string]*AllowBlockRule
-	rulesMutex sync.RWMutex
-	mode       string // "whitelist" (只允许匹配的), "blacklist" (阻止匹配的), "mixed" (混合模式)
+	rules        map[string]*AllowBlockRule
+	rulesMutex   sync.RWMutex
+	mode         string                // "whitelist" (只允许匹配的), "blacklist" (阻止匹配的), "mixed" (混合模式)
+	blocklists   map[string]*Blocklist // 导入的阻止列表，与规则共用rulesMutex
+	blocklistIDs []string              // 按ID排序，匹配时按此顺序检查，保证结果确定
+
+	// 所有请求的统计，包括未匹配任何规则的请求
+	allowedTotal int64
+	blockedTotal int64
 }
 
 // NewAllowBlockManager 创建允许/阻止管理器
 func NewAllowBlockManager() *AllowBlockManager {
 	return &AllowBlockManager{
-		rules: make(map[string]*AllowBlockRule),
-		mode:  "mixed", // 默认混合模式
+		rules:      make(map[string]*AllowBlockRule),
+		blocklists: make(map[string]*Blocklist),
+		mode:       "mixed", // 默认混合模式
 	}
 }
 
@@ -52,10 +120,15 @@ func (abm *AllowBlockManager) GetMode() string {
 }
 
 // AddRule 添加规则
-func (abm *AllowBlockManager) AddRule(rule *AllowBlockRule) {
+func (abm *AllowBlockManager) AddRule(rule *AllowBlockRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+
 	abm.rulesMutex.Lock()
 	defer abm.rulesMutex.Unlock()
 	abm.rules[rule.ID] = rule
+	return nil
 }
 
 // RemoveRule 移除规则
@@ -67,13 +140,21 @@ func (abm *AllowBlockManager) RemoveRule(ruleID string) {
 
 // UpdateRule 更新规则
 func (abm *AllowBlockManager) UpdateRule(rule *AllowBlockRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+
 	abm.rulesMutex.Lock()
 	defer abm.rulesMutex.Unlock()
 	
-	if _, exists := abm.rules[rule.ID]; !exists {
+	existing, exists := abm.rules[rule.ID]
+	if !exists {
 		return fmt.Errorf("rule not found: %s", rule.ID)
 	}
 	
+	// 更新规则时保留统计
+	rule.AllowedCount = atomic.LoadInt64(&existing.AllowedCount)
+	rule.BlockedCount = atomic.LoadInt64(&existing.BlockedCount)
 	abm.rules[rule.ID] = rule
 	return nil
 }
@@ -117,7 +198,10 @@ func (abm *AllowBlockManager) CheckRequest(flow *proxycore.Flow) (allowed bool,
 			continue
 		}
 		
-		// 检查URL匹配
+		// 检查主机和URL匹配
+		if rule.HostPattern != "" && !matchHostPort(rule.HostPattern, flowHostPort(flow)) {
+			continue
+		}
 		matched, err := abm.matchURL(flow.URL, rule)
 		if err != nil || !matched {
 			continue
@@ -145,16 +229,22 @@ func (abm *AllowBlockManager) CheckRequest(flow *proxycore.Flow) (allowed bool,
 		if matchedBlockRule != nil {
 			return false, matchedBlockRule
 		}
+		if listRule := abm.matchBlocklistsLocked(flow.Domain); listRule != nil {
+			return false, listRule
+		}
 		return true, nil
 		
 	case "mixed":
-		// 混合模式：阻止规则优先，然后是允许规则，最后默认允许
+		// 混合模式：阻止规则优先，然后是允许规则（可作为阻止列表的例外），再是阻止列表，最后默认允许
 		if matchedBlockRule != nil {
 			return false, matchedBlockRule
 		}
 		if matchedAllowRule != nil {
 			return true, matchedAllowRule
 		}
+		if listRule := abm.matchBlocklistsLocked(flow.Domain); listRule != nil {
+			return false, listRule
+		}
 		return true, nil // 默认允许
 		
 	default:
@@ -162,6 +252,97 @@ func (abm *AllowBlockManager) CheckRequest(flow *proxycore.Flow) (allowed bool,
 	}
 }
 
+// CheckConnect 在CONNECT时按 host:port 判断隧道是否允许。
+// URL规则可能包含路径，只有阻止规则匹配隧道地址时才能在隧道层阻止；
+// decided为false表示无法在隧道层判断，需由解密后的每个请求决定；
+// 标记为ssl-bypass的隧道不会解密，此时按没有URL规则匹配处理，白名单模式下阻止
+func (abm *AllowBlockManager) CheckConnect(flow *proxycore.Flow) (decided, allowed bool, rule *AllowBlockRule) {
+	abm.rulesMutex.RLock()
+	defer abm.rulesMutex.RUnlock()
+
+	hostPort := flowHostPort(flow)
+	tunnelOnly := flow.HasTag("ssl-bypass")
+	var hostAllow, hostBlock, urlBlock *AllowBlockRule
+	hasURLAllow := false
+	for _, rule := range abm.rules {
+		if !rule.Enabled || (rule.Method != "" && rule.Method != "*" && rule.Method != http.MethodConnect) {
+			continue
+		}
+		if rule.URLPattern != "" {
+			if rule.Type == "allow" {
+				hasURLAllow = true
+			} else if rule.HostPattern == "" || matchHostPort(rule.HostPattern, hostPort) {
+				if matched, err := abm.matchURL(flow.URL, rule); err == nil && matched {
+					urlBlock = rule
+				}
+			}
+			continue
+		}
+		if !matchHostPort(rule.HostPattern, hostPort) {
+			continue
+		}
+		if rule.Type == "allow" {
+			hostAllow = rule
+		} else if rule.Type == "block" {
+			hostBlock = rule
+		}
+	}
+
+	switch abm.mode {
+	case "whitelist":
+		if hostAllow != nil {
+			return true, true, hostAllow
+		}
+		if hasURLAllow && !tunnelOnly {
+			return false, false, nil
+		}
+		return true, false, nil
+	case "blacklist", "mixed":
+		if hostBlock != nil {
+			return true, false, hostBlock
+		}
+		if urlBlock != nil {
+			return true, false, urlBlock
+		}
+		if hostAllow != nil {
+			return true, true, hostAllow
+		}
+		// 阻止列表按主机匹配，混合模式下URL允许规则可能为该主机的部分请求开例外，交给请求时判断
+		if listRule := abm.matchBlocklistsLocked(flow.Domain); listRule != nil && (abm.mode == "blacklist" || !hasURLAllow || tunnelOnly) {
+			return true, false, listRule
+		}
+	}
+	return false, true, nil
+}
+
+// flowHostPort 获取Flow的 host:port，未写端口时按协议补全默认端口
+func flowHostPort(flow *proxycore.Flow) string {
+	if _, _, err := net.SplitHostPort(flow.Domain); err == nil {
+		return flow.Domain
+	}
+	if flow.Scheme == "https" {
+		return net.JoinHostPort(flow.Domain, "443")
+	}
+	return net.JoinHostPort(flow.Domain, "80")
+}
+
+// matchHostPort 匹配 host:port，模式不含端口时匹配任意端口，主机部分为 * 时匹配任意主机
+func matchHostPort(pattern, hostPort string) bool {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host, port = hostPort, ""
+	}
+
+	patternHost, patternPort := pattern, ""
+	if h, p, err := net.SplitHostPort(pattern); err == nil {
+		patternHost, patternPort = h, p
+	}
+	if patternPort != "" && patternPort != port {
+		return false
+	}
+	return patternHost == "*" || matchHost(patternHost, host)
+}
+
 // matchURL 匹配URL
 func (abm *AllowBlockManager) matchURL(url string, rule *AllowBlockRule) (bool, error) {
 	if rule.IsRegex {
@@ -190,25 +371,120 @@ func NewAllowBlockInterceptor(manager *AllowBlockManager) *AllowBlockInterceptor
 // InterceptRequest 拦截请求
 func (abi *AllowBlockInterceptor) InterceptRequest(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
 	allowed, rule := abi.manager.CheckRequest(flow)
+	abi.manager.recordDecision(allowed, rule)
 	
 	if !allowed {
 		// 请求被阻止
-		flow.IsBlocked = true
-		if rule != nil {
-			flow.AddTag(fmt.Sprintf("blocked-by-%s", rule.Name))
-		} else {
-			flow.AddTag("blocked")
+		markBlocked(flow, rule)
+		return true, writeBlockResponse(flow, w, r, rule, false)
+	}
+	
+	// 请求被允许，添加标签
+	if rule != nil {
+		flow.AddTag(fmt.Sprintf("allowed-by-%s", rule.Name))
+	}
+	
+	return false, nil // 继续处理请求
+}
+
+// InterceptConnect 在建立HTTPS隧道前按 host:port 决定是否允许，被阻止的隧道以CONNECT的错误状态码响应，
+// 不会为其签发证书或进行TLS握手
+func (abi *AllowBlockInterceptor) InterceptConnect(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
+	decided, allowed, rule := abi.manager.CheckConnect(flow)
+	if !decided || allowed {
+		return false, nil
+	}
+	abi.manager.recordDecision(false, rule)
+	markBlocked(flow, rule)
+	flow.AddTag("blocked-tunnel")
+	return true, writeBlockResponse(flow, w, r, rule, true)
+}
+
+// markBlocked 标记被阻止的Flow
+func markBlocked(flow *proxycore.Flow, rule *AllowBlockRule) {
+	flow.IsBlocked = true
+	if rule != nil {
+		flow.AddTag(fmt.Sprintf("blocked-by-%s", rule.Name))
+	} else {
+		flow.AddTag("blocked")
+	}
+}
+
+// writeBlockResponse 按规则的动作响应被阻止的请求。
+// close和hang返回ErrAbortConnection，由代理断开连接；tunnel为true时响应CONNECT，只使用错误状态码
+func writeBlockResponse(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request, rule *AllowBlockRule, tunnel bool) error {
+	action := BlockActionForbidden
+	if rule != nil && rule.Action != "" {
+		action = rule.Action
+	}
+
+	switch action {
+	case BlockActionClose:
+		return proxycore.ErrAbortConnection
+	case BlockActionHang:
+		hang := time.Duration(defaultHangSeconds) * time.Second
+		if rule.HangSeconds > 0 {
+			hang = time.Duration(rule.HangSeconds) * time.Second
 		}
-		
-		// 返回403 Forbidden
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Header().Set("X-ProxyWoman-Blocked", "true")
-		if rule != nil {
-			w.Header().Set("X-ProxyWoman-Rule", rule.Name)
+		timer := time.NewTimer(hang)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
 		}
-		
-		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte(`<!DOCTYPE html>
+		return proxycore.ErrAbortConnection
+	}
+
+	statusCode := http.StatusForbidden
+	contentType, body := forbiddenBody(flow, r)
+	switch action {
+	case BlockActionEmpty:
+		statusCode, contentType, body = http.StatusNoContent, "", nil
+	case BlockActionStatus:
+		statusCode, contentType, body = rule.StatusCode, rule.ContentType, []byte(rule.Body)
+		if contentType == "" && len(body) > 0 {
+			contentType = "text/plain; charset=utf-8"
+		}
+	}
+	// CONNECT的2xx响应表示隧道已建立，阻止时只能使用错误状态码
+	if tunnel && statusCode < 300 {
+		statusCode, contentType, body = http.StatusForbidden, "", nil
+	}
+
+	header := make(http.Header)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("X-ProxyWoman-Blocked", "true")
+	if rule != nil {
+		header.Set("X-ProxyWoman-Rule", rule.Name)
+	}
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(statusCode)
+	w.Write(body)
+
+	flow.SetResponse(&http.Response{
+		StatusCode: statusCode,
+		Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		Header:     header,
+	}, body)
+	return nil
+}
+
+// forbiddenBody 默认的403响应体，客户端接受JSON时返回JSON，否则返回HTML页面
+func forbiddenBody(flow *proxycore.Flow, r *http.Request) (string, []byte) {
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "json") && !strings.Contains(accept, "text/html") {
+		body, _ := json.Marshal(map[string]string{
+			"error": "request blocked by ProxyWoman",
+			"url":   flow.URL,
+		})
+		return "application/json; charset=utf-8", body
+	}
+
+	return "text/html; charset=utf-8", []byte(`<!DOCTYPE html>
 <html>
 <head>
     <title>Request Blocked - ProxyWoman</title>
@@ -223,33 +499,62 @@ func (abi *AllowBlockInterceptor) InterceptRequest(flow *proxycore.Flow, w http.
     <div class="container">
         <h1 class="error">🚫 Request Blocked</h1>
         <p>This request has been blocked by ProxyWoman.</p>
-        <div class="url">` + flow.URL + `</div>
+        <div class="url">` + html.EscapeString(flow.URL) + `</div>
         <p><small>ProxyWoman - Network Debugging Proxy</small></p>
     </div>
 </body>
-</html>`))
-		
-		return true, nil // 请求已处理
+</html>`)
+}
+
+// recordDecision 记录一次允许/阻止决定
+func (abm *AllowBlockManager) recordDecision(allowed bool, rule *AllowBlockRule) {
+	if allowed {
+		atomic.AddInt64(&abm.allowedTotal, 1)
+		if rule != nil {
+			atomic.AddInt64(&rule.AllowedCount, 1)
+		}
+		return
 	}
-	
-	// 请求被允许，添加标签
+	atomic.AddInt64(&abm.blockedTotal, 1)
 	if rule != nil {
-		flow.AddTag(fmt.Sprintf("allowed-by-%s", rule.Name))
+		atomic.AddInt64(&rule.BlockedCount, 1)
 	}
-	
-	return false, nil // 继续处理请求
 }
 
-// GetBlockedRequestsCount 获取被阻止的请求数量
-func (abm *AllowBlockManager) GetBlockedRequestsCount() int {
-	// 这个方法需要与代理服务器集成来统计
-	// 暂时返回0
+// GetBlockedRequestsCount 获取被阻止的请求数量，ruleID为空时返回所有请求的统计
+func (abm *AllowBlockManager) GetBlockedRequestsCount(ruleID string) int {
+	if ruleID == "" {
+		return int(atomic.LoadInt64(&abm.blockedTotal))
+	}
+	if rule, exists := abm.GetRule(ruleID); exists {
+		return int(atomic.LoadInt64(&rule.BlockedCount))
+	}
 	return 0
 }
 
-// GetAllowedRequestsCount 获取被允许的请求数量
-func (abm *AllowBlockManager) GetAllowedRequestsCount() int {
-	// 这个方法需要与代理服务器集成来统计
-	// 暂时返回0
+// GetAllowedRequestsCount 获取被允许的请求数量，ruleID为空时返回所有请求的统计
+func (abm *AllowBlockManager) GetAllowedRequestsCount(ruleID string) int {
+	if ruleID == "" {
+		return int(atomic.LoadInt64(&abm.allowedTotal))
+	}
+	if rule, exists := abm.GetRule(ruleID); exists {
+		return int(atomic.LoadInt64(&rule.AllowedCount))
+	}
 	return 0
 }
+
+// ResetCounters 清零所有统计
+func (abm *AllowBlockManager) ResetCounters() {
+	abm.rulesMutex.RLock()
+	defer abm.rulesMutex.RUnlock()
+
+	atomic.StoreInt64(&abm.allowedTotal, 0)
+	atomic.StoreInt64(&abm.blockedTotal, 0)
+	for _, rule := range abm.rules {
+		atomic.StoreInt64(&rule.AllowedCount, 0)
+		atomic.StoreInt64(&rule.BlockedCount, 0)
+	}
+	for _, list := range abm.blocklists {
+		atomic.StoreInt64(&list.rule.BlockedCount, 0)
+	}
+}
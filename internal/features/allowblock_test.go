@@ -0,0 +1,268 @@
+package features
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+func TestBlockActions(t *testing.T) {
+	tests := []struct {
+		name       string
+		rule       AllowBlockRule
+		accept     string
+		wantStatus int
+		wantBody   string
+		wantError  bool
+	}{
+		{"default html escapes url", AllowBlockRule{}, "", 403, "&lt;script&gt;", false},
+		{"default json for api clients", AllowBlockRule{}, "application/json", 403, `"error":"request blocked by ProxyWoman"`, false},
+		{"custom status", AllowBlockRule{Action: BlockActionStatus, StatusCode: 451, Body: `{"blocked":true}`, ContentType: "application/json"}, "", 451, `{"blocked":true}`, false},
+		{"empty", AllowBlockRule{Action: BlockActionEmpty}, "", 204, "", false},
+		{"close", AllowBlockRule{Action: BlockActionClose}, "", 0, "", true},
+		{"hang", AllowBlockRule{Action: BlockActionHang, HangSeconds: 1}, "", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewAllowBlockManager()
+			rule := tt.rule
+			rule.ID, rule.Name, rule.Type, rule.URLPattern, rule.Enabled = "b", "ads", "block", "ads.example.com", true
+			if err := manager.AddRule(&rule); err != nil {
+				t.Fatal(err)
+			}
+			_, client, flows := newTestProxy(t, NewAllowBlockInterceptor(manager))
+
+			req, _ := http.NewRequest("GET", "http://ads.example.com/?q=<script>", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, err := client.Do(req)
+			if tt.wantError {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("expected connection error, got %d", resp.StatusCode)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantStatus || !strings.Contains(string(body), tt.wantBody) {
+					t.Errorf("got %d %q", resp.StatusCode, body)
+				}
+				if strings.Contains(string(body), "<script>") {
+					t.Error("blocked URL must be escaped")
+				}
+			}
+
+			flow := <-flows
+			if !flow.IsBlocked || !flow.HasTag("blocked-by-ads") {
+				t.Errorf("unexpected flow: blocked=%v tags=%v", flow.IsBlocked, flow.Tags)
+			}
+			if manager.GetBlockedRequestsCount("b") != 1 || manager.GetBlockedRequestsCount("") != 1 {
+				t.Errorf("blocked counters = %d/%d", manager.GetBlockedRequestsCount("b"), manager.GetBlockedRequestsCount(""))
+			}
+		})
+	}
+}
+
+func TestBlockStatusCodeRange(t *testing.T) {
+	manager := NewAllowBlockManager()
+	for _, code := range []int{0, 100, 199, 600, 999} {
+		rule := &AllowBlockRule{ID: "b", Name: "ads", Type: "block", URLPattern: "ads.example.com", Enabled: true,
+			Action: BlockActionStatus, StatusCode: code}
+		if err := manager.AddRule(rule); err == nil {
+			t.Errorf("expected status code %d to be rejected", code)
+		}
+	}
+	for _, code := range []int{200, 451, 599} {
+		rule := &AllowBlockRule{ID: "b", Name: "ads", Type: "block", URLPattern: "ads.example.com", Enabled: true,
+			Action: BlockActionStatus, StatusCode: code}
+		if err := manager.AddRule(rule); err != nil {
+			t.Errorf("expected status code %d to be accepted: %v", code, err)
+		}
+	}
+}
+
+func TestBlockConnectTunnel(t *testing.T) {
+	manager := NewAllowBlockManager()
+	manager.AddRule(&AllowBlockRule{ID: "b", Name: "tracker", Type: "block", URLPattern: "tracker.example.com", Enabled: true})
+	_, client, flows := newTestProxy(t, NewAllowBlockInterceptor(manager))
+
+	_, err := client.Get("https://tracker.example.com/pixel")
+	if err == nil || !strings.Contains(err.Error(), "Forbidden") {
+		t.Fatalf("expected CONNECT to be refused with 403, got %v", err)
+	}
+
+	flow := <-flows
+	if flow.Method != http.MethodConnect || flow.StatusCode != 403 || !flow.IsBlocked {
+		t.Errorf("unexpected flow: method=%s status=%d blocked=%v", flow.Method, flow.StatusCode, flow.IsBlocked)
+	}
+}
+
+func TestAllowBlockCounters(t *testing.T) {
+	manager := NewAllowBlockManager()
+	manager.AddRule(&AllowBlockRule{ID: "a", Name: "api", Type: "allow", URLPattern: "api.example.com", Enabled: true})
+	manager.AddRule(&AllowBlockRule{ID: "b", Name: "ads", Type: "block", URLPattern: "ads.example.com", Enabled: true})
+
+	for _, u := range []string{"http://api.example.com/1", "http://api.example.com/2", "http://ads.example.com/", "http://other.test/"} {
+		allowed, rule := manager.CheckRequest(&proxycore.Flow{URL: u, Method: "GET"})
+		manager.recordDecision(allowed, rule)
+	}
+
+	if got := manager.GetAllowedRequestsCount("a"); got != 2 {
+		t.Errorf("allowed count for rule = %d, want 2", got)
+	}
+	if got := manager.GetBlockedRequestsCount("b"); got != 1 {
+		t.Errorf("blocked count for rule = %d, want 1", got)
+	}
+	if got := manager.GetAllowedRequestsCount(""); got != 3 {
+		t.Errorf("total allowed = %d, want 3", got)
+	}
+
+	// 更新规则保留统计，清零后归零
+	manager.UpdateRule(&AllowBlockRule{ID: "a", Name: "api", Type: "allow", URLPattern: "api.example.com/v2", Enabled: true})
+	if got := manager.GetAllowedRequestsCount("a"); got != 2 {
+		t.Errorf("allowed count after update = %d, want 2", got)
+	}
+	manager.ResetCounters()
+	if manager.GetAllowedRequestsCount("a") != 0 || manager.GetBlockedRequestsCount("") != 0 {
+		t.Error("counters should be reset")
+	}
+
+	if err := manager.AddRule(&AllowBlockRule{ID: "x", Type: "block", Action: BlockActionStatus}); err == nil {
+		t.Error("status action without status code should be rejected")
+	}
+}
+
+func TestCheckConnectHostPort(t *testing.T) {
+	connectFlow := func(target string) *proxycore.Flow {
+		return &proxycore.Flow{Method: http.MethodConnect, Scheme: "https", Domain: target, URL: "https://" + strings.TrimSuffix(target, ":443")}
+	}
+
+	manager := NewAllowBlockManager()
+	manager.AddRule(&AllowBlockRule{ID: "p", Name: "smtp", Type: "block", HostPattern: "*:8443", Enabled: true})
+	manager.AddRule(&AllowBlockRule{ID: "h", Name: "ads", Type: "block", HostPattern: "*.ads.test", Enabled: true})
+	manager.AddRule(&AllowBlockRule{ID: "u", Name: "pixel", Type: "block", URLPattern: "cdn.example.com/pixel", Enabled: true})
+
+	tests := []struct {
+		target      string
+		wantDecided bool
+		wantAllowed bool
+	}{
+		{"api.example.com:8443", true, false},
+		{"x.ads.test:443", true, false},
+		{"cdn.example.com:443", false, true}, // 带路径的URL规则只能在请求时判断
+		{"api.example.com:443", false, true},
+	}
+	for _, tt := range tests {
+		decided, allowed, _ := manager.CheckConnect(connectFlow(tt.target))
+		if decided != tt.wantDecided || allowed != tt.wantAllowed {
+			t.Errorf("%s: decided=%v allowed=%v", tt.target, decided, allowed)
+		}
+	}
+
+	// 主机规则同样作用于解密后的请求，未写端口时按协议补全
+	allowed, _ := manager.CheckRequest(&proxycore.Flow{Method: "GET", Scheme: "https", Domain: "www.ads.test", URL: "https://www.ads.test/"})
+	if allowed {
+		t.Error("host rule should block requests to the host")
+	}
+
+	whitelist := NewAllowBlockManager()
+	whitelist.SetMode("whitelist")
+	whitelist.AddRule(&AllowBlockRule{ID: "a", Name: "api", Type: "allow", HostPattern: "api.example.com:443", Enabled: true})
+	if decided, allowed, _ := whitelist.CheckConnect(connectFlow("api.example.com:443")); !decided || !allowed {
+		t.Error("whitelisted host should be allowed at CONNECT")
+	}
+	if decided, allowed, _ := whitelist.CheckConnect(connectFlow("other.test:443")); !decided || allowed {
+		t.Error("other hosts should be blocked at CONNECT in whitelist mode")
+	}
+}
+
+func TestTLSInterceptionBypass(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("direct"))
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	tlsManager := NewTLSInterceptManager()
+	tlsManager.SetMode(TLSInterceptExclude)
+	tlsManager.SetHosts([]string{backendURL.Hostname()})
+	if tlsManager.ShouldInterceptTLS("other.test:443") != true || tlsManager.ShouldInterceptTLS(backendURL.Host) {
+		t.Fatal("unexpected interception decision")
+	}
+
+	// 代理没有证书管理器，只有原样转发时请求才能成功
+	ps := proxycore.NewProxyServer(0, nil)
+	ps.SetTLSInterceptionPolicy(tlsManager)
+	flows := make(chan *proxycore.Flow, 1)
+	ps.SetFlowHandler(func(flow *proxycore.Flow) { flows <- flow })
+	proxy := httptest.NewServer(ps)
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	transport := backend.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	transport.DisableKeepAlives = true
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+
+	resp, err := client.Get(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "direct" {
+		t.Errorf("body = %q", body)
+	}
+
+	flow := <-flows
+	if !flow.HasTag("ssl-bypass") {
+		t.Errorf("expected ssl-bypass tunnel flow, got %v", flow.Tags)
+	}
+}
+
+// TestWhitelistBlocksUndecryptedTunnels 不解密的隧道没有请求级检查，白名单中只有URL允许规则时必须在CONNECT时阻止
+func TestWhitelistBlocksUndecryptedTunnels(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("direct"))
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	manager := NewAllowBlockManager()
+	manager.SetMode("whitelist")
+	manager.AddRule(&AllowBlockRule{ID: "a", Name: "api", Type: "allow", URLPattern: backend.URL + "/allowed", Enabled: true})
+
+	flow := &proxycore.Flow{Method: http.MethodConnect, Scheme: "https", Domain: backendURL.Host, URL: "https://" + backendURL.Host}
+	if decided, _, _ := manager.CheckConnect(flow); decided {
+		t.Error("decrypted tunnels are left to the per-request check")
+	}
+	flow.AddTag("ssl-bypass")
+	if decided, allowed, _ := manager.CheckConnect(flow); !decided || allowed {
+		t.Error("undecrypted tunnels must be blocked when only URL rules allow the host")
+	}
+
+	tlsManager := NewTLSInterceptManager()
+	tlsManager.SetMode(TLSInterceptExclude)
+	tlsManager.SetHosts([]string{backendURL.Hostname()})
+	ps, client, flows := newTestProxy(t, NewAllowBlockInterceptor(manager))
+	ps.SetTLSInterceptionPolicy(tlsManager)
+
+	if resp, err := client.Get(backend.URL + "/allowed"); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the tunnel to be refused")
+	}
+	if flow := <-flows; !flow.HasTag("blocked-tunnel") {
+		t.Errorf("expected blocked tunnel flow, got %v", flow.Tags)
+	}
+}
@@ -0,0 +1,379 @@
+package features
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 阻止列表格式
+const (
+	BlocklistFormatAuto    = "auto"    // 按内容自动识别
+	BlocklistFormatHosts   = "hosts"   // hosts文件：0.0.0.0 ads.example.com，只阻止列出的主机
+	BlocklistFormatDomains = "domains" // 每行一个域名，阻止该域名及其子域名
+	BlocklistFormatAdblock = "adblock" // Adblock网络规则：||ads.example.com^，阻止该域名及其子域名
+)
+
+// Blocklist 导入的阻止列表，按域名后缀树匹配，阻止规则和允许规则之后生效
+type Blocklist struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Source       string    `json:"source"` // 本地文件路径
+	Format       string    `json:"format"`
+	Enabled      bool      `json:"enabled"`
+	EntryCount   int       `json:"entryCount"`
+	SkippedCount int       `json:"skippedCount"` // 无法按域名匹配而跳过的行（如带路径或选项的Adblock规则）
+	BlockedCount int64     `json:"blockedCount"`
+	LoadedAt     time.Time `json:"loadedAt"`
+
+	trie *domainTrie
+	rule *AllowBlockRule // 命中时作为阻止规则返回，用于标签、统计和阻止动作
+}
+
+// blocklistEntry 解析出的一条域名
+type blocklistEntry struct {
+	domain            string
+	includeSubdomains bool
+}
+
+// domainTrie 按域名标签倒序存储的后缀树，查找耗时只与主机名的层级数有关，与列表大小无关
+type domainTrie struct {
+	root *trieNode
+	size int
+}
+
+type trieNode struct {
+	children map[string]*trieNode
+	exact    bool // 该域名本身被阻止
+	subtree  bool // 该域名及其所有子域名被阻止
+}
+
+func newDomainTrie() *domainTrie {
+	return &domainTrie{root: &trieNode{}}
+}
+
+// insert 插入域名，includeSubdomains为true时同时匹配其子域名
+func (t *domainTrie) insert(domain string, includeSubdomains bool) {
+	labels := strings.Split(domain, ".")
+	node := t.root
+	for i := len(labels) - 1; i >= 0; i-- {
+		if node.children == nil {
+			node.children = make(map[string]*trieNode)
+		}
+		child, exists := node.children[labels[i]]
+		if !exists {
+			child = &trieNode{}
+			node.children[labels[i]] = child
+		}
+		node = child
+	}
+	if !node.exact && !node.subtree {
+		t.size++
+	}
+	if includeSubdomains {
+		node.subtree = true
+	} else {
+		node.exact = true
+	}
+}
+
+// match 主机是否被阻止，主机可带端口
+func (t *domainTrie) match(host string) bool {
+	host = normalizeBlocklistHost(host)
+	if host == "" {
+		return false
+	}
+	labels := strings.Split(host, ".")
+	node := t.root
+	for i := len(labels) - 1; i >= 0; i-- {
+		child, exists := node.children[labels[i]]
+		if !exists {
+			return false
+		}
+		node = child
+		if node.subtree {
+			return true
+		}
+	}
+	return node.exact
+}
+
+// normalizeBlocklistHost 去掉端口和末尾的点并转为小写
+func normalizeBlocklistHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// validBlocklistDomain 是否为可用于匹配的域名
+func validBlocklistDomain(domain string) bool {
+	if domain == "" || !strings.Contains(domain, ".") || net.ParseIP(domain) != nil {
+		return false
+	}
+	for _, c := range domain {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// hostsLocalNames hosts文件中指向本机的常见名称，不作为阻止项
+var hostsLocalNames = map[string]bool{
+	"localhost": true, "localhost.localdomain": true, "local": true, "broadcasthost": true,
+	"ip6-localhost": true, "ip6-loopback": true, "ip6-localnet": true, "ip6-mcastprefix": true,
+	"ip6-allnodes": true, "ip6-allrouters": true, "ip6-allhosts": true, "0.0.0.0": true,
+}
+
+// detectBlocklistFormat 根据前若干条有效行识别列表格式
+func detectBlocklistFormat(lines []string) string {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		if strings.HasPrefix(line, "||") || strings.HasPrefix(line, "@@") || strings.Contains(line, "##") {
+			return BlocklistFormatAdblock
+		}
+		if fields := strings.Fields(line); len(fields) >= 2 && net.ParseIP(fields[0]) != nil {
+			return BlocklistFormatHosts
+		}
+		return BlocklistFormatDomains
+	}
+	return BlocklistFormatDomains
+}
+
+// parseBlocklist 按格式解析列表，返回域名条目和跳过的行数
+func parseBlocklist(r io.Reader, format string) ([]blocklistEntry, int, string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, format, err
+	}
+
+	if format == "" || format == BlocklistFormatAuto {
+		format = detectBlocklistFormat(lines)
+	}
+
+	var parse func(line string) ([]blocklistEntry, bool)
+	switch format {
+	case BlocklistFormatHosts:
+		parse = parseHostsLine
+	case BlocklistFormatDomains:
+		parse = parseDomainLine
+	case BlocklistFormatAdblock:
+		parse = parseAdblockLine
+	default:
+		return nil, 0, format, fmt.Errorf("unknown blocklist format: %s", format)
+	}
+
+	entries := make([]blocklistEntry, 0, len(lines))
+	skipped := 0
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		parsed, ok := parse(line)
+		if !ok {
+			skipped++
+			continue
+		}
+		entries = append(entries, parsed...)
+	}
+	return entries, skipped, format, nil
+}
+
+// parseHostsLine 解析hosts文件行："IP 主机名 [主机名...] [# 注释]"
+func parseHostsLine(line string) ([]blocklistEntry, bool) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+		return nil, false
+	}
+
+	var entries []blocklistEntry
+	for _, name := range fields[1:] {
+		name = normalizeBlocklistHost(name)
+		if hostsLocalNames[name] {
+			continue
+		}
+		if validBlocklistDomain(name) {
+			entries = append(entries, blocklistEntry{domain: name})
+		}
+	}
+	return entries, true
+}
+
+// parseDomainLine 解析域名列表行，允许 *.example.com 或 .example.com 写法
+func parseDomainLine(line string) ([]blocklistEntry, bool) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	domain := strings.TrimLeft(normalizeBlocklistHost(line), "*.")
+	if !validBlocklistDomain(domain) {
+		return nil, false
+	}
+	return []blocklistEntry{{domain: domain, includeSubdomains: true}}, true
+}
+
+// parseAdblockLine 解析Adblock网络规则，只支持纯域名规则 ||example.com^（可带$important），
+// 例外规则、元素隐藏规则以及带路径或其他选项的规则无法按主机判断，予以跳过
+func parseAdblockLine(line string) ([]blocklistEntry, bool) {
+	if !strings.HasPrefix(line, "||") {
+		return nil, false
+	}
+	rule := strings.TrimPrefix(line, "||")
+	if i := strings.Index(rule, "$"); i >= 0 {
+		if options := rule[i+1:]; options != "important" {
+			return nil, false
+		}
+		rule = rule[:i]
+	}
+	rule = strings.TrimSuffix(rule, "^")
+	domain := normalizeBlocklistHost(rule)
+	if !validBlocklistDomain(domain) {
+		return nil, false
+	}
+	return []blocklistEntry{{domain: domain, includeSubdomains: true}}, true
+}
+
+// buildBlocklist 从读取器构建阻止列表
+func buildBlocklist(id, name, source, format string, r io.Reader) (*Blocklist, error) {
+	entries, skipped, format, err := parseBlocklist(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	trie := newDomainTrie()
+	for _, entry := range entries {
+		trie.insert(entry.domain, entry.includeSubdomains)
+	}
+
+	return &Blocklist{
+		ID:           id,
+		Name:         name,
+		Source:       source,
+		Format:       format,
+		Enabled:      true,
+		EntryCount:   trie.size,
+		SkippedCount: skipped,
+		LoadedAt:     time.Now(),
+		trie:         trie,
+		rule: &AllowBlockRule{
+			ID:      "blocklist:" + id,
+			Name:    name,
+			Type:    "block",
+			Enabled: true,
+		},
+	}, nil
+}
+
+// ImportBlocklist 从本地文件导入阻止列表，ID已存在时替换原列表并保留启用状态和统计
+func (abm *AllowBlockManager) ImportBlocklist(id, name, path, format string) (*Blocklist, error) {
+	if id == "" || strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("blocklist id and name are required")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blocklist: %v", err)
+	}
+	defer file.Close()
+
+	return abm.ImportBlocklistFromReader(id, name, path, format, file)
+}
+
+// ImportBlocklistFromReader 从读取器导入阻止列表
+func (abm *AllowBlockManager) ImportBlocklistFromReader(id, name, source, format string, r io.Reader) (*Blocklist, error) {
+	list, err := buildBlocklist(id, name, source, format, r)
+	if err != nil {
+		return nil, err
+	}
+
+	abm.rulesMutex.Lock()
+	defer abm.rulesMutex.Unlock()
+	if existing, exists := abm.blocklists[id]; exists {
+		list.Enabled = existing.Enabled
+		list.rule.BlockedCount = atomic.LoadInt64(&existing.rule.BlockedCount)
+	} else {
+		abm.blocklistIDs = append(abm.blocklistIDs, id)
+		sort.Strings(abm.blocklistIDs)
+	}
+	abm.blocklists[id] = list
+	return list, nil
+}
+
+// ReloadBlocklist 重新读取列表的源文件
+func (abm *AllowBlockManager) ReloadBlocklist(id string) (*Blocklist, error) {
+	abm.rulesMutex.RLock()
+	list, exists := abm.blocklists[id]
+	abm.rulesMutex.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("blocklist not found: %s", id)
+	}
+	return abm.ImportBlocklist(list.ID, list.Name, list.Source, list.Format)
+}
+
+// SetBlocklistEnabled 启用或停用阻止列表
+func (abm *AllowBlockManager) SetBlocklistEnabled(id string, enabled bool) error {
+	abm.rulesMutex.Lock()
+	defer abm.rulesMutex.Unlock()
+
+	list, exists := abm.blocklists[id]
+	if !exists {
+		return fmt.Errorf("blocklist not found: %s", id)
+	}
+	list.Enabled = enabled
+	return nil
+}
+
+// RemoveBlocklist 删除阻止列表
+func (abm *AllowBlockManager) RemoveBlocklist(id string) {
+	abm.rulesMutex.Lock()
+	defer abm.rulesMutex.Unlock()
+	if _, exists := abm.blocklists[id]; !exists {
+		return
+	}
+	delete(abm.blocklists, id)
+	index := sort.SearchStrings(abm.blocklistIDs, id)
+	abm.blocklistIDs = append(abm.blocklistIDs[:index], abm.blocklistIDs[index+1:]...)
+}
+
+// GetBlocklists 获取所有阻止列表，按名称排序
+func (abm *AllowBlockManager) GetBlocklists() []*Blocklist {
+	abm.rulesMutex.RLock()
+	defer abm.rulesMutex.RUnlock()
+
+	lists := make([]*Blocklist, 0, len(abm.blocklists))
+	for _, list := range abm.blocklists {
+		copied := *list
+		copied.BlockedCount = atomic.LoadInt64(&list.rule.BlockedCount)
+		lists = append(lists, &copied)
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Name < lists[j].Name })
+	return lists
+}
+
+// matchBlocklistsLocked 按ID顺序返回第一个包含该主机的已启用列表的阻止规则，调用方需持有rulesMutex
+func (abm *AllowBlockManager) matchBlocklistsLocked(host string) *AllowBlockRule {
+	for _, id := range abm.blocklistIDs {
+		list := abm.blocklists[id]
+		if list.Enabled && list.trie.match(host) {
+			return list.rule
+		}
+	}
+	return nil
+}
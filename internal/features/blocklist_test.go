@@ -0,0 +1,191 @@
+package features
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+func TestParseBlocklistFormats(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantFormat  string
+		wantEntries int
+		wantSkipped int
+		blocked     []string
+		allowed     []string
+	}{
+		{
+			name: "hosts",
+			content: `# comment
+127.0.0.1 localhost
+0.0.0.0 ads.example.com tracker.example.com # inline
+::1 ip6-localhost
+`,
+			wantFormat:  BlocklistFormatHosts,
+			wantEntries: 2,
+			blocked:     []string{"ads.example.com", "TRACKER.example.com:443"},
+			allowed:     []string{"sub.ads.example.com", "example.com", "localhost"},
+		},
+		{
+			name:        "domains",
+			content:     "# list\nads.example.com\n*.metrics.test\nnot a domain\n",
+			wantFormat:  BlocklistFormatDomains,
+			wantEntries: 2,
+			wantSkipped: 1,
+			blocked:     []string{"ads.example.com", "a.b.ads.example.com", "x.metrics.test", "metrics.test."},
+			allowed:     []string{"badads.example.com", "example.com"},
+		},
+		{
+			name: "adblock",
+			content: `[Adblock Plus 2.0]
+! Title: test
+||ads.example.com^
+||pixel.test^$important
+@@||good.ads.example.com^
+||cdn.test/banner.js
+||video.test^$third-party
+example.com##.banner
+`,
+			wantFormat:  BlocklistFormatAdblock,
+			wantEntries: 2,
+			wantSkipped: 4,
+			blocked:     []string{"ads.example.com", "good.ads.example.com", "pixel.test"},
+			allowed:     []string{"cdn.test", "video.test"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := buildBlocklist("l", tt.name, "", BlocklistFormatAuto, strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if list.Format != tt.wantFormat || list.EntryCount != tt.wantEntries || list.SkippedCount != tt.wantSkipped {
+				t.Errorf("format=%s entries=%d skipped=%d", list.Format, list.EntryCount, list.SkippedCount)
+			}
+			for _, host := range tt.blocked {
+				if !list.trie.match(host) {
+					t.Errorf("%s should be blocked", host)
+				}
+			}
+			for _, host := range tt.allowed {
+				if list.trie.match(host) {
+					t.Errorf("%s should not be blocked", host)
+				}
+			}
+		})
+	}
+
+	if _, err := buildBlocklist("l", "bad", "", "csv", strings.NewReader("a.test")); err == nil {
+		t.Error("unknown format should be rejected")
+	}
+}
+
+func TestLargeBlocklist(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 150000; i++ {
+		fmt.Fprintf(&sb, "0.0.0.0 host%d.tracker%d.test\n", i, i%1000)
+	}
+
+	manager := NewAllowBlockManager()
+	list, err := manager.ImportBlocklistFromReader("big", "big", "", BlocklistFormatHosts, strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.EntryCount != 150000 {
+		t.Fatalf("entries = %d", list.EntryCount)
+	}
+
+	start := time.Now()
+	for i := 0; i < 10000; i++ {
+		manager.CheckRequest(&proxycore.Flow{Method: "GET", Domain: fmt.Sprintf("host%d.tracker%d.test", i, i%1000), URL: "http://x/"})
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("10k lookups took %v", elapsed)
+	}
+	if allowed, _ := manager.CheckRequest(&proxycore.Flow{Method: "GET", Domain: "host149999.tracker999.test", URL: "http://x/"}); allowed {
+		t.Error("last entry should be blocked")
+	}
+}
+
+func TestBlocklistWithRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ads.txt")
+	os.WriteFile(path, []byte("||ads.example.com^\n"), 0644)
+
+	manager := NewAllowBlockManager()
+	if _, err := manager.ImportBlocklist("ads", "EasyList", path, BlocklistFormatAuto); err != nil {
+		t.Fatal(err)
+	}
+	flow := func(host string) *proxycore.Flow {
+		return &proxycore.Flow{Method: "GET", Scheme: "https", Domain: host, URL: "https://" + host + "/"}
+	}
+
+	allowed, rule := manager.CheckRequest(flow("x.ads.example.com"))
+	if allowed || rule == nil || rule.Name != "EasyList" {
+		t.Fatalf("expected block by list, got allowed=%v rule=%v", allowed, rule)
+	}
+	if decided, allowed, _ := manager.CheckConnect(flow("x.ads.example.com:443")); !decided || allowed {
+		t.Error("listed host should be blocked at CONNECT")
+	}
+
+	// 允许规则作为阻止列表的例外
+	manager.AddRule(&AllowBlockRule{ID: "a", Name: "ok", Type: "allow", URLPattern: "ok.ads.example.com", Enabled: true})
+	if allowed, _ := manager.CheckRequest(flow("ok.ads.example.com")); !allowed {
+		t.Error("allow rule should override blocklist")
+	}
+	if decided, _, _ := manager.CheckConnect(flow("x.ads.example.com:443")); decided {
+		t.Error("URL allow rules should defer the CONNECT decision in mixed mode")
+	}
+
+	manager.recordDecision(false, rule)
+	manager.SetBlocklistEnabled("ads", false)
+	if allowed, _ := manager.CheckRequest(flow("x.ads.example.com")); !allowed {
+		t.Error("disabled list should not block")
+	}
+
+	// 重新加载文件，保留启用状态和统计
+	os.WriteFile(path, []byte("||ads.example.com^\n||metrics.test^\n"), 0644)
+	if _, err := manager.ReloadBlocklist("ads"); err != nil {
+		t.Fatal(err)
+	}
+	lists := manager.GetBlocklists()
+	if len(lists) != 1 || lists[0].EntryCount != 2 || lists[0].Enabled || lists[0].BlockedCount != 1 {
+		t.Errorf("unexpected lists after reload: %+v", lists[0])
+	}
+
+	manager.RemoveBlocklist("ads")
+	if len(manager.GetBlocklists()) != 0 {
+		t.Error("list should be removed")
+	}
+	if _, err := manager.ImportBlocklist("x", "missing", filepath.Join(t.TempDir(), "none"), ""); err == nil {
+		t.Error("missing file should fail")
+	}
+
+	// 多个列表包含同一主机时，总是由ID最小的列表阻止
+	overlap := NewAllowBlockManager()
+	for _, id := range []string{"m", "c", "x", "a", "q"} {
+		overlap.ImportBlocklistFromReader(id, "list-"+id, "", "", strings.NewReader("tracker.test"))
+	}
+	overlap.RemoveBlocklist("a")
+	for i := 0; i < 20; i++ {
+		if _, rule := overlap.CheckRequest(flow("tracker.test")); rule == nil || rule.Name != "list-c" {
+			t.Fatalf("expected list-c to block, got %v", rule)
+		}
+	}
+
+	whitelist := NewAllowBlockManager()
+	whitelist.SetMode("whitelist")
+	whitelist.ImportBlocklistFromReader("ads", "ads", "", "", strings.NewReader("ads.example.com"))
+	whitelist.AddRule(&AllowBlockRule{ID: "a", Name: "all", Type: "allow", HostPattern: "*", Enabled: true})
+	if allowed, _ := whitelist.CheckRequest(&proxycore.Flow{Method: http.MethodGet, Domain: "ads.example.com", URL: "http://ads.example.com/"}); !allowed {
+		t.Error("blocklists are ignored in whitelist mode")
+	}
+}
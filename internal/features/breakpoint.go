@@ -1,11 +1,18 @@
 package features
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"ProxyWoman/internal/proxycore"
@@ -21,6 +28,53 @@ type BreakpointRule struct {
 	IsRegex     bool   `json:"isRegex"`
 	BreakOnRequest  bool `json:"breakOnRequest"`
 	BreakOnResponse bool `json:"breakOnResponse"`
+	TimeoutSeconds  int    `json:"timeoutSeconds"` // 暂停超时，0表示使用默认值
+	TimeoutAction   string `json:"timeoutAction"`  // 超时后的处理："continue"（原样继续，默认）或 "fail"（返回504）
+	Condition       string `json:"condition"`      // 触发条件，为空表示不限制
+	ConditionType   string `json:"conditionType"`  // 条件类型："query"（流量查询语法，默认）或 "js"（JS谓词）
+	HitCount        int    `json:"hitCount"`       // 只在第N次满足条件时暂停，0表示每次都暂停
+	RequestHits     int64  `json:"requestHits"`    // 请求阶段满足条件的次数，不持久化
+	ResponseHits    int64  `json:"responseHits"`   // 响应阶段满足条件的次数，不持久化
+}
+
+// 断点超时处理方式
+const (
+	TimeoutContinue = "continue"
+	TimeoutFail     = "fail"
+)
+
+// 会话数达到上限后的处理方式
+const (
+	OverflowQueue = "queue" // 排队等待空位
+	OverflowPass  = "pass"  // 不暂停，直接放行
+)
+
+// defaultBreakpointTimeout 规则未设置超时时的默认暂停时长
+const defaultBreakpointTimeout = 5 * time.Minute
+
+// ErrBreakpointTimeout 断点超时且规则要求失败
+var ErrBreakpointTimeout = errors.New("breakpoint timeout")
+
+// ErrClientDisconnected 断点暂停期间客户端断开了连接
+var ErrClientDisconnected = errors.New("client disconnected while paused at breakpoint")
+
+// pauseAllRule 全局暂停时使用的内置规则
+var pauseAllRule = &BreakpointRule{
+	ID:             "pause-all",
+	Name:           "Pause all",
+	Method:         "*",
+	Enabled:        true,
+	BreakOnRequest: true,
+	TimeoutAction:  TimeoutContinue,
+}
+
+// BreakpointStatus 断点运行状态
+type BreakpointStatus struct {
+	Held     int    `json:"held"`
+	Queued   int    `json:"queued"`
+	MaxHeld  int    `json:"maxHeld"`
+	Overflow string `json:"overflow"`
+	Paused   bool   `json:"paused"`
 }
 
 // BreakpointSession 断点会话
@@ -30,10 +84,40 @@ type BreakpointSession struct {
 	Rule        *BreakpointRule        `json:"rule"`
 	Type        string                 `json:"type"` // "request" or "response"
 	StartTime   time.Time              `json:"startTime"`
-	ResponseChan chan *http.Response   `json:"-"`
+	ResumeChan  chan *BreakpointAction `json:"-"`
 	ErrorChan   chan error             `json:"-"`
-	ModifiedRequest *http.Request      `json:"-"`
-	ModifiedResponse *http.Response    `json:"-"`
+}
+
+// 断点操作类型
+const (
+	BreakpointResume  = "resume"  // 继续（可附带修改）
+	BreakpointRespond = "respond" // 不请求服务器，直接返回用户编写的响应
+	BreakpointAbort   = "abort"   // 断开连接，模拟网络故障
+	BreakpointDelay   = "delay"   // 延迟后继续（可附带修改）
+
+	breakpointTimeout = "timeout" // 超时，仅用于Flow上的记录
+)
+
+// maxBreakpointDelay 延迟操作的最大时长
+const maxBreakpointDelay = 10 * time.Minute
+
+// BreakpointAction 对暂停中的断点会话执行的操作
+type BreakpointAction struct {
+	Type    string          `json:"type"`
+	Edit    *BreakpointEdit `json:"edit,omitempty"` // resume/delay时应用的修改，respond时作为返回的响应
+	DelayMs int             `json:"delayMs,omitempty"`
+
+	timedOut bool // 由超时策略产生，而非用户操作
+}
+
+// BreakpointEdit 断点编辑内容，由前端在恢复断点时提交。
+// 零值字段表示不修改；Headers非nil时整体替换请求头/响应头
+type BreakpointEdit struct {
+	Method     string            `json:"method,omitempty"`     // 仅请求阶段
+	URL        string            `json:"url,omitempty"`        // 仅请求阶段
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       *string           `json:"body,omitempty"`       // nil表示不修改
+	StatusCode int               `json:"statusCode,omitempty"` // 仅响应阶段
 }
 
 // BreakpointStorage 断点存储接口
@@ -47,19 +131,31 @@ type BreakpointStorage interface {
 // BreakpointManager 断点管理器
 type BreakpointManager struct {
 	rules        map[string]*BreakpointRule
+	conditions   map[string]*breakpointCondition // 规则ID -> 编译后的条件，由rulesMutex保护
 	sessions     map[string]*BreakpointSession
 	rulesMutex   sync.RWMutex
 	sessionsMutex sync.RWMutex
 	eventHandler func(session *BreakpointSession)
 	storage      BreakpointStorage
+
+	// 并发暂停限制与全局暂停，均由sessionsMutex保护
+	maxHeld   int
+	overflow  string
+	queued    int
+	slotFreed chan struct{} // 有会话结束时关闭并替换，用于唤醒排队的请求
+	paused    bool
 }
 
 // NewBreakpointManager 创建新的断点管理器
 func NewBreakpointManager(storage BreakpointStorage) *BreakpointManager {
 	manager := &BreakpointManager{
 		rules:    make(map[string]*BreakpointRule),
+		conditions: make(map[string]*breakpointCondition),
 		sessions: make(map[string]*BreakpointSession),
 		storage:  storage,
+		maxHeld:   20,
+		overflow:  OverflowQueue,
+		slotFreed: make(chan struct{}),
 	}
 
 	// 从数据库加载规则
@@ -84,7 +180,13 @@ func (bm *BreakpointManager) loadRulesFromStorage() {
 	defer bm.rulesMutex.Unlock()
 
 	for _, rule := range rules {
+		condition, err := compileCondition(rule.ConditionType, rule.Condition)
+		if err != nil {
+			fmt.Printf("Breakpoint rule %s: %v\n", rule.ID, err)
+			rule.Enabled = false
+		}
 		bm.rules[rule.ID] = rule
+		bm.setConditionLocked(rule.ID, condition)
 	}
 }
 
@@ -95,6 +197,22 @@ func (bm *BreakpointManager) SetEventHandler(handler func(session *BreakpointSes
 
 // AddRule 添加断点规则
 func (bm *BreakpointManager) AddRule(rule *BreakpointRule) error {
+	if rule.TimeoutSeconds < 0 {
+		return fmt.Errorf("invalid timeout: %d", rule.TimeoutSeconds)
+	}
+	switch rule.TimeoutAction {
+	case "", TimeoutContinue, TimeoutFail:
+	default:
+		return fmt.Errorf("unknown timeout action: %s", rule.TimeoutAction)
+	}
+	if rule.HitCount < 0 {
+		return fmt.Errorf("invalid hit count: %d", rule.HitCount)
+	}
+	condition, err := compileCondition(rule.ConditionType, rule.Condition)
+	if err != nil {
+		return err
+	}
+
 	bm.rulesMutex.Lock()
 	defer bm.rulesMutex.Unlock()
 
@@ -106,9 +224,53 @@ func (bm *BreakpointManager) AddRule(rule *BreakpointRule) error {
 	}
 
 	bm.rules[rule.ID] = rule
+	bm.setConditionLocked(rule.ID, condition)
 	return nil
 }
 
+// setConditionLocked 保存规则编译后的条件，调用方需持有rulesMutex
+func (bm *BreakpointManager) setConditionLocked(ruleID string, condition *breakpointCondition) {
+	if condition == nil {
+		delete(bm.conditions, ruleID)
+		return
+	}
+	bm.conditions[ruleID] = condition
+}
+
+// ResetHits 清零规则的命中计数，ruleID为空时清零所有规则
+func (bm *BreakpointManager) ResetHits(ruleID string) error {
+	bm.rulesMutex.RLock()
+	defer bm.rulesMutex.RUnlock()
+
+	if ruleID == "" {
+		for _, rule := range bm.rules {
+			rule.resetHits()
+		}
+		return nil
+	}
+
+	rule, exists := bm.rules[ruleID]
+	if !exists {
+		return fmt.Errorf("breakpoint rule not found: %s", ruleID)
+	}
+	rule.resetHits()
+	return nil
+}
+
+// resetHits 清零两个阶段的命中计数
+func (rule *BreakpointRule) resetHits() {
+	atomic.StoreInt64(&rule.RequestHits, 0)
+	atomic.StoreInt64(&rule.ResponseHits, 0)
+}
+
+// hitCounter 返回对应阶段的命中计数
+func (rule *BreakpointRule) hitCounter(breakType string) *int64 {
+	if breakType == "response" {
+		return &rule.ResponseHits
+	}
+	return &rule.RequestHits
+}
+
 // RemoveRule 移除断点规则
 func (bm *BreakpointManager) RemoveRule(ruleID string) error {
 	bm.rulesMutex.Lock()
@@ -122,6 +284,7 @@ func (bm *BreakpointManager) RemoveRule(ruleID string) error {
 	}
 
 	delete(bm.rules, ruleID)
+	delete(bm.conditions, ruleID)
 	return nil
 }
 
@@ -146,24 +309,104 @@ func (bm *BreakpointManager) UpdateRuleStatus(ruleID string, enabled bool) error
 	return nil
 }
 
-// GetAllRules 获取所有断点规则
+// GetAllRules 按ID顺序获取所有断点规则的副本，命中计数在匹配时并发更新，需原子读取
 func (bm *BreakpointManager) GetAllRules() []*BreakpointRule {
 	bm.rulesMutex.RLock()
 	defer bm.rulesMutex.RUnlock()
 	
 	rules := make([]*BreakpointRule, 0, len(bm.rules))
-	for _, rule := range bm.rules {
-		rules = append(rules, rule)
+	for _, rule := range bm.sortedRulesLocked() {
+		copied := *rule
+		copied.RequestHits = atomic.LoadInt64(&rule.RequestHits)
+		copied.ResponseHits = atomic.LoadInt64(&rule.ResponseHits)
+		rules = append(rules, &copied)
 	}
 	return rules
 }
 
 // CheckBreakpoint 检查是否需要断点
 func (bm *BreakpointManager) CheckBreakpoint(flow *proxycore.Flow, breakType string) (*BreakpointSession, bool) {
+	return bm.HoldBreakpoint(context.Background(), flow, breakType)
+}
+
+// HoldBreakpoint 检查是否需要断点，需要时创建暂停会话。
+// 暂停会话数达到上限时按溢出策略排队或直接放行；排队期间ctx结束则放行
+func (bm *BreakpointManager) HoldBreakpoint(ctx context.Context, flow *proxycore.Flow, breakType string) (*BreakpointSession, bool) {
+	rule := bm.matchRule(flow, breakType)
+	if rule == nil {
+		return nil, false
+	}
+
+	queued := false
+	defer func() {
+		if queued {
+			bm.sessionsMutex.Lock()
+			bm.queued--
+			bm.sessionsMutex.Unlock()
+		}
+	}()
+
+	for {
+		bm.sessionsMutex.Lock()
+		if bm.maxHeld <= 0 || len(bm.sessions) < bm.maxHeld {
+			break // 持有锁进入创建会话
+		}
+		if bm.overflow == OverflowPass {
+			bm.sessionsMutex.Unlock()
+			flow.AddTag("breakpoint-overflow")
+			return nil, false
+		}
+		if !queued {
+			queued = true
+			bm.queued++
+		}
+		wait := bm.slotFreed
+		bm.sessionsMutex.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+
+	// 创建断点会话
+	session := &BreakpointSession{
+		ID:           fmt.Sprintf("bp_%d", time.Now().UnixNano()),
+		Flow:         flow,
+		Rule:         rule,
+		Type:         breakType,
+		StartTime:    time.Now(),
+		ResumeChan:   make(chan *BreakpointAction, 1),
+		ErrorChan:    make(chan error, 1),
+	}
+	bm.sessions[session.ID] = session
+	bm.sessionsMutex.Unlock()
+	
+	// 通知前端
+	if bm.eventHandler != nil {
+		go bm.eventHandler(session)
+	}
+	
+	return session, true
+}
+
+// matchRule 查找命中的断点规则，全局暂停时所有请求都命中内置规则
+func (bm *BreakpointManager) matchRule(flow *proxycore.Flow, breakType string) *BreakpointRule {
+	bm.sessionsMutex.RLock()
+	paused := bm.paused
+	bm.sessionsMutex.RUnlock()
+	if paused && breakType == "request" {
+		return pauseAllRule
+	}
+
 	bm.rulesMutex.RLock()
 	defer bm.rulesMutex.RUnlock()
-	
-	for _, rule := range bm.rules {
+
+	// 按ID顺序检查所有规则，每个满足条件的规则都计入命中次数，再由第一个达到次数的规则暂停，
+	// 这样重叠的规则各自的计数不受彼此影响
+	var hit *BreakpointRule
+	for _, rule := range bm.sortedRulesLocked() {
 		if !rule.Enabled {
 			continue
 		}
@@ -186,31 +429,93 @@ func (bm *BreakpointManager) CheckBreakpoint(flow *proxycore.Flow, breakType str
 		if err != nil || !matched {
 			continue
 		}
-		
-		// 创建断点会话
-		session := &BreakpointSession{
-			ID:           fmt.Sprintf("bp_%d", time.Now().UnixNano()),
-			Flow:         flow,
-			Rule:         rule,
-			Type:         breakType,
-			StartTime:    time.Now(),
-			ResponseChan: make(chan *http.Response, 1),
-			ErrorChan:    make(chan error, 1),
+
+		// 检查触发条件
+		if condition := bm.conditions[rule.ID]; condition != nil && !condition.match(flow) {
+			continue
 		}
-		
-		bm.sessionsMutex.Lock()
-		bm.sessions[session.ID] = session
-		bm.sessionsMutex.Unlock()
-		
-		// 通知前端
-		if bm.eventHandler != nil {
-			go bm.eventHandler(session)
+
+		// 检查命中次数，只在第N次满足条件时暂停
+		hits := atomic.AddInt64(rule.hitCounter(breakType), 1)
+		if rule.HitCount > 0 && hits != int64(rule.HitCount) {
+			continue
+		}
+		if hit == nil {
+			hit = rule
 		}
-		
-		return session, true
 	}
 	
-	return nil, false
+	return hit
+}
+
+// sortedRulesLocked 按ID排序的规则，调用方需持有rulesMutex
+func (bm *BreakpointManager) sortedRulesLocked() []*BreakpointRule {
+	rules := make([]*BreakpointRule, 0, len(bm.rules))
+	for _, rule := range bm.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// removeSessionLocked 移除会话并唤醒排队的请求，调用方需持有sessionsMutex
+func (bm *BreakpointManager) removeSessionLocked(sessionID string) {
+	delete(bm.sessions, sessionID)
+	close(bm.slotFreed)
+	bm.slotFreed = make(chan struct{})
+}
+
+// SetConcurrencyLimit 设置同时暂停的会话上限（0表示不限制）及溢出策略
+func (bm *BreakpointManager) SetConcurrencyLimit(maxHeld int, overflow string) error {
+	if maxHeld < 0 {
+		return fmt.Errorf("invalid session limit: %d", maxHeld)
+	}
+	switch overflow {
+	case OverflowQueue, OverflowPass:
+	default:
+		return fmt.Errorf("unknown overflow mode: %s", overflow)
+	}
+
+	bm.sessionsMutex.Lock()
+	defer bm.sessionsMutex.Unlock()
+
+	bm.maxHeld = maxHeld
+	bm.overflow = overflow
+	// 上限可能变大，唤醒排队的请求重新检查
+	close(bm.slotFreed)
+	bm.slotFreed = make(chan struct{})
+	return nil
+}
+
+// PauseAll 全局暂停：此后所有请求都在请求阶段暂停
+func (bm *BreakpointManager) PauseAll() {
+	bm.sessionsMutex.Lock()
+	defer bm.sessionsMutex.Unlock()
+	bm.paused = true
+}
+
+// ReleaseAll 取消全局暂停并原样放行所有暂停中的会话，返回放行的数量
+func (bm *BreakpointManager) ReleaseAll() int {
+	bm.sessionsMutex.Lock()
+	bm.paused = false
+	bm.sessionsMutex.Unlock()
+
+	count, _ := bm.ResumeAllMatching("", nil)
+	return count
+}
+
+// GetStatus 获取断点运行状态
+func (bm *BreakpointManager) GetStatus() BreakpointStatus {
+	bm.sessionsMutex.RLock()
+	defer bm.sessionsMutex.RUnlock()
+
+	return BreakpointStatus{
+		Held:     len(bm.sessions),
+		Queued:   bm.queued,
+		MaxHeld:  bm.maxHeld,
+		Overflow: bm.overflow,
+		Paused:   bm.paused,
+	}
 }
 
 // matchURL 匹配URL
@@ -226,8 +531,17 @@ func (bm *BreakpointManager) matchURL(url string, rule *BreakpointRule) (bool, e
 	}
 }
 
-// ResumeBreakpoint 恢复断点
-func (bm *BreakpointManager) ResumeBreakpoint(sessionID string, modifiedRequest *http.Request, modifiedResponse *http.Response) error {
+// ResumeBreakpoint 恢复断点，edit为nil时原样放行
+func (bm *BreakpointManager) ResumeBreakpoint(sessionID string, edit *BreakpointEdit) error {
+	return bm.ApplyAction(sessionID, &BreakpointAction{Type: BreakpointResume, Edit: edit})
+}
+
+// ApplyAction 对暂停中的断点会话执行操作
+func (bm *BreakpointManager) ApplyAction(sessionID string, action *BreakpointAction) error {
+	if action == nil {
+		action = &BreakpointAction{Type: BreakpointResume}
+	}
+
 	bm.sessionsMutex.Lock()
 	defer bm.sessionsMutex.Unlock()
 	
@@ -235,42 +549,289 @@ func (bm *BreakpointManager) ResumeBreakpoint(sessionID string, modifiedRequest
 	if !exists {
 		return fmt.Errorf("breakpoint session not found: %s", sessionID)
 	}
-	
-	session.ModifiedRequest = modifiedRequest
-	session.ModifiedResponse = modifiedResponse
+
+	if err := validateBreakpointAction(session.Type, action); err != nil {
+		return err
+	}
 	
 	// 发送恢复信号
-	if modifiedResponse != nil {
-		session.ResponseChan <- modifiedResponse
-	} else {
-		session.ResponseChan <- nil
-	}
+	session.ResumeChan <- action
 	
 	// 清理会话
-	delete(bm.sessions, sessionID)
+	bm.removeSessionLocked(sessionID)
 	
 	return nil
 }
 
-// CancelBreakpoint 取消断点
-func (bm *BreakpointManager) CancelBreakpoint(sessionID string) error {
+// ResumeAllMatching 以同一操作恢复指定规则命中的所有断点会话，ruleID为空时恢复全部，返回恢复的数量
+func (bm *BreakpointManager) ResumeAllMatching(ruleID string, action *BreakpointAction) (int, error) {
+	if action == nil {
+		action = &BreakpointAction{Type: BreakpointResume}
+	}
+
 	bm.sessionsMutex.Lock()
 	defer bm.sessionsMutex.Unlock()
-	
-	session, exists := bm.sessions[sessionID]
-	if !exists {
-		return fmt.Errorf("breakpoint session not found: %s", sessionID)
+
+	// 先全部校验，避免只恢复了一部分
+	matched := make([]*BreakpointSession, 0)
+	for _, session := range bm.sessions {
+		if ruleID != "" && (session.Rule == nil || session.Rule.ID != ruleID) {
+			continue
+		}
+		if err := validateBreakpointAction(session.Type, action); err != nil {
+			return 0, err
+		}
+		matched = append(matched, session)
+	}
+
+	for _, session := range matched {
+		session.ResumeChan <- action
+		bm.removeSessionLocked(session.ID)
+	}
+	return len(matched), nil
+}
+
+// validateBreakpointAction 校验断点操作
+func validateBreakpointAction(breakType string, action *BreakpointAction) error {
+	switch action.Type {
+	case BreakpointResume:
+		return validateBreakpointEdit(breakType, action.Edit)
+	case BreakpointDelay:
+		if action.DelayMs <= 0 || time.Duration(action.DelayMs)*time.Millisecond > maxBreakpointDelay {
+			return fmt.Errorf("invalid delay: %dms", action.DelayMs)
+		}
+		return validateBreakpointEdit(breakType, action.Edit)
+	case BreakpointRespond:
+		// 返回的响应在任一阶段都只包含状态码、响应头和响应体
+		return validateBreakpointEdit("response", action.Edit)
+	case BreakpointAbort:
+		return nil
+	default:
+		return fmt.Errorf("unknown breakpoint action: %s", action.Type)
+	}
+}
+
+// validateBreakpointEdit 校验编辑内容与断点阶段是否匹配
+func validateBreakpointEdit(breakType string, edit *BreakpointEdit) error {
+	if edit == nil {
+		return nil
+	}
+	if breakType == "request" {
+		if edit.StatusCode != 0 {
+			return fmt.Errorf("status code can only be edited in response breakpoints")
+		}
+		if edit.URL != "" {
+			target, err := url.Parse(edit.URL)
+			if err != nil || !target.IsAbs() || target.Host == "" {
+				return fmt.Errorf("invalid URL: %s", edit.URL)
+			}
+		}
+		return nil
+	}
+
+	if edit.Method != "" || edit.URL != "" {
+		return fmt.Errorf("method and URL can only be edited in request breakpoints")
+	}
+	if edit.StatusCode != 0 && (edit.StatusCode < 100 || edit.StatusCode > 999) {
+		return fmt.Errorf("invalid status code: %d", edit.StatusCode)
 	}
-	
-	// 发送错误信号
-	session.ErrorChan <- fmt.Errorf("breakpoint cancelled")
-	
-	// 清理会话
-	delete(bm.sessions, sessionID)
-	
 	return nil
 }
 
+// applyRequestEdit 把编辑应用到即将发往上游的请求和Flow。
+// 请求体已被代理服务器读取到Flow中，上游请求体以flow.Request.Body为准
+func applyRequestEdit(flow *proxycore.Flow, r *http.Request, edit *BreakpointEdit) {
+	if edit == nil {
+		return
+	}
+
+	if edit.Method != "" {
+		r.Method = edit.Method
+		flow.Method = edit.Method
+		flow.Request.Method = edit.Method
+	}
+
+	if edit.URL != "" {
+		target, _ := url.Parse(edit.URL)
+		r.URL = target
+		r.Host = target.Host
+		flow.URL = target.String()
+		flow.Request.URL = target.String()
+		flow.Domain = target.Host
+		flow.Path = target.Path
+	}
+
+	if edit.Headers != nil {
+		r.Header = make(http.Header, len(edit.Headers))
+		flow.Request.Headers = make(map[string]string, len(edit.Headers))
+		for name, value := range edit.Headers {
+			if strings.EqualFold(name, "Host") {
+				r.Host = value
+				continue
+			}
+			r.Header.Set(name, value)
+			flow.Request.Headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+
+	if edit.Body != nil {
+		body := []byte(*edit.Body)
+		flow.SetRequestBody(body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Del("Content-Length")
+	}
+}
+
+// mockResponse 按编辑内容构造不经服务器的响应，未指定状态码时为200
+func mockResponse(edit *BreakpointEdit, req *http.Request) (*http.Response, []byte) {
+	if edit == nil {
+		edit = &BreakpointEdit{}
+	}
+
+	statusCode := edit.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	var body []byte
+	if edit.Body != nil {
+		body = []byte(*edit.Body)
+	}
+
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header, len(edit.Headers)),
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		Request:       req,
+	}
+	for name, value := range edit.Headers {
+		resp.Header.Set(name, value)
+	}
+	resp.Header.Del("Content-Length")
+	return resp, body
+}
+
+// recordAction 在Flow上记录断点操作
+func recordAction(flow *proxycore.Flow, session *BreakpointSession, action *BreakpointAction) {
+	record := proxycore.BreakpointRecord{
+		Phase:   session.Type,
+		Action:  action.Type,
+		Edited:  action.Edit != nil,
+		DelayMs: action.DelayMs,
+		HeldMs:  time.Since(session.StartTime).Milliseconds(),
+		At:      time.Now(),
+	}
+	if action.timedOut {
+		record.Action = breakpointTimeout
+		flow.AddTag("breakpoint-timeout")
+	}
+	if session.Rule != nil {
+		record.RuleID = session.Rule.ID
+		record.RuleName = session.Rule.Name
+	}
+	flow.BreakpointActions = append(flow.BreakpointActions, record)
+}
+
+// resolveWait 把等待结果转换为要执行的操作：超时失败时返回504响应，客户端断开时中止连接
+func resolveWait(action *BreakpointAction, err error) (*BreakpointAction, error) {
+	switch {
+	case err == nil:
+		return action, nil
+	case errors.Is(err, ErrBreakpointTimeout):
+		body := "Request timed out while paused at a breakpoint"
+		return &BreakpointAction{
+			Type: BreakpointRespond,
+			Edit: &BreakpointEdit{
+				StatusCode: http.StatusGatewayTimeout,
+				Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+				Body:       &body,
+			},
+			timedOut: true,
+		}, nil
+	case errors.Is(err, ErrClientDisconnected):
+		return nil, proxycore.ErrAbortConnection
+	}
+	return nil, err
+}
+
+// waitDelay 执行延迟操作，请求被客户端取消时提前返回
+func waitDelay(ctx context.Context, action *BreakpointAction) error {
+	if action.Type != BreakpointDelay {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(action.DelayMs) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// applyResponseEdit 基于原始响应和编辑内容构造返回给客户端的响应，并同步到Flow
+func applyResponseEdit(flow *proxycore.Flow, resp *http.Response, edit *BreakpointEdit) *http.Response {
+	if edit == nil {
+		return resp
+	}
+
+	var body []byte
+	if flow.Response != nil {
+		body = flow.Response.Body
+	}
+
+	modified := &http.Response{
+		Status:        resp.Status,
+		StatusCode:    resp.StatusCode,
+		Proto:         resp.Proto,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
+		Header:        resp.Header.Clone(),
+		ContentLength: resp.ContentLength,
+		Request:       resp.Request,
+	}
+
+	if edit.StatusCode != 0 {
+		modified.StatusCode = edit.StatusCode
+		modified.Status = fmt.Sprintf("%d %s", edit.StatusCode, http.StatusText(edit.StatusCode))
+	}
+
+	if edit.Headers != nil {
+		modified.Header = make(http.Header, len(edit.Headers))
+		for name, value := range edit.Headers {
+			modified.Header.Set(name, value)
+		}
+	}
+
+	if edit.Body != nil {
+		body = []byte(*edit.Body)
+		modified.ContentLength = int64(len(body))
+		modified.Header.Del("Content-Length")
+		if edit.Headers == nil {
+			// 编辑的是解码后的文本，原始压缩编码不再适用
+			modified.Header.Del("Content-Encoding")
+		}
+	}
+	modified.Body = io.NopCloser(bytes.NewReader(body))
+
+	// SetResponse会重新计时，保留原始的响应耗时
+	endTime, duration := flow.EndTime, flow.Duration
+	flow.SetResponse(modified, body)
+	flow.EndTime, flow.Duration = endTime, duration
+
+	return modified
+}
+
+// CancelBreakpoint 取消断点，等同于断开连接
+func (bm *BreakpointManager) CancelBreakpoint(sessionID string) error {
+	return bm.ApplyAction(sessionID, &BreakpointAction{Type: BreakpointAbort})
+}
+
 // GetActiveBreakpoints 获取活跃的断点会话
 func (bm *BreakpointManager) GetActiveBreakpoints() []*BreakpointSession {
 	bm.sessionsMutex.RLock()
@@ -283,18 +844,51 @@ func (bm *BreakpointManager) GetActiveBreakpoints() []*BreakpointSession {
 	return sessions
 }
 
-// WaitForBreakpoint 等待断点恢复
-func (bm *BreakpointManager) WaitForBreakpoint(session *BreakpointSession, timeout time.Duration) (*http.Response, error) {
+// WaitForBreakpoint 等待断点恢复，返回前端提交的操作。
+// 超时按规则处理：continue时返回timeout操作原样继续，fail时返回ErrBreakpointTimeout；
+// ctx结束（客户端断开）时清理会话并返回ErrClientDisconnected
+func (bm *BreakpointManager) WaitForBreakpoint(ctx context.Context, session *BreakpointSession) (*BreakpointAction, error) {
+	timeout := defaultBreakpointTimeout
+	if session.Rule != nil && session.Rule.TimeoutSeconds > 0 {
+		timeout = time.Duration(session.Rule.TimeoutSeconds) * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
 	select {
-	case response := <-session.ResponseChan:
-		return response, nil
+	case action := <-session.ResumeChan:
+		return action, nil
 	case err := <-session.ErrorChan:
 		return nil, err
-	case <-time.After(timeout):
-		// 超时，自动恢复
-		bm.sessionsMutex.Lock()
-		delete(bm.sessions, session.ID)
-		bm.sessionsMutex.Unlock()
-		return nil, fmt.Errorf("breakpoint timeout")
+	case <-timer.C:
+		if action, resumed := bm.expireSession(session); resumed {
+			return action, nil
+		}
+		if session.Rule != nil && session.Rule.TimeoutAction == TimeoutFail {
+			return nil, ErrBreakpointTimeout
+		}
+		return &BreakpointAction{Type: BreakpointResume, timedOut: true}, nil
+	case <-ctx.Done():
+		if action, resumed := bm.expireSession(session); resumed {
+			return action, nil
+		}
+		return nil, ErrClientDisconnected
+	}
+}
+
+// expireSession 移除未被处理的会话；若会话已在同一时刻被恢复，返回该操作
+func (bm *BreakpointManager) expireSession(session *BreakpointSession) (*BreakpointAction, bool) {
+	bm.sessionsMutex.Lock()
+	defer bm.sessionsMutex.Unlock()
+
+	if _, exists := bm.sessions[session.ID]; exists {
+		bm.removeSessionLocked(session.ID)
+		return nil, false
+	}
+	select {
+	case action := <-session.ResumeChan:
+		return action, true
+	default:
+		return nil, false
 	}
 }
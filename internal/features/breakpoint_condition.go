@@ -0,0 +1,139 @@
+package features
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+// 断点条件类型
+const (
+	ConditionQuery = "query" // 流量查询语法，如 status:5xx header.X-Debug=1
+	ConditionJS    = "js"    // JS谓词，如 flow.status >= 500 && flow.json.code != 0
+)
+
+// conditionEvalTimeout JS条件的最长执行时间
+const conditionEvalTimeout = 100 * time.Millisecond
+
+// breakpointCondition 编译后的断点条件
+type breakpointCondition struct {
+	query   *proxycore.FlowQuery
+	program *goja.Program
+	vm      *goja.Runtime
+	vmMutex sync.Mutex
+}
+
+// compileCondition 编译断点条件，condition为空时返回nil
+func compileCondition(conditionType, condition string) (*breakpointCondition, error) {
+	condition = strings.TrimSpace(condition)
+	if condition == "" {
+		return nil, nil
+	}
+
+	switch conditionType {
+	case "", ConditionQuery:
+		query, err := proxycore.ParseFlowQuery(condition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition: %v", err)
+		}
+		return &breakpointCondition{query: query}, nil
+	case ConditionJS:
+		// 含return时按函数体处理，否则按表达式处理
+		source := "(" + condition + ")"
+		if strings.Contains(condition, "return") {
+			source = "(function(){\n" + condition + "\n})()"
+		}
+		program, err := goja.Compile("condition", source, true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition: %v", err)
+		}
+		return &breakpointCondition{program: program, vm: goja.New()}, nil
+	default:
+		return nil, fmt.Errorf("unknown condition type: %s", conditionType)
+	}
+}
+
+// match 判断Flow是否满足条件，JS执行出错或超时视为不满足
+func (c *breakpointCondition) match(flow *proxycore.Flow) bool {
+	if c.query != nil {
+		return c.query.Match(flow)
+	}
+
+	c.vmMutex.Lock()
+	defer c.vmMutex.Unlock()
+
+	c.vm.Set("flow", conditionFlowObject(flow))
+	timer := time.AfterFunc(conditionEvalTimeout, func() {
+		c.vm.Interrupt("condition evaluation timeout")
+	})
+	result, err := c.vm.RunProgram(c.program)
+	timer.Stop()
+	c.vm.ClearInterrupt()
+
+	if err != nil {
+		fmt.Printf("Breakpoint condition failed: %v\n", err)
+		return false
+	}
+	return result.ToBoolean()
+}
+
+// conditionFlowObject 构造JS条件中可访问的flow对象
+func conditionFlowObject(flow *proxycore.Flow) map[string]interface{} {
+	obj := map[string]interface{}{
+		"method":          flow.Method,
+		"url":             flow.URL,
+		"host":            flow.Domain,
+		"path":            flow.Path,
+		"scheme":          flow.Scheme,
+		"status":          flow.StatusCode,
+		"size":            flow.ResponseSize,
+		"requestSize":     flow.RequestSize,
+		"tags":            flow.Tags,
+		"headers":         map[string]string{},
+		"body":            "",
+		"json":            nil,
+		"responseHeaders": map[string]string{},
+		"responseBody":    "",
+		"responseJson":    nil,
+	}
+
+	if flow.Request != nil {
+		obj["headers"] = lowerHeaders(flow.Request.Headers)
+		obj["body"] = string(flow.Request.Body)
+		obj["json"] = parseJSONBody(flow.Request.Body)
+	}
+	if flow.Response != nil {
+		body := flow.Response.TextContent
+		if body == "" {
+			body = string(flow.Response.Body)
+		}
+		obj["responseHeaders"] = lowerHeaders(flow.Response.Headers)
+		obj["responseBody"] = body
+		obj["responseJson"] = parseJSONBody([]byte(body))
+	}
+	return obj
+}
+
+// lowerHeaders 头部名称统一转为小写，便于在JS中访问
+func lowerHeaders(headers map[string]string) map[string]string {
+	result := make(map[string]string, len(headers))
+	for name, value := range headers {
+		result[strings.ToLower(name)] = value
+	}
+	return result
+}
+
+// parseJSONBody 解析JSON消息体，非JSON时返回nil
+func parseJSONBody(body []byte) interface{} {
+	var value interface{}
+	if len(body) == 0 || json.Unmarshal(body, &value) != nil {
+		return nil
+	}
+	return value
+}
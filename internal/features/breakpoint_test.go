@@ -0,0 +1,445 @@
+package features
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+// newBreakpointProxy 启动带断点拦截器的代理，返回通过代理访问的客户端
+func newBreakpointProxy(t *testing.T, manager *BreakpointManager, onHit func(session *BreakpointSession)) (*http.Client, chan *proxycore.Flow) {
+	t.Helper()
+	interceptor := NewBreakpointInterceptor(manager)
+	interceptor.SetEventHandler(onHit)
+	_, client, flows := newTestProxy(t, interceptor)
+	return client, flows
+}
+
+func TestBreakpointEditsRequestAndResponse(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Seen", r.Method+" "+r.URL.Path+" "+r.Header.Get("X-Edited")+" "+string(body))
+		w.Write([]byte("original"))
+	}))
+	defer backend.Close()
+
+	manager := NewBreakpointManager(nil)
+	manager.AddRule(&BreakpointRule{
+		ID: "bp", Name: "bp", URLPattern: backend.URL, Enabled: true,
+		BreakOnRequest: true, BreakOnResponse: true,
+	})
+
+	var seenByResponsePhase string
+	client, flows := newBreakpointProxy(t, manager, func(session *BreakpointSession) {
+		if session.Type == "request" {
+			body := "edited body"
+			err := manager.ResumeBreakpoint(session.ID, &BreakpointEdit{
+				Method:  http.MethodPut,
+				URL:     backend.URL + "/edited",
+				Headers: map[string]string{"X-Edited": "yes"},
+				Body:    &body,
+			})
+			if err != nil {
+				t.Errorf("resume request: %v", err)
+			}
+			return
+		}
+
+		seenByResponsePhase = session.Flow.Response.Headers["X-Seen"]
+		body := "replaced"
+		err := manager.ResumeBreakpoint(session.ID, &BreakpointEdit{
+			StatusCode: http.StatusCreated,
+			Headers:    map[string]string{"X-Breakpoint": "response"},
+			Body:       &body,
+		})
+		if err != nil {
+			t.Errorf("resume response: %v", err)
+		}
+	})
+
+	resp, err := client.Post(backend.URL+"/original", "text/plain", strings.NewReader("original body"))
+	if err != nil {
+		t.Fatalf("request through proxy: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if seenByResponsePhase != "PUT /edited yes edited body" {
+		t.Errorf("request edits not applied upstream, backend saw %q", seenByResponsePhase)
+	}
+	if resp.StatusCode != http.StatusCreated || string(body) != "replaced" {
+		t.Errorf("response edits not applied: %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("X-Breakpoint") != "response" || resp.Header.Get("X-Seen") != "" {
+		t.Errorf("response headers not replaced: %v", resp.Header)
+	}
+
+	flow := <-flows
+	if flow.Method != http.MethodPut || string(flow.Request.Body) != "edited body" {
+		t.Errorf("flow request not updated: %s %q", flow.Method, flow.Request.Body)
+	}
+	if flow.StatusCode != http.StatusCreated || string(flow.Response.Body) != "replaced" {
+		t.Errorf("flow response not updated: %d %q", flow.StatusCode, flow.Response.Body)
+	}
+}
+
+func TestBreakpointRejectsEditForWrongPhase(t *testing.T) {
+	manager := NewBreakpointManager(nil)
+	manager.AddRule(&BreakpointRule{ID: "bp", URLPattern: "example", Enabled: true, BreakOnRequest: true})
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/", nil)
+	session, ok := manager.CheckBreakpoint(proxycore.NewFlow("f", req), "request")
+	if !ok {
+		t.Fatal("expected breakpoint to hit")
+	}
+	if err := manager.ResumeBreakpoint(session.ID, &BreakpointEdit{StatusCode: 500}); err == nil {
+		t.Error("expected status edit to be rejected for request breakpoint")
+	}
+	if err := manager.ResumeBreakpoint(session.ID, nil); err != nil {
+		t.Errorf("plain resume should still work: %v", err)
+	}
+}
+
+func TestBreakpointActions(t *testing.T) {
+	var backendHits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backendHits, 1)
+		w.Write([]byte("server"))
+	}))
+	defer backend.Close()
+
+	manager := NewBreakpointManager(nil)
+	manager.AddRule(&BreakpointRule{ID: "bp", Name: "bp", URLPattern: backend.URL, Enabled: true, BreakOnRequest: true})
+
+	var next *BreakpointAction
+	client, flows := newBreakpointProxy(t, manager, func(session *BreakpointSession) {
+		if err := manager.ApplyAction(session.ID, next); err != nil {
+			t.Errorf("apply action: %v", err)
+		}
+	})
+
+	t.Run("respond", func(t *testing.T) {
+		body := `{"mock":true}`
+		next = &BreakpointAction{Type: BreakpointRespond, Edit: &BreakpointEdit{
+			StatusCode: http.StatusTeapot, Headers: map[string]string{"Content-Type": "application/json"}, Body: &body,
+		}}
+		resp, err := client.Get(backend.URL + "/mock")
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTeapot || string(got) != body {
+			t.Errorf("unexpected mocked response: %d %q", resp.StatusCode, got)
+		}
+		if atomic.LoadInt32(&backendHits) != 0 {
+			t.Error("mocked response must not reach the server")
+		}
+		flow := <-flows
+		if len(flow.BreakpointActions) != 1 || flow.BreakpointActions[0].Action != BreakpointRespond {
+			t.Errorf("action not recorded: %+v", flow.BreakpointActions)
+		}
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		next = &BreakpointAction{Type: BreakpointAbort}
+		// 使用POST避免客户端对幂等请求自动重试
+		if _, err := client.Post(backend.URL+"/abort", "text/plain", strings.NewReader("x")); err == nil {
+			t.Fatal("expected connection error")
+		}
+		flow := <-flows
+		if !flow.HasTag("aborted") || flow.BreakpointActions[0].Action != BreakpointAbort {
+			t.Errorf("abort not recorded: %v %+v", flow.Tags, flow.BreakpointActions)
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		next = &BreakpointAction{Type: BreakpointDelay, DelayMs: 200}
+		start := time.Now()
+		resp, err := client.Get(backend.URL + "/delay")
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+		if time.Since(start) < 200*time.Millisecond {
+			t.Error("expected request to be delayed")
+		}
+		flow := <-flows
+		if flow.BreakpointActions[0].DelayMs != 200 {
+			t.Errorf("delay not recorded: %+v", flow.BreakpointActions)
+		}
+	})
+}
+
+func TestBreakpointResumeAllMatching(t *testing.T) {
+	manager := NewBreakpointManager(nil)
+	manager.AddRule(&BreakpointRule{ID: "a", URLPattern: "a.test", Enabled: true, BreakOnRequest: true})
+	manager.AddRule(&BreakpointRule{ID: "b", URLPattern: "b.test", Enabled: true, BreakOnRequest: true})
+
+	hold := func(target string) *BreakpointSession {
+		session, ok := manager.CheckBreakpoint(proxycore.NewFlow(target, httptest.NewRequest(http.MethodGet, target, nil)), "request")
+		if !ok {
+			t.Fatalf("expected breakpoint for %s", target)
+		}
+		return session
+	}
+	a1, a2, b := hold("http://a.test/1"), hold("http://a.test/2"), hold("http://b.test/")
+
+	count, err := manager.ResumeAllMatching("a", nil)
+	if err != nil || count != 2 {
+		t.Fatalf("expected 2 sessions resumed, got %d (%v)", count, err)
+	}
+	for _, session := range []*BreakpointSession{a1, a2} {
+		if action := <-session.ResumeChan; action.Type != BreakpointResume {
+			t.Errorf("unexpected action %s", action.Type)
+		}
+	}
+	if active := manager.GetActiveBreakpoints(); len(active) != 1 || active[0].ID != b.ID {
+		t.Errorf("expected only rule b session to remain, got %d", len(active))
+	}
+}
+
+func TestBreakpointTimeoutActions(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("server"))
+	}))
+	defer backend.Close()
+
+	manager := NewBreakpointManager(nil)
+	manager.AddRule(&BreakpointRule{ID: "continue", URLPattern: "/continue", Enabled: true, BreakOnRequest: true, TimeoutSeconds: 1, TimeoutAction: TimeoutContinue})
+	manager.AddRule(&BreakpointRule{ID: "fail", URLPattern: "/fail", Enabled: true, BreakOnRequest: true, TimeoutSeconds: 1, TimeoutAction: TimeoutFail})
+	client, flows := newBreakpointProxy(t, manager, func(session *BreakpointSession) {})
+
+	resp, err := client.Get(backend.URL + "/continue")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "server" {
+		t.Errorf("expected request to continue after timeout, got %q", body)
+	}
+	if flow := <-flows; flow.BreakpointActions[0].Action != "timeout" {
+		t.Errorf("timeout not recorded: %+v", flow.BreakpointActions)
+	}
+
+	resp, err = client.Get(backend.URL + "/fail")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 after failing timeout, got %d", resp.StatusCode)
+	}
+	<-flows
+}
+
+func TestBreakpointConcurrencyLimit(t *testing.T) {
+	manager := NewBreakpointManager(nil)
+	manager.AddRule(&BreakpointRule{ID: "all", URLPattern: "http", Enabled: true, BreakOnRequest: true})
+	newFlow := func() *proxycore.Flow {
+		return proxycore.NewFlow("f", httptest.NewRequest(http.MethodGet, "http://limit.test/", nil))
+	}
+
+	// 溢出放行
+	manager.SetConcurrencyLimit(1, OverflowPass)
+	first, ok := manager.CheckBreakpoint(newFlow(), "request")
+	if !ok {
+		t.Fatal("expected first request to be held")
+	}
+	overflowFlow := newFlow()
+	if _, ok := manager.CheckBreakpoint(overflowFlow, "request"); ok || !overflowFlow.HasTag("breakpoint-overflow") {
+		t.Fatal("expected overflow request to pass through")
+	}
+
+	// 溢出排队，空位出现后进入暂停
+	manager.SetConcurrencyLimit(1, OverflowQueue)
+	held := make(chan *BreakpointSession, 1)
+	go func() {
+		session, _ := manager.CheckBreakpoint(newFlow(), "request")
+		held <- session
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if status := manager.GetStatus(); status.Queued != 1 || status.Held != 1 {
+		t.Fatalf("expected one queued request, got %+v", status)
+	}
+	manager.ResumeBreakpoint(first.ID, nil)
+	select {
+	case session := <-held:
+		if session == nil {
+			t.Fatal("queued request was not held")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("queued request never got a slot")
+	}
+}
+
+func TestBreakpointClientDisconnectCleansUp(t *testing.T) {
+	manager := NewBreakpointManager(nil)
+	manager.AddRule(&BreakpointRule{ID: "all", URLPattern: "http", Enabled: true, BreakOnRequest: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session, _ := manager.HoldBreakpoint(ctx, proxycore.NewFlow("f", httptest.NewRequest(http.MethodGet, "http://gone.test/", nil)), "request")
+	done := make(chan error, 1)
+	go func() {
+		_, err := manager.WaitForBreakpoint(ctx, session)
+		done <- err
+	}()
+	cancel()
+
+	if err := <-done; err != ErrClientDisconnected {
+		t.Errorf("expected disconnect error, got %v", err)
+	}
+	if len(manager.GetActiveBreakpoints()) != 0 {
+		t.Error("expected session to be removed after client disconnect")
+	}
+}
+
+func TestBreakpointPauseAllAndReleaseAll(t *testing.T) {
+	manager := NewBreakpointManager(nil)
+	manager.PauseAll()
+
+	session, ok := manager.CheckBreakpoint(proxycore.NewFlow("f", httptest.NewRequest(http.MethodGet, "http://any.test/", nil)), "request")
+	if !ok || session.Rule.ID != "pause-all" {
+		t.Fatal("expected every request to pause while paused")
+	}
+	if released := manager.ReleaseAll(); released != 1 {
+		t.Errorf("expected 1 released session, got %d", released)
+	}
+	if _, ok := manager.CheckBreakpoint(proxycore.NewFlow("g", httptest.NewRequest(http.MethodGet, "http://any.test/", nil)), "request"); ok {
+		t.Error("expected requests to flow after release")
+	}
+}
+
+func TestBreakpointConditions(t *testing.T) {
+	flow := func(method, body string, status int) *proxycore.Flow {
+		f := &proxycore.Flow{
+			URL: "https://api.example.com/items", Method: method, StatusCode: status,
+			Request: &proxycore.FlowRequest{Headers: map[string]string{"X-Trace": "abc"}, Body: []byte(body)},
+		}
+		if status != 0 {
+			f.Response = &proxycore.FlowResponse{TextContent: `{"ok":false}`}
+		}
+		return f
+	}
+
+	tests := []struct {
+		name string
+		rule BreakpointRule
+		flow *proxycore.Flow
+		want bool
+	}{
+		{"query header", BreakpointRule{Condition: "header.x-trace=abc", BreakOnRequest: true}, flow("GET", "", 0), true},
+		{"query json", BreakpointRule{Condition: "json.qty>10", BreakOnRequest: true}, flow("POST", `{"qty":3}`, 0), false},
+		{"query status range", BreakpointRule{Condition: "status:500-599", BreakOnResponse: true}, flow("GET", "", 502), true},
+		{"js expression", BreakpointRule{ConditionType: ConditionJS, Condition: "flow.json.qty > 10", BreakOnRequest: true}, flow("POST", `{"qty":30}`, 0), true},
+		{"js function body", BreakpointRule{ConditionType: ConditionJS, Condition: "if (flow.status < 400) return false; return flow.responseJson.ok === false", BreakOnResponse: true}, flow("GET", "", 404), true},
+		{"js error", BreakpointRule{ConditionType: ConditionJS, Condition: "flow.json.missing.field", BreakOnRequest: true}, flow("GET", "", 0), false},
+		{"js endless loop", BreakpointRule{ConditionType: ConditionJS, Condition: "while (true) {} return true", BreakOnRequest: true}, flow("GET", "", 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewBreakpointManager(nil)
+			rule := tt.rule
+			rule.ID, rule.Enabled, rule.URLPattern = "bp", true, "example.com"
+			if err := manager.AddRule(&rule); err != nil {
+				t.Fatalf("add rule: %v", err)
+			}
+			phase := "request"
+			if rule.BreakOnResponse {
+				phase = "response"
+			}
+			if got := manager.matchRule(tt.flow, phase) != nil; got != tt.want {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	manager := NewBreakpointManager(nil)
+	for _, rule := range []*BreakpointRule{
+		{ID: "bad-query", Condition: "(status:5xx"},
+		{ID: "bad-js", ConditionType: ConditionJS, Condition: "flow.status >"},
+		{ID: "bad-type", ConditionType: "lua", Condition: "x"},
+		{ID: "bad-hits", HitCount: -1},
+	} {
+		if err := manager.AddRule(rule); err == nil {
+			t.Errorf("rule %s should be rejected", rule.ID)
+		}
+	}
+}
+
+func TestBreakpointHitCount(t *testing.T) {
+	manager := NewBreakpointManager(nil)
+	manager.AddRule(&BreakpointRule{
+		ID: "bp", URLPattern: "example.com", Enabled: true, BreakOnRequest: true,
+		Condition: "method:POST", HitCount: 3,
+	})
+
+	var fired []int
+	for i := 1; i <= 5; i++ {
+		manager.matchRule(&proxycore.Flow{URL: "https://example.com/", Method: "GET"}, "request")
+		if manager.matchRule(&proxycore.Flow{URL: "https://example.com/", Method: "POST"}, "request") != nil {
+			fired = append(fired, i)
+		}
+	}
+	if len(fired) != 1 || fired[0] != 3 {
+		t.Fatalf("expected to break only on the 3rd matching request, fired on %v", fired)
+	}
+
+	// 响应阶段独立计数，不受请求阶段命中的影响
+	manager.AddRule(&BreakpointRule{
+		ID: "bp", URLPattern: "example.com", Enabled: true, BreakOnRequest: true, BreakOnResponse: true, HitCount: 2,
+	})
+	flow := &proxycore.Flow{URL: "https://example.com/", Method: "GET"}
+	if manager.matchRule(flow, "request") != nil || manager.matchRule(flow, "response") != nil {
+		t.Fatal("first request and response should not break")
+	}
+	if manager.matchRule(flow, "request") == nil || manager.matchRule(flow, "response") == nil {
+		t.Fatal("second request and response should both break")
+	}
+	rule := manager.GetAllRules()[0]
+	if rule.RequestHits != 2 || rule.ResponseHits != 2 {
+		t.Fatalf("hits = %d/%d, want 2/2", rule.RequestHits, rule.ResponseHits)
+	}
+
+	manager.ResetHits("bp")
+	if rule := manager.GetAllRules()[0]; rule.RequestHits != 0 || rule.ResponseHits != 0 {
+		t.Fatalf("expected hits to be reset, got %d/%d", rule.RequestHits, rule.ResponseHits)
+	}
+
+	// 重叠的规则各自计数：每次都暂停的规则不影响第3次才暂停的规则
+	overlap := NewBreakpointManager(nil)
+	overlap.AddRule(&BreakpointRule{ID: "a-every", URLPattern: "example.com", Enabled: true, BreakOnRequest: true})
+	overlap.AddRule(&BreakpointRule{ID: "b-third", URLPattern: "example.com/api", Enabled: true, BreakOnRequest: true, HitCount: 3})
+	for i := 1; i <= 4; i++ {
+		rule := overlap.matchRule(&proxycore.Flow{URL: "https://example.com/api", Method: "GET"}, "request")
+		if rule == nil || rule.ID != "a-every" {
+			t.Fatalf("request %d: expected the first rule by ID to pause, got %v", i, rule)
+		}
+	}
+	rules := overlap.GetAllRules()
+	if rules[0].ID != "a-every" || rules[1].RequestHits != 4 {
+		t.Errorf("expected every matching rule to count hits, got %+v", rules[1])
+	}
+
+	overlap.RemoveRule("a-every")
+	overlap.ResetHits("")
+	fired = nil
+	overlap.AddRule(&BreakpointRule{ID: "z-every", URLPattern: "example.com", Enabled: true, BreakOnRequest: true})
+	for i := 1; i <= 5; i++ {
+		if rule := overlap.matchRule(&proxycore.Flow{URL: "https://example.com/api", Method: "GET"}, "request"); rule != nil && rule.ID == "b-third" {
+			fired = append(fired, i)
+		}
+	}
+	if len(fired) != 1 || fired[0] != 3 {
+		t.Errorf("expected the Nth-hit rule to pause on the 3rd request only, fired on %v", fired)
+	}
+}
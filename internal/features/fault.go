@@ -0,0 +1,436 @@
+package features
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+// 故障类型
+const (
+	FaultStatus     = "status"      // 返回指定状态码和响应体，不请求上游
+	FaultReset      = "reset"       // 发送部分响应体后以RST重置连接
+	FaultTruncate   = "truncate"    // 发送部分响应体后正常关闭连接，响应不完整
+	FaultSlowDrip   = "slow-drip"   // 响应体按少量字节间隔发送
+	FaultBadChunked = "bad-chunked" // 响应头之后发送无法解析的chunked编码
+	FaultTLSFailure = "tls-failure" // HTTPS的TLS握手失败
+	FaultDNSFailure = "dns-failure" // 模拟域名解析失败
+)
+
+const (
+	defaultDripBytes      = 16
+	defaultDripIntervalMs = 200
+)
+
+// errFaultInjected 故障写入器断开连接后，后续写入返回该错误
+var errFaultInjected = errors.New("connection closed by fault injection")
+
+// FaultRule 故障注入规则
+type FaultRule struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	HostPattern string            `json:"hostPattern"` // 如 api.example.com、*.example.com，为空时匹配所有主机
+	Type        string            `json:"type"`
+	Probability float64           `json:"probability"` // 触发概率，0~1
+	StatusCode  int               `json:"statusCode,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Body        string            `json:"body,omitempty"`
+	// AfterBytes reset/truncate 在发送多少字节响应体后断开
+	AfterBytes int `json:"afterBytes,omitempty"`
+	// DripBytes、DripIntervalMs slow-drip 每次发送的字节数和间隔，为0时使用默认值
+	DripBytes      int    `json:"dripBytes,omitempty"`
+	DripIntervalMs int    `json:"dripIntervalMs,omitempty"`
+	Enabled        bool   `json:"enabled"`
+	Description    string `json:"description"`
+}
+
+// validate 检查规则类型和参数
+func (rule *FaultRule) validate() error {
+	switch rule.Type {
+	case FaultStatus:
+		if rule.StatusCode < 100 || rule.StatusCode > 999 {
+			return fmt.Errorf("invalid status code: %d", rule.StatusCode)
+		}
+	case FaultReset, FaultTruncate:
+		if rule.AfterBytes < 0 {
+			return fmt.Errorf("afterBytes must not be negative")
+		}
+	case FaultSlowDrip:
+		if rule.DripBytes < 0 || rule.DripIntervalMs < 0 {
+			return fmt.Errorf("drip bytes and interval must not be negative")
+		}
+	case FaultBadChunked, FaultTLSFailure, FaultDNSFailure:
+	default:
+		return fmt.Errorf("unknown fault type: %s", rule.Type)
+	}
+	if rule.Probability <= 0 || rule.Probability > 1 {
+		return fmt.Errorf("probability must be in (0, 1]")
+	}
+	return nil
+}
+
+// FaultManager 故障注入管理器
+type FaultManager struct {
+	rules      map[string]*FaultRule
+	rulesMutex sync.RWMutex
+}
+
+// NewFaultManager 创建故障注入管理器
+func NewFaultManager() *FaultManager {
+	return &FaultManager{
+		rules: make(map[string]*FaultRule),
+	}
+}
+
+// AddRule 添加规则
+func (fm *FaultManager) AddRule(rule *FaultRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+
+	fm.rulesMutex.Lock()
+	defer fm.rulesMutex.Unlock()
+	fm.rules[rule.ID] = rule
+	return nil
+}
+
+// UpdateRule 更新规则
+func (fm *FaultManager) UpdateRule(rule *FaultRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+
+	fm.rulesMutex.Lock()
+	defer fm.rulesMutex.Unlock()
+
+	if _, exists := fm.rules[rule.ID]; !exists {
+		return fmt.Errorf("rule not found: %s", rule.ID)
+	}
+	fm.rules[rule.ID] = rule
+	return nil
+}
+
+// RemoveRule 移除规则
+func (fm *FaultManager) RemoveRule(ruleID string) {
+	fm.rulesMutex.Lock()
+	defer fm.rulesMutex.Unlock()
+	delete(fm.rules, ruleID)
+}
+
+// GetAllRules 获取所有规则，按ID排序
+func (fm *FaultManager) GetAllRules() []*FaultRule {
+	fm.rulesMutex.RLock()
+	defer fm.rulesMutex.RUnlock()
+
+	rules := make([]*FaultRule, 0, len(fm.rules))
+	for _, rule := range fm.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// pick 按规则顺序为主机掷骰，返回第一个命中的指定类型的规则
+func (fm *FaultManager) pick(host string, types ...string) *FaultRule {
+	for _, rule := range fm.GetAllRules() {
+		if !rule.Enabled || !containsString(types, rule.Type) {
+			continue
+		}
+		if rule.HostPattern != "" && !matchHost(rule.HostPattern, host) {
+			continue
+		}
+		if rand.Float64() < rule.Probability {
+			return rule
+		}
+	}
+	return nil
+}
+
+// containsString 切片中是否包含指定字符串
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// markFault 在Flow上标记注入的故障
+func markFault(flow *proxycore.Flow, rule *FaultRule) {
+	flow.AddTag("fault-injected")
+	flow.AddTag("fault-" + rule.Type)
+}
+
+// dnsFailureMessage 与真实解析失败时代理返回的错误一致
+func dnsFailureMessage(host string) string {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	return fmt.Sprintf("dial tcp: lookup %s: no such host", hostname)
+}
+
+// FaultInterceptor 故障注入拦截器，同时作用于CONNECT、请求和写给客户端的响应
+type FaultInterceptor struct {
+	manager *FaultManager
+}
+
+// NewFaultInterceptor 创建故障注入拦截器
+func NewFaultInterceptor(manager *FaultManager) *FaultInterceptor {
+	return &FaultInterceptor{
+		manager: manager,
+	}
+}
+
+// InterceptConnect 在建立HTTPS隧道前注入TLS握手失败或域名解析失败
+func (fi *FaultInterceptor) InterceptConnect(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
+	rule := fi.manager.pick(r.Host, FaultTLSFailure, FaultDNSFailure)
+	if rule == nil {
+		return false, nil
+	}
+	markFault(flow, rule)
+
+	if rule.Type == FaultDNSFailure {
+		http.Error(w, dnsFailureMessage(r.Host), http.StatusBadGateway)
+		flow.StatusCode = http.StatusBadGateway
+		return true, nil
+	}
+
+	w.WriteHeader(http.StatusOK)
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return false, fmt.Errorf("hijacking not supported")
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return false, err
+	}
+	rejectTLSHandshake(conn)
+	return true, nil
+}
+
+// rejectTLSHandshake 读取客户端的ClientHello后回复handshake_failure警报并关闭连接
+func rejectTLSHandshake(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	conn.Read(buf)
+	// TLS记录：类型21（alert），版本TLS1.2，长度2，级别fatal，描述handshake_failure(40)
+	conn.Write([]byte{0x15, 0x03, 0x03, 0x00, 0x02, 0x02, 0x28})
+}
+
+// InterceptRequest 注入不需要上游响应的故障：指定状态码或域名解析失败
+func (fi *FaultInterceptor) InterceptRequest(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
+	types := []string{FaultStatus, FaultDNSFailure}
+	if proxycore.InTunnel(r) {
+		// 隧道建立前已在InterceptConnect中为域名解析失败掷过骰，不再重复，否则实际概率会偏高
+		types = []string{FaultStatus}
+	}
+	rule := fi.manager.pick(flow.Domain, types...)
+	if rule == nil {
+		return false, nil
+	}
+	markFault(flow, rule)
+
+	statusCode := rule.StatusCode
+	body := []byte(rule.Body)
+	header := make(http.Header)
+	if rule.Type == FaultDNSFailure {
+		statusCode = http.StatusBadGateway
+		body = []byte(dnsFailureMessage(flow.Domain) + "\n")
+	}
+	for name, value := range rule.Headers {
+		header.Set(name, value)
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	for name, values := range header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(statusCode)
+	w.Write(body)
+
+	flow.SetResponse(&http.Response{
+		StatusCode: statusCode,
+		Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		Header:     header,
+	}, body)
+	return true, nil
+}
+
+// WrapResponseWriter 为在传输中生效的故障包装响应写入器，响应无论来自上游还是其他拦截器都会受影响
+func (fi *FaultInterceptor) WrapResponseWriter(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	rule := fi.manager.pick(flow.Domain, FaultReset, FaultTruncate, FaultSlowDrip, FaultBadChunked)
+	if rule == nil {
+		return nil
+	}
+	return &faultResponseWriter{ResponseWriter: w, ctx: r.Context(), flow: flow, rule: rule}
+}
+
+// faultResponseWriter 在写出响应的过程中注入故障
+type faultResponseWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	flow        *proxycore.Flow
+	rule        *FaultRule
+	fired       bool // 故障已实际生效并记录到Flow
+	wroteHeader bool
+	written     int
+	closed      bool
+}
+
+func (fw *faultResponseWriter) WriteHeader(statusCode int) {
+	if fw.wroteHeader {
+		return
+	}
+	fw.wroteHeader = true
+	if fw.rule.Type == FaultBadChunked {
+		fw.writeMalformedChunked(statusCode)
+		return
+	}
+	fw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (fw *faultResponseWriter) Write(p []byte) (int, error) {
+	if !fw.wroteHeader {
+		fw.WriteHeader(http.StatusOK)
+	}
+	if fw.closed {
+		return 0, errFaultInjected
+	}
+
+	switch fw.rule.Type {
+	case FaultReset, FaultTruncate:
+		remaining := fw.rule.AfterBytes - fw.written
+		if len(p) <= remaining {
+			n, err := fw.ResponseWriter.Write(p)
+			fw.written += n
+			return n, err
+		}
+		n, _ := fw.ResponseWriter.Write(p[:remaining])
+		fw.written += n
+		fw.cut(fw.rule.Type == FaultReset)
+		return n, errFaultInjected
+	case FaultSlowDrip:
+		return fw.drip(p)
+	}
+	return fw.ResponseWriter.Write(p)
+}
+
+// drip 按规则的字节数和间隔逐段写出
+func (fw *faultResponseWriter) drip(p []byte) (int, error) {
+	size := fw.rule.DripBytes
+	if size <= 0 {
+		size = defaultDripBytes
+	}
+	interval := time.Duration(fw.rule.DripIntervalMs) * time.Millisecond
+	if fw.rule.DripIntervalMs <= 0 {
+		interval = defaultDripIntervalMs * time.Millisecond
+	}
+
+	written := 0
+	for written < len(p) {
+		end := written + size
+		if end > len(p) {
+			end = len(p)
+		}
+		n, err := fw.ResponseWriter.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		fw.Flush()
+		if written < len(p) {
+			fw.fire()
+			timer := time.NewTimer(interval)
+			select {
+			case <-timer.C:
+			case <-fw.ctx.Done():
+				timer.Stop()
+				return written, fw.ctx.Err()
+			}
+		}
+	}
+	return written, nil
+}
+
+// fire 故障实际生效时标记Flow，响应短于触发条件时不会标记
+func (fw *faultResponseWriter) fire() {
+	if fw.fired {
+		return
+	}
+	fw.fired = true
+	markFault(fw.flow, fw.rule)
+}
+
+// cut 发送已写出的数据后断开连接，reset为true时以RST重置，否则正常关闭使响应不完整
+func (fw *faultResponseWriter) cut(reset bool) {
+	fw.closed = true
+	fw.fire()
+	// 劫持会丢弃尚未发送的缓冲数据，先刷新
+	fw.Flush()
+	if reset {
+		proxycore.AbortConnection(fw.ResponseWriter)
+		return
+	}
+	if conn, _, err := fw.hijack(); err == nil {
+		conn.Close()
+	}
+}
+
+// writeMalformedChunked 劫持连接，写出响应头后发送非法的chunk长度行并关闭连接
+func (fw *faultResponseWriter) writeMalformedChunked(statusCode int) {
+	fw.closed = true
+	fw.fire()
+	conn, buf, err := fw.hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	header := fw.Header().Clone()
+	header.Del("Content-Length")
+	header.Set("Transfer-Encoding", "chunked")
+
+	fmt.Fprintf(buf, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	header.Write(buf)
+	buf.WriteString("\r\nzz\r\n")
+	buf.WriteString(strings.Repeat("x", 32))
+	buf.Flush()
+}
+
+// hijack 劫持底层连接
+func (fw *faultResponseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := fw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
+
+// Flush 实现 http.Flusher
+func (fw *faultResponseWriter) Flush() {
+	if flusher, ok := fw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack 实现 http.Hijacker，供AbortConnection断开连接
+func (fw *faultResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return fw.hijack()
+}
@@ -0,0 +1,165 @@
+package features
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+// newFaultTestProxy 启动使用单条故障规则的代理，返回上游地址、经代理的客户端和Flow通道
+func newFaultTestProxy(t *testing.T, rule *FaultRule) (string, *http.Client, chan *proxycore.Flow) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("a"), 1000))
+	}))
+	t.Cleanup(backend.Close)
+
+	manager := NewFaultManager()
+	if err := manager.AddRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	_, client, flows := newTestProxy(t, NewFaultInterceptor(manager))
+	return backend.URL, client, flows
+}
+
+func TestFaultStatus(t *testing.T) {
+	target, client, flows := newFaultTestProxy(t, &FaultRule{
+		ID: "f1", Type: FaultStatus, StatusCode: 503, Body: "maintenance", Probability: 1, Enabled: true,
+	})
+
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 503 || string(body) != "maintenance" {
+		t.Errorf("got %d %q", resp.StatusCode, body)
+	}
+
+	flow := <-flows
+	if !flow.HasTag("fault-injected") || !flow.HasTag("fault-status") || flow.StatusCode != 503 {
+		t.Errorf("unexpected flow: status=%d tags=%v", flow.StatusCode, flow.Tags)
+	}
+}
+
+func TestFaultBrokenBodies(t *testing.T) {
+	rules := []*FaultRule{
+		{ID: "reset", Type: FaultReset, AfterBytes: 100},
+		{ID: "truncate", Type: FaultTruncate, AfterBytes: 100},
+		{ID: "chunked", Type: FaultBadChunked},
+	}
+	for _, rule := range rules {
+		t.Run(rule.Type, func(t *testing.T) {
+			rule.Probability, rule.Enabled = 1, true
+			target, client, flows := newFaultTestProxy(t, rule)
+
+			resp, err := client.Get(target)
+			if err == nil {
+				body, readErr := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if readErr == nil {
+					t.Fatalf("expected a broken response, read %d bytes", len(body))
+				}
+				if rule.Type == FaultTruncate && len(body) != 100 {
+					t.Errorf("truncated body length = %d, want 100", len(body))
+				}
+			}
+
+			flow := <-flows
+			if !flow.HasTag("fault-" + rule.Type) {
+				t.Errorf("expected fault tag, got %v", flow.Tags)
+			}
+		})
+	}
+}
+
+func TestFaultNotFiredIsNotTagged(t *testing.T) {
+	// 响应体短于AfterBytes时不会断开，Flow不应标记为注入了故障
+	target, client, flows := newFaultTestProxy(t, &FaultRule{ID: "late", Type: FaultTruncate, AfterBytes: 5000, Probability: 1, Enabled: true})
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || len(body) != 1000 {
+		t.Fatalf("expected the full body, got %d bytes: %v", len(body), err)
+	}
+	if flow := <-flows; flow.HasTag("fault-injected") || flow.HasTag("fault-truncate") {
+		t.Errorf("fault did not fire but flow is tagged: %v", flow.Tags)
+	}
+}
+
+func TestFaultSlowDrip(t *testing.T) {
+	target, client, _ := newFaultTestProxy(t, &FaultRule{
+		ID: "drip", Type: FaultSlowDrip, DripBytes: 250, DripIntervalMs: 50, Probability: 1, Enabled: true,
+	})
+
+	start := time.Now()
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if len(body) != 1000 {
+		t.Errorf("body length = %d, want 1000", len(body))
+	}
+	// 1000字节分4段，段间间隔3次
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("slow drip finished in %v", elapsed)
+	}
+}
+
+func TestFaultConnect(t *testing.T) {
+	for _, faultType := range []string{FaultDNSFailure, FaultTLSFailure} {
+		t.Run(faultType, func(t *testing.T) {
+			_, client, flows := newFaultTestProxy(t, &FaultRule{
+				ID: "c", Type: faultType, HostPattern: "*.example.com", Probability: 1, Enabled: true,
+			})
+
+			_, err := client.Get("https://api.example.com/")
+			if err == nil {
+				t.Fatal("expected HTTPS request to fail")
+			}
+			if faultType == FaultDNSFailure && !strings.Contains(err.Error(), "Bad Gateway") {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			flow := <-flows
+			if flow.Method != http.MethodConnect || !flow.HasTag("fault-"+faultType) {
+				t.Errorf("unexpected flow: method=%s tags=%v", flow.Method, flow.Tags)
+			}
+		})
+	}
+}
+
+func TestFaultRuleScope(t *testing.T) {
+	manager := NewFaultManager()
+	manager.AddRule(&FaultRule{ID: "a", Type: FaultReset, HostPattern: "*.example.com", Probability: 1, Enabled: true})
+	if manager.pick("api.example.com:443", FaultReset) == nil {
+		t.Error("expected rule to match subdomain")
+	}
+	if manager.pick("other.test", FaultReset) != nil {
+		t.Error("rule should not match other hosts")
+	}
+	if manager.pick("api.example.com", FaultTruncate) != nil {
+		t.Error("rule should only be picked for its own type")
+	}
+
+	for _, rule := range []*FaultRule{
+		{ID: "p", Type: FaultReset, Probability: 0},
+		{ID: "s", Type: FaultStatus, StatusCode: 0, Probability: 1},
+		{ID: "t", Type: "explode", Probability: 1},
+	} {
+		if err := manager.AddRule(rule); err == nil {
+			t.Errorf("rule %s should be rejected", rule.ID)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 // FeatureManager 功能管理器，用于管理所有高级功能
 type FeatureManager struct {
 	MapLocal     *MapLocalManager
+	MapRemote    *MapRemoteManager
+	Rewrite      *RewriteManager
 	Breakpoint   *BreakpointManager
 	Replay       *ReplayManager
 	Scripting    *ScriptManager
@@ -14,26 +16,40 @@ type FeatureManager struct {
 	HAR          *HARManager
 	ReverseProxy *ReverseProxyManager
 	Upstream     *UpstreamManager
+	Throttle     *ThrottleManager
+	Fault        *FaultManager
+	TLSIntercept *TLSInterceptManager
 }
 
 // DatabaseStorage 数据库存储接口
 type DatabaseStorage interface {
 	BreakpointStorage
 	ScriptStorage
+	ScriptValueStorage
+	RewriteStorage
+	ReverseProxyStorage
+	UpstreamStorage
 }
 
 // NewFeatureManager 创建新的功能管理器
 func NewFeatureManager(storage DatabaseStorage) *FeatureManager {
-	return &FeatureManager{
+	fm := &FeatureManager{
 		MapLocal:     NewMapLocalManager(),
+		MapRemote:    NewMapRemoteManager(),
+		Rewrite:      NewRewriteManager(storage),
 		Breakpoint:   NewBreakpointManager(storage),
 		Replay:       NewReplayManager(),
 		Scripting:    NewScriptManager(storage),
 		AllowBlock:   NewAllowBlockManager(),
 		HAR:          NewHARManager(),
-		ReverseProxy: NewReverseProxyManager(),
-		Upstream:     NewUpstreamManager(),
+		ReverseProxy: NewReverseProxyManager(storage),
+		Upstream:     NewUpstreamManager(storage),
+		Throttle:     NewThrottleManager(),
+		Fault:        NewFaultManager(),
+		TLSIntercept: NewTLSInterceptManager(),
 	}
+	fm.Scripting.SetReplayManager(fm.Replay)
+	return fm
 }
 
 // SetBreakpointEventHandler 设置断点事件处理器
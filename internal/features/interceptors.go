@@ -2,12 +2,12 @@ package features
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"strings"
-	"time"
+	"slices"
 
 	"ProxyWoman/internal/proxycore"
 )
@@ -26,14 +26,20 @@ func NewMapLocalInterceptor(manager *MapLocalManager) *MapLocalInterceptor {
 
 // InterceptRequest 拦截请求
 func (mli *MapLocalInterceptor) InterceptRequest(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
-	rule, err := mli.manager.MatchRule(flow.URL)
+	match, err := mli.manager.Resolve(flow.URL)
 	if err != nil {
 		return false, err
 	}
 
-	if rule != nil {
+	if match != nil {
+		if match.Missing && match.Rule.FallbackToNetwork {
+			// 本地文件不存在，改为请求网络
+			flow.AddTag("map-local-fallback")
+			return false, nil
+		}
+
 		// 处理Map Local
-		err = mli.manager.HandleMapLocal(w, r, rule)
+		err = mli.manager.HandleMapLocal(w, r, flow, match)
 		if err != nil {
 			return false, err
 		}
@@ -67,46 +73,84 @@ func (bi *BreakpointInterceptor) SetEventHandler(handler func(session *Breakpoin
 
 // InterceptRequest 拦截请求
 func (bi *BreakpointInterceptor) InterceptRequest(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
-	session, hasBreakpoint := bi.manager.CheckBreakpoint(flow, "request")
+	session, hasBreakpoint := bi.manager.HoldBreakpoint(r.Context(), flow, "request")
 	if !hasBreakpoint {
 		return false, nil
 	}
 
-	// 等待断点恢复
-	_, err := bi.manager.WaitForBreakpoint(session, 5*time.Minute)
+	// 等待断点恢复，客户端断开时会话随请求上下文一起清理
+	action, err := resolveWait(bi.manager.WaitForBreakpoint(r.Context(), session))
 	if err != nil {
 		return false, err
 	}
+	recordAction(flow, session, action)
+	flow.AddTag("breakpoint-request")
 
-	// 如果有修改的请求，使用修改后的请求
-	if session.ModifiedRequest != nil {
-		*r = *session.ModifiedRequest
+	switch action.Type {
+	case BreakpointAbort:
+		return false, proxycore.ErrAbortConnection
+	case BreakpointRespond:
+		// 直接返回用户编写的响应，不请求服务器
+		resp, body := mockResponse(action.Edit, r)
+		flow.SetResponse(resp, body)
+		flow.AddTag("breakpoint-mocked")
+		for name, values := range resp.Header {
+			for _, value := range values {
+				w.Header().Add(name, value)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		w.Write(body)
+		return true, nil
 	}
 
-	flow.AddTag("breakpoint-request")
+	if err := waitDelay(r.Context(), action); err != nil {
+		return false, proxycore.ErrAbortConnection
+	}
+
+	// 应用前端提交的修改
+	applyRequestEdit(flow, r, action.Edit)
 	return false, nil // 继续处理请求
 }
 
 // InterceptResponse 拦截响应
 func (bi *BreakpointInterceptor) InterceptResponse(flow *proxycore.Flow, resp *http.Response) (*http.Response, error) {
-	session, hasBreakpoint := bi.manager.CheckBreakpoint(flow, "response")
+	ctx := context.Background()
+	if resp.Request != nil {
+		ctx = resp.Request.Context()
+	}
+
+	session, hasBreakpoint := bi.manager.HoldBreakpoint(ctx, flow, "response")
 	if !hasBreakpoint {
 		return resp, nil
 	}
 
 	// 等待断点恢复
-	modifiedResp, err := bi.manager.WaitForBreakpoint(session, 5*time.Minute)
+	action, err := resolveWait(bi.manager.WaitForBreakpoint(ctx, session))
 	if err != nil {
 		return resp, err
 	}
-
+	recordAction(flow, session, action)
 	flow.AddTag("breakpoint-response")
 
-	if modifiedResp != nil {
-		return modifiedResp, nil
+	switch action.Type {
+	case BreakpointAbort:
+		return nil, proxycore.ErrAbortConnection
+	case BreakpointRespond:
+		// 以用户编写的响应整体替换服务器响应
+		mocked, body := mockResponse(action.Edit, resp.Request)
+		endTime, duration := flow.EndTime, flow.Duration
+		flow.SetResponse(mocked, body)
+		flow.EndTime, flow.Duration = endTime, duration
+		flow.AddTag("breakpoint-mocked")
+		return mocked, nil
 	}
 
-	return resp, nil
+	if err := waitDelay(ctx, action); err != nil {
+		return nil, proxycore.ErrAbortConnection
+	}
+
+	return applyResponseEdit(flow, resp, action.Edit), nil
 }
 
 // ScriptInterceptor 脚本拦截器
@@ -123,82 +167,83 @@ func NewScriptInterceptor(manager *ScriptManager) *ScriptInterceptor {
 
 // InterceptRequest 拦截请求
 func (si *ScriptInterceptor) InterceptRequest(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
-	// 保存原始请求信息
-	originalMethod := r.Method
-	originalURL := r.URL.String()
-	originalHeaders := make(map[string]string)
-	for k, v := range r.Header {
-		if len(v) > 0 {
-			originalHeaders[k] = v[0]
-		}
+	// 以脚本执行前的Flow为基准判断脚本做了哪些修改，只把这些修改应用到实际请求，
+	// 不覆盖之前的拦截器（如Map Remote）对请求的改写
+	var originalMethod, originalURL string
+	var flowHeaders http.Header
+	if flow.Request != nil {
+		originalMethod = flow.Request.Method
+		originalURL = flow.Request.URL
+		alignScriptHeaderValues(flow.Request.Headers, &flow.Request.HeaderValues)
+		flowHeaders = flow.Request.HeaderValues.Clone()
 	}
 
-	err := si.manager.ExecuteRequestScripts(flow)
+	mocked, err := si.manager.ExecuteRequestScripts(flow)
 	if err != nil {
 		return false, err
 	}
+	if mocked != nil {
+		// 脚本调用了respond()，直接返回脚本构造的响应，不请求服务器
+		resp, body := mocked.mockedResponse(r)
+		flow.SetResponse(resp, body)
+		flow.AddTag("script-mocked")
+		for name, values := range resp.Header {
+			for _, value := range values {
+				w.Header().Add(name, value)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		w.Write(body)
+		return true, nil
+	}
 
-	// 检查脚本是否修改了请求，如果有修改则应用到实际请求中
+	// 检查脚本是否修改了请求，如果有修改则应用到实际请求中；请求体由代理直接从Flow读取
 	if flow.Request != nil {
-		modified := false
-
 		// 检查方法是否被修改
 		if flow.Request.Method != originalMethod {
 			r.Method = flow.Request.Method
-			modified = true
 		}
 
-		// 检查URL是否被修改
+		// 检查URL是否被修改，与Map Remote一致，Host随URL一起改变
 		if flow.Request.URL != originalURL {
 			newURL, err := url.Parse(flow.Request.URL)
 			if err == nil {
 				r.URL = newURL
-				modified = true
+				r.Host = newURL.Host
 			}
 		}
 
-		// 检查请求头是否被修改
-		for k, v := range flow.Request.Headers {
-			if originalHeaders[k] != v {
-				r.Header.Set(k, v)
-				modified = true
+		// 检查请求头是否被修改或新增，多值的头部整体替换
+		for k, values := range flow.Request.HeaderValues {
+			if !slices.Equal(flowHeaders[k], values) {
+				replaceHeaderValues(r.Header, k, values)
 			}
 		}
 
-		// 检查是否有新增的请求头
-		for k, v := range flow.Request.Headers {
-			if _, exists := originalHeaders[k]; !exists {
-				r.Header.Set(k, v)
-				modified = true
+		// 检查是否有脚本删除的请求头
+		for k := range flowHeaders {
+			if _, exists := flow.Request.HeaderValues[k]; !exists {
+				r.Header.Del(k)
 			}
 		}
-
-		// 检查请求体是否被修改
-		if len(flow.Request.Body) > 0 {
-			r.Body = io.NopCloser(strings.NewReader(string(flow.Request.Body)))
-			r.ContentLength = int64(len(flow.Request.Body))
-			modified = true
-		}
-
-		if modified {
-			// 不再添加script-modified标签，由脚本管理器统一处理
-		}
 	}
 
 	return false, nil // 继续处理请求
 }
 
+// replaceHeaderValues 以values替换头部的全部值
+func replaceHeaderValues(header http.Header, name string, values []string) {
+	header.Del(name)
+	for _, value := range values {
+		header.Add(name, value)
+	}
+}
+
 // InterceptResponse 拦截响应
 func (si *ScriptInterceptor) InterceptResponse(flow *proxycore.Flow, resp *http.Response) (*http.Response, error) {
 	// 保存原始响应信息
 	originalStatusCode := resp.StatusCode
 	originalStatus := resp.Status
-	originalHeaders := make(map[string]string)
-	for k, v := range resp.Header {
-		if len(v) > 0 {
-			originalHeaders[k] = v[0]
-		}
-	}
 
 	// 读取原始响应体
 	var originalBody []byte
@@ -213,6 +258,12 @@ func (si *ScriptInterceptor) InterceptResponse(flow *proxycore.Flow, resp *http.
 		resp.Body = io.NopCloser(bytes.NewReader(originalBody))
 	}
 
+	var flowHeaders http.Header
+	if flow.Response != nil {
+		alignScriptHeaderValues(flow.Response.Headers, &flow.Response.HeaderValues)
+		flowHeaders = flow.Response.HeaderValues.Clone()
+	}
+
 	err := si.manager.ExecuteResponseScripts(flow)
 	if err != nil {
 		// 如果脚本执行失败，恢复原始响应体
@@ -258,23 +309,24 @@ func (si *ScriptInterceptor) InterceptResponse(flow *proxycore.Flow, resp *http.
 			modified = true
 		}
 
-		// 检查响应头是否被修改
-		for k, v := range flow.Response.Headers {
-			if originalHeaders[k] != v {
-				newResp.Header.Set(k, v)
+		// 检查响应头是否被修改或新增，多值的头部（如Set-Cookie）整体替换，未修改的保留全部值
+		for k, values := range flow.Response.HeaderValues {
+			if !slices.Equal(flowHeaders[k], values) {
+				replaceHeaderValues(newResp.Header, k, values)
 				modified = true
 			}
 		}
 
-		// 检查是否有新增的响应头
-		for k, v := range flow.Response.Headers {
-			if _, exists := originalHeaders[k]; !exists {
-				newResp.Header.Set(k, v)
+		// 检查是否有脚本删除的响应头
+		for k := range flowHeaders {
+			if _, exists := flow.Response.HeaderValues[k]; !exists {
+				newResp.Header.Del(k)
 				modified = true
 			}
 		}
 
-		// 检查响应体是否被修改
+		// 检查响应体是否被修改；脚本写入的是解压后的内容，Content-Encoding已随之从Flow中删除，
+		// 由上面删除响应头的检查同步到实际响应
 		if string(flow.Response.Body) != string(originalBody) {
 			newResp.Body = io.NopCloser(bytes.NewReader(flow.Response.Body))
 			newResp.ContentLength = int64(len(flow.Response.Body))
@@ -1,14 +1,24 @@
 package features
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
 )
 
 // MapLocalRule Map Local规则
@@ -20,6 +30,43 @@ type MapLocalRule struct {
 	ContentType string `json:"contentType"`
 	Enabled     bool   `json:"enabled"`
 	IsRegex     bool   `json:"isRegex"`
+
+	// 目录映射：LocalPath为目录，URL的剩余路径映射为目录下的文件
+	IsDirectory       bool   `json:"isDirectory"`
+	IndexFile         string `json:"indexFile"`         // 路径指向目录时使用的文件，默认index.html
+	FallbackToNetwork bool   `json:"fallbackToNetwork"` // 本地文件不存在时改为请求网络，否则返回404
+
+	// 自定义响应
+	StatusCode   int               `json:"statusCode"`   // 响应状态码，默认200
+	Headers      map[string]string `json:"headers"`      // 额外的响应头
+	DelayMs      int               `json:"delayMs"`      // 响应前的延迟
+	BodyTemplate string            `json:"bodyTemplate"` // 响应体模板（text/template），设置后代替本地文件
+
+	bodyTemplate *template.Template // 保存规则时解析的BodyTemplate
+}
+
+// maxMapLocalDelay Map Local延迟的上限
+const maxMapLocalDelay = 10 * time.Minute
+
+// validate 检查规则的自定义响应设置，并缓存解析后的响应体模板，模板错误在保存时报告
+func (rule *MapLocalRule) validate() error {
+	if rule.StatusCode != 0 && (rule.StatusCode < 100 || rule.StatusCode > 999) {
+		return fmt.Errorf("invalid status code: %d", rule.StatusCode)
+	}
+	if rule.DelayMs < 0 || time.Duration(rule.DelayMs)*time.Millisecond > maxMapLocalDelay {
+		return fmt.Errorf("invalid delay: %dms", rule.DelayMs)
+	}
+	rule.bodyTemplate = nil
+	if rule.BodyTemplate != "" {
+		tmpl, err := parseBodyTemplate(rule.BodyTemplate)
+		if err != nil {
+			return err
+		}
+		rule.bodyTemplate = tmpl
+	} else if rule.LocalPath == "" {
+		return fmt.Errorf("local path or body template is required")
+	}
+	return nil
 }
 
 // MapLocalManager Map Local管理器
@@ -36,10 +83,15 @@ func NewMapLocalManager() *MapLocalManager {
 }
 
 // AddRule 添加规则
-func (mlm *MapLocalManager) AddRule(rule *MapLocalRule) {
+func (mlm *MapLocalManager) AddRule(rule *MapLocalRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+
 	mlm.rulesMutex.Lock()
 	defer mlm.rulesMutex.Unlock()
 	mlm.rules[rule.ID] = rule
+	return nil
 }
 
 // RemoveRule 移除规则
@@ -71,6 +123,10 @@ func (mlm *MapLocalManager) GetAllRules() []*MapLocalRule {
 
 // UpdateRule 更新规则
 func (mlm *MapLocalManager) UpdateRule(rule *MapLocalRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+
 	mlm.rulesMutex.Lock()
 	defer mlm.rulesMutex.Unlock()
 	
@@ -82,107 +138,313 @@ func (mlm *MapLocalManager) UpdateRule(rule *MapLocalRule) error {
 	return nil
 }
 
+// MapLocalMatch Map Local匹配结果
+type MapLocalMatch struct {
+	Rule      *MapLocalRule
+	LocalPath string // 解析后的本地文件路径
+	Missing   bool   // 本地文件不存在
+}
+
 // MatchRule 匹配规则
 func (mlm *MapLocalManager) MatchRule(url string) (*MapLocalRule, error) {
+	match, err := mlm.Resolve(url)
+	if err != nil || match == nil {
+		return nil, err
+	}
+	return match.Rule, nil
+}
+
+// Resolve 匹配规则并解析出对应的本地文件。
+// 本地文件不存在且规则允许回退时继续尝试其他规则，都不可用时返回Missing的结果
+func (mlm *MapLocalManager) Resolve(url string) (*MapLocalMatch, error) {
 	mlm.rulesMutex.RLock()
 	defer mlm.rulesMutex.RUnlock()
-	
+
+	var fallback *MapLocalMatch
 	for _, rule := range mlm.rules {
 		if !rule.Enabled {
 			continue
 		}
-		
-		matched, err := mlm.matchURL(url, rule)
+
+		matcher, err := compileURLPattern(rule.URLPattern, rule.IsRegex)
 		if err != nil {
 			continue // 忽略匹配错误，继续下一个规则
 		}
-		
-		if matched {
-			return rule, nil
+		m := matcher.match(url)
+		if m == nil {
+			continue
+		}
+		if rule.BodyTemplate != "" {
+			// 响应体由模板生成，不需要本地文件
+			return &MapLocalMatch{Rule: rule}, nil
+		}
+
+		localPath := resolveLocalPath(rule, m, matcher.wildcard)
+		if info, err := os.Stat(localPath); err == nil && !info.IsDir() {
+			return &MapLocalMatch{Rule: rule, LocalPath: localPath}, nil
+		}
+
+		match := &MapLocalMatch{Rule: rule, LocalPath: localPath, Missing: true}
+		if !rule.FallbackToNetwork {
+			return match, nil
+		}
+		if fallback == nil {
+			fallback = match
 		}
 	}
-	
-	return nil, nil // 没有匹配的规则
+
+	return fallback, nil
+}
+
+// resolveLocalPath 计算URL对应的本地路径：先代入捕获组，
+// 目录规则且LocalPath未引用捕获组时追加URL剩余路径，路径指向目录时使用索引文件
+func resolveLocalPath(rule *MapLocalRule, m *urlMatch, wildcard bool) string {
+	expanded, substituted := m.expand(rule.LocalPath, wildcard)
+
+	var root, relative string
+	switch {
+	case substituted:
+		// 代入的部分来自URL，清理后限制在引用之前的目录内
+		root = rule.LocalPath[:strings.IndexAny(rule.LocalPath, "$*")]
+		root = root[:strings.LastIndexAny(root, `/\`)+1]
+		relative = cleanURLPath(strings.TrimPrefix(expanded, root))
+	case rule.IsDirectory:
+		root = expanded
+		relative = cleanURLPath(m.suffix())
+	default:
+		return expanded
+	}
+
+	target := filepath.Join(root, filepath.FromSlash(relative))
+	if !rule.IsDirectory {
+		return target
+	}
+	if relative == "" || strings.HasSuffix(relative, "/") {
+		return filepath.Join(target, rule.indexFile())
+	}
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		return filepath.Join(target, rule.indexFile())
+	}
+	return target
+}
+
+// cleanURLPath 去掉查询参数和片段并解码，清理后的路径不会跳出根目录
+func cleanURLPath(p string) string {
+	if index := strings.IndexAny(p, "?#"); index >= 0 {
+		p = p[:index]
+	}
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		p = unescaped
+	}
+	trailingSlash := strings.HasSuffix(p, "/")
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if trailingSlash && p != "" {
+		p += "/"
+	}
+	return p
+}
+
+// indexFile 目录规则的索引文件名
+func (rule *MapLocalRule) indexFile() string {
+	if rule.IndexFile != "" {
+		return rule.IndexFile
+	}
+	return "index.html"
+}
+
+// HandleMapLocal 处理Map Local请求，把构造的响应写给客户端并记录到Flow
+func (mlm *MapLocalManager) HandleMapLocal(w http.ResponseWriter, r *http.Request, flow *proxycore.Flow, match *MapLocalMatch) error {
+	resp, body, err := buildMapLocalResponse(r, flow, match)
+	if err != nil {
+		return err
+	}
+
+	if err := waitMapLocalDelay(r.Context(), match.Rule.DelayMs); err != nil {
+		return proxycore.ErrAbortConnection
+	}
+
+	for name, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+
+	flow.SetResponse(resp, body)
+	return nil
 }
 
-// matchURL 匹配URL
-func (mlm *MapLocalManager) matchURL(url string, rule *MapLocalRule) (bool, error) {
-	if rule.IsRegex {
-		regex, err := regexp.Compile(rule.URLPattern)
+// buildMapLocalResponse 按规则构造响应：响应体来自模板或本地文件，再应用状态码和响应头
+func buildMapLocalResponse(r *http.Request, flow *proxycore.Flow, match *MapLocalMatch) (*http.Response, []byte, error) {
+	rule := match.Rule
+	header := make(http.Header)
+	statusCode := http.StatusOK
+	if rule.StatusCode != 0 {
+		statusCode = rule.StatusCode
+	}
+
+	var body []byte
+	switch {
+	case rule.BodyTemplate != "":
+		rendered, err := renderBodyTemplate(rule.bodyTemplate, flow)
 		if err != nil {
-			return false, err
+			return nil, nil, err
 		}
-		return regex.MatchString(url), nil
-	} else {
-		// 简单字符串匹配
-		return strings.Contains(url, rule.URLPattern), nil
+		body = rendered
+		header.Set("Content-Type", http.DetectContentType(body))
+	case match.Missing:
+		statusCode = http.StatusNotFound
+		body = []byte(fmt.Sprintf("local file not found: %s\n", match.LocalPath))
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+	default:
+		// 打开本地文件
+		file, err := os.Open(match.LocalPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open local file: %v", err)
+		}
+		defer file.Close()
+
+		// 根据文件推断Content-Type
+		header.Set("Content-Type", detectContentType(match.LocalPath, file))
+		body, err = io.ReadAll(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read local file: %v", err)
+		}
+	}
+
+	if rule.ContentType != "" {
+		header.Set("Content-Type", rule.ContentType)
 	}
+	for name, value := range rule.Headers {
+		header.Set(name, value)
+	}
+
+	// 设置其他响应头
+	header.Set("X-ProxyWoman-MapLocal", "true")
+	header.Set("X-ProxyWoman-Rule-ID", rule.ID)
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	return &http.Response{
+		StatusCode:    statusCode,
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}, body, nil
 }
 
-// HandleMapLocal 处理Map Local请求
-func (mlm *MapLocalManager) HandleMapLocal(w http.ResponseWriter, r *http.Request, rule *MapLocalRule) error {
-	// 检查本地文件是否存在
-	if _, err := os.Stat(rule.LocalPath); os.IsNotExist(err) {
-		return fmt.Errorf("local file not found: %s", rule.LocalPath)
+// waitMapLocalDelay 等待规则设置的延迟，客户端断开时返回错误
+func waitMapLocalDelay(ctx context.Context, delayMs int) error {
+	if delayMs <= 0 {
+		return nil
 	}
-	
-	// 打开本地文件
-	file, err := os.Open(rule.LocalPath)
+	timer := time.NewTimer(time.Duration(delayMs) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// bodyTemplateData 响应体模板可访问的请求数据
+type bodyTemplateData struct {
+	Method  string
+	URL     string
+	Host    string
+	Path    string
+	Query   map[string]string // 每个参数的第一个值
+	Headers map[string]string
+	Body    string
+	JSON    interface{} // 请求体解析后的JSON，非JSON时为空对象
+	Flow    *proxycore.Flow
+}
+
+// bodyTemplateFuncs 响应体模板中可用的函数
+var bodyTemplateFuncs = template.FuncMap{
+	"header": func(headers map[string]string, name string) string {
+		value, _ := lookupHeaderValue(headers, name)
+		return value
+	},
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"default": func(fallback, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+	"now": time.Now,
+}
+
+// parseBodyTemplate 解析响应体模板
+func parseBodyTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("body").Funcs(bodyTemplateFuncs).Option("missingkey=zero").Parse(text)
 	if err != nil {
-		return fmt.Errorf("failed to open local file: %v", err)
+		return nil, fmt.Errorf("invalid body template: %v", err)
 	}
-	defer file.Close()
-	
-	// 设置Content-Type
-	if rule.ContentType != "" {
-		w.Header().Set("Content-Type", rule.ContentType)
-	} else {
-		// 根据文件扩展名推断Content-Type
-		ext := filepath.Ext(rule.LocalPath)
-		contentType := getContentTypeByExt(ext)
-		if contentType != "" {
-			w.Header().Set("Content-Type", contentType)
+	return tmpl, nil
+}
+
+// renderBodyTemplate 以Flow中的请求数据渲染响应体模板
+func renderBodyTemplate(tmpl *template.Template, flow *proxycore.Flow) ([]byte, error) {
+	data := bodyTemplateData{
+		Method:  flow.Method,
+		URL:     flow.URL,
+		Host:    flow.Domain,
+		Path:    flow.Path,
+		Query:   make(map[string]string),
+		Headers: make(map[string]string),
+		Flow:    flow,
+	}
+	if parsed, err := url.Parse(flow.URL); err == nil {
+		for name, values := range parsed.Query() {
+			data.Query[name] = values[0]
 		}
 	}
-	
-	// 设置其他响应头
-	w.Header().Set("X-ProxyWoman-MapLocal", "true")
-	w.Header().Set("X-ProxyWoman-Rule-ID", rule.ID)
-	
-	// 复制文件内容到响应
-	w.WriteHeader(http.StatusOK)
-	_, err = io.Copy(w, file)
-	return err
-}
-
-// getContentTypeByExt 根据文件扩展名获取Content-Type
-func getContentTypeByExt(ext string) string {
-	switch strings.ToLower(ext) {
-	case ".html", ".htm":
-		return "text/html; charset=utf-8"
-	case ".css":
-		return "text/css; charset=utf-8"
-	case ".js":
-		return "application/javascript; charset=utf-8"
-	case ".json":
-		return "application/json; charset=utf-8"
-	case ".xml":
-		return "application/xml; charset=utf-8"
-	case ".txt":
-		return "text/plain; charset=utf-8"
-	case ".png":
-		return "image/png"
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".gif":
-		return "image/gif"
-	case ".svg":
-		return "image/svg+xml"
-	case ".ico":
-		return "image/x-icon"
-	case ".pdf":
-		return "application/pdf"
-	default:
-		return ""
+	if flow.Request != nil {
+		data.Headers = flow.Request.Headers
+		data.Body = string(flow.Request.Body)
+		data.JSON = parseJSONBody(flow.Request.Body)
 	}
+	if data.JSON == nil {
+		data.JSON = map[string]interface{}{}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render body template: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// lookupHeaderValue 不区分大小写地查找头部
+func lookupHeaderValue(headers map[string]string, name string) (string, bool) {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// detectContentType 根据扩展名推断Content-Type，未知扩展名时根据文件内容判断
+func detectContentType(localPath string, file io.ReadSeeker) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(localPath)); contentType != "" {
+		return contentType
+	}
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(file, buf)
+	file.Seek(0, io.SeekStart)
+	return http.DetectContentType(buf[:n])
 }
@@ -0,0 +1,196 @@
+package features
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		target := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMapLocalResolve(t *testing.T) {
+	dist := t.TempDir()
+	writeFiles(t, dist, map[string]string{
+		"index.html":         "home",
+		"js/app.js":          "app",
+		"docs/index.html":    "docs",
+		"mocks/user_42.json": `{"id":42}`,
+	})
+
+	tests := []struct {
+		name    string
+		rule    MapLocalRule
+		url     string
+		want    string // 相对dist的路径，空表示不匹配
+		missing bool
+	}{
+		{"wildcard directory", MapLocalRule{URLPattern: "https://cdn.example.com/app/*", LocalPath: dist + "/*", IsDirectory: true},
+			"https://cdn.example.com/app/js/app.js?v=3", "js/app.js", false},
+		{"directory without placeholder", MapLocalRule{URLPattern: "https://cdn.example.com/app/*", LocalPath: dist, IsDirectory: true},
+			"https://cdn.example.com/app/js/app.js", "js/app.js", false},
+		{"plain prefix directory", MapLocalRule{URLPattern: "cdn.example.com/app/", LocalPath: dist, IsDirectory: true},
+			"https://cdn.example.com/app/js/app.js", "js/app.js", false},
+		{"index file", MapLocalRule{URLPattern: "https://cdn.example.com/app/*", LocalPath: dist, IsDirectory: true},
+			"https://cdn.example.com/app/", "index.html", false},
+		{"nested directory index", MapLocalRule{URLPattern: "https://cdn.example.com/app/*", LocalPath: dist, IsDirectory: true},
+			"https://cdn.example.com/app/docs", "docs/index.html", false},
+		{"regex capture group", MapLocalRule{URLPattern: `/api/users/(\d+)$`, IsRegex: true, LocalPath: dist + "/mocks/user_$1.json"},
+			"https://api.example.com/api/users/42", "mocks/user_42.json", false},
+		{"missing file", MapLocalRule{URLPattern: "https://cdn.example.com/app/*", LocalPath: dist, IsDirectory: true},
+			"https://cdn.example.com/app/missing.js", "missing.js", true},
+		{"path traversal stays inside", MapLocalRule{URLPattern: "https://cdn.example.com/app/*", LocalPath: dist, IsDirectory: true},
+			"https://cdn.example.com/app/%2e%2e/%2e%2e/js/app.js", "js/app.js", false},
+		{"no match", MapLocalRule{URLPattern: "https://cdn.example.com/app/*", LocalPath: dist, IsDirectory: true},
+			"https://other.example.com/app/js/app.js", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewMapLocalManager()
+			rule := tt.rule
+			rule.ID, rule.Enabled = "rule", true
+			manager.AddRule(&rule)
+
+			match, err := manager.Resolve(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if match != nil {
+					t.Fatalf("expected no match, got %s", match.LocalPath)
+				}
+				return
+			}
+			if match == nil {
+				t.Fatal("expected a match")
+			}
+			if want := filepath.Join(dist, filepath.FromSlash(tt.want)); match.LocalPath != want || match.Missing != tt.missing {
+				t.Errorf("got %s (missing=%v), want %s (missing=%v)", match.LocalPath, match.Missing, want, tt.missing)
+			}
+		})
+	}
+}
+
+func TestMapLocalFallbackToNetwork(t *testing.T) {
+	dist := t.TempDir()
+	writeFiles(t, dist, map[string]string{"app.js": "local"})
+
+	manager := NewMapLocalManager()
+	manager.AddRule(&MapLocalRule{ID: "dist", URLPattern: "https://cdn.example.com/*", LocalPath: dist, IsDirectory: true, FallbackToNetwork: true, Enabled: true})
+
+	if match, _ := manager.Resolve("https://cdn.example.com/app.js"); match == nil || match.Missing {
+		t.Fatal("expected local file to be served")
+	}
+	match, _ := manager.Resolve("https://cdn.example.com/vendor.js")
+	if match == nil || !match.Missing {
+		t.Fatal("expected missing match for fallback")
+	}
+
+	interceptor := NewMapLocalInterceptor(manager)
+	req := httptest.NewRequest(http.MethodGet, "https://cdn.example.com/vendor.js", nil)
+	flow := proxycore.NewFlow("flow", req)
+	handled, err := interceptor.InterceptRequest(flow, httptest.NewRecorder(), req)
+	if err != nil || handled || !flow.HasTag("map-local-fallback") {
+		t.Fatalf("expected request to fall back to network, handled=%v err=%v tags=%v", handled, err, flow.Tags)
+	}
+}
+
+func TestHandleMapLocalContentType(t *testing.T) {
+	dist := t.TempDir()
+	writeFiles(t, dist, map[string]string{
+		"app.mjs": "export default 1",
+		"logo":    "\x89PNG\r\n\x1a\n0000",
+	})
+
+	manager := NewMapLocalManager()
+	rule := &MapLocalRule{ID: "dist", URLPattern: "https://cdn.example.com/*", LocalPath: dist, IsDirectory: true, Enabled: true}
+	manager.AddRule(rule)
+
+	for file, want := range map[string]string{"app.mjs": "javascript", "logo": "image/png", "none.js": "text/plain"} {
+		match, _ := manager.Resolve("https://cdn.example.com/" + file)
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if err := manager.HandleMapLocal(recorder, req, proxycore.NewFlow("flow", req), match); err != nil {
+			t.Fatal(err)
+		}
+		if got := recorder.Header().Get("Content-Type"); !strings.Contains(got, want) {
+			t.Errorf("%s: Content-Type %q, want %q", file, got, want)
+		}
+		if file == "none.js" && recorder.Code != http.StatusNotFound {
+			t.Errorf("missing file should return 404, got %d", recorder.Code)
+		}
+	}
+}
+
+func TestMapLocalCustomResponse(t *testing.T) {
+	manager := NewMapLocalManager()
+	if err := manager.AddRule(&MapLocalRule{ID: "bad", URLPattern: "x", BodyTemplate: "{{.Method"}); err == nil {
+		t.Error("invalid template should be rejected")
+	}
+	if err := manager.AddRule(&MapLocalRule{ID: "bad", URLPattern: "x", LocalPath: "x", StatusCode: 42}); err == nil {
+		t.Error("invalid status code should be rejected")
+	}
+
+	err := manager.AddRule(&MapLocalRule{
+		ID: "mock", URLPattern: "api.example.com/orders", Enabled: true,
+		StatusCode:   http.StatusCreated,
+		Headers:      map[string]string{"Cache-Control": "no-store", "Location": "/orders/1"},
+		DelayMs:      100,
+		ContentType:  "application/json",
+		BodyTemplate: `{"method":"{{.Method}}","page":"{{.Query.page}}","token":"{{header .Headers "x-token"}}","item":{{json .JSON.item}}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "https://api.example.com/orders?page=2", strings.NewReader(`{"item":{"sku":"A1","qty":2}}`))
+	req.Header.Set("X-Token", "secret")
+	flow := proxycore.NewFlow("flow", req)
+	flow.SetRequestBody([]byte(`{"item":{"sku":"A1","qty":2}}`))
+
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	handled, err := NewMapLocalInterceptor(manager).InterceptRequest(flow, recorder, req)
+	if err != nil || !handled {
+		t.Fatalf("expected request to be handled: %v", err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("expected response to be delayed")
+	}
+
+	want := `{"method":"POST","page":"2","token":"secret","item":{"qty":2,"sku":"A1"}}`
+	if recorder.Code != http.StatusCreated || recorder.Body.String() != want {
+		t.Errorf("unexpected response: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder.Header().Get("Cache-Control") != "no-store" || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers: %v", recorder.Header())
+	}
+	if flow.Response == nil || flow.StatusCode != http.StatusCreated || string(flow.Response.Body) != want {
+		t.Errorf("mocked response not recorded on flow: %+v", flow.Response)
+	}
+
+	// 模板在保存时解析并缓存，无效的更新被拒绝且不影响已保存的规则
+	if err := manager.UpdateRule(&MapLocalRule{ID: "mock", URLPattern: "x", BodyTemplate: "{{end}}"}); err == nil {
+		t.Error("invalid template should be rejected on update")
+	}
+	if rule, _ := manager.GetRule("mock"); rule.bodyTemplate == nil || rule.URLPattern != "api.example.com/orders" {
+		t.Errorf("saved rule changed or template not cached: %+v", rule)
+	}
+}
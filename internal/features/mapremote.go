@@ -0,0 +1,195 @@
+package features
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+// MapRemoteRule Map Remote规则：把匹配的请求改发到另一个地址，客户端仍认为在访问原地址
+type MapRemoteRule struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	URLPattern string `json:"urlPattern"` // 如 api.prod.example.com/v2/*
+	IsRegex    bool   `json:"isRegex"`
+	// TargetURL 目标地址，可用 * 或 $1 引用URL中匹配的部分，如 http://localhost:3000/v2/*；
+	// 未引用时URL中匹配部分之后的内容（或最后一个通配部分）追加到目标之后，未写协议时沿用原请求的协议
+	TargetURL    string `json:"targetUrl"`
+	PreserveHost bool   `json:"preserveHost"` // 保留原始Host请求头
+	Enabled      bool   `json:"enabled"`
+	Description  string `json:"description"`
+}
+
+// MapRemoteManager Map Remote管理器
+type MapRemoteManager struct {
+	rules      map[string]*MapRemoteRule
+	rulesMutex sync.RWMutex
+}
+
+// NewMapRemoteManager 创建新的Map Remote管理器
+func NewMapRemoteManager() *MapRemoteManager {
+	return &MapRemoteManager{
+		rules: make(map[string]*MapRemoteRule),
+	}
+}
+
+// validate 检查规则的模式和目标
+func (rule *MapRemoteRule) validate() error {
+	if rule.URLPattern == "" {
+		return fmt.Errorf("URL pattern is required")
+	}
+	if _, err := compileURLPattern(rule.URLPattern, rule.IsRegex); err != nil {
+		return fmt.Errorf("invalid URL pattern: %v", err)
+	}
+	if strings.TrimSpace(rule.TargetURL) == "" {
+		return fmt.Errorf("target URL is required")
+	}
+	return nil
+}
+
+// AddRule 添加规则
+func (mrm *MapRemoteManager) AddRule(rule *MapRemoteRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+
+	mrm.rulesMutex.Lock()
+	defer mrm.rulesMutex.Unlock()
+	mrm.rules[rule.ID] = rule
+	return nil
+}
+
+// UpdateRule 更新规则
+func (mrm *MapRemoteManager) UpdateRule(rule *MapRemoteRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+
+	mrm.rulesMutex.Lock()
+	defer mrm.rulesMutex.Unlock()
+
+	if _, exists := mrm.rules[rule.ID]; !exists {
+		return fmt.Errorf("rule not found: %s", rule.ID)
+	}
+	mrm.rules[rule.ID] = rule
+	return nil
+}
+
+// RemoveRule 移除规则
+func (mrm *MapRemoteManager) RemoveRule(ruleID string) {
+	mrm.rulesMutex.Lock()
+	defer mrm.rulesMutex.Unlock()
+	delete(mrm.rules, ruleID)
+}
+
+// GetAllRules 获取所有规则，按ID排序
+func (mrm *MapRemoteManager) GetAllRules() []*MapRemoteRule {
+	mrm.rulesMutex.RLock()
+	defer mrm.rulesMutex.RUnlock()
+
+	rules := make([]*MapRemoteRule, 0, len(mrm.rules))
+	for _, rule := range mrm.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// Resolve 匹配规则并计算映射后的URL，没有匹配的规则时返回nil
+func (mrm *MapRemoteManager) Resolve(originalURL string) (*MapRemoteRule, *url.URL, error) {
+	original, err := url.Parse(originalURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid URL: %v", err)
+	}
+
+	for _, rule := range mrm.GetAllRules() {
+		if !rule.Enabled {
+			continue
+		}
+
+		matcher, err := compileURLPattern(rule.URLPattern, rule.IsRegex)
+		if err != nil {
+			continue
+		}
+		m := matcher.match(originalURL)
+		if m == nil {
+			continue
+		}
+
+		target, substituted := m.expand(rule.TargetURL, matcher.wildcard)
+		if !substituted {
+			target = joinMappedURL(target, m.suffix())
+		}
+		if !strings.Contains(target, "://") {
+			target = original.Scheme + "://" + target
+		}
+
+		mapped, err := url.Parse(target)
+		if err != nil || mapped.Host == "" {
+			return rule, nil, fmt.Errorf("invalid mapped URL %q for rule %s", target, rule.ID)
+		}
+		return rule, mapped, nil
+	}
+	return nil, nil, nil
+}
+
+// joinMappedURL 把原URL中匹配部分之后的内容追加到目标地址后，避免重复或缺少斜杠
+func joinMappedURL(target, rest string) string {
+	switch {
+	case rest == "":
+		return target
+	case strings.HasSuffix(target, "/") && strings.HasPrefix(rest, "/"):
+		return target + rest[1:]
+	case strings.HasPrefix(rest, "/") || strings.HasPrefix(rest, "?") || strings.HasSuffix(target, "/"):
+		return target + rest
+	default:
+		return target + "/" + rest
+	}
+}
+
+// MapRemoteInterceptor Map Remote拦截器
+type MapRemoteInterceptor struct {
+	manager *MapRemoteManager
+}
+
+// NewMapRemoteInterceptor 创建Map Remote拦截器
+func NewMapRemoteInterceptor(manager *MapRemoteManager) *MapRemoteInterceptor {
+	return &MapRemoteInterceptor{
+		manager: manager,
+	}
+}
+
+// InterceptRequest 改写请求的目标地址，Flow保留原始URL并记录映射后的URL
+func (mri *MapRemoteInterceptor) InterceptRequest(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
+	originalURL := flow.URL
+	if r.URL.IsAbs() {
+		originalURL = r.URL.String()
+	}
+
+	rule, mapped, err := mri.manager.Resolve(originalURL)
+	if err != nil {
+		return false, err
+	}
+	if rule == nil {
+		return false, nil
+	}
+
+	originalHost := r.Host
+	if originalHost == "" {
+		originalHost = r.URL.Host
+	}
+	r.URL = mapped
+	r.Host = mapped.Host
+	if rule.PreserveHost {
+		r.Host = originalHost
+	}
+
+	flow.MappedURL = mapped.String()
+	flow.AddTag("map-remote")
+	return false, nil
+}
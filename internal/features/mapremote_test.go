@@ -0,0 +1,139 @@
+package features
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+func TestMapRemoteResolve(t *testing.T) {
+	tests := []struct {
+		name string
+		rule MapRemoteRule
+		url  string
+		want string
+	}{
+		{"wildcard to wildcard", MapRemoteRule{URLPattern: "api.prod.example.com/v2/*", TargetURL: "localhost:3000/v2/*"},
+			"https://api.prod.example.com/v2/users?page=2", "https://localhost:3000/v2/users?page=2"},
+		{"explicit scheme", MapRemoteRule{URLPattern: "https://api.prod.example.com/*", TargetURL: "http://localhost:3000/*"},
+			"https://api.prod.example.com/v2/users", "http://localhost:3000/v2/users"},
+		{"wildcard without placeholder", MapRemoteRule{URLPattern: "api.prod.example.com/v2/*", TargetURL: "http://localhost:3000/api/"},
+			"https://api.prod.example.com/v2/users", "http://localhost:3000/api/users"},
+		{"plain host keeps path and query", MapRemoteRule{URLPattern: "api.prod.example.com", TargetURL: "http://staging.example.com:8080"},
+			"https://api.prod.example.com/v2/users?id=1", "http://staging.example.com:8080/v2/users?id=1"},
+		{"regex groups", MapRemoteRule{URLPattern: `^https://(\w+)\.prod\.example\.com/(.*)$`, IsRegex: true, TargetURL: "http://$1.local:9000/${2}"},
+			"https://orders.prod.example.com/list?x=1", "http://orders.local:9000/list?x=1"},
+		{"no match", MapRemoteRule{URLPattern: "api.prod.example.com/v2/*", TargetURL: "localhost:3000/v2/*"},
+			"https://api.prod.example.com/v1/users", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewMapRemoteManager()
+			rule := tt.rule
+			rule.ID, rule.Enabled = "rule", true
+			if err := manager.AddRule(&rule); err != nil {
+				t.Fatal(err)
+			}
+
+			matched, mapped, err := manager.Resolve(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if matched != nil {
+					t.Fatalf("expected no match, got %s", mapped)
+				}
+				return
+			}
+			if mapped == nil || mapped.String() != tt.want {
+				t.Errorf("mapped to %v, want %s", mapped, tt.want)
+			}
+		})
+	}
+
+	if err := NewMapRemoteManager().AddRule(&MapRemoteRule{ID: "bad", URLPattern: "(", IsRegex: true, TargetURL: "x"}); err == nil {
+		t.Error("invalid regex should be rejected")
+	}
+}
+
+func TestMapRemoteThroughProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + r.URL.RequestURI()))
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	for _, preserveHost := range []bool{false, true} {
+		manager := NewMapRemoteManager()
+		manager.AddRule(&MapRemoteRule{
+			ID: "local", URLPattern: "api.prod.example.com/v2/*", TargetURL: backend.URL + "/v2/*",
+			PreserveHost: preserveHost, Enabled: true,
+		})
+
+		ps := proxycore.NewProxyServer(0, nil)
+		ps.AddRequestInterceptor(NewMapRemoteInterceptor(manager))
+		flows := make(chan *proxycore.Flow, 1)
+		ps.SetFlowHandler(func(flow *proxycore.Flow) { flows <- flow })
+		proxy := httptest.NewServer(ps)
+		proxyURL, _ := url.Parse(proxy.URL)
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 5 * time.Second}
+
+		resp, err := client.Get("http://api.prod.example.com/v2/users?page=2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		proxy.Close()
+
+		wantHost := backendURL.Host
+		if preserveHost {
+			wantHost = "api.prod.example.com"
+		}
+		if want := wantHost + " /v2/users?page=2"; string(body) != want {
+			t.Errorf("preserveHost=%v: backend saw %q, want %q", preserveHost, body, want)
+		}
+
+		flow := <-flows
+		if flow.URL != "http://api.prod.example.com/v2/users?page=2" || flow.MappedURL != backend.URL+"/v2/users?page=2" || !flow.HasTag("map-remote") {
+			t.Errorf("unexpected flow: url=%s mapped=%s tags=%v", flow.URL, flow.MappedURL, flow.Tags)
+		}
+	}
+}
+
+func TestMapRemoteWithScripts(t *testing.T) {
+	backend := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + " " + r.URL.RequestURI() + " " + r.Header.Get("X-Script")))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	prod, local := backend("prod"), backend("local")
+
+	remote := NewMapRemoteManager()
+	remote.AddRule(&MapRemoteRule{ID: "local", URLPattern: prod.URL + "/api/*", TargetURL: local.URL + "/api/*", Enabled: true})
+	scripts := NewScriptManager(nil)
+	scripts.AddScript(&Script{ID: "s", Name: "s", Type: "request", Enabled: true, Content: `request.headers.set("X-Script", "1")`})
+
+	// 实际的拦截器顺序：Map Remote在脚本之前，脚本没有改URL时不应撤销映射
+	_, client, flows := newTestProxy(t, NewMapRemoteInterceptor(remote), NewScriptInterceptor(scripts))
+	resp, err := client.Get(prod.URL + "/api/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "local /api/users 1" {
+		t.Errorf("backend response = %q, want the mapped backend with the script header", body)
+	}
+	if flow := <-flows; flow.MappedURL != local.URL+"/api/users" || !flow.HasTag("map-remote") {
+		t.Errorf("unexpected flow: mapped=%s tags=%v", flow.MappedURL, flow.Tags)
+	}
+}
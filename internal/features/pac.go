@@ -0,0 +1,425 @@
+package features
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
+
+	"github.com/dop251/goja"
+)
+
+// pacEvalTimeout 单次FindProxyForURL执行的最长时间
+const pacEvalTimeout = 2 * time.Second
+
+// PAC解析结果缓存：PAC可能依赖时间和DNS，结果只缓存一段时间；超过条数上限时淘汰最久未使用的主机
+const (
+	pacCacheTTL        = 5 * time.Minute
+	pacCacheMaxEntries = 1024
+)
+
+// pacHelpers PAC标准辅助函数（纯JavaScript部分），DNS相关函数由Go注入
+const pacHelpers = `
+function isPlainHostName(host) {
+	return host.indexOf('.') < 0;
+}
+function dnsDomainIs(host, domain) {
+	host = String(host).toLowerCase();
+	domain = String(domain).toLowerCase();
+	return host.length >= domain.length && host.substring(host.length - domain.length) === domain;
+}
+function localHostOrDomainIs(host, hostdom) {
+	return host === hostdom || (host.indexOf('.') < 0 && hostdom.lastIndexOf(host + '.', 0) === 0);
+}
+function isResolvable(host) {
+	return dnsResolve(host) !== null;
+}
+function dnsDomainLevels(host) {
+	return host.split('.').length - 1;
+}
+function shExpMatch(str, shexp) {
+	var re = String(shexp).replace(/[.+^${}()|[\]\\]/g, '\\$&').replace(/\*/g, '.*').replace(/\?/g, '.');
+	return new RegExp('^' + re + '$').test(str);
+}
+function convertAddr(ip) {
+	var b = String(ip).split('.');
+	return ((b[0] << 24) | (b[1] << 16) | (b[2] << 8) | b[3]) >>> 0;
+}
+function isInNet(host, pattern, mask) {
+	var ip = /^\d+\.\d+\.\d+\.\d+$/.test(host) ? host : dnsResolve(host);
+	if (ip === null) {
+		return false;
+	}
+	return (convertAddr(ip) & convertAddr(mask)) === (convertAddr(pattern) & convertAddr(mask));
+}
+var __pacDays = ['SUN', 'MON', 'TUE', 'WED', 'THU', 'FRI', 'SAT'];
+var __pacMonths = ['JAN', 'FEB', 'MAR', 'APR', 'MAY', 'JUN', 'JUL', 'AUG', 'SEP', 'OCT', 'NOV', 'DEC'];
+function __pacArgs(args) {
+	var list = Array.prototype.slice.call(args);
+	var gmt = list.length > 0 && list[list.length - 1] === 'GMT';
+	if (gmt) {
+		list.pop();
+	}
+	return { list: list, now: new Date(), gmt: gmt };
+}
+function __pacInRange(value, start, end) {
+	return start <= end ? (value >= start && value <= end) : (value >= start || value <= end);
+}
+function weekdayRange() {
+	var a = __pacArgs(arguments);
+	var day = a.gmt ? a.now.getUTCDay() : a.now.getDay();
+	var start = __pacDays.indexOf(a.list[0]);
+	var end = a.list.length > 1 ? __pacDays.indexOf(a.list[1]) : start;
+	return __pacInRange(day, start, end);
+}
+function dateRange() {
+	var a = __pacArgs(arguments);
+	var d = a.now;
+	var day = a.gmt ? d.getUTCDate() : d.getDate();
+	var month = a.gmt ? d.getUTCMonth() : d.getMonth();
+	var year = a.gmt ? d.getUTCFullYear() : d.getFullYear();
+	var toValue = function(v) {
+		if (typeof v === 'number') {
+			return v > 31 ? { year: v } : { day: v };
+		}
+		return { month: __pacMonths.indexOf(v) };
+	};
+	var values = a.list.map(toValue);
+	var key = function(v) {
+		return (v.year !== undefined ? v.year : year) * 10000 +
+			(v.month !== undefined ? v.month : month) * 100 +
+			(v.day !== undefined ? v.day : day);
+	};
+	var current = year * 10000 + month * 100 + day;
+	if (values.length === 1) {
+		return key(values[0]) === current;
+	}
+	var half = values.length / 2;
+	var start = {}, end = {};
+	for (var i = 0; i < half; i++) {
+		Object.assign(start, values[i]);
+		Object.assign(end, values[half + i]);
+	}
+	return __pacInRange(current, key(start), key(end));
+}
+function timeRange() {
+	var a = __pacArgs(arguments);
+	var d = a.now;
+	var h = a.gmt ? d.getUTCHours() : d.getHours();
+	var m = a.gmt ? d.getUTCMinutes() : d.getMinutes();
+	var s = a.gmt ? d.getUTCSeconds() : d.getSeconds();
+	var l = a.list;
+	switch (l.length) {
+	case 1:
+		return h === l[0];
+	case 2:
+		return __pacInRange(h, l[0], l[1] - 1);
+	case 4:
+		return __pacInRange(h * 60 + m, l[0] * 60 + l[1], l[2] * 60 + l[3] - 1);
+	case 6:
+		return __pacInRange(h * 3600 + m * 60 + s, l[0] * 3600 + l[1] * 60 + l[2], l[3] * 3600 + l[4] * 60 + l[5] - 1);
+	}
+	return false;
+}
+function alert() {}
+`
+
+// PACProxy PAC脚本返回的单个代理条目
+type PACProxy struct {
+	Type string `json:"type"` // "DIRECT", "PROXY", "HTTPS", "SOCKS"
+	Host string `json:"host"` // host:port，DIRECT时为空
+}
+
+// ProxyURL 转换为上游代理URL，DIRECT返回空字符串
+func (p PACProxy) ProxyURL() string {
+	switch p.Type {
+	case "PROXY", "HTTP":
+		return "http://" + p.Host
+	case "HTTPS":
+		return "https://" + p.Host
+	case "SOCKS", "SOCKS5", "SOCKS4":
+		return "socks5://" + p.Host
+	default:
+		return ""
+	}
+}
+
+// String 返回PAC格式的条目
+func (p PACProxy) String() string {
+	if p.Type == "DIRECT" {
+		return "DIRECT"
+	}
+	return p.Type + " " + p.Host
+}
+
+// ParsePACResult 解析FindProxyForURL的返回值，如 "PROXY a:8080; SOCKS b:1080; DIRECT"
+func ParsePACResult(result string) []PACProxy {
+	var chain []PACProxy
+	for _, part := range strings.Split(result, ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		entryType := strings.ToUpper(fields[0])
+		switch entryType {
+		case "DIRECT":
+			chain = append(chain, PACProxy{Type: "DIRECT"})
+		case "PROXY", "HTTP", "HTTPS", "SOCKS", "SOCKS5", "SOCKS4":
+			if len(fields) < 2 {
+				continue
+			}
+			chain = append(chain, PACProxy{Type: entryType, Host: fields[1]})
+		}
+	}
+	if len(chain) == 0 {
+		chain = append(chain, PACProxy{Type: "DIRECT"})
+	}
+	return chain
+}
+
+// PACResolver PAC脚本解析器，按主机缓存解析结果
+type PACResolver struct {
+	source     string
+	vm         *goja.Runtime
+	findProxy  goja.Callable
+	vmMutex    sync.Mutex
+	cache      map[string]*list.Element // 主机 -> cacheOrder中的*pacCacheEntry
+	cacheOrder *list.List               // 最近使用的在前
+	cacheMutex sync.Mutex
+}
+
+// pacCacheEntry 一个主机的缓存结果
+type pacCacheEntry struct {
+	host    string
+	chain   []PACProxy
+	expires time.Time
+}
+
+// LoadPAC 从本地文件、file:// 或 http(s):// 地址加载PAC脚本
+func LoadPAC(source string) (*PACResolver, error) {
+	script, err := readPACSource(source)
+	if err != nil {
+		return nil, err
+	}
+	return NewPACResolver(source, script)
+}
+
+// readPACSource 读取PAC脚本内容
+func readPACSource(source string) (string, error) {
+	parsed, err := url.Parse(source)
+	if err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") {
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(source)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch PAC file: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("failed to fetch PAC file: status %d", resp.StatusCode)
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("failed to read PAC file: %v", err)
+		}
+		return string(data), nil
+	}
+
+	path := source
+	if err == nil && parsed.Scheme == "file" {
+		path = parsed.Path
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read PAC file: %v", err)
+	}
+	return string(data), nil
+}
+
+// NewPACResolver 编译PAC脚本，脚本必须定义FindProxyForURL(url, host)
+func NewPACResolver(source, script string) (*PACResolver, error) {
+	vm := goja.New()
+	vm.Set("dnsResolve", pacDNSResolve)
+	vm.Set("myIpAddress", pacMyIPAddress)
+
+	if _, err := vm.RunString(pacHelpers); err != nil {
+		return nil, fmt.Errorf("failed to load PAC helpers: %v", err)
+	}
+	if _, err := vm.RunString(script); err != nil {
+		return nil, fmt.Errorf("failed to evaluate PAC script: %v", err)
+	}
+
+	findProxy, ok := goja.AssertFunction(vm.Get("FindProxyForURL"))
+	if !ok {
+		return nil, fmt.Errorf("PAC script does not define FindProxyForURL")
+	}
+
+	return &PACResolver{
+		source:     source,
+		vm:         vm,
+		findProxy:  findProxy,
+		cache:      make(map[string]*list.Element),
+		cacheOrder: list.New(),
+	}, nil
+}
+
+// Source 获取PAC脚本来源
+func (pr *PACResolver) Source() string {
+	return pr.source
+}
+
+// FindProxy 获取目标URL的代理链，结果按主机缓存
+func (pr *PACResolver) FindProxy(targetURL string) ([]PACProxy, error) {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	host := parsed.Hostname()
+
+	if chain, cached := pr.cached(host); cached {
+		return chain, nil
+	}
+
+	pr.vmMutex.Lock()
+	timer := time.AfterFunc(pacEvalTimeout, func() {
+		pr.vm.Interrupt("PAC evaluation timeout")
+	})
+	result, err := pr.findProxy(goja.Undefined(), pr.vm.ToValue(targetURL), pr.vm.ToValue(host))
+	timer.Stop()
+	pr.vm.ClearInterrupt()
+	pr.vmMutex.Unlock()
+
+	if err != nil {
+		return nil, fmt.Errorf("FindProxyForURL failed: %v", err)
+	}
+
+	chain := ParsePACResult(result.String())
+	pr.store(host, chain)
+	return chain, nil
+}
+
+// cached 获取未过期的缓存结果
+func (pr *PACResolver) cached(host string) ([]PACProxy, bool) {
+	pr.cacheMutex.Lock()
+	defer pr.cacheMutex.Unlock()
+
+	element, exists := pr.cache[host]
+	if !exists {
+		return nil, false
+	}
+	entry := element.Value.(*pacCacheEntry)
+	if time.Now().After(entry.expires) {
+		pr.cacheOrder.Remove(element)
+		delete(pr.cache, host)
+		return nil, false
+	}
+	pr.cacheOrder.MoveToFront(element)
+	return entry.chain, true
+}
+
+// store 缓存主机的解析结果，超过上限时淘汰最久未使用的主机
+func (pr *PACResolver) store(host string, chain []PACProxy) {
+	pr.cacheMutex.Lock()
+	defer pr.cacheMutex.Unlock()
+
+	entry := &pacCacheEntry{host: host, chain: chain, expires: time.Now().Add(pacCacheTTL)}
+	if element, exists := pr.cache[host]; exists {
+		element.Value = entry
+		pr.cacheOrder.MoveToFront(element)
+		return
+	}
+	pr.cache[host] = pr.cacheOrder.PushFront(entry)
+	for pr.cacheOrder.Len() > pacCacheMaxEntries {
+		oldest := pr.cacheOrder.Back()
+		pr.cacheOrder.Remove(oldest)
+		delete(pr.cache, oldest.Value.(*pacCacheEntry).host)
+	}
+}
+
+// ClearCache 清空解析缓存
+func (pr *PACResolver) ClearCache() {
+	pr.cacheMutex.Lock()
+	defer pr.cacheMutex.Unlock()
+	pr.cache = make(map[string]*list.Element)
+	pr.cacheOrder.Init()
+}
+
+// pacDNSResolve 解析主机的IPv4地址，失败返回null
+func pacDNSResolve(host string) interface{} {
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		return ip.String()
+	}
+	addrs, err := net.LookupIP(host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ip4 := addr.To4(); ip4 != nil {
+			return ip4.String()
+		}
+	}
+	return nil
+}
+
+// pacMyIPAddress 返回本机第一个非回环IPv4地址
+func pacMyIPAddress() string {
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+				if ip4 := ipNet.IP.To4(); ip4 != nil {
+					return ip4.String()
+				}
+			}
+		}
+	}
+	return "127.0.0.1"
+}
+
+// GeneratePAC 生成指向ProxyWoman的PAC脚本，bypass中的主机模式直连
+func GeneratePAC(proxyAddr string, bypass []string) string {
+	var sb strings.Builder
+	sb.WriteString("function FindProxyForURL(url, host) {\n")
+	sb.WriteString("\tif (isPlainHostName(host) || host === \"localhost\" || shExpMatch(host, \"127.*\")) {\n")
+	sb.WriteString("\t\treturn \"DIRECT\";\n")
+	sb.WriteString("\t}\n")
+	for _, pattern := range bypass {
+		fmt.Fprintf(&sb, "\tif (shExpMatch(host, %q)) {\n\t\treturn \"DIRECT\";\n\t}\n", pattern)
+	}
+	fmt.Fprintf(&sb, "\treturn \"PROXY %s; DIRECT\";\n", proxyAddr)
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// PACFileInterceptor 当客户端直接请求代理的 /proxy.pac 时返回自动配置脚本
+type PACFileInterceptor struct {
+	bypass []string
+}
+
+// NewPACFileInterceptor 创建PAC文件拦截器
+func NewPACFileInterceptor(bypass []string) *PACFileInterceptor {
+	return &PACFileInterceptor{
+		bypass: bypass,
+	}
+}
+
+// InterceptRequest 拦截请求
+func (pfi *PACFileInterceptor) InterceptRequest(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
+	// 只处理直接发往代理自身（非代理形式的绝对URL）的请求
+	if r.URL.IsAbs() || r.URL.Path != "/proxy.pac" {
+		return false, nil
+	}
+
+	flow.AddTag("pac-file")
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write([]byte(GeneratePAC(r.Host, pfi.bypass)))
+	return true, err
+}
@@ -0,0 +1,166 @@
+package features
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParsePACResult(t *testing.T) {
+	chain := ParsePACResult("PROXY a.example:8080; SOCKS b.example:1080;DIRECT")
+	if len(chain) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(chain))
+	}
+	if chain[0].ProxyURL() != "http://a.example:8080" {
+		t.Errorf("unexpected proxy URL: %s", chain[0].ProxyURL())
+	}
+	if chain[1].ProxyURL() != "socks5://b.example:1080" {
+		t.Errorf("unexpected socks URL: %s", chain[1].ProxyURL())
+	}
+	if chain[2].Type != "DIRECT" {
+		t.Errorf("expected DIRECT, got %s", chain[2].Type)
+	}
+
+	if chain := ParsePACResult(""); len(chain) != 1 || chain[0].Type != "DIRECT" {
+		t.Errorf("empty result should mean DIRECT, got %v", chain)
+	}
+}
+
+func TestPACResolverHelpersAndCache(t *testing.T) {
+	var calls int32
+	resolver, err := NewPACResolver("inline", `
+		function FindProxyForURL(url, host) {
+			countCall();
+			if (isPlainHostName(host) || dnsDomainIs(host, ".internal.example")) {
+				return "DIRECT";
+			}
+			if (shExpMatch(host, "*.corp.example")) {
+				return "PROXY corp:3128; DIRECT";
+			}
+			return "SOCKS socks:1080";
+		}`)
+	if err != nil {
+		t.Fatalf("compile PAC: %v", err)
+	}
+	resolver.vm.Set("countCall", func() { atomic.AddInt32(&calls, 1) })
+
+	cases := map[string]string{
+		"http://intranet/":               "DIRECT",
+		"https://wiki.internal.example/": "DIRECT",
+		"https://git.corp.example/repo":  "PROXY corp:3128",
+		"https://example.com/":           "SOCKS socks:1080",
+	}
+	for target, want := range cases {
+		chain, err := resolver.FindProxy(target)
+		if err != nil {
+			t.Fatalf("FindProxy(%s): %v", target, err)
+		}
+		if chain[0].String() != want {
+			t.Errorf("FindProxy(%s) = %s, want %s", target, chain[0], want)
+		}
+	}
+
+	resolver.FindProxy("https://git.corp.example/other")
+	if got := atomic.LoadInt32(&calls); got != int32(len(cases)) {
+		t.Errorf("expected results to be cached per host, got %d evaluations", got)
+	}
+}
+
+func TestPACFailoverToNextProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("direct"))
+	}))
+	defer target.Close()
+
+	// 先占用再释放一个端口，保证第一个代理不可用
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadAddr := dead.Addr().String()
+	dead.Close()
+
+	resolver, err := NewPACResolver("inline", `
+		function FindProxyForURL(url, host) {
+			return "PROXY `+deadAddr+`; DIRECT";
+		}`)
+	if err != nil {
+		t.Fatalf("compile PAC: %v", err)
+	}
+
+	manager := NewUpstreamManager(nil)
+	manager.SetPAC(resolver)
+
+	_, body, _, err := roundTripUpstream(manager, target.URL+"/x")
+	if err != nil {
+		t.Fatalf("expected failover to DIRECT: %v", err)
+	}
+	if body != "direct" {
+		t.Errorf("unexpected body: %q", body)
+	}
+	if stats := manager.GetProxyStats("pac:PROXY " + deadAddr); stats["errors"].(int64) != 1 {
+		t.Errorf("expected dead proxy error to be counted, got %v", stats)
+	}
+}
+
+func TestPACResolverCache(t *testing.T) {
+	resolver, err := NewPACResolver("inline", `
+		var calls = 0;
+		function FindProxyForURL(url, host) {
+			calls++;
+			return "DIRECT";
+		}`)
+	if err != nil {
+		t.Fatalf("compile PAC: %v", err)
+	}
+	calls := func() int64 { return resolver.vm.Get("calls").ToInteger() }
+
+	resolver.FindProxy("http://a.test/1")
+	resolver.FindProxy("http://a.test/2")
+	if calls() != 1 {
+		t.Fatalf("expected the second lookup to hit the cache, calls = %d", calls())
+	}
+
+	// 过期的结果重新解析
+	resolver.cache["a.test"].Value.(*pacCacheEntry).expires = time.Now().Add(-time.Second)
+	resolver.FindProxy("http://a.test/")
+	if calls() != 2 {
+		t.Fatalf("expected an expired entry to be resolved again, calls = %d", calls())
+	}
+
+	// 超过上限时淘汰最久未使用的主机
+	for i := 0; i < pacCacheMaxEntries; i++ {
+		resolver.FindProxy(fmt.Sprintf("http://host%d.test/", i))
+	}
+	if len(resolver.cache) != pacCacheMaxEntries || resolver.cacheOrder.Len() != pacCacheMaxEntries {
+		t.Fatalf("cache size = %d/%d", len(resolver.cache), resolver.cacheOrder.Len())
+	}
+	if _, exists := resolver.cache["a.test"]; exists {
+		t.Error("least recently used host should be evicted")
+	}
+
+	manager := NewUpstreamManager(nil)
+	manager.SetPAC(resolver)
+	manager.SetPAC(nil)
+	if len(resolver.cache) != 0 {
+		t.Error("replacing the PAC should clear the old cache")
+	}
+}
+
+func TestGeneratePAC(t *testing.T) {
+	script := GeneratePAC("127.0.0.1:8080", []string{"*.local"})
+	resolver, err := NewPACResolver("generated", script)
+	if err != nil {
+		t.Fatalf("generated PAC does not compile: %v", err)
+	}
+	chain, _ := resolver.FindProxy("http://printer.local/")
+	if chain[0].Type != "DIRECT" {
+		t.Errorf("expected bypass host to be DIRECT, got %s", chain[0])
+	}
+	chain, _ = resolver.FindProxy("https://example.com/")
+	if !strings.HasPrefix(chain[0].String(), "PROXY 127.0.0.1:8080") {
+		t.Errorf("expected ProxyWoman as proxy, got %s", chain[0])
+	}
+}
@@ -0,0 +1,39 @@
+package features
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+// newTestProxy 启动挂载给定拦截器的代理，拦截器按实现的接口依次注册为CONNECT、请求和响应拦截器；
+// 返回代理服务器（启动后仍可设置上游、TLS策略等）、经代理访问的客户端和Flow通道
+func newTestProxy(t *testing.T, interceptors ...interface{}) (*proxycore.ProxyServer, *http.Client, chan *proxycore.Flow) {
+	t.Helper()
+	ps := proxycore.NewProxyServer(0, nil)
+	for _, interceptor := range interceptors {
+		if connect, ok := interceptor.(proxycore.ConnectInterceptor); ok {
+			ps.AddConnectInterceptor(connect)
+		}
+		if request, ok := interceptor.(proxycore.RequestInterceptor); ok {
+			ps.AddRequestInterceptor(request)
+		}
+		if response, ok := interceptor.(proxycore.ResponseInterceptor); ok {
+			ps.AddResponseInterceptor(response)
+		}
+	}
+	flows := make(chan *proxycore.Flow, 1)
+	ps.SetFlowHandler(func(flow *proxycore.Flow) { flows <- flow })
+
+	proxy := httptest.NewServer(ps)
+	t.Cleanup(proxy.Close)
+	proxyURL, _ := url.Parse(proxy.URL)
+	return ps, &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+		Timeout:   5 * time.Second,
+	}, flows
+}
@@ -1,6 +1,7 @@
 package features
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -65,6 +66,11 @@ func (rm *ReplayManager) ReplayFlow(flow *proxycore.Flow) (*ReplayResponse, erro
 
 // SendRequest 发送自定义请求
 func (rm *ReplayManager) SendRequest(replayReq *ReplayRequest) (*ReplayResponse, error) {
+	return rm.SendRequestContext(context.Background(), replayReq)
+}
+
+// SendRequestContext 发送自定义请求，ctx取消或超时时中止请求
+func (rm *ReplayManager) SendRequestContext(ctx context.Context, replayReq *ReplayRequest) (*ReplayResponse, error) {
 	startTime := time.Now()
 
 	// 解析URL
@@ -82,7 +88,7 @@ func (rm *ReplayManager) SendRequest(replayReq *ReplayRequest) (*ReplayResponse,
 	}
 
 	// 创建HTTP请求
-	req, err := http.NewRequest(replayReq.Method, parsedURL.String(), bodyReader)
+	req, err := http.NewRequestWithContext(ctx, replayReq.Method, parsedURL.String(), bodyReader)
 	if err != nil {
 		return &ReplayResponse{
 			Error: fmt.Sprintf("Failed to create request: %v", err),
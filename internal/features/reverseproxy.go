@@ -1,14 +1,18 @@
 package features
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 
+	"ProxyWoman/internal/certmanager"
 	"ProxyWoman/internal/proxycore"
 )
 
@@ -23,6 +27,27 @@ type ReverseProxyRule struct {
 	StripPath   bool   `json:"stripPath"`   // 是否去除路径前缀
 	AddHeaders  map[string]string `json:"addHeaders"`  // 添加的请求头
 	Description string `json:"description"`
+	Host        string `json:"host"`       // 匹配的Host，支持 *.example.com 通配，为空时匹配任意Host
+	ListenerID  string `json:"listenerId"` // 绑定的监听器，为空时对所有入口生效
+}
+
+// ReverseProxyListener 反向代理监听器，每个监听器绑定独立端口
+type ReverseProxyListener struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Port        int    `json:"port"`
+	TLS         bool   `json:"tls"`
+	CertFile    string `json:"certFile"` // 证书文件，为空时使用CA按SNI签发
+	KeyFile     string `json:"keyFile"`
+	Enabled     bool   `json:"enabled"`
+	Description string `json:"description"`
+}
+
+// ReverseProxyStorage 反向代理监听器存储接口
+type ReverseProxyStorage interface {
+	SaveReverseProxyListener(listener *ReverseProxyListener) error
+	GetReverseProxyListeners() ([]*ReverseProxyListener, error)
+	DeleteReverseProxyListener(id string) error
 }
 
 // ReverseProxyManager 反向代理管理器
@@ -30,14 +55,60 @@ type ReverseProxyManager struct {
 	rules      map[string]*ReverseProxyRule
 	rulesMutex sync.RWMutex
 	proxies    map[string]*httputil.ReverseProxy
+
+	// 反向代理监听器
+	listeners      map[string]*ReverseProxyListener
+	servers        map[string]*ReverseProxyServer
+	listenersMutex sync.Mutex
+	started        bool
+	proxyServer    *proxycore.ProxyServer
+	certManager    *certmanager.CertManager
+	storage        ReverseProxyStorage
 }
 
 // NewReverseProxyManager 创建反向代理管理器
-func NewReverseProxyManager() *ReverseProxyManager {
-	return &ReverseProxyManager{
-		rules:   make(map[string]*ReverseProxyRule),
-		proxies: make(map[string]*httputil.ReverseProxy),
+func NewReverseProxyManager(storage ReverseProxyStorage) *ReverseProxyManager {
+	manager := &ReverseProxyManager{
+		rules:     make(map[string]*ReverseProxyRule),
+		proxies:   make(map[string]*httputil.ReverseProxy),
+		listeners: make(map[string]*ReverseProxyListener),
+		servers:   make(map[string]*ReverseProxyServer),
+		storage:   storage,
 	}
+
+	// 从数据库加载监听器，代理启动时开始监听
+	manager.loadListenersFromStorage()
+
+	return manager
+}
+
+// loadListenersFromStorage 从存储加载监听器，配置无效的监听器保留但停用
+func (rpm *ReverseProxyManager) loadListenersFromStorage() {
+	if rpm.storage == nil {
+		return
+	}
+
+	listeners, err := rpm.storage.GetReverseProxyListeners()
+	if err != nil {
+		fmt.Printf("Failed to load reverse proxy listeners from storage: %v\n", err)
+		return
+	}
+	for _, listener := range listeners {
+		if err := validateReverseProxyListener(listener); err != nil {
+			fmt.Printf("Reverse proxy listener %s: %v\n", listener.ID, err)
+			listener.Enabled = false
+		}
+		rpm.listeners[listener.ID] = listener
+	}
+}
+
+// SetProxyServer 设置代理服务器，监听器收到的请求交给它处理，以记录Flow并执行拦截器链
+func (rpm *ReverseProxyManager) SetProxyServer(ps *proxycore.ProxyServer, cm *certmanager.CertManager) {
+	rpm.listenersMutex.Lock()
+	defer rpm.listenersMutex.Unlock()
+
+	rpm.proxyServer = ps
+	rpm.certManager = cm
 }
 
 // AddRule 添加反向代理规则
@@ -148,13 +219,26 @@ func (rpm *ReverseProxyManager) GetAllRules() []*ReverseProxyRule {
 
 // MatchRule 匹配反向代理规则
 func (rpm *ReverseProxyManager) MatchRule(path string) (*ReverseProxyRule, *httputil.ReverseProxy) {
+	return rpm.MatchRequest("", "", path)
+}
+
+// MatchRequest 按监听器、Host和路径匹配反向代理规则。
+// 指定了Host的规则优先于未指定的，同类规则中监听路径更长的优先
+func (rpm *ReverseProxyManager) MatchRequest(listenerID, host, path string) (*ReverseProxyRule, *httputil.ReverseProxy) {
 	rpm.rulesMutex.RLock()
 	defer rpm.rulesMutex.RUnlock()
 	
+	candidates := make([]*ReverseProxyRule, 0, len(rpm.rules))
 	for _, rule := range rpm.rules {
 		if !rule.Enabled {
 			continue
 		}
+		if rule.ListenerID != "" && rule.ListenerID != listenerID {
+			continue
+		}
+		if rule.Host != "" && !matchHost(rule.Host, host) {
+			continue
+		}
 		
 		matched, err := rpm.matchPath(path, rule)
 		if err != nil {
@@ -162,12 +246,26 @@ func (rpm *ReverseProxyManager) MatchRule(path string) (*ReverseProxyRule, *http
 		}
 		
 		if matched {
-			proxy := rpm.proxies[rule.ID]
-			return rule, proxy
+			candidates = append(candidates, rule)
 		}
 	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if (a.Host != "") != (b.Host != "") {
+			return a.Host != ""
+		}
+		if len(a.ListenPath) != len(b.ListenPath) {
+			return len(a.ListenPath) > len(b.ListenPath)
+		}
+		return a.ID < b.ID
+	})
 	
-	return nil, nil
+	rule := candidates[0]
+	return rule, rpm.proxies[rule.ID]
 }
 
 // matchPath 匹配路径
@@ -184,6 +282,84 @@ func (rpm *ReverseProxyManager) matchPath(path string, rule *ReverseProxyRule) (
 	}
 }
 
+// matchHost 匹配Host，模式不含端口时忽略请求中的端口
+func matchHost(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	host = strings.ToLower(host)
+	if !strings.Contains(pattern, ":") {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return host == pattern
+}
+
+// stripListenPath 按规则去除监听路径前缀
+func stripListenPath(rule *ReverseProxyRule, path string) string {
+	if !rule.StripPath || rule.ListenPath == "/" || !strings.HasPrefix(path, rule.ListenPath) {
+		return path
+	}
+	path = strings.TrimPrefix(path, rule.ListenPath)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// rewriteRequest 把监听器收到的请求改写为发往规则目标的绝对URL请求
+func (rpm *ReverseProxyManager) rewriteRequest(rule *ReverseProxyRule, r *http.Request, scheme string) (*http.Request, error) {
+	target, err := url.Parse(rule.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+
+	outURL := &url.URL{
+		Scheme:   target.Scheme,
+		Host:     target.Host,
+		Path:     joinURLPath(target.Path, stripListenPath(rule, r.URL.Path)),
+		RawQuery: r.URL.RawQuery,
+	}
+	if target.RawQuery != "" {
+		if outURL.RawQuery == "" {
+			outURL.RawQuery = target.RawQuery
+		} else {
+			outURL.RawQuery = target.RawQuery + "&" + outURL.RawQuery
+		}
+	}
+
+	outReq := r.Clone(r.Context())
+	outReq.URL = outURL
+	outReq.Host = target.Host
+	outReq.RequestURI = ""
+
+	// 标准转发头
+	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+			clientIP = prior + ", " + clientIP
+		}
+		outReq.Header.Set("X-Forwarded-For", clientIP)
+	}
+	outReq.Header.Set("X-Forwarded-Host", r.Host)
+	outReq.Header.Set("X-Forwarded-Proto", scheme)
+
+	for key, value := range rule.AddHeaders {
+		outReq.Header.Set(key, value)
+	}
+	return outReq, nil
+}
+
+// joinURLPath 拼接目标路径与请求路径
+func joinURLPath(base, path string) string {
+	if base == "" {
+		return path
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
 // ReverseProxyInterceptor 反向代理拦截器
 type ReverseProxyInterceptor struct {
 	manager *ReverseProxyManager
@@ -198,7 +374,11 @@ func NewReverseProxyInterceptor(manager *ReverseProxyManager) *ReverseProxyInter
 
 // InterceptRequest 拦截请求
 func (rpi *ReverseProxyInterceptor) InterceptRequest(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
-	rule, proxy := rpi.manager.MatchRule(r.URL.Path)
+	if flow.HasTag("reverse-proxy") {
+		return false, nil // 来自反向代理监听器的请求已改写为目标地址
+	}
+
+	rule, proxy := rpi.manager.MatchRequest("", r.Host, r.URL.Path)
 	if rule == nil || proxy == nil {
 		return false, nil // 不处理，继续正常代理
 	}
@@ -219,10 +399,16 @@ func (rpi *ReverseProxyInterceptor) InterceptRequest(flow *proxycore.Flow, w htt
 
 // ReverseProxyServer 反向代理服务器
 type ReverseProxyServer struct {
-	manager *ReverseProxyManager
-	server  *http.Server
-	port    int
-	running bool
+	manager  *ReverseProxyManager
+	server   *http.Server
+	port     int
+	running  bool
+	listener *ReverseProxyListener
+
+	// 设置后请求经代理服务器处理，记录Flow并执行拦截器链
+	proxyServer *proxycore.ProxyServer
+	certManager *certmanager.CertManager
+	addr        net.Addr
 }
 
 // NewReverseProxyServer 创建反向代理服务器
@@ -234,39 +420,50 @@ func NewReverseProxyServer(port int, manager *ReverseProxyManager) *ReverseProxy
 	}
 }
 
+// NewReverseProxyListenerServer 为监听器创建反向代理服务器
+func NewReverseProxyListenerServer(listener *ReverseProxyListener, manager *ReverseProxyManager, ps *proxycore.ProxyServer, cm *certmanager.CertManager) *ReverseProxyServer {
+	return &ReverseProxyServer{
+		manager:     manager,
+		port:        listener.Port,
+		listener:    listener,
+		proxyServer: ps,
+		certManager: cm,
+	}
+}
+
 // Start 启动反向代理服务器
 func (rps *ReverseProxyServer) Start() error {
 	if rps.running {
 		return fmt.Errorf("reverse proxy server is already running")
 	}
 
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", rps.port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %d: %v", rps.port, err)
+	}
+
+	if rps.listener != nil && rps.listener.TLS {
+		tlsConfig, err := rps.tlsConfig()
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
 	mux := http.NewServeMux()
 	
 	// 处理所有请求
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		rule, proxy := rps.manager.MatchRule(r.URL.Path)
-		if rule != nil && proxy != nil {
-			// 设置响应头
-			w.Header().Set("X-ProxyWoman-ReverseProxy", "true")
-			w.Header().Set("X-ProxyWoman-Rule", rule.Name)
-			
-			// 执行反向代理
-			proxy.ServeHTTP(w, r)
-		} else {
-			// 没有匹配的规则，返回404
-			http.NotFound(w, r)
-		}
-	})
+	mux.HandleFunc("/", rps.handle)
 
 	rps.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", rps.port),
 		Handler: mux,
 	}
-
+	rps.addr = ln.Addr()
 	rps.running = true
 
 	go func() {
-		if err := rps.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := rps.server.Serve(ln); err != nil && err != http.ErrServerClosed {
 			fmt.Printf("Reverse proxy server error: %v\n", err)
 		}
 	}()
@@ -274,6 +471,67 @@ func (rps *ReverseProxyServer) Start() error {
 	return nil
 }
 
+// tlsConfig 创建HTTPS监听的TLS配置：优先使用提供的证书，否则由CA按SNI签发
+func (rps *ReverseProxyServer) tlsConfig() (*tls.Config, error) {
+	if rps.listener.CertFile != "" || rps.listener.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(rps.listener.CertFile, rps.listener.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %v", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+	}
+
+	if rps.certManager == nil {
+		return nil, fmt.Errorf("no certificate configured for listener %s", rps.listener.Name)
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name = "localhost"
+			}
+			return rps.certManager.GenerateServerCert(name)
+		},
+	}, nil
+}
+
+// handle 处理反向代理请求
+func (rps *ReverseProxyServer) handle(w http.ResponseWriter, r *http.Request) {
+	listenerID := ""
+	if rps.listener != nil {
+		listenerID = rps.listener.ID
+	}
+
+	rule, proxy := rps.manager.MatchRequest(listenerID, r.Host, r.URL.Path)
+	if rule == nil || proxy == nil {
+		// 没有匹配的规则，返回404
+		http.NotFound(w, r)
+		return
+	}
+
+	// 设置响应头
+	w.Header().Set("X-ProxyWoman-ReverseProxy", "true")
+	w.Header().Set("X-ProxyWoman-Rule", rule.Name)
+
+	if rps.proxyServer == nil {
+		// 执行反向代理
+		proxy.ServeHTTP(w, r)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	outReq, err := rps.manager.rewriteRequest(rule, r, scheme)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	rps.proxyServer.HandleRequest(w, outReq, "reverse-proxy", fmt.Sprintf("reverse-proxy-%s", rule.Name))
+}
+
 // Stop 停止反向代理服务器
 func (rps *ReverseProxyServer) Stop() error {
 	if !rps.running {
@@ -291,3 +549,164 @@ func (rps *ReverseProxyServer) Stop() error {
 func (rps *ReverseProxyServer) IsRunning() bool {
 	return rps.running
 }
+
+// Addr 获取实际监听地址，未运行时返回nil
+func (rps *ReverseProxyServer) Addr() net.Addr {
+	return rps.addr
+}
+
+// AddListener 添加反向代理监听器，监听器已启动时立即开始监听
+func (rpm *ReverseProxyManager) AddListener(listener *ReverseProxyListener) error {
+	if err := validateReverseProxyListener(listener); err != nil {
+		return err
+	}
+
+	rpm.listenersMutex.Lock()
+	defer rpm.listenersMutex.Unlock()
+
+	if _, exists := rpm.listeners[listener.ID]; exists {
+		return fmt.Errorf("listener already exists: %s", listener.ID)
+	}
+	if rpm.storage != nil {
+		if err := rpm.storage.SaveReverseProxyListener(listener); err != nil {
+			return fmt.Errorf("failed to save reverse proxy listener: %v", err)
+		}
+	}
+	rpm.listeners[listener.ID] = listener
+	if rpm.started && listener.Enabled {
+		return rpm.startListenerLocked(listener)
+	}
+	return nil
+}
+
+// UpdateListener 更新反向代理监听器，运行中的监听器会按新配置重启
+func (rpm *ReverseProxyManager) UpdateListener(listener *ReverseProxyListener) error {
+	if err := validateReverseProxyListener(listener); err != nil {
+		return err
+	}
+
+	rpm.listenersMutex.Lock()
+	defer rpm.listenersMutex.Unlock()
+
+	if _, exists := rpm.listeners[listener.ID]; !exists {
+		return fmt.Errorf("listener not found: %s", listener.ID)
+	}
+	if rpm.storage != nil {
+		if err := rpm.storage.SaveReverseProxyListener(listener); err != nil {
+			return fmt.Errorf("failed to save reverse proxy listener: %v", err)
+		}
+	}
+	rpm.stopListenerLocked(listener.ID)
+	rpm.listeners[listener.ID] = listener
+	if rpm.started && listener.Enabled {
+		return rpm.startListenerLocked(listener)
+	}
+	return nil
+}
+
+// RemoveListener 移除反向代理监听器
+func (rpm *ReverseProxyManager) RemoveListener(listenerID string) error {
+	rpm.listenersMutex.Lock()
+	defer rpm.listenersMutex.Unlock()
+
+	if rpm.storage != nil {
+		if err := rpm.storage.DeleteReverseProxyListener(listenerID); err != nil {
+			return fmt.Errorf("failed to delete reverse proxy listener: %v", err)
+		}
+	}
+	rpm.stopListenerLocked(listenerID)
+	delete(rpm.listeners, listenerID)
+	return nil
+}
+
+// GetAllListeners 获取所有反向代理监听器
+func (rpm *ReverseProxyManager) GetAllListeners() []*ReverseProxyListener {
+	rpm.listenersMutex.Lock()
+	defer rpm.listenersMutex.Unlock()
+
+	listeners := make([]*ReverseProxyListener, 0, len(rpm.listeners))
+	for _, listener := range rpm.listeners {
+		listeners = append(listeners, listener)
+	}
+	sort.Slice(listeners, func(i, j int) bool { return listeners[i].Port < listeners[j].Port })
+	return listeners
+}
+
+// GetListenerAddr 获取监听器的实际监听地址，未运行时返回空字符串
+func (rpm *ReverseProxyManager) GetListenerAddr(listenerID string) string {
+	rpm.listenersMutex.Lock()
+	defer rpm.listenersMutex.Unlock()
+
+	server, exists := rpm.servers[listenerID]
+	if !exists || server.Addr() == nil {
+		return ""
+	}
+	return server.Addr().String()
+}
+
+// StartListeners 启动所有启用的监听器，单个监听器失败不影响其他监听器
+func (rpm *ReverseProxyManager) StartListeners() error {
+	rpm.listenersMutex.Lock()
+	defer rpm.listenersMutex.Unlock()
+
+	rpm.started = true
+	var failed []string
+	for _, listener := range rpm.listeners {
+		if !listener.Enabled {
+			continue
+		}
+		if err := rpm.startListenerLocked(listener); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", listener.Name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to start reverse proxy listeners: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// StopListeners 停止所有监听器
+func (rpm *ReverseProxyManager) StopListeners() {
+	rpm.listenersMutex.Lock()
+	defer rpm.listenersMutex.Unlock()
+
+	rpm.started = false
+	for id := range rpm.servers {
+		rpm.stopListenerLocked(id)
+	}
+}
+
+// startListenerLocked 启动单个监听器，调用方需持有listenersMutex
+func (rpm *ReverseProxyManager) startListenerLocked(listener *ReverseProxyListener) error {
+	if rpm.proxyServer == nil {
+		return fmt.Errorf("proxy server not set")
+	}
+	server := NewReverseProxyListenerServer(listener, rpm, rpm.proxyServer, rpm.certManager)
+	if err := server.Start(); err != nil {
+		return err
+	}
+	rpm.servers[listener.ID] = server
+	return nil
+}
+
+// stopListenerLocked 停止单个监听器，调用方需持有listenersMutex
+func (rpm *ReverseProxyManager) stopListenerLocked(listenerID string) {
+	if server, exists := rpm.servers[listenerID]; exists {
+		server.Stop()
+		delete(rpm.servers, listenerID)
+	}
+}
+
+// validateReverseProxyListener 校验监听器配置
+func validateReverseProxyListener(listener *ReverseProxyListener) error {
+	if listener.ID == "" {
+		return fmt.Errorf("listener ID is required")
+	}
+	if listener.Port < 0 || listener.Port > 65535 {
+		return fmt.Errorf("invalid listener port: %d", listener.Port)
+	}
+	if (listener.CertFile == "") != (listener.KeyFile == "") {
+		return fmt.Errorf("certFile and keyFile must be provided together")
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package features
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ProxyWoman/internal/certmanager"
+	"ProxyWoman/internal/proxycore"
+)
+
+// tagInterceptor 记录经过拦截器链的请求
+type tagInterceptor struct {
+	seen chan string
+}
+
+func (ti *tagInterceptor) InterceptRequest(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
+	ti.seen <- flow.URL
+	return false, nil
+}
+
+// startReverseListener 启动随机端口的反向代理监听器，返回监听地址
+func startReverseListener(t *testing.T, manager *ReverseProxyManager, listener *ReverseProxyListener) string {
+	t.Helper()
+	if err := manager.AddListener(listener); err != nil {
+		t.Fatalf("add listener: %v", err)
+	}
+	t.Cleanup(manager.StopListeners)
+	addr := manager.GetListenerAddr(listener.ID)
+	if addr == "" {
+		t.Fatal("listener not running")
+	}
+	return strings.Replace(addr, "[::]", "127.0.0.1", 1)
+}
+
+func TestReverseProxyListenerHostAndPathRouting(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("api " + r.URL.Path + " " + r.Header.Get("X-Forwarded-Host")))
+	}))
+	defer api.Close()
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("web " + r.URL.Path))
+	}))
+	defer web.Close()
+
+	ps := proxycore.NewProxyServer(0, nil)
+	seen := &tagInterceptor{seen: make(chan string, 4)}
+	ps.AddRequestInterceptor(seen)
+	flows := make(chan *proxycore.Flow, 4)
+	ps.SetFlowHandler(func(flow *proxycore.Flow) { flows <- flow })
+
+	manager := NewReverseProxyManager(nil)
+	manager.SetProxyServer(ps, nil)
+	manager.AddRule(&ReverseProxyRule{ID: "api", Name: "api", Host: "api.test", ListenPath: "/v1", TargetURL: api.URL + "/backend", StripPath: true, Enabled: true, ListenerID: "main"})
+	manager.AddRule(&ReverseProxyRule{ID: "web", Name: "web", ListenPath: "/", TargetURL: web.URL, Enabled: true})
+	manager.StartListeners()
+	addr := startReverseListener(t, manager, &ReverseProxyListener{ID: "main", Name: "main", Enabled: true})
+
+	get := func(host, path string) string {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+path, nil)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if body := get("api.test:8000", "/v1/users"); body != "api /backend/users api.test:8000" {
+		t.Errorf("unexpected api body: %q", body)
+	}
+	if body := get("other.test", "/v1/users"); body != "web /v1/users" {
+		t.Errorf("expected host mismatch to fall back to path rule, got %q", body)
+	}
+
+	select {
+	case flow := <-flows:
+		if !flow.HasTag("reverse-proxy") || !strings.HasPrefix(flow.URL, api.URL) {
+			t.Errorf("unexpected flow: %s %v", flow.URL, flow.Tags)
+		}
+		if flow.Response == nil || flow.StatusCode != http.StatusOK {
+			t.Error("expected flow to capture the response")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("flow not recorded")
+	}
+	if url := <-seen.seen; !strings.HasPrefix(url, api.URL) {
+		t.Errorf("expected interceptor chain to see target URL, got %s", url)
+	}
+}
+
+func TestReverseProxyListenerGeneratedTLS(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proto " + r.Header.Get("X-Forwarded-Proto")))
+	}))
+	defer backend.Close()
+
+	cm := certmanager.NewCertManager(t.TempDir())
+	if err := cm.InitCA(); err != nil {
+		t.Fatalf("init CA: %v", err)
+	}
+
+	manager := NewReverseProxyManager(nil)
+	manager.SetProxyServer(proxycore.NewProxyServer(0, cm), cm)
+	manager.AddRule(&ReverseProxyRule{ID: "all", Name: "all", ListenPath: "/", TargetURL: backend.URL, Enabled: true})
+	manager.StartListeners()
+	addr := startReverseListener(t, manager, &ReverseProxyListener{ID: "tls", Name: "tls", TLS: true, Enabled: true})
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, ServerName: "app.test"}}}
+	resp, err := client.Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "proto https" {
+		t.Errorf("unexpected body: %q", body)
+	}
+	if cn := resp.TLS.PeerCertificates[0].Subject.CommonName; cn != "app.test" {
+		t.Errorf("expected certificate for SNI name, got %s", cn)
+	}
+}
+
+// memoryListenerStorage 内存中的反向代理监听器存储
+type memoryListenerStorage struct {
+	listeners map[string]ReverseProxyListener
+}
+
+func (m *memoryListenerStorage) SaveReverseProxyListener(listener *ReverseProxyListener) error {
+	m.listeners[listener.ID] = *listener
+	return nil
+}
+
+func (m *memoryListenerStorage) GetReverseProxyListeners() ([]*ReverseProxyListener, error) {
+	var listeners []*ReverseProxyListener
+	for _, listener := range m.listeners {
+		listener := listener
+		listeners = append(listeners, &listener)
+	}
+	return listeners, nil
+}
+
+func (m *memoryListenerStorage) DeleteReverseProxyListener(id string) error {
+	delete(m.listeners, id)
+	return nil
+}
+
+func TestReverseProxyListenersPersist(t *testing.T) {
+	storage := &memoryListenerStorage{listeners: make(map[string]ReverseProxyListener)}
+	manager := NewReverseProxyManager(storage)
+	manager.AddListener(&ReverseProxyListener{ID: "api", Name: "api", Port: 9001, Enabled: true})
+	manager.AddListener(&ReverseProxyListener{ID: "web", Name: "web", Port: 9002, Enabled: true})
+	manager.UpdateListener(&ReverseProxyListener{ID: "web", Name: "web", Port: 9003, TLS: true, Enabled: true})
+	manager.RemoveListener("api")
+
+	listeners := NewReverseProxyManager(storage).GetAllListeners()
+	if len(listeners) != 1 || listeners[0].ID != "web" || listeners[0].Port != 9003 || !listeners[0].TLS {
+		t.Fatalf("unexpected listeners after reload: %+v", listeners)
+	}
+}
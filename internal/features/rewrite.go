@@ -0,0 +1,525 @@
+package features
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+// 改写规则作用的阶段
+const (
+	RewritePhaseRequest  = "request"
+	RewritePhaseResponse = "response"
+	RewritePhaseBoth     = "both"
+)
+
+// 改写操作类型
+const (
+	RewriteAddHeader     = "add-header"     // 添加头部：Name, Value
+	RewriteRemoveHeader  = "remove-header"  // 删除头部：Name
+	RewriteReplaceHeader = "replace-header" // 替换已有头部：Name；Match为空时整体替换为Value，否则把值中的Match替换为Value
+	RewriteReplaceBody   = "replace-body"   // 替换消息体中的内容：Match, Value, IsRegex
+	RewriteSetQuery      = "set-query"      // 设置查询参数（仅请求）：Name, Value
+	RewriteSetStatus     = "set-status"     // 设置状态码（仅响应）：Value
+	RewriteSetJSON       = "set-json"       // 设置JSON字段：Name为点分路径，Value为JSON值（不是合法JSON时按字符串处理）
+	RewriteRenameCookie  = "rename-cookie"  // 重命名Cookie：Name -> Value
+	RewriteDropCookie    = "drop-cookie"    // 删除Cookie：Name
+)
+
+// RewriteOperation 单个改写操作
+type RewriteOperation struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Match   string `json:"match"`
+	IsRegex bool   `json:"isRegex"`
+}
+
+// RewriteRule 声明式改写规则
+type RewriteRule struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	URLPattern  string             `json:"urlPattern"`
+	IsRegex     bool               `json:"isRegex"`
+	Phase       string             `json:"phase"` // "request"、"response" 或 "both"
+	Enabled     bool               `json:"enabled"`
+	Operations  []RewriteOperation `json:"operations"`
+	Description string             `json:"description"`
+}
+
+// RewriteStorage 改写规则存储接口
+type RewriteStorage interface {
+	SaveRewriteRule(rule *RewriteRule) error
+	GetRewriteRules() ([]*RewriteRule, error)
+	DeleteRewriteRule(id string) error
+}
+
+// RewriteManager 改写规则管理器
+type RewriteManager struct {
+	rules      map[string]*RewriteRule
+	regexes    map[string]*regexp.Regexp // 操作中的正则，按表达式缓存
+	rulesMutex sync.RWMutex
+	storage    RewriteStorage
+}
+
+// NewRewriteManager 创建改写规则管理器
+func NewRewriteManager(storage RewriteStorage) *RewriteManager {
+	manager := &RewriteManager{
+		rules:   make(map[string]*RewriteRule),
+		regexes: make(map[string]*regexp.Regexp),
+		storage: storage,
+	}
+
+	// 从数据库加载规则
+	manager.loadRulesFromStorage()
+
+	return manager
+}
+
+// loadRulesFromStorage 从存储加载规则
+func (rm *RewriteManager) loadRulesFromStorage() {
+	if rm.storage == nil {
+		return
+	}
+
+	rules, err := rm.storage.GetRewriteRules()
+	if err != nil {
+		fmt.Printf("Failed to load rewrite rules from storage: %v\n", err)
+		return
+	}
+
+	rm.rulesMutex.Lock()
+	defer rm.rulesMutex.Unlock()
+
+	for _, rule := range rules {
+		if err := rm.validateLocked(rule); err != nil {
+			fmt.Printf("Rewrite rule %s: %v\n", rule.ID, err)
+			rule.Enabled = false
+		}
+		rm.rules[rule.ID] = rule
+	}
+}
+
+// validateLocked 检查规则并编译其中的正则，调用方需持有rulesMutex
+func (rm *RewriteManager) validateLocked(rule *RewriteRule) error {
+	if _, err := compileURLPattern(rule.URLPattern, rule.IsRegex); err != nil {
+		return fmt.Errorf("invalid URL pattern: %v", err)
+	}
+	switch rule.Phase {
+	case RewritePhaseRequest, RewritePhaseResponse, RewritePhaseBoth:
+	default:
+		return fmt.Errorf("unknown phase: %s", rule.Phase)
+	}
+
+	for i, op := range rule.Operations {
+		if err := validateRewriteOperation(rule.Phase, op); err != nil {
+			return fmt.Errorf("operation %d: %v", i+1, err)
+		}
+		if op.IsRegex {
+			regex, err := regexp.Compile(op.Match)
+			if err != nil {
+				return fmt.Errorf("operation %d: invalid regex: %v", i+1, err)
+			}
+			rm.regexes[op.Match] = regex
+		}
+	}
+	return nil
+}
+
+// validateRewriteOperation 检查操作参数及其是否适用于规则的阶段
+func validateRewriteOperation(phase string, op RewriteOperation) error {
+	switch op.Type {
+	case RewriteAddHeader, RewriteRemoveHeader, RewriteReplaceHeader, RewriteRenameCookie, RewriteDropCookie, RewriteSetJSON:
+		if op.Name == "" {
+			return fmt.Errorf("%s requires a name", op.Type)
+		}
+		if op.Type == RewriteRenameCookie && op.Value == "" {
+			return fmt.Errorf("%s requires a new name", op.Type)
+		}
+	case RewriteReplaceBody:
+		if op.Match == "" {
+			return fmt.Errorf("%s requires a match", op.Type)
+		}
+	case RewriteSetQuery:
+		if op.Name == "" {
+			return fmt.Errorf("%s requires a name", op.Type)
+		}
+		if phase == RewritePhaseResponse {
+			return fmt.Errorf("%s only applies to requests", op.Type)
+		}
+	case RewriteSetStatus:
+		status, err := strconv.Atoi(op.Value)
+		if err != nil || status < 100 || status > 999 {
+			return fmt.Errorf("invalid status code: %s", op.Value)
+		}
+		if phase == RewritePhaseRequest {
+			return fmt.Errorf("%s only applies to responses", op.Type)
+		}
+	default:
+		return fmt.Errorf("unknown operation: %s", op.Type)
+	}
+	return nil
+}
+
+// AddRule 添加或替换改写规则
+func (rm *RewriteManager) AddRule(rule *RewriteRule) error {
+	if rule.Phase == "" {
+		rule.Phase = RewritePhaseBoth
+	}
+
+	rm.rulesMutex.Lock()
+	defer rm.rulesMutex.Unlock()
+
+	if err := rm.validateLocked(rule); err != nil {
+		return err
+	}
+
+	// 保存到数据库
+	if rm.storage != nil {
+		if err := rm.storage.SaveRewriteRule(rule); err != nil {
+			return fmt.Errorf("failed to save rewrite rule: %v", err)
+		}
+	}
+
+	rm.rules[rule.ID] = rule
+	return nil
+}
+
+// RemoveRule 移除改写规则
+func (rm *RewriteManager) RemoveRule(ruleID string) error {
+	rm.rulesMutex.Lock()
+	defer rm.rulesMutex.Unlock()
+
+	// 从数据库删除
+	if rm.storage != nil {
+		if err := rm.storage.DeleteRewriteRule(ruleID); err != nil {
+			return fmt.Errorf("failed to delete rewrite rule: %v", err)
+		}
+	}
+
+	delete(rm.rules, ruleID)
+	return nil
+}
+
+// GetAllRules 获取所有改写规则，按ID排序
+func (rm *RewriteManager) GetAllRules() []*RewriteRule {
+	rm.rulesMutex.RLock()
+	defer rm.rulesMutex.RUnlock()
+
+	rules := make([]*RewriteRule, 0, len(rm.rules))
+	for _, rule := range rm.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// matchingRules 获取对URL和阶段生效的规则
+func (rm *RewriteManager) matchingRules(url, phase string) []*RewriteRule {
+	var matched []*RewriteRule
+	for _, rule := range rm.GetAllRules() {
+		if !rule.Enabled || (rule.Phase != RewritePhaseBoth && rule.Phase != phase) {
+			continue
+		}
+		matcher, err := compileURLPattern(rule.URLPattern, rule.IsRegex)
+		if err != nil || matcher.match(url) == nil {
+			continue
+		}
+		matched = append(matched, rule)
+	}
+	return matched
+}
+
+// rewriteMessage 改写过程中的消息：请求或响应共用的头部、消息体，以及各自特有的部分
+type rewriteMessage struct {
+	phase      string
+	header     http.Header
+	body       []byte
+	bodyEdited bool
+	req        *http.Request // 仅请求阶段
+	statusCode int           // 仅响应阶段
+}
+
+// apply 依次执行规则中的操作
+func (rm *RewriteManager) apply(msg *rewriteMessage, rules []*RewriteRule) {
+	rm.rulesMutex.RLock()
+	defer rm.rulesMutex.RUnlock()
+
+	for _, rule := range rules {
+		for _, op := range rule.Operations {
+			rm.applyOperation(msg, op)
+		}
+	}
+}
+
+// applyOperation 执行单个改写操作
+func (rm *RewriteManager) applyOperation(msg *rewriteMessage, op RewriteOperation) {
+	switch op.Type {
+	case RewriteAddHeader:
+		msg.header.Add(op.Name, op.Value)
+	case RewriteRemoveHeader:
+		msg.header.Del(op.Name)
+	case RewriteReplaceHeader:
+		values := msg.header.Values(op.Name)
+		msg.header.Del(op.Name)
+		for _, value := range values {
+			if op.Match == "" {
+				value = op.Value
+			} else {
+				value = rm.replace(value, op)
+			}
+			msg.header.Add(op.Name, value)
+		}
+	case RewriteReplaceBody:
+		replaced := rm.replace(string(msg.body), op)
+		if replaced != string(msg.body) {
+			msg.body = []byte(replaced)
+			msg.bodyEdited = true
+		}
+	case RewriteSetQuery:
+		if msg.req == nil {
+			return // 作用于两个阶段的规则在响应阶段跳过
+		}
+		query := msg.req.URL.Query()
+		query.Set(op.Name, op.Value)
+		msg.req.URL.RawQuery = query.Encode()
+	case RewriteSetStatus:
+		if msg.phase == RewritePhaseResponse {
+			msg.statusCode, _ = strconv.Atoi(op.Value)
+		}
+	case RewriteSetJSON:
+		if body, err := setJSONPath(msg.body, op.Name, op.Value); err == nil {
+			msg.body = body
+			msg.bodyEdited = true
+		}
+	case RewriteRenameCookie, RewriteDropCookie:
+		if msg.phase == RewritePhaseRequest {
+			rewriteRequestCookies(msg.header, op)
+		} else {
+			rewriteSetCookies(msg.header, op)
+		}
+	}
+}
+
+// replace 按操作替换文本，支持普通字符串和正则（可用 $1 引用捕获组）
+func (rm *RewriteManager) replace(text string, op RewriteOperation) string {
+	if op.IsRegex {
+		if regex := rm.regexes[op.Match]; regex != nil {
+			return regex.ReplaceAllString(text, op.Value)
+		}
+		return text
+	}
+	return strings.ReplaceAll(text, op.Match, op.Value)
+}
+
+// setJSONPath 设置JSON中点分路径对应的值，路径中不存在的对象会被创建
+func setJSONPath(body []byte, path, rawValue string) ([]byte, error) {
+	var root interface{}
+	if err := json.Unmarshal(body, &root); err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(rawValue), &value); err != nil {
+		value = rawValue
+	}
+
+	parts := strings.Split(path, ".")
+	current := root
+	for i, part := range parts {
+		last := i == len(parts)-1
+		switch node := current.(type) {
+		case map[string]interface{}:
+			if last {
+				node[part] = value
+				break
+			}
+			next, exists := node[part]
+			if _, isContainer := next.(map[string]interface{}); !exists || (!isContainer && !isJSONArray(next)) {
+				next = make(map[string]interface{})
+				node[part] = next
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("invalid array index %q in %s", part, path)
+			}
+			if last {
+				node[index] = value
+				break
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("cannot set %s", path)
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+// isJSONArray 判断解析后的JSON值是否为数组
+func isJSONArray(value interface{}) bool {
+	_, ok := value.([]interface{})
+	return ok
+}
+
+// rewriteRequestCookies 重命名或删除请求Cookie头中的Cookie
+func rewriteRequestCookies(header http.Header, op RewriteOperation) {
+	var cookies []string
+	for _, line := range header.Values("Cookie") {
+		for _, pair := range strings.Split(line, ";") {
+			pair = strings.TrimSpace(pair)
+			name, value, _ := strings.Cut(pair, "=")
+			if name == op.Name {
+				if op.Type == RewriteDropCookie {
+					continue
+				}
+				pair = op.Value + "=" + value
+			}
+			if pair != "" {
+				cookies = append(cookies, pair)
+			}
+		}
+	}
+
+	header.Del("Cookie")
+	if len(cookies) > 0 {
+		header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+}
+
+// rewriteSetCookies 重命名或删除响应中的Set-Cookie
+func rewriteSetCookies(header http.Header, op RewriteOperation) {
+	values := header.Values("Set-Cookie")
+	header.Del("Set-Cookie")
+	for _, line := range values {
+		name, rest, _ := strings.Cut(line, "=")
+		if strings.TrimSpace(name) == op.Name {
+			if op.Type == RewriteDropCookie {
+				continue
+			}
+			line = op.Value + "=" + rest
+		}
+		header.Add("Set-Cookie", line)
+	}
+}
+
+// hasBodyOperations 规则中是否有修改消息体的操作
+func hasBodyOperations(rules []*RewriteRule) bool {
+	for _, rule := range rules {
+		for _, op := range rule.Operations {
+			if op.Type == RewriteReplaceBody || op.Type == RewriteSetJSON {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RewriteInterceptor 改写规则拦截器
+type RewriteInterceptor struct {
+	manager *RewriteManager
+}
+
+// NewRewriteInterceptor 创建改写规则拦截器
+func NewRewriteInterceptor(manager *RewriteManager) *RewriteInterceptor {
+	return &RewriteInterceptor{
+		manager: manager,
+	}
+}
+
+// InterceptRequest 改写请求，并同步到Flow
+func (ri *RewriteInterceptor) InterceptRequest(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
+	rules := ri.manager.matchingRules(flow.URL, RewritePhaseRequest)
+	if len(rules) == 0 {
+		return false, nil
+	}
+
+	msg := &rewriteMessage{phase: RewritePhaseRequest, header: r.Header, body: flow.Request.Body, req: r}
+	ri.manager.apply(msg, rules)
+
+	if msg.bodyEdited {
+		// 请求体以flow.Request.Body为准发往上游
+		flow.SetRequestBody(msg.body)
+		r.Body = io.NopCloser(bytes.NewReader(msg.body))
+		r.ContentLength = int64(len(msg.body))
+		r.Header.Del("Content-Length")
+	}
+
+	flow.Request.URL = r.URL.String()
+	flow.Request.Headers = make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		if len(values) > 0 {
+			flow.Request.Headers[name] = values[0]
+		}
+	}
+	flow.AddTag("rewrite")
+	return false, nil
+}
+
+// InterceptResponse 改写响应，并同步到Flow
+func (ri *RewriteInterceptor) InterceptResponse(flow *proxycore.Flow, resp *http.Response) (*http.Response, error) {
+	rules := ri.manager.matchingRules(flow.URL, RewritePhaseResponse)
+	if len(rules) == 0 {
+		return resp, nil
+	}
+
+	var body []byte
+	if resp.Body != nil {
+		var err error
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return resp, err
+		}
+	}
+
+	header := resp.Header.Clone()
+	if hasBodyOperations(rules) {
+		// 消息体操作针对解压后的内容
+		if encoding := header.Get("Content-Encoding"); encoding != "" {
+			if decoded, err := proxycore.DecompressBody(body, encoding); err == nil {
+				body = decoded
+				header.Del("Content-Encoding")
+			}
+		}
+	}
+
+	msg := &rewriteMessage{phase: RewritePhaseResponse, header: header, body: body, statusCode: resp.StatusCode}
+	ri.manager.apply(msg, rules)
+
+	modified := &http.Response{
+		Status:        resp.Status,
+		StatusCode:    msg.statusCode,
+		Proto:         resp.Proto,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
+		Header:        msg.header,
+		ContentLength: int64(len(msg.body)),
+		Body:          io.NopCloser(bytes.NewReader(msg.body)),
+		Request:       resp.Request,
+		TLS:           resp.TLS,
+	}
+	if msg.statusCode != resp.StatusCode {
+		modified.Status = fmt.Sprintf("%d %s", msg.statusCode, http.StatusText(msg.statusCode))
+	}
+	modified.Header.Set("Content-Length", strconv.Itoa(len(msg.body)))
+
+	// SetResponse会重新计时，保留原始的响应耗时
+	endTime, duration := flow.EndTime, flow.Duration
+	flow.SetResponse(modified, msg.body)
+	flow.EndTime, flow.Duration = endTime, duration
+	flow.AddTag("rewrite")
+
+	return modified, nil
+}
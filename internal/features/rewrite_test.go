@@ -0,0 +1,118 @@
+package features
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+func TestRewriteThroughProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Seen", r.URL.RawQuery+"|"+r.Header.Get("X-Added")+"|"+r.Header.Get("Cookie")+"|"+string(body))
+		w.Header().Set("Server", "backend")
+		w.Header().Add("Set-Cookie", "session=abc; Path=/")
+		w.Header().Add("Set-Cookie", "tracking=1; Path=/")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(`{"user":{"name":"alice","plan":"free"},"env":"production"}`))
+		gz.Close()
+	}))
+	defer backend.Close()
+
+	manager := NewRewriteManager(nil)
+	err := manager.AddRule(&RewriteRule{
+		ID: "1-request", URLPattern: backend.URL + "/*", Phase: RewritePhaseRequest, Enabled: true,
+		Operations: []RewriteOperation{
+			{Type: RewriteAddHeader, Name: "X-Added", Value: "yes"},
+			{Type: RewriteSetQuery, Name: "debug", Value: "1"},
+			{Type: RewriteRenameCookie, Name: "sid", Value: "session"},
+			{Type: RewriteDropCookie, Name: "ads"},
+			{Type: RewriteSetJSON, Name: "order.qty", Value: "5"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manager.AddRule(&RewriteRule{
+		ID: "2-response", URLPattern: backend.URL, Phase: RewritePhaseResponse, Enabled: true,
+		Operations: []RewriteOperation{
+			{Type: RewriteSetStatus, Value: "202"},
+			{Type: RewriteRemoveHeader, Name: "Server"},
+			{Type: RewriteReplaceBody, Match: `"env":"(\w+)"`, Value: `"env":"staging-$1"`, IsRegex: true},
+			{Type: RewriteSetJSON, Name: "user.plan", Value: `"pro"`},
+			{Type: RewriteDropCookie, Name: "tracking"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps := proxycore.NewProxyServer(0, nil)
+	interceptor := NewRewriteInterceptor(manager)
+	ps.AddRequestInterceptor(interceptor)
+	ps.AddResponseInterceptor(interceptor)
+	flows := make(chan *proxycore.Flow, 1)
+	ps.SetFlowHandler(func(flow *proxycore.Flow) { flows <- flow })
+	proxy := httptest.NewServer(ps)
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL), DisableCompression: true},
+		Timeout:   5 * time.Second,
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, backend.URL+"/orders?page=2", strings.NewReader(`{"order":{"qty":1}}`))
+	req.Header.Set("Cookie", "sid=42; ads=1; theme=dark")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if want := `debug=1&page=2|yes|session=42; theme=dark|{"order":{"qty":5}}`; resp.Header.Get("X-Seen") != want {
+		t.Errorf("backend saw %q, want %q", resp.Header.Get("X-Seen"), want)
+	}
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get("Server") != "" || resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("unexpected response: %d %v", resp.StatusCode, resp.Header)
+	}
+	if cookies := resp.Header.Values("Set-Cookie"); len(cookies) != 1 || !strings.HasPrefix(cookies[0], "session=") {
+		t.Errorf("unexpected cookies: %v", cookies)
+	}
+	if want := `{"env":"staging-production","user":{"name":"alice","plan":"pro"}}`; string(body) != want {
+		t.Errorf("body %s, want %s", body, want)
+	}
+
+	flow := <-flows
+	if flow.StatusCode != http.StatusAccepted || !flow.HasTag("rewrite") || string(flow.Request.Body) != `{"order":{"qty":5}}` {
+		t.Errorf("rewrite not recorded on flow: %d %v %s", flow.StatusCode, flow.Tags, flow.Request.Body)
+	}
+}
+
+func TestRewriteRuleValidation(t *testing.T) {
+	manager := NewRewriteManager(nil)
+	for _, rule := range []*RewriteRule{
+		{ID: "status-on-request", Phase: RewritePhaseRequest, Operations: []RewriteOperation{{Type: RewriteSetStatus, Value: "500"}}},
+		{ID: "query-on-response", Phase: RewritePhaseResponse, Operations: []RewriteOperation{{Type: RewriteSetQuery, Name: "a"}}},
+		{ID: "bad-regex", Operations: []RewriteOperation{{Type: RewriteReplaceBody, Match: "(", IsRegex: true}}},
+		{ID: "bad-status", Operations: []RewriteOperation{{Type: RewriteSetStatus, Value: "ok"}}},
+		{ID: "unknown", Operations: []RewriteOperation{{Type: "explode"}}},
+		{ID: "bad-phase", Phase: "sometimes"},
+	} {
+		if err := manager.AddRule(rule); err == nil {
+			t.Errorf("rule %s should be rejected", rule.ID)
+		}
+	}
+
+	if err := manager.AddRule(&RewriteRule{ID: "both", Operations: []RewriteOperation{{Type: RewriteSetStatus, Value: "500"}}}); err != nil {
+		t.Errorf("set-status should be allowed on rules for both phases: %v", err)
+	}
+}
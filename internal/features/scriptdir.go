@@ -0,0 +1,523 @@
+package features
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dop251/goja"
+)
+
+// 脚本目录：目录下带有元数据头的.js文件作为脚本加载，文件变化时自动重新加载，
+// 没有元数据头的.js和.json文件是共享模块，只能通过require()引用。元数据头是文件开头的注释：
+//
+//	// @name 添加鉴权头
+//	// @type request
+//	// @match api.example.com/*
+//	// @method POST
+//	// @order 10
+//	// @enabled false
+//
+// 从目录加载的脚本不保存到数据库，ID为"file:"加文件名，只能通过修改文件更新。
+
+// scriptDirPollInterval 检查脚本目录变化的间隔
+const scriptDirPollInterval = time.Second
+
+// scriptFileIDPrefix 从目录加载的脚本ID前缀
+const scriptFileIDPrefix = "file:"
+
+// scriptModulePrefix 模块按CommonJS的方式包装，不换行以保持错误信息中的行号
+const scriptModulePrefix = "(function(exports, require, module, __filename, __dirname){"
+
+// scriptFileStamp 用于判断文件是否变化
+type scriptFileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// SetScriptsDir 从目录加载脚本并监视变化，dir为空时停止监视并移除从目录加载的脚本
+func (sm *ScriptManager) SetScriptsDir(dir string) error {
+	sm.StopScriptsDirWatch()
+
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("failed to open scripts directory: %v", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("not a directory: %s", dir)
+		}
+		if dir, err = filepath.Abs(dir); err != nil {
+			return err
+		}
+	}
+
+	sm.dirMutex.Lock()
+	defer sm.dirMutex.Unlock()
+	sm.scriptsDir = dir
+	sm.dirStamps = nil
+	if dir == "" {
+		sm.replaceFileScripts(nil)
+		return nil
+	}
+	if _, err := sm.reloadScriptsDir(); err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	sm.dirStop = stop
+	go sm.watchScriptsDir(stop)
+	return nil
+}
+
+// GetScriptsDir 获取当前的脚本目录
+func (sm *ScriptManager) GetScriptsDir() string {
+	sm.dirMutex.Lock()
+	defer sm.dirMutex.Unlock()
+	return sm.scriptsDir
+}
+
+// StopScriptsDirWatch 停止监视脚本目录，已加载的脚本保留
+func (sm *ScriptManager) StopScriptsDirWatch() {
+	sm.dirMutex.Lock()
+	defer sm.dirMutex.Unlock()
+
+	if sm.dirStop != nil {
+		close(sm.dirStop)
+		sm.dirStop = nil
+	}
+}
+
+// watchScriptsDir 周期检查目录中的文件，有变化时重新加载
+func (sm *ScriptManager) watchScriptsDir(stop chan struct{}) {
+	ticker := time.NewTicker(scriptDirPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			sm.dirMutex.Lock()
+			if sm.dirStop == stop {
+				if reloaded, err := sm.reloadScriptsDir(); err != nil {
+					fmt.Printf("Failed to reload scripts directory: %v\n", err)
+				} else if reloaded {
+					fmt.Printf("Reloaded scripts from %s\n", sm.scriptsDir)
+				}
+			}
+			sm.dirMutex.Unlock()
+		}
+	}
+}
+
+// reloadScriptsDir 目录中的脚本或模块有变化时重新加载全部脚本，调用方持有dirMutex
+func (sm *ScriptManager) reloadScriptsDir() (bool, error) {
+	stamps, err := scanScriptsDir(sm.scriptsDir)
+	if err != nil {
+		return false, err
+	}
+	if sm.dirStamps != nil && sameScriptStamps(sm.dirStamps, stamps) {
+		return false, nil
+	}
+	sm.dirStamps = stamps
+
+	names := make([]string, 0, len(stamps))
+	for name := range stamps {
+		// 只有目录顶层的.js文件可能是脚本，子目录中的都是模块
+		if filepath.Ext(name) == ".js" && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	scripts := make([]*Script, 0, len(names))
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(sm.scriptsDir, name))
+		if err != nil {
+			continue // 读取期间被删除，下次检查时会再次变化
+		}
+		script, isScript, err := parseScriptFile(name, string(content))
+		if !isScript {
+			continue
+		}
+		script.ID = scriptFileIDPrefix + name
+		script.File = name
+		script.dir = sm.scriptsDir
+		script.CreatedAt = stamps[name].modTime
+		script.UpdatedAt = stamps[name].modTime
+		if err == nil {
+			err = prepareScript(script)
+		}
+		if err != nil {
+			// 与从数据库加载时一样保留出错的脚本，执行时记录失败原因
+			script.program, script.compileErr = nil, err
+			fmt.Printf("Failed to load script %s: %v\n", name, err)
+		}
+		scripts = append(scripts, script)
+	}
+
+	sm.modulesMutex.Lock()
+	sm.modules = make(map[string]*goja.Program)
+	sm.modulesMutex.Unlock()
+	sm.replaceFileScripts(scripts)
+	return true, nil
+}
+
+// replaceFileScripts 以新加载的脚本替换所有从目录加载的脚本
+func (sm *ScriptManager) replaceFileScripts(scripts []*Script) {
+	sm.scriptsMutex.Lock()
+	defer sm.scriptsMutex.Unlock()
+
+	for id, script := range sm.scripts {
+		if script.File != "" {
+			delete(sm.scripts, id)
+		}
+	}
+	for _, script := range scripts {
+		sm.scripts[script.ID] = script
+	}
+}
+
+// scanScriptsDir 列出目录（含子目录）中的.js和.json文件，名称是以/分隔的相对路径
+func scanScriptsDir(dir string) (map[string]scriptFileStamp, error) {
+	stamps := make(map[string]scriptFileStamp)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".js" && ext != ".json" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		stamps[filepath.ToSlash(rel)] = scriptFileStamp{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scripts directory: %v", err)
+	}
+	return stamps, nil
+}
+
+func sameScriptStamps(a, b map[string]scriptFileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, stamp := range a {
+		other, exists := b[name]
+		if !exists || !other.modTime.Equal(stamp.modTime) || other.size != stamp.size {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptMetadataField 元数据头中的一个字段
+type scriptMetadataField struct {
+	line       int
+	key, value string
+}
+
+// parseScriptFile 解析文件开头的元数据头，没有@name时不是脚本（如只有// @ts-check的模块）；
+// 不认识的@字段忽略。脚本内容是整个文件，元数据头保留为注释，错误信息中的行号与文件一致
+func parseScriptFile(fileName, content string) (*Script, bool, error) {
+	script := &Script{
+		Content: content,
+		Type:    "both",
+		Enabled: true,
+	}
+
+	isScript := false
+	fields := make([]scriptMetadataField, 0)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+		field := strings.TrimSpace(strings.TrimPrefix(line, "//"))
+		if !strings.HasPrefix(field, "@") {
+			continue
+		}
+
+		key, value, _ := strings.Cut(field[1:], " ")
+		fields = append(fields, scriptMetadataField{line: lineNo, key: key, value: strings.TrimSpace(value)})
+		if key == "name" {
+			isScript = true
+		}
+	}
+	if !isScript {
+		return nil, false, nil
+	}
+
+	for _, field := range fields {
+		if err := script.setMetadata(field.key, field.value); err != nil {
+			return script, true, fmt.Errorf("line %d: %v", field.line, err)
+		}
+	}
+	if script.Name == "" {
+		script.Name = strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	}
+	return script, true, nil
+}
+
+// setMetadata 设置元数据头中的一个字段，其他工具使用的字段（如@license）忽略
+func (s *Script) setMetadata(key, value string) error {
+	switch key {
+	case "name":
+		s.Name = value
+	case "description":
+		s.Description = value
+	case "type":
+		if value != "request" && value != "response" && value != "both" {
+			return fmt.Errorf("invalid @type: %s", value)
+		}
+		s.Type = value
+	case "match":
+		s.URLPattern = value
+	case "regex":
+		// 只写@regex时表示true
+		s.IsRegex = value == "" || value == "true"
+	case "method":
+		s.Method = strings.ToUpper(value)
+	case "order":
+		order, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid @order: %s", value)
+		}
+		s.Order = order
+	case "enabled":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid @enabled: %s", value)
+		}
+		s.Enabled = enabled
+	}
+	return nil
+}
+
+// formatScriptFile 生成带元数据头的脚本文件内容
+func formatScriptFile(script *Script) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// @name %s\n", singleLine(script.Name))
+	if script.Description != "" {
+		fmt.Fprintf(&b, "// @description %s\n", singleLine(script.Description))
+	}
+	fmt.Fprintf(&b, "// @type %s\n", script.Type)
+	if script.URLPattern != "" {
+		fmt.Fprintf(&b, "// @match %s\n", script.URLPattern)
+	}
+	if script.IsRegex {
+		b.WriteString("// @regex\n")
+	}
+	if script.Method != "" {
+		fmt.Fprintf(&b, "// @method %s\n", script.Method)
+	}
+	if script.Order != 0 {
+		fmt.Fprintf(&b, "// @order %d\n", script.Order)
+	}
+	if !script.Enabled {
+		b.WriteString("// @enabled false\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(script.Content)
+	if !strings.HasSuffix(script.Content, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func singleLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// ExportScriptsToDir 把数据库中的脚本导出为带元数据头的.js文件，返回写入的文件路径；
+// 同名文件会被覆盖。不能导出到正在监视的目录，否则同一脚本会同时从数据库和目录加载
+func (sm *ScriptManager) ExportScriptsToDir(dir string) ([]string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if watched := sm.GetScriptsDir(); watched != "" && abs == watched {
+		return nil, fmt.Errorf("cannot export into the active scripts directory %s: scripts would run twice", watched)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	used := make(map[string]bool)
+	paths := make([]string, 0)
+	for _, script := range sm.GetAllScripts() {
+		if script.File != "" {
+			continue
+		}
+		base := scriptFileName(script)
+		name := base + ".js"
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s-%d.js", base, i)
+		}
+		used[name] = true
+
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(formatScriptFile(script)), 0644); err != nil {
+			return paths, fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// scriptFileName 由脚本名称生成文件名，只保留字母和数字
+func scriptFileName(script *Script) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, script.Name)
+	name = strings.Join(strings.FieldsFunc(name, func(r rune) bool { return r == '-' }), "-")
+	if name == "" {
+		name = script.ID
+	}
+	return name
+}
+
+// scriptRequire 实现脚本中的require()，模块路径相对于当前文件，不能超出脚本目录；
+// 同一次执行中每个模块只执行一次，循环引用时得到未执行完的exports
+type scriptRequire struct {
+	sm     *ScriptManager
+	vm     *goja.Runtime
+	codec  *scriptJSONCodec
+	root   string
+	loaded map[string]*goja.Object // 本次执行已加载的module对象
+}
+
+// installScriptRequire 注入require()，dir为空时require不可用
+func (sm *ScriptManager) installScriptRequire(vm *goja.Runtime, codec *scriptJSONCodec, dir string) {
+	if dir == "" {
+		vm.Set("require", func(string) (goja.Value, error) {
+			return nil, fmt.Errorf("require is only available for scripts loaded from the scripts directory")
+		})
+		return
+	}
+	r := &scriptRequire{sm: sm, vm: vm, codec: codec, root: dir, loaded: make(map[string]*goja.Object)}
+	vm.Set("require", r.requireFrom(dir))
+}
+
+func (r *scriptRequire) requireFrom(base string) func(string) (goja.Value, error) {
+	return func(name string) (goja.Value, error) {
+		path, err := r.resolve(base, name)
+		if err != nil {
+			return nil, err
+		}
+		if module, exists := r.loaded[path]; exists {
+			return module.Get("exports"), nil
+		}
+		return r.load(path)
+	}
+}
+
+// resolve 解析模块路径，省略扩展名时依次尝试.js和.json
+func (r *scriptRequire) resolve(base, name string) (string, error) {
+	path := filepath.Clean(filepath.Join(base, filepath.FromSlash(name)))
+	if rel, err := filepath.Rel(r.root, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("module %s is outside the scripts directory", name)
+	}
+
+	candidates := []string{path}
+	if ext := filepath.Ext(path); ext != ".js" && ext != ".json" {
+		candidates = []string{path + ".js", path + ".json"}
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("module not found: %s", name)
+}
+
+// load 执行模块并缓存其module对象，加载失败时移除缓存，之后的require会重新报告错误
+func (r *scriptRequire) load(path string) (result goja.Value, err error) {
+	module := r.vm.NewObject()
+	exports := r.vm.NewObject()
+	module.Set("exports", exports)
+	r.loaded[path] = module
+	defer func() {
+		if err != nil {
+			delete(r.loaded, path)
+		}
+	}()
+
+	if filepath.Ext(path) == ".json" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read module: %v", err)
+		}
+		value, err := r.codec.decode(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON module %s: %v", filepath.Base(path), err)
+		}
+		module.Set("exports", value)
+		return value, nil
+	}
+
+	program, err := r.sm.compileModule(r.root, path)
+	if err != nil {
+		return nil, err
+	}
+	wrapper, err := r.vm.RunProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	call, ok := goja.AssertFunction(wrapper)
+	if !ok {
+		return nil, fmt.Errorf("invalid module: %s", path)
+	}
+	dir := filepath.Dir(path)
+	if _, err := call(goja.Undefined(), exports, r.vm.ToValue(r.requireFrom(dir)), module, r.vm.ToValue(path), r.vm.ToValue(dir)); err != nil {
+		return nil, err
+	}
+	return module.Get("exports"), nil
+}
+
+// compileModule 编译模块，结果缓存到脚本目录下次变化为止
+func (sm *ScriptManager) compileModule(root, path string) (*goja.Program, error) {
+	sm.modulesMutex.Lock()
+	defer sm.modulesMutex.Unlock()
+
+	if program, exists := sm.modules[path]; exists {
+		return program, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module: %v", err)
+	}
+	name, _ := filepath.Rel(root, path)
+	program, err := goja.Compile(filepath.ToSlash(name), scriptModulePrefix+string(content)+"\n})", false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile module: %v", err)
+	}
+	if sm.modules == nil {
+		sm.modules = make(map[string]*goja.Program)
+	}
+	sm.modules[path] = program
+	return program, nil
+}
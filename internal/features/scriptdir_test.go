@@ -0,0 +1,175 @@
+package features
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeScriptFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScriptsDir(t *testing.T) {
+	dir := t.TempDir()
+	writeScriptFile(t, dir, "auth.js", `// @name Add token
+// @type request
+// @match example.com/*
+// @order 5
+var auth = require("./lib/auth");
+function onRequest(ctx) {
+  ctx.request.headers.set("Authorization", auth.header());
+}
+`)
+	// 其他工具使用的@字段不会让模块被当作脚本
+	writeScriptFile(t, dir, "lib/auth.js", `// @ts-check
+// @license MIT
+var config = require("../config.json");
+exports.header = function() { return "Bearer " + config.token; };
+`)
+	writeScriptFile(t, dir, "config.json", `{"token": "abc"}`)
+	writeScriptFile(t, dir, "escape.js", `// @name Escape
+require("../outside");
+`)
+	// 加载失败的模块不缓存，再次require时仍然报错
+	writeScriptFile(t, dir, "flaky.js", `// @name Flaky
+var results = [];
+for (var i = 0; i < 2; i++) {
+  try { require("./lib/broken"); results.push("ok"); } catch (e) { results.push("err"); }
+}
+console.log("broken:" + results.join(","));
+`)
+	writeScriptFile(t, dir, "lib/broken.js", `exports.partial = true;
+throw new Error("broken module");
+`)
+
+	manager := NewScriptManager(nil)
+	defer manager.StopScriptsDirWatch()
+	if err := manager.SetScriptsDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	scripts := manager.GetAllScripts()
+	if len(scripts) != 3 {
+		t.Fatalf("scripts = %d, want 3 (helper modules are not scripts)", len(scripts))
+	}
+	script, exists := manager.GetScript("file:auth.js")
+	if !exists || script.Name != "Add token" || script.Type != "request" || script.URLPattern != "example.com/*" || script.Order != 5 || script.File != "auth.js" {
+		t.Fatalf("script = %+v", script)
+	}
+
+	flow := newScriptTestFlow()
+	if _, err := manager.ExecuteRequestScripts(flow); err != nil {
+		t.Fatal(err)
+	}
+	if got := flow.Request.Headers["Authorization"]; got != "Bearer abc" {
+		t.Errorf("Authorization = %q, executions = %+v", got, flow.ScriptExecutions)
+	}
+	flaky := false
+	for _, execution := range flow.ScriptExecutions {
+		if execution.ScriptID == "file:escape.js" && (execution.Success || !strings.Contains(execution.Error, "outside the scripts directory")) {
+			t.Errorf("escape = %+v", execution)
+		}
+		if execution.ScriptID == "file:flaky.js" {
+			flaky = true
+			expectLogs(t, execution.Logs, "broken:err,err")
+		}
+	}
+	if !flaky {
+		t.Error("flaky.js did not run")
+	}
+
+	if _, err := manager.ExportScriptsToDir(dir); err == nil {
+		t.Error("exporting into the active scripts directory should be refused")
+	}
+
+	if err := manager.UpdateScript(&Script{ID: "file:auth.js", Name: "x", Content: "1", Type: "both"}); err == nil {
+		t.Error("file scripts must not be updated through the manager")
+	}
+	if err := manager.RemoveScript("file:auth.js"); err == nil {
+		t.Error("file scripts must not be removed through the manager")
+	}
+
+	// 修改模块和脚本后重新加载
+	writeScriptFile(t, dir, "config.json", `{"token": "changed"}`)
+	if err := os.Remove(filepath.Join(dir, "escape.js")); err != nil {
+		t.Fatal(err)
+	}
+	manager.dirMutex.Lock()
+	reloaded, err := manager.reloadScriptsDir()
+	manager.dirMutex.Unlock()
+	if err != nil || !reloaded {
+		t.Fatalf("reload = %v, %v", reloaded, err)
+	}
+	if _, exists := manager.GetScript("file:escape.js"); exists {
+		t.Error("deleted script is still loaded")
+	}
+	flow = newScriptTestFlow()
+	manager.ExecuteRequestScripts(flow)
+	if got := flow.Request.Headers["Authorization"]; got != "Bearer changed" {
+		t.Errorf("Authorization after reload = %q", got)
+	}
+
+	if err := manager.SetScriptsDir(""); err != nil {
+		t.Fatal(err)
+	}
+	if len(manager.GetAllScripts()) != 0 {
+		t.Error("file scripts should be removed when the directory is cleared")
+	}
+}
+
+func TestScriptFileFormat(t *testing.T) {
+	script, isScript, err := parseScriptFile("x.js", "// helper\nmodule.exports = 1;\n")
+	if isScript || err != nil {
+		t.Errorf("file without metadata should be a module: %v %v", isScript, err)
+	}
+	if _, _, err := parseScriptFile("x.js", "// @name x\n// @type sometimes\n"); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("invalid type error = %v", err)
+	}
+	if _, isScript, _ := parseScriptFile("x.js", "// @ts-check\n// @type request\nmodule.exports = 1;\n"); isScript {
+		t.Error("file without @name should be a module")
+	}
+	if script, isScript, err := parseScriptFile("x.js", "// @name x\n// @license MIT\n"); !isScript || err != nil || script.Name != "x" {
+		t.Errorf("unknown metadata should be ignored: %v %v", isScript, err)
+	}
+
+	original := &Script{
+		ID:         "s1",
+		Name:       "重写 响应",
+		Content:    "function onResponse(ctx) {}",
+		Type:       "response",
+		URLPattern: `^https://api\.`,
+		IsRegex:    true,
+		Method:     "GET",
+		Order:      -1,
+		Enabled:    false,
+	}
+	script, isScript, err = parseScriptFile("a.js", formatScriptFile(original))
+	if !isScript || err != nil {
+		t.Fatalf("parse exported file: %v %v", isScript, err)
+	}
+	if script.Name != original.Name || script.Type != original.Type || script.URLPattern != original.URLPattern ||
+		!script.IsRegex || script.Method != "GET" || script.Order != -1 || script.Enabled {
+		t.Errorf("round trip = %+v", script)
+	}
+
+	manager := NewScriptManager(nil)
+	manager.AddScript(original)
+	manager.AddScript(&Script{ID: "s2", Name: "重写 响应", Content: "1", Type: "both", Enabled: true})
+	paths, err := manager.ExportScriptsToDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同名脚本的文件名加上序号
+	if len(paths) != 2 || filepath.Base(paths[0]) != "重写-响应.js" || filepath.Base(paths[1]) != "重写-响应-2.js" {
+		t.Errorf("paths = %v", paths)
+	}
+}
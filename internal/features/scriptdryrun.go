@@ -0,0 +1,346 @@
+package features
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"ProxyWoman/internal/proxycore"
+
+	"github.com/dop251/goja"
+)
+
+// ScriptDryRunTarget 试运行的脚本：已保存脚本的ID，或未保存的脚本内容（优先）
+type ScriptDryRunTarget struct {
+	ScriptID string `json:"scriptId"`
+	Source   string `json:"source"`
+	Type     string `json:"type"` // 试运行内容时的脚本类型，默认"both"
+	Dir      string `json:"dir"`  // 试运行内容时require()加载模块的目录，为空时不能使用require
+}
+
+// ScriptDryRunResult 脚本在一个Flow副本上的试运行结果
+type ScriptDryRunResult struct {
+	FlowID     string                      `json:"flowId"`
+	Method     string                      `json:"method"`
+	URL        string                      `json:"url"`
+	Success    bool                        `json:"success"`
+	Error      *ScriptError                `json:"error,omitempty"`
+	Executions []proxycore.ScriptExecution `json:"executions"`
+	Action     string                      `json:"action,omitempty"`
+	Mocked     *ScriptResponse             `json:"mocked,omitempty"` // 请求阶段respond()构造的响应
+	Changes    []ScriptChange              `json:"changes"`
+}
+
+// ScriptError 脚本错误，行列号从1开始，无法定位时为0
+type ScriptError struct {
+	Phase   string `json:"phase,omitempty"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+// ScriptChange 试运行前后的一处差异
+type ScriptChange struct {
+	Path   string `json:"path"` // 如 request.url、request.headers.X-Token、response.body
+	Type   string `json:"type"` // "added"、"removed"、"changed"
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// SetFlowSource 设置试运行按ID查找已捕获Flow的方式
+func (sm *ScriptManager) SetFlowSource(lookup func(flowID string) (*proxycore.Flow, bool)) {
+	sm.flowSource = lookup
+}
+
+// DryRun 在已捕获Flow的副本上试运行脚本
+func (sm *ScriptManager) DryRun(target ScriptDryRunTarget, flowID string) (*ScriptDryRunResult, error) {
+	if sm.flowSource == nil {
+		return nil, fmt.Errorf("no captured flows available")
+	}
+	flow, exists := sm.flowSource(flowID)
+	if !exists {
+		return nil, fmt.Errorf("flow not found: %s", flowID)
+	}
+	return sm.DryRunFlow(target, flow)
+}
+
+// DryRunHAR 对HAR文件中的每个请求试运行脚本，用于批量回归测试
+func (sm *ScriptManager) DryRunHAR(target ScriptDryRunTarget, harPath string) ([]*ScriptDryRunResult, error) {
+	flows, err := NewHARManager().ImportHARToFlows(harPath)
+	if err != nil {
+		return nil, err
+	}
+	script, err := sm.dryRunScript(target)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*ScriptDryRunResult, 0, len(flows))
+	for _, flow := range flows {
+		results = append(results, sm.dryRun(script, flow))
+	}
+	return results, nil
+}
+
+// DryRunFlow 在Flow的副本上试运行脚本，不访问网络，不修改原Flow，store的修改不保存
+func (sm *ScriptManager) DryRunFlow(target ScriptDryRunTarget, flow *proxycore.Flow) (*ScriptDryRunResult, error) {
+	script, err := sm.dryRunScript(target)
+	if err != nil {
+		return nil, err
+	}
+	return sm.dryRun(script, flow), nil
+}
+
+// dryRunScript 取得要试运行的脚本，内容有语法错误时返回带行列号的ScriptError
+func (sm *ScriptManager) dryRunScript(target ScriptDryRunTarget) (*Script, error) {
+	if target.Source == "" {
+		script, exists := sm.GetScript(target.ScriptID)
+		if !exists {
+			return nil, fmt.Errorf("script not found: %s", target.ScriptID)
+		}
+		if script.program == nil {
+			return nil, newScriptError("", script.compileErr)
+		}
+		return script, nil
+	}
+
+	script := &Script{ID: "dry-run", Name: "dry-run", Content: target.Source, Type: target.Type, Enabled: true, dir: target.Dir}
+	if script.Type == "" {
+		script.Type = "both"
+	}
+	program, err := compileScript(script.Name, script.Content)
+	if err != nil {
+		return nil, newScriptError("", err)
+	}
+	script.program = program
+	return script, nil
+}
+
+// dryRun 依次执行请求和响应阶段：请求阶段没有响应，respond()后不再执行响应阶段，与实际代理时一致
+func (sm *ScriptManager) dryRun(script *Script, original *proxycore.Flow) *ScriptDryRunResult {
+	flow := cloneFlowForDryRun(original)
+	response := flow.Response
+	flow.Response = nil
+
+	result := &ScriptDryRunResult{
+		FlowID:  original.ID,
+		Method:  original.Method,
+		URL:     original.URL,
+		Success: true,
+	}
+	run := scriptRun{store: sm.store.sandbox(), offline: true}
+
+	for _, phase := range []string{"request", "response"} {
+		if script.Type != phase && script.Type != "both" {
+			continue
+		}
+		if phase == "response" {
+			if response == nil || result.Mocked != nil {
+				break
+			}
+			flow.Response = response
+		}
+
+		// 与实际代理时一致，每个阶段的执行链都从空的previous开始
+		run.phase, run.previous = phase, ""
+		start := time.Now()
+		snapshot := snapshotScriptFlow(flow)
+		outcome, err := sm.executeScript(script, flow, run)
+		execution := proxycore.ScriptExecution{
+			ScriptID:   script.ID,
+			ScriptName: script.Name,
+			Phase:      phase,
+			Success:    err == nil,
+			Logs:       outcome.logs,
+			ExecutedAt: start,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			snapshot.restore(flow)
+			execution.Error = err.Error()
+			result.Executions = append(result.Executions, execution)
+			result.Success = false
+			result.Error = newScriptError(phase, err)
+			break
+		}
+		if outcome.action != nil {
+			execution.Action = outcome.action.Type
+			result.Action = outcome.action.Type
+		}
+		result.Executions = append(result.Executions, execution)
+
+		if outcome.action != nil && outcome.action.Type == ScriptActionRespond {
+			if phase == "request" {
+				result.Mocked = outcome.action.Response
+			} else {
+				applyScriptResponse(flow.Response, outcome.action.Response)
+			}
+		}
+		if outcome.action != nil {
+			break
+		}
+	}
+
+	if flow.Response == nil && result.Mocked == nil {
+		flow.Response = response
+	}
+	result.Changes = diffDryRunFlow(original, flow, result.Mocked)
+	return result
+}
+
+// applyScriptResponse 以respond()构造的响应替换Flow的响应
+func applyScriptResponse(response *proxycore.FlowResponse, mock *ScriptResponse) {
+	response.StatusCode = mock.StatusCode
+	response.Status = mock.Status
+	response.Headers = mock.Headers
+	response.HeaderValues = mock.header.Clone()
+	response.Body = []byte(mock.Body)
+}
+
+// cloneFlowForDryRun 复制Flow中脚本可以修改的部分
+func cloneFlowForDryRun(flow *proxycore.Flow) *proxycore.Flow {
+	cloned := *flow
+	snapshot := snapshotScriptFlow(flow)
+	cloned.Request = snapshot.request
+	cloned.Response = snapshot.response
+	cloned.Tags = append([]string(nil), flow.Tags...)
+	cloned.ScriptExecutions = nil
+	return &cloned
+}
+
+// diffDryRunFlow 比较试运行前后的请求和响应，mocked不为nil时与原响应比较
+func diffDryRunFlow(before, after *proxycore.Flow, mocked *ScriptResponse) []ScriptChange {
+	changes := make([]ScriptChange, 0)
+	if before.Request != nil && after.Request != nil {
+		changes = appendValueChange(changes, "request.method", before.Request.Method, after.Request.Method)
+		changes = appendValueChange(changes, "request.url", before.Request.URL, after.Request.URL)
+		changes = appendHeaderChanges(changes, "request.headers", before.Request.Headers, after.Request.Headers)
+		changes = appendValueChange(changes, "request.body", bodyText(before.Request.Body), bodyText(after.Request.Body))
+	}
+
+	oldResp, newResp := before.Response, after.Response
+	if mocked != nil {
+		newResp = &proxycore.FlowResponse{
+			StatusCode: mocked.StatusCode,
+			Status:     mocked.Status,
+			Headers:    mocked.Headers,
+			Body:       []byte(mocked.Body),
+		}
+	}
+	if newResp == nil {
+		return changes
+	}
+	if oldResp == nil {
+		oldResp = &proxycore.FlowResponse{}
+	}
+	changes = appendValueChange(changes, "response.statusCode", statusCodeText(oldResp.StatusCode), statusCodeText(newResp.StatusCode))
+	changes = appendValueChange(changes, "response.status", oldResp.Status, newResp.Status)
+	changes = appendHeaderChanges(changes, "response.headers", oldResp.Headers, newResp.Headers)
+	changes = appendValueChange(changes, "response.body", bodyText(oldResp.Body), bodyText(newResp.Body))
+	return changes
+}
+
+func appendValueChange(changes []ScriptChange, path, before, after string) []ScriptChange {
+	switch {
+	case before == after:
+		return changes
+	case before == "":
+		return append(changes, ScriptChange{Path: path, Type: "added", After: after})
+	case after == "":
+		return append(changes, ScriptChange{Path: path, Type: "removed", Before: before})
+	}
+	return append(changes, ScriptChange{Path: path, Type: "changed", Before: before, After: after})
+}
+
+// appendHeaderChanges 按头部名称排序比较
+func appendHeaderChanges(changes []ScriptChange, path string, before, after map[string]string) []ScriptChange {
+	names := make([]string, 0, len(before)+len(after))
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, exists := before[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		oldValue, hadOld := before[name]
+		newValue, hasNew := after[name]
+		switch {
+		case !hadOld:
+			changes = append(changes, ScriptChange{Path: path + "." + name, Type: "added", After: newValue})
+		case !hasNew:
+			changes = append(changes, ScriptChange{Path: path + "." + name, Type: "removed", Before: oldValue})
+		case oldValue != newValue:
+			changes = append(changes, ScriptChange{Path: path + "." + name, Type: "changed", Before: oldValue, After: newValue})
+		}
+	}
+	return changes
+}
+
+// bodyText 消息体的文本形式，非UTF-8内容只显示长度
+func bodyText(body []byte) string {
+	if utf8.Valid(body) {
+		return string(body)
+	}
+	return fmt.Sprintf("<%d bytes binary>", len(body))
+}
+
+func statusCodeText(code int) string {
+	if code == 0 {
+		return ""
+	}
+	return strconv.Itoa(code)
+}
+
+// parserErrorPattern 解析器错误消息，如 "name: Line 2:9 Unexpected token ;"
+var parserErrorPattern = regexp.MustCompile(`Line (\d+):(\d+) (.*)`)
+
+// newScriptError 从执行或编译错误中取出脚本内的行列号
+func newScriptError(phase string, err error) *ScriptError {
+	scriptErr := &ScriptError{Phase: phase, Message: err.Error()}
+
+	var syntaxErr *goja.CompilerSyntaxError
+	var exception *goja.Exception
+	switch {
+	case errors.As(err, &syntaxErr):
+		scriptErr.Message = syntaxErr.Message
+		if syntaxErr.File != nil {
+			position := syntaxErr.File.Position(syntaxErr.Offset)
+			scriptErr.Line, scriptErr.Column = position.Line, position.Column
+		} else if match := parserErrorPattern.FindStringSubmatch(syntaxErr.Message); match != nil {
+			// 解析器的错误只在消息中带有位置
+			scriptErr.Line, _ = strconv.Atoi(match[1])
+			scriptErr.Column, _ = strconv.Atoi(match[2])
+			scriptErr.Message = match[3]
+		}
+	case errors.As(err, &exception):
+		for _, frame := range exception.Stack() {
+			if position := frame.Position(); position.Line > 0 {
+				scriptErr.Line, scriptErr.Column = position.Line, position.Column
+				break
+			}
+		}
+		scriptErr.Message = exception.Value().String()
+	}
+
+	// 脚本第一行前面有包装函数的前缀
+	if scriptErr.Line == 1 && scriptErr.Column > len(scriptWrapperPrefix) {
+		scriptErr.Column -= len(scriptWrapperPrefix)
+	}
+	return scriptErr
+}
+
+// Error 实现error接口
+func (e *ScriptError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s (line %d, column %d)", e.Message, e.Line, e.Column)
+	}
+	return e.Message
+}
@@ -0,0 +1,144 @@
+package features
+
+import (
+	"path/filepath"
+	"testing"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+// newDryRunTestFlow 创建带响应的Flow
+func newDryRunTestFlow(id, url string) *proxycore.Flow {
+	flow := newScriptTestFlow()
+	flow.ID, flow.URL, flow.Request.URL = id, url, url
+	flow.Request.Headers["Cookie"] = "a=1"
+	flow.Response = &proxycore.FlowResponse{
+		StatusCode: 200,
+		Status:     "200 OK",
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       []byte(`{"ok":true}`),
+	}
+	return flow
+}
+
+func TestScriptDryRun(t *testing.T) {
+	storage := &memoryScriptStorage{memoryValueStorage{values: map[string]string{}}}
+	manager := NewScriptManager(storage)
+	flow := newDryRunTestFlow("f1", "http://example.com/api")
+
+	result, err := manager.DryRunFlow(ScriptDryRunTarget{Source: `
+		function onRequest(ctx) {
+			console.log("request");
+			ctx.request.headers.set("X-Token", "abc");
+			ctx.request.headers.delete("Cookie");
+			store.set("seen", true);
+			try { fetch("http://127.0.0.1:1/"); } catch (e) { console.log("fetch:" + e); }
+			return "from-request";
+		}
+		function onResponse(ctx) {
+			console.log("previous:" + ctx.previous);
+			var data = ctx.response.json();
+			data.patched = true;
+			ctx.response.body = data;
+		}
+	`}, flow)
+	if err != nil || !result.Success {
+		t.Fatalf("dry run failed: %v %+v", err, result)
+	}
+	expectLogs(t, result.Executions[0].Logs, "request", "fetch:GoError: fetch is not available in dry run")
+	// 请求阶段的返回值不会传给响应阶段
+	expectLogs(t, result.Executions[1].Logs, "previous:undefined")
+
+	want := map[string]ScriptChange{
+		"request.headers.Cookie":  {Type: "removed", Before: "a=1"},
+		"request.headers.X-Token": {Type: "added", After: "abc"},
+		"response.body":           {Type: "changed", Before: `{"ok":true}`, After: `{"ok":true,"patched":true}`},
+	}
+	if len(result.Changes) != len(want) {
+		t.Errorf("changes = %+v", result.Changes)
+	}
+	for _, change := range result.Changes {
+		if expected := want[change.Path]; change.Type != expected.Type || change.Before != expected.Before || change.After != expected.After {
+			t.Errorf("unexpected change %+v", change)
+		}
+	}
+
+	// 原Flow和存储不受影响
+	if flow.Request.Headers["Cookie"] != "a=1" || string(flow.Response.Body) != `{"ok":true}` || len(flow.ScriptExecutions) != 0 {
+		t.Errorf("original flow modified: %+v", flow.Request)
+	}
+	if len(storage.values) != 0 {
+		t.Errorf("store persisted in dry run: %v", storage.values)
+	}
+}
+
+func TestScriptDryRunErrorsAndMocks(t *testing.T) {
+	manager := NewScriptManager(nil)
+	flow := newDryRunTestFlow("f1", "http://example.com/api")
+
+	if _, err := manager.DryRunFlow(ScriptDryRunTarget{Source: "var a = 1;\nvar b = ;"}, flow); err == nil {
+		t.Error("syntax error should be reported")
+	} else if scriptErr, ok := err.(*ScriptError); !ok || scriptErr.Line != 2 {
+		t.Errorf("syntax error = %#v", err)
+	}
+
+	result, err := manager.DryRunFlow(ScriptDryRunTarget{Source: "request.body = 'x';\n\n  null.foo;"}, flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || result.Error == nil || result.Error.Phase != "request" || result.Error.Line != 3 || result.Error.Column != 8 {
+		t.Errorf("runtime error = %+v", result.Error)
+	}
+	if len(result.Changes) != 0 {
+		t.Errorf("failed script should leave no changes: %+v", result.Changes)
+	}
+
+	// 请求阶段的respond()与原响应比较，不再执行响应阶段
+	manager.AddScript(&Script{ID: "mock", Name: "mock", Type: "both", Content: `
+		function onRequest() { return respond(404, "missing"); }
+		function onResponse(ctx) { ctx.response.body = "never"; }
+	`})
+	manager.SetFlowSource(func(id string) (*proxycore.Flow, bool) { return flow, id == "f1" })
+	result, err = manager.DryRun(ScriptDryRunTarget{ScriptID: "mock"}, "f1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != ScriptActionRespond || result.Mocked == nil || len(result.Executions) != 1 {
+		t.Errorf("mock result = %+v", result)
+	}
+	if len(result.Changes) != 4 || result.Changes[0].Path != "response.statusCode" || result.Changes[0].After != "404" {
+		t.Errorf("mock changes = %+v", result.Changes)
+	}
+	if _, err := manager.DryRun(ScriptDryRunTarget{ScriptID: "mock"}, "missing"); err == nil {
+		t.Error("unknown flow should fail")
+	}
+}
+
+func TestScriptDryRunHAR(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.har")
+	flows := []*proxycore.Flow{
+		newDryRunTestFlow("a", "http://example.com/users"),
+		newDryRunTestFlow("b", "http://example.com/orders"),
+	}
+	if err := NewHARManager().ExportFlowsToHAR(flows, path); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewScriptManager(nil)
+	results, err := manager.DryRunHAR(ScriptDryRunTarget{Source: `
+		if (request.url.indexOf("/orders") >= 0) throw new Error("orders not supported");
+		request.headers["X-Checked"] = "1";
+	`, Type: "request"}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %d", len(results))
+	}
+	if !results[0].Success || len(results[0].Changes) != 1 || results[0].Changes[0].Path != "request.headers.X-Checked" {
+		t.Errorf("users = %+v", results[0])
+	}
+	if results[1].Success || results[1].Error.Message != "Error: orders not supported" || results[1].Error.Line != 2 {
+		t.Errorf("orders = %+v", results[1].Error)
+	}
+}
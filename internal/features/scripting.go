@@ -1,9 +1,14 @@
 package features
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"runtime/metrics"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"ProxyWoman/internal/proxycore"
@@ -19,24 +24,99 @@ type Script struct {
 	Enabled     bool      `json:"enabled"`
 	Type        string    `json:"type"` // "request", "response", "both"
 	Description string    `json:"description"`
+	URLPattern  string    `json:"urlPattern"` // 匹配的URL模式，为空时匹配所有请求
+	IsRegex     bool      `json:"isRegex"`
+	Method      string    `json:"method"` // 匹配的请求方法，为空或*时匹配所有方法
+	Order       int       `json:"order"`  // 执行顺序，小的先执行，相同时按创建时间
+	File        string    `json:"file"`   // 从脚本目录加载时的文件名，为空表示保存在数据库中
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
+
+	program    *goja.Program // 保存时预编译的程序
+	compileErr error         // 从存储加载时的编译错误，执行时返回
+	dir        string        // require()加载模块的目录，为空时不能使用require
+}
+
+// matches 判断脚本的匹配规则是否适用于该请求
+func (s *Script) matches(flow *proxycore.Flow) bool {
+	if s.Method != "" && s.Method != "*" {
+		method := flow.Method
+		if flow.Request != nil {
+			method = flow.Request.Method
+		}
+		if !strings.EqualFold(s.Method, method) {
+			return false
+		}
+	}
+	if s.URLPattern == "" {
+		return true
+	}
+	matcher, err := compileURLPattern(s.URLPattern, s.IsRegex)
+	if err != nil {
+		return false
+	}
+	return matcher.match(flow.URL) != nil
+}
+
+// 脚本结束执行链的方式
+const (
+	ScriptActionStop    = "stop"    // 后续脚本不再执行
+	ScriptActionRespond = "respond" // 以脚本构造的响应结束，请求阶段不再请求服务器
+)
+
+// scriptAction 脚本通过 return stop() 或 return respond(...) 返回的控制结果
+type scriptAction struct {
+	Type     string
+	Response *ScriptResponse
 }
 
-// ScriptContext 脚本执行上下文
-type ScriptContext struct {
-	Flow     *proxycore.Flow `json:"flow"`
-	Request  *ScriptRequest  `json:"request"`
-	Response *ScriptResponse `json:"response"`
-	Console  *ScriptConsole  `json:"console"`
+// scriptHooks 脚本定义的生命周期函数
+type scriptHooks struct {
+	onRequest  goja.Value
+	onResponse goja.Value
 }
 
-// ScriptRequest 脚本中的请求对象
-type ScriptRequest struct {
-	Method  string            `json:"method"`
-	URL     string            `json:"url"`
-	Headers map[string]string `json:"headers"`
-	Body    string            `json:"body"`
+// scriptRun 单次执行的参数
+type scriptRun struct {
+	phase    string
+	previous string       // 前一个脚本返回值的JSON
+	store    *scriptStore // 脚本使用的键值存储
+	offline  bool         // 试运行时禁止fetch访问网络
+}
+
+// scriptResult 单个脚本的执行结果
+type scriptResult struct {
+	logs   []string
+	output string        // 返回值的JSON，传给下一个脚本，undefined时为空
+	action *scriptAction // 脚本结束了执行链时非nil
+}
+
+// ScriptLimits 脚本执行限制
+type ScriptLimits struct {
+	TimeoutMs        int `json:"timeoutMs"`        // 单个脚本每次执行（含定时器回调）的最长时间
+	MaxCallStackSize int `json:"maxCallStackSize"` // 最大调用栈深度，防止无限递归
+	// MaxHeapGrowthMB 执行期间整个进程的堆增长上限，0为不限制（默认）。
+	// 这是近似的进程级保护，不是单个脚本的内存限制：并发执行的脚本和代理本身的分配都会计入
+	MaxHeapGrowthMB int `json:"maxHeapGrowthMB"`
+}
+
+// DefaultScriptLimits 默认脚本执行限制
+var DefaultScriptLimits = ScriptLimits{
+	TimeoutMs:        1000,
+	MaxCallStackSize: 4096,
+	MaxHeapGrowthMB:  0,
+}
+
+// scriptHooksSource 脚本在函数作用域中执行，避免顶层声明留在复用的运行时里，执行后返回生命周期函数；
+// 脚本顶层的return会跳过这里，直接作为脚本的返回值
+const scriptHooksSource = "\nreturn __proxywomanHooks(typeof onRequest === 'function' ? onRequest : undefined, typeof onResponse === 'function' ? onResponse : undefined);\n})()"
+
+// scriptWrapperPrefix 包装函数的前缀，不换行以保持错误信息中的行号
+const scriptWrapperPrefix = "(function(){"
+
+// compileScript 编译脚本
+func compileScript(name, content string) (*goja.Program, error) {
+	return goja.Compile(name, scriptWrapperPrefix+content+scriptHooksSource, false)
 }
 
 // ScriptResponse 脚本中的响应对象
@@ -45,6 +125,8 @@ type ScriptResponse struct {
 	Status     string            `json:"status"`
 	Headers    map[string]string `json:"headers"`
 	Body       string            `json:"body"`
+
+	header http.Header // respond()设置的全部响应头，包括同名的多个值
 }
 
 // ScriptConsole 脚本控制台
@@ -81,17 +163,37 @@ type ScriptStorage interface {
 type ScriptManager struct {
 	scripts      map[string]*Script
 	scriptsMutex sync.RWMutex
-	vm           *goja.Runtime
 	storage      ScriptStorage
+
+	runtimes    chan *scriptRuntime // 空闲的运行时
+	limits      ScriptLimits
+	limitsMutex sync.RWMutex
+
+	replay *ReplayManager // fetch使用的客户端
+	store  *scriptStore   // 脚本共享的键值存储
+
+	flowSource func(flowID string) (*proxycore.Flow, bool) // 试运行时按ID查找已捕获的Flow
+
+	// 脚本目录
+	scriptsDir   string
+	dirStamps    map[string]scriptFileStamp // 上次加载时目录中的文件
+	dirStop      chan struct{}
+	dirMutex     sync.Mutex
+	modules      map[string]*goja.Program // require()编译的模块，目录变化时清空
+	modulesMutex sync.Mutex
 }
 
 // NewScriptManager 创建脚本管理器
 func NewScriptManager(storage ScriptStorage) *ScriptManager {
 	manager := &ScriptManager{
-		scripts: make(map[string]*Script),
-		vm:      goja.New(),
-		storage: storage,
+		scripts:  make(map[string]*Script),
+		storage:  storage,
+		limits:   DefaultScriptLimits,
+		replay:   NewReplayManager(),
+		runtimes: make(chan *scriptRuntime, scriptRuntimePoolSize),
 	}
+	valueStorage, _ := storage.(ScriptValueStorage)
+	manager.store = newScriptStore(valueStorage)
 
 	// 从数据库加载脚本
 	manager.loadScriptsFromStorage()
@@ -115,15 +217,48 @@ func (sm *ScriptManager) loadScriptsFromStorage() {
 	defer sm.scriptsMutex.Unlock()
 
 	for _, script := range scripts {
+		script.program, script.compileErr = compileScript(script.Name, script.Content)
 		sm.scripts[script.ID] = script
 	}
 }
 
+// SetReplayManager 设置脚本中fetch使用的重放管理器
+func (sm *ScriptManager) SetReplayManager(replay *ReplayManager) {
+	sm.replay = replay
+}
+
+// SetLimits 设置脚本执行限制
+func (sm *ScriptManager) SetLimits(limits ScriptLimits) error {
+	if limits.TimeoutMs <= 0 {
+		return fmt.Errorf("script timeout must be positive")
+	}
+	if limits.MaxCallStackSize <= 0 || limits.MaxHeapGrowthMB < 0 {
+		return fmt.Errorf("invalid script limits")
+	}
+
+	sm.limitsMutex.Lock()
+	defer sm.limitsMutex.Unlock()
+	sm.limits = limits
+	return nil
+}
+
+// GetLimits 获取脚本执行限制
+func (sm *ScriptManager) GetLimits() ScriptLimits {
+	sm.limitsMutex.RLock()
+	defer sm.limitsMutex.RUnlock()
+	return sm.limits
+}
+
 // AddScript 添加脚本
 func (sm *ScriptManager) AddScript(script *Script) error {
+	if err := prepareScript(script); err != nil {
+		return err
+	}
+
 	sm.scriptsMutex.Lock()
 	defer sm.scriptsMutex.Unlock()
 
+	script.File = ""
 	script.CreatedAt = time.Now()
 	script.UpdatedAt = time.Now()
 
@@ -138,11 +273,30 @@ func (sm *ScriptManager) AddScript(script *Script) error {
 	return nil
 }
 
+// prepareScript 编译脚本并检查匹配规则，保存前调用
+func prepareScript(script *Script) error {
+	if script.URLPattern != "" {
+		if _, err := compileURLPattern(script.URLPattern, script.IsRegex); err != nil {
+			return fmt.Errorf("invalid URL pattern: %v", err)
+		}
+	}
+	program, err := compileScript(script.Name, script.Content)
+	if err != nil {
+		return fmt.Errorf("failed to compile script: %v", err)
+	}
+	script.program, script.compileErr = program, nil
+	return nil
+}
+
 // RemoveScript 移除脚本
 func (sm *ScriptManager) RemoveScript(scriptID string) error {
 	sm.scriptsMutex.Lock()
 	defer sm.scriptsMutex.Unlock()
 
+	if script, exists := sm.scripts[scriptID]; exists && script.File != "" {
+		return fmt.Errorf("script is loaded from %s, delete the file instead", script.File)
+	}
+
 	// 从数据库删除
 	if sm.storage != nil {
 		if err := sm.storage.DeleteScript(scriptID); err != nil {
@@ -156,12 +310,20 @@ func (sm *ScriptManager) RemoveScript(scriptID string) error {
 
 // UpdateScript 更新脚本
 func (sm *ScriptManager) UpdateScript(script *Script) error {
+	if err := prepareScript(script); err != nil {
+		return err
+	}
+
 	sm.scriptsMutex.Lock()
 	defer sm.scriptsMutex.Unlock()
 
-	if _, exists := sm.scripts[script.ID]; !exists {
+	existing, exists := sm.scripts[script.ID]
+	if !exists {
 		return fmt.Errorf("script not found: %s", script.ID)
 	}
+	if existing.File != "" {
+		return fmt.Errorf("script is loaded from %s, edit the file instead", existing.File)
+	}
 
 	script.UpdatedAt = time.Now()
 
@@ -186,8 +348,8 @@ func (sm *ScriptManager) UpdateScriptStatus(scriptID string, enabled bool) error
 		return fmt.Errorf("script not found: %s", scriptID)
 	}
 
-	// 更新数据库
-	if sm.storage != nil {
+	// 从目录加载的脚本只在内存中切换，文件变化重新加载后以元数据头为准
+	if sm.storage != nil && script.File == "" {
 		if err := sm.storage.UpdateScriptStatus(scriptID, enabled); err != nil {
 			return fmt.Errorf("failed to update script status: %v", err)
 		}
@@ -215,400 +377,414 @@ func (sm *ScriptManager) GetAllScripts() []*Script {
 	for _, script := range sm.scripts {
 		scripts = append(scripts, script)
 	}
+	sortScripts(scripts)
 	return scripts
 }
 
-// ExecuteRequestScripts 执行请求脚本
-func (sm *ScriptManager) ExecuteRequestScripts(flow *proxycore.Flow) error {
-	sm.scriptsMutex.RLock()
-	defer sm.scriptsMutex.RUnlock()
-
-	fmt.Printf("ExecuteRequestScripts: Found %d scripts\n", len(sm.scripts))
-	executed := false
-	for _, script := range sm.scripts {
-		if !script.Enabled {
-			fmt.Printf("Script '%s' is disabled, skipping\n", script.Name)
-			continue
-		}
-
-		if script.Type != "request" && script.Type != "both" {
-			fmt.Printf("Script '%s' type '%s' not applicable for request phase\n", script.Name, script.Type)
-			continue
-		}
-
-		fmt.Printf("Executing request script: %s\n", script.Name)
-		logs, err := sm.executeScript(script, flow, "request")
-
-		// 记录脚本执行信息到Flow
-		execution := proxycore.ScriptExecution{
-			ScriptID:   script.ID,
-			ScriptName: script.Name,
-			Phase:      "request",
-			Success:    err == nil,
-			Logs:       logs,
-			ExecutedAt: time.Now(),
-		}
-		if err != nil {
-			execution.Error = err.Error()
-			fmt.Printf("Script execution error (%s): %v\n", script.Name, err)
-		} else {
-			fmt.Printf("Script '%s' executed successfully\n", script.Name)
-			executed = true
-		}
-
-		// 添加执行记录到Flow
-		if flow.ScriptExecutions == nil {
-			flow.ScriptExecutions = make([]proxycore.ScriptExecution, 0)
-		}
-		flow.ScriptExecutions = append(flow.ScriptExecutions, execution)
-	}
-
-	// 统计执行成功的脚本数量
-	successCount := 0
-	for _, execution := range flow.ScriptExecutions {
-		if execution.Phase == "request" && execution.Success {
-			successCount++
-		}
+// ExecuteRequestScripts 按顺序执行请求脚本，脚本调用respond()时返回其构造的响应，由调用方直接返回给客户端
+func (sm *ScriptManager) ExecuteRequestScripts(flow *proxycore.Flow) (*ScriptResponse, error) {
+	action := sm.runScriptChain(flow, "request")
+	if action != nil && action.Type == ScriptActionRespond {
+		return action.Response, nil
 	}
+	return nil, nil
+}
 
-	// 只有在实际执行了脚本时才添加标签
-	if executed && successCount > 0 {
-		if flow.Tags == nil {
-			flow.Tags = make([]string, 0)
-		}
-
-		// 添加脚本标签，显示执行成功的脚本数量
-		scriptTag := fmt.Sprintf("脚本(%d)", successCount)
-
-		// 检查是否已经有脚本标签，避免重复添加
-		hasScriptTag := false
-		for i, tag := range flow.Tags {
-			if strings.HasPrefix(tag, "脚本(") {
-				// 更新现有标签
-				flow.Tags[i] = scriptTag
-				hasScriptTag = true
-				break
-			}
-		}
-
-		if !hasScriptTag {
-			flow.Tags = append(flow.Tags, scriptTag)
-		}
+// ExecuteResponseScripts 按顺序执行响应脚本，脚本调用respond()时以其构造的响应替换服务器响应
+func (sm *ScriptManager) ExecuteResponseScripts(flow *proxycore.Flow) error {
+	action := sm.runScriptChain(flow, "response")
+	if action != nil && action.Type == ScriptActionRespond && flow.Response != nil {
+		applyScriptResponse(flow.Response, action.Response)
 	}
-
 	return nil
 }
 
-// ExecuteResponseScripts 执行响应脚本
-func (sm *ScriptManager) ExecuteResponseScripts(flow *proxycore.Flow) error {
+// scriptsForPhase 返回适用于该阶段和请求的已启用脚本，按Order、创建时间、ID排序
+func (sm *ScriptManager) scriptsForPhase(flow *proxycore.Flow, phase string) []*Script {
 	sm.scriptsMutex.RLock()
 	defer sm.scriptsMutex.RUnlock()
 
-	executed := false
+	scripts := make([]*Script, 0, len(sm.scripts))
 	for _, script := range sm.scripts {
-		if !script.Enabled {
+		if !script.Enabled || (script.Type != phase && script.Type != "both") {
 			continue
 		}
-
-		if script.Type != "response" && script.Type != "both" {
+		if !script.matches(flow) {
 			continue
 		}
+		scripts = append(scripts, script)
+	}
+	sortScripts(scripts)
+	return scripts
+}
 
-		logs, err := sm.executeScript(script, flow, "response")
+// sortScripts 按执行顺序排序
+func sortScripts(scripts []*Script) {
+	sort.Slice(scripts, func(i, j int) bool {
+		a, b := scripts[i], scripts[j]
+		if a.Order != b.Order {
+			return a.Order < b.Order
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+}
+
+// runScriptChain 依次执行脚本并记录到Flow，每个脚本收到前一个脚本的返回值；
+// 脚本返回stop()或respond()时结束执行链并返回该结果，执行失败的脚本不影响后续脚本
+func (sm *ScriptManager) runScriptChain(flow *proxycore.Flow, phase string) *scriptAction {
+	var previous string
+	var action *scriptAction
+	for _, script := range sm.scriptsForPhase(flow, phase) {
+		start := time.Now()
+		snapshot := snapshotScriptFlow(flow)
+		result, err := sm.executeScript(script, flow, scriptRun{phase: phase, previous: previous, store: sm.store})
 
 		// 记录脚本执行信息到Flow
 		execution := proxycore.ScriptExecution{
 			ScriptID:   script.ID,
 			ScriptName: script.Name,
-			Phase:      "response",
+			Phase:      phase,
 			Success:    err == nil,
-			Logs:       logs,
-			ExecutedAt: time.Now(),
+			Logs:       result.logs,
+			ExecutedAt: start,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
 		}
 		if err != nil {
+			// 失败的脚本不留下部分修改
+			snapshot.restore(flow)
 			execution.Error = err.Error()
 			fmt.Printf("Script execution error (%s): %v\n", script.Name, err)
 		} else {
-			executed = true
+			previous = result.output
+			action = result.action
+			if action != nil {
+				execution.Action = action.Type
+			}
 		}
+		flow.ScriptExecutions = append(flow.ScriptExecutions, execution)
 
-		// 添加执行记录到Flow
-		if flow.ScriptExecutions == nil {
-			flow.ScriptExecutions = make([]proxycore.ScriptExecution, 0)
+		if action != nil {
+			break
 		}
-		flow.ScriptExecutions = append(flow.ScriptExecutions, execution)
 	}
 
-	// 统计执行成功的脚本数量
+	tagScriptExecutions(flow, phase)
+	return action
+}
+
+// tagScriptExecutions 以"脚本(n)"标签显示该阶段执行成功的脚本数量
+func tagScriptExecutions(flow *proxycore.Flow, phase string) {
 	successCount := 0
 	for _, execution := range flow.ScriptExecutions {
-		if execution.Phase == "response" && execution.Success {
+		if execution.Phase == phase && execution.Success {
 			successCount++
 		}
 	}
+	if successCount == 0 {
+		return
+	}
 
-	// 只有在实际执行了脚本时才添加标签
-	if executed && successCount > 0 {
-		if flow.Tags == nil {
-			flow.Tags = make([]string, 0)
-		}
-
-		// 添加脚本标签，显示执行成功的脚本数量
-		scriptTag := fmt.Sprintf("脚本(%d)", successCount)
-
-		// 检查是否已经有脚本标签，避免重复添加
-		hasScriptTag := false
-		for i, tag := range flow.Tags {
-			if strings.HasPrefix(tag, "脚本(") {
-				// 更新现有标签
-				flow.Tags[i] = scriptTag
-				hasScriptTag = true
-				break
-			}
-		}
-
-		if !hasScriptTag {
-			flow.Tags = append(flow.Tags, scriptTag)
+	// 已有脚本标签时更新，避免重复添加
+	scriptTag := fmt.Sprintf("脚本(%d)", successCount)
+	for i, tag := range flow.Tags {
+		if strings.HasPrefix(tag, "脚本(") {
+			flow.Tags[i] = scriptTag
+			return
 		}
 	}
-
-	return nil
+	flow.Tags = append(flow.Tags, scriptTag)
 }
 
 // executeScript 执行单个脚本
-func (sm *ScriptManager) executeScript(script *Script, flow *proxycore.Flow, phase string) ([]string, error) {
-	// 创建新的VM实例以避免状态污染
-	vm := goja.New()
-
-	// 创建脚本上下文
-	console := &ScriptConsole{logs: make([]string, 0)}
-	context := &ScriptContext{
-		Flow:    flow,
-		Console: console,
+func (sm *ScriptManager) executeScript(script *Script, flow *proxycore.Flow, run scriptRun) (scriptResult, error) {
+	if script.program == nil {
+		return scriptResult{}, fmt.Errorf("script compilation failed: %v", script.compileErr)
 	}
 
-	// 设置请求对象
+	// 从池中取运行时，内置对象已冻结，执行后删除脚本留下的全局属性再放回；被中断的运行时直接丢弃
+	rt := sm.acquireRuntime()
+	vm := rt.vm
+	limits := sm.GetLimits()
+	vm.SetMaxCallStackSize(limits.MaxCallStackSize)
+	watchdog := startScriptWatchdog(vm, limits)
+	defer func() {
+		sm.releaseRuntime(rt, watchdog.stop())
+	}()
+
+	// 注入以Flow为后端的请求和响应对象，脚本中的赋值直接修改Flow
+	console := &ScriptConsole{logs: make([]string, 0)}
+	codec := newScriptJSONCodec(vm)
+	request, response := goja.Null(), goja.Null()
 	if flow.Request != nil {
-		context.Request = &ScriptRequest{
-			Method:  flow.Request.Method,
-			URL:     flow.Request.URL,
-			Headers: flow.Request.Headers,
-			Body:    string(flow.Request.Body),
-		}
+		request = newScriptRequestObject(vm, codec, flow)
 	}
-
-	// 设置响应对象（如果存在）
 	if flow.Response != nil {
-		context.Response = &ScriptResponse{
-			StatusCode: flow.Response.StatusCode,
-			Status:     flow.Response.Status,
-			Headers:    flow.Response.Headers,
-			Body:       string(flow.Response.Body),
-		}
+		response = newScriptResponseObject(vm, codec, flow)
 	}
-
-	// 将上下文对象注入到VM中
-	vm.Set("flow", context.Flow)
-	vm.Set("request", context.Request)
-	vm.Set("response", context.Response)
+	vm.Set("flow", flow)
+	vm.Set("request", request)
+	vm.Set("response", response)
 
 	// 创建console对象，支持JavaScript的console.log调用
 	consoleObj := vm.NewObject()
 	consoleObj.Set("log", console.LogJS)
 	vm.Set("console", consoleObj)
 
-	// 创建JavaScript友好的context对象
 	contextObj := vm.NewObject()
-	contextObj.Set("flow", context.Flow)
-
-	// 设置request对象
-	if context.Request != nil {
-		requestObj := vm.NewObject()
-		requestObj.Set("method", context.Request.Method)
-		requestObj.Set("url", context.Request.URL)
-		requestObj.Set("headers", context.Request.Headers)
-		requestObj.Set("body", context.Request.Body)
-		contextObj.Set("request", requestObj)
-		console.LogJS(fmt.Sprintf("Created request object: method=%s, url=%s", context.Request.Method, context.Request.URL))
-	} else {
-		console.LogJS("No request object available")
-	}
-
-	// 设置response对象
-	if context.Response != nil {
-		responseObj := vm.NewObject()
-		responseObj.Set("statusCode", context.Response.StatusCode)
-		responseObj.Set("status", context.Response.Status)
-		responseObj.Set("headers", context.Response.Headers)
-		responseObj.Set("body", context.Response.Body)
-		contextObj.Set("response", responseObj)
-		console.LogJS(fmt.Sprintf("Created response object: statusCode=%d, status=%s", context.Response.StatusCode, context.Response.Status))
-	} else {
-		console.LogJS("No response object available")
-	}
-
+	contextObj.Set("flow", flow)
+	contextObj.Set("request", request)
+	contextObj.Set("response", response)
 	vm.Set("context", contextObj)
 
-	// 添加一些实用函数
-	vm.Set("setTimeout", func(callback func(), delay int) {
-		go func() {
-			time.Sleep(time.Duration(delay) * time.Millisecond)
-			callback()
-		}()
+	// setTimeout回调在脚本执行完后于同一goroutine中按时间顺序执行，受同一截止时间约束
+	loop := newScriptEventLoop(vm)
+	vm.Set("setTimeout", loop.setTimeout)
+	vm.Set("clearTimeout", loop.clearTimeout)
+	sm.installScriptStdlib(vm, watchdog.deadline, run)
+	sm.installScriptRequire(vm, codec, script.dir)
+
+	// 前一个脚本的返回值，作为context.previous和生命周期函数的第二个参数
+	previousValue := goja.Undefined()
+	if run.previous != "" {
+		if value, err := codec.decode(run.previous); err == nil {
+			previousValue = value
+		}
+	}
+	contextObj.Set("previous", previousValue)
+	vm.Set("stop", func() *scriptAction { return &scriptAction{Type: ScriptActionStop} })
+	vm.Set("respond", func(status, body, headers goja.Value) (*scriptAction, error) {
+		mock, err := newScriptResponse(codec, status, body, headers)
+		if err != nil {
+			return nil, err
+		}
+		return &scriptAction{Type: ScriptActionRespond, Response: mock}, nil
+	})
+	vm.Set("__proxywomanHooks", func(onRequest, onResponse goja.Value) *scriptHooks {
+		return &scriptHooks{onRequest: onRequest, onResponse: onResponse}
 	})
 
 	// 执行脚本
-	_, err := vm.RunString(script.Content)
+	returned, err := vm.RunProgram(script.program)
 	if err != nil {
-		return console.GetLogs(), fmt.Errorf("script execution failed: %v", err)
+		if limitErr := watchdog.limitError(err, limits); limitErr != nil {
+			return scriptResult{logs: console.GetLogs()}, limitErr
+		}
+		return scriptResult{logs: console.GetLogs()}, fmt.Errorf("script execution failed: %w", err)
 	}
 
-	// 检查并调用特定的生命周期函数
-	if phase == "request" {
-		if onRequestFunc := vm.Get("onRequest"); onRequestFunc != nil {
-			if callable, ok := goja.AssertFunction(onRequestFunc); ok {
-				// 传递JavaScript友好的context对象
-				_, err := callable(goja.Undefined(), vm.Get("context"))
-				if err != nil {
-					console.LogJS(fmt.Sprintf("onRequest function error: %v", err))
-				}
-			}
+	// 检查并调用特定的生命周期函数，脚本顶层return时以顶层返回值为结果
+	if hooks, ok := returned.Export().(*scriptHooks); ok {
+		hookName, hook := "onRequest", hooks.onRequest
+		if run.phase == "response" {
+			hookName, hook = "onResponse", hooks.onResponse
 		}
-	} else if phase == "response" {
-		if onResponseFunc := vm.Get("onResponse"); onResponseFunc != nil {
-			if callable, ok := goja.AssertFunction(onResponseFunc); ok {
-				// 传递JavaScript友好的context对象
-				_, err := callable(goja.Undefined(), vm.Get("context"))
-				if err != nil {
-					console.LogJS(fmt.Sprintf("onResponse function error: %v", err))
+		returned = goja.Undefined()
+		if callable, ok := goja.AssertFunction(hook); ok {
+			// 传递JavaScript友好的context对象
+			value, err := callable(goja.Undefined(), contextObj, previousValue)
+			if err != nil {
+				if limitErr := watchdog.limitError(err, limits); limitErr != nil {
+					return scriptResult{logs: console.GetLogs()}, limitErr
 				}
+				return scriptResult{logs: console.GetLogs()}, fmt.Errorf("%s failed: %w", hookName, err)
 			}
+			returned = value
+		}
+	}
+	if err := loop.run(watchdog.deadline); err != nil {
+		if limitErr := watchdog.limitError(err, limits); limitErr != nil {
+			return scriptResult{logs: console.GetLogs()}, limitErr
 		}
+		return scriptResult{logs: console.GetLogs()}, err
 	}
 
-	// 获取修改后的值并应用到Flow
-	// 直接从VM中获取修改后的context对象
-	if contextVal := vm.Get("context"); contextVal != nil && !goja.IsUndefined(contextVal) {
-		console.LogJS("Found context object in VM")
-
-		// 将context对象转换为Go对象
-		if contextObj := contextVal.ToObject(vm); contextObj != nil {
-			// 应用请求修改
-			if requestVal := contextObj.Get("request"); requestVal != nil && !goja.IsUndefined(requestVal) && flow.Request != nil {
-				console.LogJS("Processing request modifications")
-				if requestObj := requestVal.ToObject(vm); requestObj != nil {
-					if method := requestObj.Get("method"); method != nil && !goja.IsUndefined(method) {
-						if methodStr := method.String(); methodStr != "" {
-							flow.Request.Method = methodStr
-							console.LogJS(fmt.Sprintf("Updated request method to: %s", methodStr))
-						}
-					}
-					if url := requestObj.Get("url"); url != nil && !goja.IsUndefined(url) {
-						if urlStr := url.String(); urlStr != "" {
-							flow.Request.URL = urlStr
-							console.LogJS(fmt.Sprintf("Updated request URL to: %s", urlStr))
-						}
-					}
-					if headers := requestObj.Get("headers"); headers != nil && !goja.IsUndefined(headers) {
-						if headersObj := headers.Export(); headersObj != nil {
-							if headerMap, ok := headersObj.(map[string]interface{}); ok {
-								newHeaders := make(map[string]string)
-								for k, v := range headerMap {
-									if strVal, ok := v.(string); ok {
-										newHeaders[k] = strVal
-									}
-								}
-								flow.Request.Headers = newHeaders
-								console.LogJS(fmt.Sprintf("Updated request headers: %d headers", len(newHeaders)))
-							}
-						}
-					}
-					if body := requestObj.Get("body"); body != nil && !goja.IsUndefined(body) {
-						if bodyStr := body.String(); bodyStr != "" {
-							flow.Request.Body = []byte(bodyStr)
-							console.LogJS(fmt.Sprintf("Updated request body: %d bytes", len(bodyStr)))
-						}
-					}
-				}
-			}
+	result := scriptResult{logs: console.GetLogs()}
+	if action, ok := returned.Export().(*scriptAction); ok {
+		result.action = action
+	} else if returned != nil && !goja.IsUndefined(returned) {
+		// 无法序列化的返回值不传给下一个脚本
+		if output, err := codec.encode(returned, 0); err == nil {
+			result.output = output
+		} else {
+			result.logs = append(result.logs, fmt.Sprintf("return value is not serializable: %v", err))
+		}
+	}
+	return result, nil
+}
 
-			// 应用响应修改
-			if responseVal := contextObj.Get("response"); responseVal != nil && !goja.IsUndefined(responseVal) && flow.Response != nil {
-				console.LogJS("Processing response modifications")
-				if responseObj := responseVal.ToObject(vm); responseObj != nil {
-					if statusCode := responseObj.Get("statusCode"); statusCode != nil && !goja.IsUndefined(statusCode) {
-						if statusCodeInt := statusCode.ToInteger(); statusCodeInt != 0 {
-							flow.Response.StatusCode = int(statusCodeInt)
-							console.LogJS(fmt.Sprintf("Updated response status code to: %d", statusCodeInt))
-						}
-					}
-					if status := responseObj.Get("status"); status != nil && !goja.IsUndefined(status) {
-						if statusStr := status.String(); statusStr != "" {
-							flow.Response.Status = statusStr
-							console.LogJS(fmt.Sprintf("Updated response status to: %s", statusStr))
-						}
-					}
-					if headers := responseObj.Get("headers"); headers != nil && !goja.IsUndefined(headers) {
-						if headersObj := headers.Export(); headersObj != nil {
-							if headerMap, ok := headersObj.(map[string]interface{}); ok {
-								newHeaders := make(map[string]string)
-								for k, v := range headerMap {
-									if strVal, ok := v.(string); ok {
-										newHeaders[k] = strVal
-									}
-								}
-								flow.Response.Headers = newHeaders
-								console.LogJS(fmt.Sprintf("Updated response headers: %d headers", len(newHeaders)))
-							}
-						}
-					}
-					if body := responseObj.Get("body"); body != nil && !goja.IsUndefined(body) {
-						if bodyStr := body.String(); bodyStr != "" {
-							originalLen := len(flow.Response.Body)
-							flow.Response.Body = []byte(bodyStr)
-							console.LogJS(fmt.Sprintf("Updated response body: %d -> %d bytes", originalLen, len(bodyStr)))
-						}
-					}
-				}
-			}
+// ValidateScript 验证脚本语法，只编译不执行
+func (sm *ScriptManager) ValidateScript(content string) error {
+	_, err := compileScript("script", content)
+	return err
+}
+
+// scriptWatchdog 监控单次执行的截止时间和进程堆增长，超限时中断运行时。
+// 堆增长上限只是尽力而为：goja没有按运行时统计的内存，这里以整个进程的堆增长近似判断，
+// 同时执行的其他脚本和代理本身的分配也会计入，垃圾回收的时机也会影响结果
+type scriptWatchdog struct {
+	deadline time.Time
+	done     chan struct{}
+	exited   chan struct{}
+	reason   atomic.Value // string，中断原因
+}
+
+// heapObjectsMetric 堆上对象（含未回收的）占用的字节数
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+// scriptMemoryCheckInterval 内存检查间隔
+const scriptMemoryCheckInterval = 10 * time.Millisecond
+
+func startScriptWatchdog(vm *goja.Runtime, limits ScriptLimits) *scriptWatchdog {
+	timeout := time.Duration(limits.TimeoutMs) * time.Millisecond
+	w := &scriptWatchdog{
+		deadline: time.Now().Add(timeout),
+		done:     make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(w.exited)
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		var ticks <-chan time.Time
+		var baseline uint64
+		if limits.MaxHeapGrowthMB > 0 {
+			baseline = readHeapObjectsBytes()
+			ticker := time.NewTicker(scriptMemoryCheckInterval)
+			defer ticker.Stop()
+			ticks = ticker.C
 		}
-	} else {
-		console.LogJS("No context object found in VM")
-	}
-
-	// 备用方案：直接从VM中获取修改后的request和response对象
-	if context.Request != nil && flow.Request != nil {
-		if val := vm.Get("request"); val != nil {
-			if reqObj := val.Export(); reqObj != nil {
-				if req, ok := reqObj.(*ScriptRequest); ok {
-					flow.Request.Method = req.Method
-					flow.Request.URL = req.URL
-					flow.Request.Headers = req.Headers
-					flow.Request.Body = []byte(req.Body)
+		limit := uint64(limits.MaxHeapGrowthMB) << 20
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-timer.C:
+				w.interrupt(vm, fmt.Sprintf("script timed out after %dms", limits.TimeoutMs))
+				return
+			case <-ticks:
+				if heap := readHeapObjectsBytes(); heap > baseline && heap-baseline > limit {
+					w.interrupt(vm, fmt.Sprintf("process heap grew more than %dMB during script execution", limits.MaxHeapGrowthMB))
+					return
 				}
 			}
 		}
+	}()
+	return w
+}
+
+func (w *scriptWatchdog) interrupt(vm *goja.Runtime, reason string) {
+	w.reason.Store(reason)
+	vm.Interrupt(reason)
+}
+
+// interrupted 返回中断原因，未中断时为空
+func (w *scriptWatchdog) interrupted() string {
+	reason, _ := w.reason.Load().(string)
+	return reason
+}
+
+// stop 停止监控并等待监控goroutine退出，返回运行时是否被中断过
+func (w *scriptWatchdog) stop() bool {
+	close(w.done)
+	<-w.exited
+	return w.interrupted() != ""
+}
+
+// limitError 错误由执行限制引起时返回说明原因的错误，否则返回nil
+func (w *scriptWatchdog) limitError(err error, limits ScriptLimits) error {
+	if reason := w.interrupted(); reason != "" {
+		return errors.New(reason)
 	}
+	var overflow *goja.StackOverflowError
+	if errors.As(err, &overflow) {
+		return fmt.Errorf("script exceeded max call stack size of %d", limits.MaxCallStackSize)
+	}
+	return nil
+}
 
-	if context.Response != nil && flow.Response != nil {
-		if val := vm.Get("response"); val != nil {
-			if respObj := val.Export(); respObj != nil {
-				if resp, ok := respObj.(*ScriptResponse); ok {
-					flow.Response.StatusCode = resp.StatusCode
-					flow.Response.Status = resp.Status
-					flow.Response.Headers = resp.Headers
-					flow.Response.Body = []byte(resp.Body)
-				}
-			}
-		}
+func readHeapObjectsBytes() uint64 {
+	sample := []metrics.Sample{{Name: heapObjectsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
 	}
+	return sample[0].Value.Uint64()
+}
 
-	return console.GetLogs(), nil
+// scriptTimer setTimeout注册的回调
+type scriptTimer struct {
+	id       int64
+	due      time.Time
+	callback goja.Callable
+	args     []goja.Value
 }
 
-// ValidateScript 验证脚本语法
-func (sm *ScriptManager) ValidateScript(content string) error {
-	vm := goja.New()
-	_, err := vm.RunString(content)
-	return err
+// scriptEventLoop 单次执行内的定时器队列，回调只在执行脚本的goroutine中调用，不会并发访问运行时
+type scriptEventLoop struct {
+	vm     *goja.Runtime
+	timers []*scriptTimer
+	nextID int64
+}
+
+func newScriptEventLoop(vm *goja.Runtime) *scriptEventLoop {
+	return &scriptEventLoop{vm: vm}
+}
+
+func (l *scriptEventLoop) setTimeout(call goja.FunctionCall) goja.Value {
+	callback, ok := goja.AssertFunction(call.Argument(0))
+	if !ok {
+		panic(l.vm.NewTypeError("setTimeout callback must be a function"))
+	}
+	delay := call.Argument(1).ToInteger()
+	if delay < 0 {
+		delay = 0
+	}
+	var args []goja.Value
+	if len(call.Arguments) > 2 {
+		args = append(args, call.Arguments[2:]...)
+	}
+
+	l.nextID++
+	l.timers = append(l.timers, &scriptTimer{
+		id:       l.nextID,
+		due:      time.Now().Add(time.Duration(delay) * time.Millisecond),
+		callback: callback,
+		args:     args,
+	})
+	return l.vm.ToValue(l.nextID)
+}
+
+func (l *scriptEventLoop) clearTimeout(id int64) {
+	for i, timer := range l.timers {
+		if timer.id == id {
+			l.timers = append(l.timers[:i], l.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+// run 按到期时间依次执行定时器，回调中可继续注册定时器；到期时间晚于截止时间时报错
+func (l *scriptEventLoop) run(deadline time.Time) error {
+	for len(l.timers) > 0 {
+		sort.SliceStable(l.timers, func(i, j int) bool { return l.timers[i].due.Before(l.timers[j].due) })
+		timer := l.timers[0]
+		l.timers = l.timers[1:]
+
+		if timer.due.After(deadline) {
+			return fmt.Errorf("setTimeout delay exceeds the script timeout")
+		}
+		if wait := time.Until(timer.due); wait > 0 {
+			time.Sleep(wait)
+		}
+		if _, err := timer.callback(goja.Undefined(), timer.args...); err != nil {
+			return fmt.Errorf("setTimeout callback failed: %v", err)
+		}
+	}
+	return nil
 }
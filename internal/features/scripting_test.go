@@ -0,0 +1,528 @@
+package features
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+// newScriptTestFlow 创建带请求的Flow
+func newScriptTestFlow() *proxycore.Flow {
+	return &proxycore.Flow{
+		Method: "GET",
+		URL:    "http://example.com/",
+		Request: &proxycore.FlowRequest{
+			Method:  "GET",
+			URL:     "http://example.com/",
+			Headers: map[string]string{"Accept": "*/*"},
+		},
+	}
+}
+
+// runTestScript 添加并执行单个请求脚本
+func runTestScript(t *testing.T, manager *ScriptManager, content string) (*proxycore.Flow, []string, error) {
+	t.Helper()
+	script := &Script{ID: "s", Name: "test", Content: content, Enabled: true, Type: "request"}
+	if err := manager.AddScript(script); err != nil {
+		t.Fatal(err)
+	}
+	flow := newScriptTestFlow()
+	result, err := manager.executeScript(script, flow, scriptRun{phase: "request", store: manager.store})
+	return flow, result.logs, err
+}
+
+func TestScriptLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  ScriptLimits
+		content string
+		wantErr string
+	}{
+		{"infinite loop", ScriptLimits{TimeoutMs: 100, MaxCallStackSize: 1000}, "while (true) {}", "timed out"},
+		{"infinite loop in hook", ScriptLimits{TimeoutMs: 100, MaxCallStackSize: 1000}, "function onRequest(ctx) { for (;;) {} }", "timed out"},
+		{"recursion", ScriptLimits{TimeoutMs: 1000, MaxCallStackSize: 100}, "function f() { return f() } f()", "stack"},
+		{"memory", ScriptLimits{TimeoutMs: 10000, MaxCallStackSize: 1000, MaxHeapGrowthMB: 16}, "var s = new Array(65536).join('x'), a = []; while (true) { a.push(s + a.length) }", "process heap grew"},
+		{"timer beyond deadline", ScriptLimits{TimeoutMs: 100, MaxCallStackSize: 1000}, "setTimeout(function() {}, 5000)", "exceeds the script timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewScriptManager(nil)
+			if err := manager.SetLimits(tt.limits); err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			_, _, err := runTestScript(t, manager, tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("script ran for %v", elapsed)
+			}
+
+			// 之后的执行不受影响
+			flow, _, err := runTestScript(t, manager, "request.Headers['X-After'] = 'ok'")
+			if err != nil || flow.Request.Headers["X-After"] != "ok" {
+				t.Errorf("follow-up execution failed: %v %v", err, flow.Request.Headers)
+			}
+		})
+	}
+
+	if err := NewScriptManager(nil).SetLimits(ScriptLimits{}); err == nil {
+		t.Error("zero timeout should be rejected")
+	}
+}
+
+func TestScriptExecutionIsolation(t *testing.T) {
+	manager := NewScriptManager(nil)
+
+	// 顶层声明、let/const和未声明赋值的变量都不应留到下一次执行
+	for i := 0; i < 3; i++ {
+		_, _, err := runTestScript(t, manager, `
+			const marker = 1;
+			let counter = 0;
+			leaked = "yes";
+			function onRequest(ctx) { ctx.request.headers["X-Hook"] = "1"; }
+		`)
+		if err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+
+	flow, logs, err := runTestScript(t, manager, `console.log("state:" + typeof leaked + "," + typeof onRequest + "," + typeof marker)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsLog(logs, "state:undefined,undefined,undefined") {
+		t.Errorf("globals leaked between executions: %v", logs)
+	}
+	if flow.Request.Headers["X-Hook"] != "" {
+		t.Error("hook from a previous script should not run")
+	}
+
+	// 对内置对象的修改和不可枚举的全局属性同样不应留到下一次执行
+	if _, _, err := runTestScript(t, manager, `
+		JSON.stringify = function() { return "hijacked"; };
+		Array.prototype.leaked = 1;
+		Object.defineProperty(globalThis, "hidden", { value: 1, enumerable: false });
+	`); err != nil {
+		t.Fatal(err)
+	}
+	flow, logs, err = runTestScript(t, manager, `
+		console.log("builtins:" + JSON.stringify({a: 1}) + "," + typeof [].leaked + "," + typeof hidden);
+		request.Headers["X-Json"] = JSON.stringify([1]);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsLog(logs, `builtins:{"a":1},undefined,undefined`) || flow.Request.Headers["X-Json"] != "[1]" {
+		t.Errorf("builtin mutations leaked between executions: %v", logs)
+	}
+
+	// 内置对象冻结后，继承它们的对象仍然可以覆盖常用的属性
+	_, logs, err = runTestScript(t, manager, `
+		function MyError(message) { this.message = message; }
+		MyError.prototype = Object.create(Error.prototype);
+		MyError.prototype.name = "MyError";
+		var point = {};
+		point.toString = function() { return "point"; };
+		console.log("override:" + String(new MyError("bad")) + "," + String(point));
+	`)
+	if err != nil || !containsLog(logs, "override:MyError: bad,point") {
+		t.Errorf("overriding inherited properties failed: %v %v", logs, err)
+	}
+}
+
+func TestScriptSetTimeout(t *testing.T) {
+	manager := NewScriptManager(nil)
+	flow, logs, err := runTestScript(t, manager, `
+		var order = [];
+		setTimeout(function(v) { order.push(v); context.request.headers["X-Order"] = order.join(","); }, 20, "b");
+		var cancelled = setTimeout(function() { order.push("x"); }, 5);
+		clearTimeout(cancelled);
+		setTimeout(function(v) { order.push(v); }, 0, "a");
+	`)
+	if err != nil {
+		t.Fatalf("%v %v", err, logs)
+	}
+	if got := flow.Request.Headers["X-Order"]; got != "a,b" {
+		t.Errorf("timer order = %q", got)
+	}
+}
+
+func TestScriptCompiledOnSave(t *testing.T) {
+	manager := NewScriptManager(nil)
+	if err := manager.AddScript(&Script{ID: "bad", Name: "bad", Content: "function (", Type: "request"}); err == nil {
+		t.Error("syntax error should be rejected on save")
+	}
+	if _, exists := manager.GetScript("bad"); exists {
+		t.Error("invalid script should not be stored")
+	}
+
+	// 验证只编译不执行
+	done := make(chan error, 1)
+	go func() { done <- manager.ValidateScript("while (true) {}") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ValidateScript executed the script")
+	}
+}
+
+func TestScriptChainOrderAndMatch(t *testing.T) {
+	manager := NewScriptManager(nil)
+	add := func(script *Script) {
+		t.Helper()
+		script.Enabled = true
+		if err := manager.AddScript(script); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 按Order执行，与添加顺序无关；每个脚本收到前一个脚本的返回值
+	add(&Script{ID: "c", Name: "c", Type: "request", Order: 3, Content: `function onRequest(ctx, prev) { ctx.request.headers["X-Chain"] = prev.steps.concat("c").join(","); }`})
+	add(&Script{ID: "a", Name: "a", Type: "request", Order: 1, Content: `return {steps: ["a"]}`})
+	add(&Script{ID: "b", Name: "b", Type: "both", Order: 2, Content: `function onRequest(ctx, prev) { prev.steps.push("b"); return prev; }`})
+	add(&Script{ID: "other", Name: "other", Type: "request", Order: 2, URLPattern: "other.test", Content: `return {steps: ["wrong"]}`})
+	add(&Script{ID: "post", Name: "post", Type: "request", Order: 2, Method: "POST", Content: `return {steps: ["wrong"]}`})
+
+	if err := manager.AddScript(&Script{ID: "bad", Name: "bad", URLPattern: "(", IsRegex: true, Content: ""}); err == nil {
+		t.Error("invalid regex should be rejected")
+	}
+
+	flow := newScriptTestFlow()
+	if mocked, err := manager.ExecuteRequestScripts(flow); err != nil || mocked != nil {
+		t.Fatalf("unexpected result: %v %v", mocked, err)
+	}
+	if got := flow.Request.Headers["X-Chain"]; got != "a,b,c" {
+		t.Errorf("chain = %q", got)
+	}
+	if len(flow.ScriptExecutions) != 3 {
+		t.Fatalf("executions = %+v", flow.ScriptExecutions)
+	}
+	for i, id := range []string{"a", "b", "c"} {
+		if execution := flow.ScriptExecutions[i]; execution.ScriptID != id || !execution.Success || execution.DurationMs <= 0 {
+			t.Errorf("execution %d = %+v", i, execution)
+		}
+	}
+	if !flow.HasTag("脚本(3)") {
+		t.Errorf("tags = %v", flow.Tags)
+	}
+
+	// 匹配规则对POST和other.test生效
+	flow = newScriptTestFlow()
+	flow.URL, flow.Request.Method = "http://other.test/x", "POST"
+	manager.ExecuteRequestScripts(flow)
+	if len(flow.ScriptExecutions) != 5 {
+		t.Errorf("expected all scripts to match, got %d", len(flow.ScriptExecutions))
+	}
+}
+
+func TestScriptStopAndRespond(t *testing.T) {
+	manager := NewScriptManager(nil)
+	manager.AddScript(&Script{ID: "stop", Name: "stop", Type: "request", Enabled: true, Order: 1, URLPattern: "/stop", Content: `return stop()`})
+	manager.AddScript(&Script{ID: "mock", Name: "mock", Type: "both", Enabled: true, Order: 2, Content: `
+		function onRequest(ctx) { if (ctx.request.url.indexOf("/mock") >= 0) return respond(201, {ok: true}, {"x-mock": 1}); }
+		function onResponse(ctx) { return respond(503, "down"); }
+	`})
+	manager.AddScript(&Script{ID: "last", Name: "last", Type: "request", Enabled: true, Order: 3, Content: `request.Headers["X-Last"] = "1"`})
+
+	flow := newScriptTestFlow()
+	flow.URL = "http://example.com/stop"
+	manager.ExecuteRequestScripts(flow)
+	if len(flow.ScriptExecutions) != 1 || flow.ScriptExecutions[0].Action != ScriptActionStop {
+		t.Errorf("stop should end the chain: %+v", flow.ScriptExecutions)
+	}
+
+	flow = newScriptTestFlow()
+	flow.URL = "http://example.com/mock"
+	flow.Request.URL = flow.URL
+	mocked, err := manager.ExecuteRequestScripts(flow)
+	if err != nil || mocked == nil {
+		t.Fatalf("expected mocked response, got %v %v", mocked, err)
+	}
+	if mocked.StatusCode != 201 || mocked.Body != `{"ok":true}` || mocked.Headers["Content-Type"] != "application/json" || mocked.Headers["X-Mock"] != "1" {
+		t.Errorf("mocked = %+v", mocked)
+	}
+	if flow.Request.Headers["X-Last"] != "" || flow.ScriptExecutions[len(flow.ScriptExecutions)-1].Action != ScriptActionRespond {
+		t.Errorf("respond should end the chain: %+v", flow.ScriptExecutions)
+	}
+
+	// 响应阶段以脚本的响应替换服务器响应
+	flow.Response = &proxycore.FlowResponse{StatusCode: 200, Status: "200 OK", Headers: map[string]string{}, Body: []byte("ok")}
+	manager.ExecuteResponseScripts(flow)
+	if flow.Response.StatusCode != 503 || string(flow.Response.Body) != "down" {
+		t.Errorf("response = %d %q", flow.Response.StatusCode, flow.Response.Body)
+	}
+
+	// 拦截器直接返回脚本的响应
+	flow = newScriptTestFlow()
+	flow.URL = "http://example.com/mock"
+	flow.Request.URL = flow.URL
+	recorder := httptest.NewRecorder()
+	handled, err := NewScriptInterceptor(manager).InterceptRequest(flow, recorder, httptest.NewRequest("GET", flow.URL, nil))
+	if !handled || err != nil || recorder.Code != 201 || recorder.Body.String() != `{"ok":true}` || flow.Response == nil {
+		t.Errorf("interceptor: handled=%v err=%v code=%d body=%q", handled, err, recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestScriptMockedResponse(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "user.json"), []byte(`{"id":1}`), 0644)
+
+	manager := NewScriptManager(nil)
+	manager.AddScript(&Script{ID: "mock", Name: "mock", Type: "request", Enabled: true, Content: fmt.Sprintf(`
+		function onRequest(ctx) {
+			var path = ctx.request.url.replace("http://example.com", "");
+			if (path === "/file") return respond({file: %q});
+			if (path === "/png") return respond({base64Body: "iVBORw0K", headers: {"Content-Type": "image/png"}});
+			return respond({status: 418, statusText: "Teapot", headers: {"Set-Cookie": ["a=1", "b=2"], "X-Count": 2}, body: "short and stout"});
+		}
+	`, filepath.Join(dir, "user.json"))})
+	interceptor := NewScriptInterceptor(manager)
+
+	serve := func(path string) (*proxycore.Flow, *httptest.ResponseRecorder) {
+		flow := newScriptTestFlow()
+		flow.URL = "http://example.com" + path
+		flow.Request.URL = flow.URL
+		recorder := httptest.NewRecorder()
+		handled, err := interceptor.InterceptRequest(flow, recorder, httptest.NewRequest("GET", flow.URL, nil))
+		if !handled || err != nil {
+			t.Fatalf("%s: handled=%v err=%v", path, handled, err)
+		}
+		if !flow.HasTag("script-mocked") || flow.Response == nil || flow.Response.StatusCode != recorder.Code {
+			t.Errorf("%s: flow not recorded as mocked: %v %+v", path, flow.Tags, flow.Response)
+		}
+		return flow, recorder
+	}
+
+	_, recorder := serve("/teapot")
+	if recorder.Code != 418 || recorder.Body.String() != "short and stout" {
+		t.Errorf("teapot = %d %q", recorder.Code, recorder.Body.String())
+	}
+	if cookies := recorder.Header().Values("Set-Cookie"); len(cookies) != 2 || recorder.Header().Get("X-Count") != "2" {
+		t.Errorf("headers = %v", recorder.Header())
+	}
+
+	_, recorder = serve("/file")
+	if recorder.Body.String() != `{"id":1}` || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("file = %q %v", recorder.Body.String(), recorder.Header())
+	}
+
+	flow, recorder := serve("/png")
+	if !bytes.Equal(recorder.Body.Bytes(), []byte{0x89, 'P', 'N', 'G', '\r', '\n'}) || len(flow.Response.Body) != 6 {
+		t.Errorf("png = %x", recorder.Body.Bytes())
+	}
+}
+
+func TestScriptObjectModel(t *testing.T) {
+	manager := NewScriptManager(nil)
+	manager.AddScript(&Script{ID: "model", Name: "model", Type: "both", Enabled: true, Content: `
+		function onRequest(ctx) {
+			var req = ctx.request;
+			console.log("accept:" + req.headers.get("accept") + "," + req.headers["ACCEPT"] + "," + req.headers.has("x-missing"));
+			req.headers.set("x-token", "abc");
+			req.headers["x-other"] = 1;
+			req.headers.delete("Accept");
+			delete req.headers["X-Other"];
+			req.location.searchParams.set("page", "2");
+			req.location.pathname = "/v2/items";
+			console.log("json:" + req.json().a + " keys:" + req.headers.keys().join(","));
+			req.body = "";
+			var u = new URL("/x?a=1&a=2", "https://api.test");
+			console.log("url:" + u.hostname + u.pathname + " " + u.searchParams.getAll("a").length);
+		}
+		function onResponse(ctx) {
+			var resp = ctx.response;
+			resp.statusCode = 404;
+			resp.headers["Set-Cookie"] = null;
+			var bytes = resp.bytes();
+			console.log("bytes:" + bytes.length + " first:" + bytes[0]);
+			resp.body = new Uint8Array([0, 255]);
+		}
+	`})
+
+	flow := newScriptTestFlow()
+	flow.Request.URL = "http://example.com/v1/items?q=go"
+	flow.Request.Body = []byte(`{"a":1}`)
+	flow.Request.Headers["X-Keep"] = "1"
+	manager.ExecuteRequestScripts(flow)
+	if execution := flow.ScriptExecutions[0]; !execution.Success {
+		t.Fatalf("script failed: %+v", execution)
+	}
+	logs := flow.ScriptExecutions[0].Logs
+	expectLogs(t, logs, "accept:*/*,*/*,false", "json:1 keys:X-Keep,X-Token", "url:api.test/x 2")
+
+	request := flow.Request
+	if request.URL != "http://example.com/v2/items?page=2&q=go" {
+		t.Errorf("url = %s", request.URL)
+	}
+	if len(request.Body) != 0 || request.Headers["X-Token"] != "abc" || len(request.Headers) != 2 {
+		t.Errorf("request = %q %v", request.Body, request.Headers)
+	}
+
+	flow.Response = &proxycore.FlowResponse{StatusCode: 200, Status: "200 OK", Headers: map[string]string{"Set-Cookie": "a=1"}, Body: []byte("hi")}
+	manager.ExecuteResponseScripts(flow)
+	expectLogs(t, flow.ScriptExecutions[1].Logs, "bytes:2 first:104")
+	if flow.Response.StatusCode != 404 || flow.Response.Status != "404 Not Found" || len(flow.Response.Headers) != 0 || string(flow.Response.Body) != "\x00\xff" {
+		t.Errorf("response = %+v", flow.Response)
+	}
+
+	// 失败的脚本不留下部分修改，拦截器删除脚本删除的请求头
+	manager.AddScript(&Script{ID: "fail", Name: "fail", Type: "request", Enabled: true, Order: 1, Content: `request.body = "changed"; throw new Error("boom")`})
+	flow = newScriptTestFlow()
+	flow.Request.Body = []byte(`{"a":1}`)
+	r := httptest.NewRequest("GET", flow.URL, nil)
+	r.Header.Set("Accept", "*/*")
+	NewScriptInterceptor(manager).InterceptRequest(flow, httptest.NewRecorder(), r)
+	if string(flow.Request.Body) != "" || !flow.ScriptExecutions[0].Success || flow.ScriptExecutions[1].Success {
+		t.Errorf("failed script should be rolled back: %q %+v", flow.Request.Body, flow.ScriptExecutions)
+	}
+	if r.Header.Get("Accept") != "" || r.Header.Get("X-Token") != "abc" {
+		t.Errorf("request headers = %v", r.Header)
+	}
+
+	// 脚本修改了URL的主机时，转发的请求使用新的Host
+	manager = NewScriptManager(nil)
+	manager.AddScript(&Script{ID: "host", Name: "host", Type: "request", Enabled: true, Content: `request.location.host = "other.test:8080"`})
+	flow = newScriptTestFlow()
+	r = httptest.NewRequest("GET", flow.URL, nil)
+	NewScriptInterceptor(manager).InterceptRequest(flow, httptest.NewRecorder(), r)
+	if r.URL.Host != "other.test:8080" || r.Host != "other.test:8080" {
+		t.Errorf("url host = %s, host = %s", r.URL.Host, r.Host)
+	}
+}
+
+func TestScriptCompressedBodies(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(`{"name":"alice"}`))
+		gz.Close()
+	}))
+	defer backend.Close()
+
+	manager := NewScriptManager(nil)
+	manager.AddScript(&Script{ID: "gzip", Name: "gzip", Type: "both", Enabled: true, Content: `
+		function onRequest(ctx) {
+			console.log("request:" + ctx.request.text());
+		}
+		function onResponse(ctx) {
+			console.log("response:" + ctx.response.body);
+			if (ctx.request.url.indexOf("/upper") >= 0) {
+				ctx.response.body = {name: ctx.response.json().name.toUpperCase()};
+			}
+		}
+	`})
+	_, client, flows := newTestProxy(t, NewScriptInterceptor(manager))
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("hello"))
+	gz.Close()
+	req, _ := http.NewRequest("POST", backend.URL+"/upper", &compressed)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	flow := <-flows
+	if string(body) != `{"name":"ALICE"}` || resp.Uncompressed || resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("modified response = %q uncompressed=%v %v", body, resp.Uncompressed, resp.Header)
+	}
+	var logs []string
+	for _, execution := range flow.ScriptExecutions {
+		logs = append(logs, execution.Logs...)
+	}
+	expectLogs(t, logs, "request:hello", `response:{"name":"alice"}`)
+
+	// 未修改消息体时原样转发压缩的响应
+	resp, err = client.Get(backend.URL + "/keep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	<-flows
+	if string(body) != `{"name":"alice"}` || !resp.Uncompressed {
+		t.Errorf("untouched response = %q uncompressed=%v", body, resp.Uncompressed)
+	}
+}
+
+func TestScriptMultiValueHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Seen", strings.Join(r.Header.Values("X-Tag"), ","))
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+	}))
+	defer backend.Close()
+
+	manager := NewScriptManager(nil)
+	manager.AddScript(&Script{ID: "multi", Name: "multi", Type: "both", Enabled: true, Content: `
+		function onRequest(ctx) {
+			ctx.request.headers.append("x-tag", "b");
+		}
+		function onResponse(ctx) {
+			var headers = ctx.response.headers;
+			console.log("cookies:" + headers.getAll("set-cookie").join(";") + " first:" + headers.get("Set-Cookie"));
+			if (ctx.request.url.indexOf("/append") >= 0) {
+				headers.append("Set-Cookie", "c=3");
+			} else {
+				headers.set("X-Other", "1");
+			}
+		}
+	`})
+	_, client, flows := newTestProxy(t, NewScriptInterceptor(manager))
+
+	get := func(path string) *http.Response {
+		req, _ := http.NewRequest("GET", backend.URL+path, nil)
+		req.Header.Set("X-Tag", "a")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// 脚本未修改的多值头部保留全部值
+	resp := get("/keep")
+	flow := <-flows
+	if cookies := resp.Header.Values("Set-Cookie"); len(cookies) != 2 || resp.Header.Get("X-Other") != "1" {
+		t.Errorf("headers = %v", resp.Header)
+	}
+	if seen := resp.Header.Get("X-Seen"); seen != "a,b" {
+		t.Errorf("backend saw X-Tag = %q", seen)
+	}
+	expectLogs(t, flow.ScriptExecutions[1].Logs, "cookies:a=1;b=2 first:a=1")
+
+	resp = get("/append")
+	<-flows
+	if cookies := resp.Header.Values("Set-Cookie"); strings.Join(cookies, ";") != "a=1;b=2;c=3" {
+		t.Errorf("cookies = %v", cookies)
+	}
+}
+
+func containsLog(logs []string, want string) bool {
+	for _, log := range logs {
+		if strings.Contains(log, want) {
+			return true
+		}
+	}
+	return false
+}
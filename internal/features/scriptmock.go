@@ -0,0 +1,129 @@
+package features
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/dop251/goja"
+)
+
+// newScriptResponse 构造respond()的响应，支持两种写法：
+//   - respond(status, body, headers)
+//   - respond({status, statusText, headers, body, base64Body, file})
+//
+// 状态码默认200；非字符串的body按JSON序列化，base64Body用于二进制内容，file读取本地文件作为响应体。
+// 头部的值可以是数组，表示同名的多个头。
+func newScriptResponse(codec *scriptJSONCodec, status, body, headers goja.Value) (*ScriptResponse, error) {
+	var statusText, base64Body, file goja.Value
+	if options, ok := status.(*goja.Object); ok && isScriptObject(options) {
+		status = options.Get("status")
+		statusText = options.Get("statusText")
+		headers = options.Get("headers")
+		body = options.Get("body")
+		base64Body = options.Get("base64Body")
+		file = options.Get("file")
+	}
+
+	statusCode := http.StatusOK
+	if isScriptValueSet(status) {
+		statusCode = int(status.ToInteger())
+	}
+	if statusCode < 100 || statusCode > 999 {
+		return nil, fmt.Errorf("invalid status code: %d", statusCode)
+	}
+
+	response := &ScriptResponse{
+		StatusCode: statusCode,
+		Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		Headers:    make(map[string]string),
+		header:     make(http.Header),
+	}
+	if isScriptValueSet(statusText) {
+		response.Status = fmt.Sprintf("%d %s", statusCode, statusText.String())
+	}
+	if isScriptValueSet(headers) {
+		headerMap, ok := headers.Export().(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("headers must be an object")
+		}
+		for name, value := range headerMap {
+			if values, ok := value.([]interface{}); ok {
+				for _, v := range values {
+					response.header.Add(name, fmt.Sprint(v))
+				}
+				continue
+			}
+			response.header.Add(name, fmt.Sprint(value))
+		}
+	}
+
+	switch {
+	case isScriptValueSet(file):
+		path := file.String()
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response file: %v", err)
+		}
+		if response.header.Get("Content-Type") == "" {
+			response.header.Set("Content-Type", detectContentType(path, bytes.NewReader(content)))
+		}
+		response.Body = string(content)
+	case isScriptValueSet(base64Body):
+		content, err := base64.StdEncoding.DecodeString(base64Body.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64Body: %v", err)
+		}
+		response.Body = string(content)
+	case !isScriptValueSet(body):
+	case isScriptString(body):
+		response.Body = body.String()
+	default:
+		encoded, err := codec.encode(body, 0)
+		if err != nil {
+			return nil, err
+		}
+		response.Body = encoded
+		if response.header.Get("Content-Type") == "" {
+			response.header.Set("Content-Type", "application/json")
+		}
+	}
+
+	for name, values := range response.header {
+		response.Headers[name] = values[0]
+	}
+	return response, nil
+}
+
+// mockedResponse 把脚本构造的响应转换为不经服务器的HTTP响应
+func (sr *ScriptResponse) mockedResponse(req *http.Request) (*http.Response, []byte) {
+	body := sr.Body
+	resp, content := mockResponse(&BreakpointEdit{StatusCode: sr.StatusCode, Headers: sr.Headers, Body: &body}, req)
+	if sr.header != nil {
+		resp.Header = sr.header.Clone()
+		resp.Header.Del("Content-Length")
+	}
+	if sr.Status != "" {
+		resp.Status = sr.Status
+	}
+	return resp, content
+}
+
+// isScriptValueSet 判断JS值既不是undefined也不是null
+func isScriptValueSet(value goja.Value) bool {
+	return value != nil && !goja.IsUndefined(value) && !goja.IsNull(value)
+}
+
+// isScriptString 判断JS值是否为字符串
+func isScriptString(value goja.Value) bool {
+	_, ok := value.Export().(string)
+	return ok
+}
+
+// isScriptObject 判断JS值是否为普通对象
+func isScriptObject(value goja.Value) bool {
+	_, ok := value.Export().(map[string]interface{})
+	return ok
+}
@@ -0,0 +1,651 @@
+package features
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"ProxyWoman/internal/proxycore"
+
+	"github.com/dop251/goja"
+)
+
+// 脚本中的 request/response 对象直接读写Flow，赋值立即生效：
+//   - request.method / request.url / request.headers / request.body
+//   - response.statusCode / response.status / response.headers / response.body
+//   - text()、json()、bytes() 以文本、JSON、Uint8Array读取消息体
+//   - 消息体按Content-Encoding解压后交给脚本，赋值body后删除Content-Encoding，以未压缩的内容发送
+//   - request.location 是与请求URL联动的URL对象，带 searchParams
+//
+// 首字母大写的旧字段名（Method、URL、Headers、Body、StatusCode、Status）保留为别名。
+
+// newScriptRequestObject 创建以flow.Request为后端的请求对象
+func newScriptRequestObject(vm *goja.Runtime, codec *scriptJSONCodec, flow *proxycore.Flow) *goja.Object {
+	req := flow.Request
+	obj := vm.NewObject()
+	headers := newScriptHeaders(vm, &req.Headers, &req.HeaderValues)
+
+	method := scriptProperty{
+		get: func() goja.Value { return vm.ToValue(req.Method) },
+		set: func(value goja.Value) error {
+			req.Method = strings.ToUpper(value.String())
+			return nil
+		},
+	}
+	rawURL := scriptProperty{
+		get: func() goja.Value { return vm.ToValue(req.URL) },
+		set: func(value goja.Value) error {
+			parsed, err := url.Parse(value.String())
+			if err != nil || !parsed.IsAbs() {
+				return fmt.Errorf("invalid URL: %s", value.String())
+			}
+			req.URL = parsed.String()
+			return nil
+		},
+	}
+	location := newScriptURLObject(vm, func() string { return req.URL }, func(u string) { req.URL = u })
+	headersProp := scriptProperty{
+		get: func() goja.Value { return headers },
+		set: func(value goja.Value) error { return replaceScriptHeaders(&req.Headers, &req.HeaderValues, value) },
+	}
+	body := scriptProperty{
+		get: func() goja.Value { return vm.ToValue(string(decodeScriptBody(req.Headers, req.Body))) },
+		set: func(value goja.Value) error {
+			content, err := scriptBodyBytes(codec, value)
+			if err != nil {
+				return err
+			}
+			flow.SetRequestBody(content)
+			deleteScriptHeader(req.Headers, req.HeaderValues, "Content-Encoding")
+			return nil
+		},
+	}
+
+	defineScriptProperty(vm, obj, "method", true, method)
+	defineScriptProperty(vm, obj, "url", true, rawURL)
+	defineScriptProperty(vm, obj, "location", false, scriptProperty{get: func() goja.Value { return location }})
+	defineScriptProperty(vm, obj, "headers", true, headersProp)
+	defineScriptProperty(vm, obj, "body", true, body)
+	defineScriptProperty(vm, obj, "Method", false, method)
+	defineScriptProperty(vm, obj, "URL", false, rawURL)
+	defineScriptProperty(vm, obj, "Headers", false, headersProp)
+	defineScriptProperty(vm, obj, "Body", false, body)
+	defineScriptBodyReaders(vm, codec, obj, func() []byte { return decodeScriptBody(req.Headers, req.Body) })
+	return obj
+}
+
+// newScriptResponseObject 创建以flow.Response为后端的响应对象
+func newScriptResponseObject(vm *goja.Runtime, codec *scriptJSONCodec, flow *proxycore.Flow) *goja.Object {
+	resp := flow.Response
+	obj := vm.NewObject()
+	headers := newScriptHeaders(vm, &resp.Headers, &resp.HeaderValues)
+
+	statusCode := scriptProperty{
+		get: func() goja.Value { return vm.ToValue(resp.StatusCode) },
+		set: func(value goja.Value) error {
+			code := int(value.ToInteger())
+			if code < 100 || code > 999 {
+				return fmt.Errorf("invalid status code: %d", code)
+			}
+			// 状态文本随状态码更新，需要自定义文本时之后再设置status
+			resp.StatusCode = code
+			resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+			flow.StatusCode = code
+			return nil
+		},
+	}
+	status := scriptProperty{
+		get: func() goja.Value { return vm.ToValue(resp.Status) },
+		set: func(value goja.Value) error {
+			resp.Status = value.String()
+			return nil
+		},
+	}
+	headersProp := scriptProperty{
+		get: func() goja.Value { return headers },
+		set: func(value goja.Value) error { return replaceScriptHeaders(&resp.Headers, &resp.HeaderValues, value) },
+	}
+	body := scriptProperty{
+		get: func() goja.Value { return vm.ToValue(string(decodeScriptBody(resp.Headers, resp.Body))) },
+		set: func(value goja.Value) error {
+			content, err := scriptBodyBytes(codec, value)
+			if err != nil {
+				return err
+			}
+			resp.Body = content
+			flow.ResponseSize = int64(len(content))
+			deleteScriptHeader(resp.Headers, resp.HeaderValues, "Content-Encoding")
+			return nil
+		},
+	}
+
+	defineScriptProperty(vm, obj, "statusCode", true, statusCode)
+	defineScriptProperty(vm, obj, "status", true, status)
+	defineScriptProperty(vm, obj, "headers", true, headersProp)
+	defineScriptProperty(vm, obj, "body", true, body)
+	defineScriptProperty(vm, obj, "StatusCode", false, statusCode)
+	defineScriptProperty(vm, obj, "Status", false, status)
+	defineScriptProperty(vm, obj, "Headers", false, headersProp)
+	defineScriptProperty(vm, obj, "Body", false, body)
+	defineScriptBodyReaders(vm, codec, obj, func() []byte { return decodeScriptBody(resp.Headers, resp.Body) })
+	return obj
+}
+
+// scriptProperty 访问器属性，set为nil时只读
+type scriptProperty struct {
+	get func() goja.Value
+	set func(goja.Value) error
+}
+
+// defineScriptProperty 在对象上定义访问器属性，set返回的错误作为TypeError抛出
+func defineScriptProperty(vm *goja.Runtime, obj *goja.Object, name string, enumerable bool, prop scriptProperty) {
+	getter := vm.ToValue(func(goja.FunctionCall) goja.Value { return prop.get() })
+	var setter goja.Value
+	if prop.set != nil {
+		setter = vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if err := prop.set(call.Argument(0)); err != nil {
+				panic(vm.NewTypeError(err.Error()))
+			}
+			return goja.Undefined()
+		})
+	}
+	flag := goja.FLAG_FALSE
+	if enumerable {
+		flag = goja.FLAG_TRUE
+	}
+	obj.DefineAccessorProperty(name, getter, setter, goja.FLAG_FALSE, flag)
+}
+
+// defineScriptBodyReaders 定义 text()、json()、bytes()
+func defineScriptBodyReaders(vm *goja.Runtime, codec *scriptJSONCodec, obj *goja.Object, body func() []byte) {
+	obj.Set("text", func() string { return string(body()) })
+	obj.Set("json", func() (goja.Value, error) { return codec.decode(string(body())) })
+	obj.Set("bytes", func() (goja.Value, error) {
+		content := append([]byte(nil), body()...)
+		return vm.New(vm.Get("Uint8Array"), vm.ToValue(vm.NewArrayBuffer(content)))
+	})
+}
+
+// scriptBodyBytes 转换赋给body的值：字符串按文本，Uint8Array和ArrayBuffer按字节，null和undefined为空，其他值按JSON序列化
+func scriptBodyBytes(codec *scriptJSONCodec, value goja.Value) ([]byte, error) {
+	if !isScriptValueSet(value) {
+		return []byte{}, nil
+	}
+	switch exported := value.Export().(type) {
+	case string:
+		return []byte(exported), nil
+	case []byte:
+		return append([]byte(nil), exported...), nil
+	case goja.ArrayBuffer:
+		return append([]byte(nil), exported.Bytes()...), nil
+	}
+	encoded, err := codec.encode(value, 0)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(encoded), nil
+}
+
+// decodeScriptBody 按Content-Encoding解压消息体，未压缩或无法解压时原样返回
+func decodeScriptBody(headers map[string]string, body []byte) []byte {
+	if encoding, ok := lookupHeaderValue(headers, "Content-Encoding"); ok {
+		if decoded, err := proxycore.DecompressBody(body, encoding); err == nil {
+			return decoded
+		}
+	}
+	return body
+}
+
+// deleteScriptHeader 同时从头部map和全部头部值中删除头部，名称不区分大小写
+func deleteScriptHeader(headers map[string]string, values http.Header, name string) {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			delete(headers, key)
+		}
+	}
+	for key := range values {
+		if strings.EqualFold(key, name) {
+			delete(values, key)
+		}
+	}
+}
+
+// alignScriptHeaderValues 以头部map为准对齐全部头部值：第一个值与map一致的头部保留全部值，
+// 其他头部（被只改写了map的代码修改过，或Flow中没有全部头部值）只保留map中的值
+func alignScriptHeaderValues(headers map[string]string, values *http.Header) {
+	aligned := make(http.Header, len(headers))
+	for name, value := range headers {
+		if existing := (*values)[name]; len(existing) > 0 && existing[0] == value {
+			aligned[name] = append([]string(nil), existing...)
+		} else {
+			aligned[name] = []string{value}
+		}
+	}
+	*values = aligned
+}
+
+// scriptHeaders 以Flow中的头部为后端的headers对象，可以 headers['X-Name'] 读写和delete，
+// 也可以调用 get/getAll/set/append/delete/has/keys/entries/forEach；名称不区分大小写，写入时使用规范形式。
+// headers是每个头部的第一个值，values是全部值（如多个Set-Cookie），两者同时修改
+type scriptHeaders struct {
+	vm      *goja.Runtime
+	headers *map[string]string
+	values  *http.Header
+	methods map[string]goja.Value
+}
+
+func newScriptHeaders(vm *goja.Runtime, headers *map[string]string, values *http.Header) *goja.Object {
+	alignScriptHeaderValues(*headers, values)
+	h := &scriptHeaders{vm: vm, headers: headers, values: values}
+	h.methods = map[string]goja.Value{
+		"get": vm.ToValue(func(name string) goja.Value {
+			if value, ok := h.lookup(name); ok {
+				return vm.ToValue(value)
+			}
+			return goja.Null()
+		}),
+		"getAll": vm.ToValue(func(name string) *goja.Object {
+			all := h.all(name)
+			values := make([]interface{}, len(all))
+			for i, value := range all {
+				values[i] = value
+			}
+			return vm.NewArray(values...)
+		}),
+		"set": vm.ToValue(func(name string, value goja.Value) {
+			h.Set(name, value)
+		}),
+		"append": vm.ToValue(func(name string, value goja.Value) {
+			h.append(name, value.String())
+		}),
+		"delete": vm.ToValue(func(name string) bool {
+			_, exists := h.lookup(name)
+			h.Delete(name)
+			return exists
+		}),
+		"has": vm.ToValue(func(name string) bool {
+			_, ok := h.lookup(name)
+			return ok
+		}),
+		"keys": vm.ToValue(func() *goja.Object {
+			keys := h.Keys()
+			values := make([]interface{}, len(keys))
+			for i, key := range keys {
+				values[i] = key
+			}
+			return vm.NewArray(values...)
+		}),
+		"entries": vm.ToValue(func() *goja.Object {
+			keys := h.Keys()
+			entries := make([]interface{}, len(keys))
+			for i, key := range keys {
+				entries[i] = vm.NewArray(key, (*h.headers)[key])
+			}
+			return vm.NewArray(entries...)
+		}),
+		"forEach": vm.ToValue(func(callback goja.Callable) error {
+			for _, key := range h.Keys() {
+				if _, err := callback(goja.Undefined(), vm.ToValue((*h.headers)[key]), vm.ToValue(key)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	}
+	return vm.NewDynamicObject(h)
+}
+
+// lookup 不区分大小写地查找头部
+func (h *scriptHeaders) lookup(name string) (string, bool) {
+	if value, ok := (*h.headers)[name]; ok {
+		return value, true
+	}
+	return lookupHeaderValue(*h.headers, name)
+}
+
+// key 不区分大小写地查找头部在map中的名称
+func (h *scriptHeaders) key(name string) (string, bool) {
+	if _, ok := (*h.headers)[name]; ok {
+		return name, true
+	}
+	for key := range *h.headers {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// all 返回头部的全部值
+func (h *scriptHeaders) all(name string) []string {
+	key, ok := h.key(name)
+	if !ok {
+		return nil
+	}
+	if values := (*h.values)[key]; len(values) > 0 {
+		return values
+	}
+	return []string{(*h.headers)[key]}
+}
+
+// append 为头部追加一个值，头部不存在时与Set相同
+func (h *scriptHeaders) append(name, value string) {
+	key, ok := h.key(name)
+	if !ok {
+		h.setValues(name, []string{value})
+		return
+	}
+	(*h.values)[key] = append(h.all(key), value)
+}
+
+// setValues 以规范名称写入头部的全部值
+func (h *scriptHeaders) setValues(name string, values []string) {
+	h.Delete(name)
+	if *h.headers == nil {
+		*h.headers = make(map[string]string)
+	}
+	if *h.values == nil {
+		*h.values = make(http.Header)
+	}
+	name = http.CanonicalHeaderKey(name)
+	(*h.headers)[name] = values[0]
+	(*h.values)[name] = values
+}
+
+func (h *scriptHeaders) Get(key string) goja.Value {
+	if method, ok := h.methods[key]; ok {
+		return method
+	}
+	if value, ok := h.lookup(key); ok {
+		return h.vm.ToValue(value)
+	}
+	return nil
+}
+
+// Set 写入头部，值为数组时写入多个值，为null、undefined或空数组时删除
+func (h *scriptHeaders) Set(key string, val goja.Value) bool {
+	var values []string
+	if isScriptValueSet(val) {
+		values = []string{val.String()}
+		if list, ok := val.Export().([]interface{}); ok {
+			values = scriptHeaderValues(list)
+		}
+	}
+	if len(values) == 0 {
+		return h.Delete(key)
+	}
+	h.setValues(key, values)
+	return true
+}
+
+func (h *scriptHeaders) Has(key string) bool {
+	if _, ok := h.methods[key]; ok {
+		return true
+	}
+	_, ok := h.lookup(key)
+	return ok
+}
+
+func (h *scriptHeaders) Delete(key string) bool {
+	deleteScriptHeader(*h.headers, *h.values, key)
+	return true
+}
+
+func (h *scriptHeaders) Keys() []string {
+	keys := make([]string, 0, len(*h.headers))
+	for name := range *h.headers {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// replaceScriptHeaders 以对象的内容替换全部头部，值为数组时表示同名的多个头
+func replaceScriptHeaders(headers *map[string]string, values *http.Header, value goja.Value) error {
+	replaced := make(map[string]string)
+	replacedValues := make(http.Header)
+	if isScriptValueSet(value) {
+		object, ok := value.Export().(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("headers must be an object")
+		}
+		for name, v := range object {
+			if list := scriptHeaderValues(v); len(list) > 0 {
+				name = http.CanonicalHeaderKey(name)
+				replaced[name] = list[0]
+				replacedValues[name] = list
+			}
+		}
+	}
+	*headers = replaced
+	*values = replacedValues
+	return nil
+}
+
+// scriptHeaderValues 转换脚本中头部的值，数组为多个值，null和undefined没有值
+func scriptHeaderValues(value interface{}) []string {
+	if list, ok := value.([]interface{}); ok {
+		values := make([]string, 0, len(list))
+		for _, v := range list {
+			if v != nil {
+				values = append(values, fmt.Sprint(v))
+			}
+		}
+		return values
+	}
+	if value == nil {
+		return nil
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+// installScriptURL 注入 URL 和 URLSearchParams 构造函数
+func installScriptURL(vm *goja.Runtime) {
+	vm.Set("URL", func(call goja.ConstructorCall) *goja.Object {
+		raw := call.Argument(0).String()
+		parsed, err := url.Parse(raw)
+		if base := call.Argument(1); isScriptValueSet(base) && err == nil {
+			var baseURL *url.URL
+			if baseURL, err = url.Parse(base.String()); err == nil {
+				parsed = baseURL.ResolveReference(parsed)
+			}
+		}
+		if err != nil || !parsed.IsAbs() {
+			panic(vm.NewTypeError("Invalid URL: " + raw))
+		}
+		current := parsed.String()
+		return newScriptURLObject(vm, func() string { return current }, func(u string) { current = u })
+	})
+	vm.Set("URLSearchParams", func(call goja.ConstructorCall) *goja.Object {
+		var query string
+		switch init := call.Argument(0).Export().(type) {
+		case nil:
+		case map[string]interface{}:
+			values := url.Values{}
+			for name, value := range init {
+				values.Set(name, fmt.Sprint(value))
+			}
+			query = values.Encode()
+		default:
+			query = strings.TrimPrefix(fmt.Sprint(init), "?")
+		}
+		return newScriptSearchParams(vm, func() string { return query }, func(q string) { query = q })
+	})
+}
+
+// newScriptURLObject 创建URL对象，读写通过get/set连接到请求URL或独立的值
+func newScriptURLObject(vm *goja.Runtime, get func() string, set func(string)) *goja.Object {
+	obj := vm.NewObject()
+	parse := func() *url.URL {
+		parsed, err := url.Parse(get())
+		if err != nil {
+			return &url.URL{}
+		}
+		return parsed
+	}
+	component := func(name string, read func(*url.URL) string, write func(*url.URL, string)) {
+		prop := scriptProperty{get: func() goja.Value { return vm.ToValue(read(parse())) }}
+		if write != nil {
+			prop.set = func(value goja.Value) error {
+				parsed := parse()
+				write(parsed, value.String())
+				set(parsed.String())
+				return nil
+			}
+		}
+		defineScriptProperty(vm, obj, name, true, prop)
+	}
+
+	component("href", (*url.URL).String, func(u *url.URL, v string) {
+		if parsed, err := url.Parse(v); err == nil && parsed.IsAbs() {
+			*u = *parsed
+		}
+	})
+	component("protocol", func(u *url.URL) string { return u.Scheme + ":" }, func(u *url.URL, v string) {
+		u.Scheme = strings.TrimSuffix(v, ":")
+	})
+	component("host", func(u *url.URL) string { return u.Host }, func(u *url.URL, v string) { u.Host = v })
+	component("hostname", (*url.URL).Hostname, func(u *url.URL, v string) {
+		if port := u.Port(); port != "" {
+			v += ":" + port
+		}
+		u.Host = v
+	})
+	component("port", (*url.URL).Port, func(u *url.URL, v string) {
+		u.Host = u.Hostname()
+		if v != "" {
+			u.Host += ":" + v
+		}
+	})
+	component("pathname", func(u *url.URL) string { return u.EscapedPath() }, func(u *url.URL, v string) {
+		if !strings.HasPrefix(v, "/") {
+			v = "/" + v
+		}
+		if path, err := url.PathUnescape(v); err == nil {
+			u.Path, u.RawPath = path, v
+		}
+	})
+	component("search", func(u *url.URL) string {
+		if u.RawQuery == "" {
+			return ""
+		}
+		return "?" + u.RawQuery
+	}, func(u *url.URL, v string) { u.RawQuery = strings.TrimPrefix(v, "?") })
+	component("hash", func(u *url.URL) string {
+		if u.Fragment == "" {
+			return ""
+		}
+		return "#" + u.Fragment
+	}, func(u *url.URL, v string) { u.Fragment = strings.TrimPrefix(v, "#") })
+	component("origin", func(u *url.URL) string { return u.Scheme + "://" + u.Host }, nil)
+
+	searchParams := newScriptSearchParams(vm, func() string { return parse().RawQuery }, func(query string) {
+		parsed := parse()
+		parsed.RawQuery = query
+		set(parsed.String())
+	})
+	defineScriptProperty(vm, obj, "searchParams", true, scriptProperty{get: func() goja.Value { return searchParams }})
+	defineScriptMethod(vm, obj, "toString", func() string { return get() })
+	defineScriptMethod(vm, obj, "toJSON", func() string { return get() })
+	return obj
+}
+
+// newScriptSearchParams 创建查询参数对象，修改后重新编码（参数按名称排序）
+func newScriptSearchParams(vm *goja.Runtime, get func() string, set func(string)) *goja.Object {
+	obj := vm.NewObject()
+	values := func() url.Values {
+		parsed, _ := url.ParseQuery(get())
+		return parsed
+	}
+	update := func(change func(url.Values)) {
+		parsed := values()
+		change(parsed)
+		set(parsed.Encode())
+	}
+
+	obj.Set("get", func(name string) goja.Value {
+		if v, ok := values()[name]; ok && len(v) > 0 {
+			return vm.ToValue(v[0])
+		}
+		return goja.Null()
+	})
+	obj.Set("getAll", func(name string) []string { return append([]string{}, values()[name]...) })
+	obj.Set("has", func(name string) bool { return values().Has(name) })
+	obj.Set("set", func(name, value string) { update(func(v url.Values) { v.Set(name, value) }) })
+	obj.Set("append", func(name, value string) { update(func(v url.Values) { v.Add(name, value) }) })
+	obj.Set("delete", func(name string) { update(func(v url.Values) { v.Del(name) }) })
+	obj.Set("keys", func() []string {
+		parsed := values()
+		keys := make([]string, 0, len(parsed))
+		for name := range parsed {
+			keys = append(keys, name)
+		}
+		sort.Strings(keys)
+		return keys
+	})
+	defineScriptMethod(vm, obj, "toString", func() string { return get() })
+	return obj
+}
+
+// defineScriptMethod 在对象上定义方法。运行时的内置原型是冻结的，覆盖toString等继承的方法需要定义而不是赋值
+func defineScriptMethod(vm *goja.Runtime, obj *goja.Object, name string, method interface{}) {
+	obj.DefineDataProperty(name, vm.ToValue(method), goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_TRUE)
+}
+
+// scriptFlowSnapshot 执行前的请求和响应，脚本失败时恢复，避免留下部分修改
+type scriptFlowSnapshot struct {
+	request      *proxycore.FlowRequest
+	response     *proxycore.FlowResponse
+	statusCode   int
+	requestSize  int64
+	responseSize int64
+}
+
+func snapshotScriptFlow(flow *proxycore.Flow) scriptFlowSnapshot {
+	snapshot := scriptFlowSnapshot{
+		statusCode:   flow.StatusCode,
+		requestSize:  flow.RequestSize,
+		responseSize: flow.ResponseSize,
+	}
+	if flow.Request != nil {
+		request := *flow.Request
+		request.Headers = cloneStringMap(request.Headers)
+		request.HeaderValues = request.HeaderValues.Clone()
+		request.Body = append([]byte(nil), request.Body...)
+		snapshot.request = &request
+	}
+	if flow.Response != nil {
+		response := *flow.Response
+		response.Headers = cloneStringMap(response.Headers)
+		response.HeaderValues = response.HeaderValues.Clone()
+		response.Body = append([]byte(nil), response.Body...)
+		snapshot.response = &response
+	}
+	return snapshot
+}
+
+// restore 恢复到快照时的状态
+func (s scriptFlowSnapshot) restore(flow *proxycore.Flow) {
+	if s.request != nil && flow.Request != nil {
+		*flow.Request = *s.request
+	}
+	if s.response != nil && flow.Response != nil {
+		*flow.Response = *s.response
+	}
+	flow.StatusCode = s.statusCode
+	flow.RequestSize = s.requestSize
+	flow.ResponseSize = s.responseSize
+}
+
+func cloneStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	cloned := make(map[string]string, len(m))
+	for k, v := range m {
+		cloned[k] = v
+	}
+	return cloned
+}
@@ -0,0 +1,116 @@
+package features
+
+import (
+	"fmt"
+
+	"github.com/dop251/goja"
+)
+
+// scriptRuntime 池中复用的运行时。创建时冻结全部内置对象，脚本无法修改JSON、Array.prototype等，
+// 每次执行后删除脚本留下的全局属性，下一次执行看到的全局作用域与新建的运行时相同
+type scriptRuntime struct {
+	vm    *goja.Runtime
+	reset goja.Callable // 删除创建之后新增的全局属性，无法完全删除时返回false
+}
+
+// scriptRuntimeSource 冻结内置对象并返回重置全局对象的函数。
+// 冻结的原型上的属性无法在继承它的对象上赋值覆盖（如 MyError.prototype.name = 'MyError'），
+// 常被覆盖的属性改为访问器：对原型本身赋值报错，对其他对象赋值时在该对象上定义同名属性
+const scriptRuntimeSource = `(function () {
+	var ownKeys = Reflect.ownKeys, getDescriptor = Object.getOwnPropertyDescriptor, defineProperty = Object.defineProperty,
+		getPrototypeOf = Object.getPrototypeOf, isExtensible = Object.isExtensible, freeze = Object.freeze;
+	var overridable = ['constructor', 'name', 'message', 'toString', 'toLocaleString', 'valueOf', 'toJSON'];
+	var hardened = new Set();
+
+	function enableOverride(obj, key) {
+		var desc = getDescriptor(obj, key);
+		if (!desc || !desc.writable || !desc.configurable) return;
+		var value = desc.value;
+		// 访问器语法定义的函数没有prototype，不会再产生需要冻结的新对象
+		var accessor = getDescriptor({
+			get value() { return value; },
+			set value(v) {
+				if (this === obj) throw new TypeError('Cannot assign to read only property ' + key);
+				defineProperty(this, key, { value: v, writable: true, enumerable: true, configurable: true });
+			}
+		}, 'value');
+		accessor.enumerable = desc.enumerable;
+		accessor.configurable = false;
+		defineProperty(obj, key, accessor);
+	}
+
+	function harden(obj) {
+		if (obj === null || (typeof obj !== 'object' && typeof obj !== 'function') || obj === globalThis || hardened.has(obj)) return;
+		hardened.add(obj);
+		for (var i = 0; i < overridable.length; i++) enableOverride(obj, overridable[i]);
+		freeze(obj);
+		var keys = ownKeys(obj);
+		for (var j = 0; j < keys.length; j++) {
+			var desc = getDescriptor(obj, keys[j]);
+			harden(desc.value);
+			harden(desc.get);
+			harden(desc.set);
+		}
+		harden(getPrototypeOf(obj));
+	}
+
+	var baseline = Object.create(null), globalProto = getPrototypeOf(globalThis);
+	var globals = ownKeys(globalThis);
+	for (var i = 0; i < globals.length; i++) {
+		var desc = getDescriptor(globalThis, globals[i]);
+		baseline[globals[i]] = true;
+		harden(desc.value);
+		if ('value' in desc) defineProperty(globalThis, globals[i], { writable: false, configurable: false });
+	}
+	freeze(baseline);
+
+	return function () {
+		var keys = ownKeys(globalThis), ok = true;
+		for (var i = 0; i < keys.length; i++) {
+			if (!(keys[i] in baseline) && !(delete globalThis[keys[i]])) ok = false;
+		}
+		return ok && isExtensible(globalThis) && getPrototypeOf(globalThis) === globalProto;
+	};
+})()`
+
+// scriptRuntimePoolSize 池中最多保留的空闲运行时数量。准备运行时需要冻结全部内置对象，开销较大，
+// 不使用sync.Pool，避免垃圾回收时清空池后重新准备
+const scriptRuntimePoolSize = 8
+
+// scriptRuntimeProgram 编译好的运行时准备脚本，所有运行时共用
+var scriptRuntimeProgram = goja.MustCompile("runtime", scriptRuntimeSource, false)
+
+func newScriptRuntime() *scriptRuntime {
+	vm := goja.New()
+	value, err := vm.RunProgram(scriptRuntimeProgram)
+	if err != nil {
+		panic(fmt.Sprintf("failed to prepare script runtime: %v", err))
+	}
+	reset, _ := goja.AssertFunction(value)
+	return &scriptRuntime{vm: vm, reset: reset}
+}
+
+// acquireRuntime 从池中取运行时，池为空时新建
+func (sm *ScriptManager) acquireRuntime() *scriptRuntime {
+	select {
+	case rt := <-sm.runtimes:
+		return rt
+	default:
+		return newScriptRuntime()
+	}
+}
+
+// releaseRuntime 重置全局作用域后放回池中；被中断过或无法重置（如脚本定义了不可删除的全局属性）的运行时直接丢弃
+func (sm *ScriptManager) releaseRuntime(rt *scriptRuntime, interrupted bool) {
+	if interrupted {
+		return
+	}
+	ok, err := rt.reset(goja.Undefined())
+	if err != nil || !ok.ToBoolean() {
+		return
+	}
+	select {
+	case sm.runtimes <- rt:
+	default:
+	}
+}
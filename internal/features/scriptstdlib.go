@@ -0,0 +1,481 @@
+package features
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// 脚本标准库，每次执行时注入到运行时的全局对象中，文档见 docs/SCRIPT_API.md：
+//   fetch(url, options)  同步HTTP请求，经重放管理器的客户端发送，受脚本超时约束
+//   encoding             base64/hex/URL 编解码
+//   crypto               哈希、HMAC和随机数
+//   json                 容错解析、格式化和按路径读写
+//   store                所有脚本共享的持久化键值存储
+//   env                  读取环境变量
+
+// ScriptValueStorage 脚本键值存储的持久化接口
+type ScriptValueStorage interface {
+	SaveScriptValue(key, value string) error
+	DeleteScriptValue(key string) error
+	GetScriptValues() (map[string]string, error)
+}
+
+// scriptStore 脚本共享的键值存储，值以JSON保存
+type scriptStore struct {
+	values  map[string]string
+	mutex   sync.RWMutex
+	storage ScriptValueStorage
+}
+
+// newScriptStore 创建键值存储，storage不为nil时从中加载已保存的值
+func newScriptStore(storage ScriptValueStorage) *scriptStore {
+	store := &scriptStore{
+		values:  make(map[string]string),
+		storage: storage,
+	}
+	if storage != nil {
+		values, err := storage.GetScriptValues()
+		if err != nil {
+			fmt.Printf("Failed to load script store: %v\n", err)
+		}
+		for key, value := range values {
+			store.values[key] = value
+		}
+	}
+	return store
+}
+
+// sandbox 复制当前的值到不保存的存储中，供试运行使用
+func (ss *scriptStore) sandbox() *scriptStore {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	sandbox := &scriptStore{values: make(map[string]string, len(ss.values))}
+	for key, value := range ss.values {
+		sandbox.values[key] = value
+	}
+	return sandbox
+}
+
+// get 获取JSON编码的值
+func (ss *scriptStore) get(key string) (string, bool) {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	value, exists := ss.values[key]
+	return value, exists
+}
+
+// set 保存JSON编码的值
+func (ss *scriptStore) set(key, value string) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	if ss.storage != nil {
+		if err := ss.storage.SaveScriptValue(key, value); err != nil {
+			return fmt.Errorf("failed to save store value: %v", err)
+		}
+	}
+	ss.values[key] = value
+	return nil
+}
+
+// remove 删除值
+func (ss *scriptStore) remove(key string) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	if ss.storage != nil {
+		if err := ss.storage.DeleteScriptValue(key); err != nil {
+			return fmt.Errorf("failed to delete store value: %v", err)
+		}
+	}
+	delete(ss.values, key)
+	return nil
+}
+
+// keys 获取所有键，按字母排序
+func (ss *scriptStore) keys() []string {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	keys := make([]string, 0, len(ss.values))
+	for key := range ss.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// clear 删除所有值
+func (ss *scriptStore) clear() error {
+	for _, key := range ss.keys() {
+		if err := ss.remove(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installScriptStdlib 向运行时注入标准库，deadline为本次执行的截止时间
+func (sm *ScriptManager) installScriptStdlib(vm *goja.Runtime, deadline time.Time, run scriptRun) {
+	codec := newScriptJSONCodec(vm)
+	if run.offline {
+		vm.Set("fetch", func(string, goja.Value) (*goja.Object, error) {
+			return nil, fmt.Errorf("fetch is not available in dry run")
+		})
+	} else {
+		vm.Set("fetch", scriptFetch(vm, codec, sm.replay, deadline))
+	}
+	vm.Set("encoding", scriptEncodingModule(vm))
+	vm.Set("crypto", scriptCryptoModule(vm))
+	vm.Set("json", scriptJSONModule(vm, codec))
+	vm.Set("store", scriptStoreModule(vm, codec, run.store))
+	vm.Set("env", scriptEnvModule(vm))
+	installScriptURL(vm)
+}
+
+// scriptJSONCodec 调用运行时内置的 JSON.parse/JSON.stringify，解析结果是原生JS对象，可以直接修改
+type scriptJSONCodec struct {
+	vm        *goja.Runtime
+	parse     goja.Callable
+	stringify goja.Callable
+}
+
+func newScriptJSONCodec(vm *goja.Runtime) *scriptJSONCodec {
+	builtin := vm.Get("JSON").ToObject(vm)
+	parse, _ := goja.AssertFunction(builtin.Get("parse"))
+	stringify, _ := goja.AssertFunction(builtin.Get("stringify"))
+	return &scriptJSONCodec{vm: vm, parse: parse, stringify: stringify}
+}
+
+// decode 解析JSON文本
+func (c *scriptJSONCodec) decode(text string) (goja.Value, error) {
+	return c.parse(goja.Undefined(), c.vm.ToValue(text))
+}
+
+// encode 序列化为JSON，indent为缩进空格数
+func (c *scriptJSONCodec) encode(value goja.Value, indent int) (string, error) {
+	if value == nil {
+		value = goja.Undefined()
+	}
+	result, err := c.stringify(goja.Undefined(), value, goja.Null(), c.vm.ToValue(indent))
+	if err != nil {
+		return "", err
+	}
+	if goja.IsUndefined(result) {
+		return "", fmt.Errorf("value is not serializable")
+	}
+	return result.String(), nil
+}
+
+// scriptFetch 同步fetch：fetch(url, {method, headers, body, timeoutMs})，
+// 返回 {ok, status, statusText, headers, body, duration, text(), json()}，网络错误时抛出异常
+func scriptFetch(vm *goja.Runtime, codec *scriptJSONCodec, replay *ReplayManager, deadline time.Time) func(string, goja.Value) (*goja.Object, error) {
+	return func(rawURL string, options goja.Value) (*goja.Object, error) {
+		req := &ReplayRequest{Method: "GET", URL: rawURL, Headers: map[string]string{}}
+		timeout := time.Until(deadline)
+
+		if options != nil && !goja.IsUndefined(options) && !goja.IsNull(options) {
+			opts := options.ToObject(vm)
+			if v := opts.Get("method"); v != nil && !goja.IsUndefined(v) {
+				req.Method = strings.ToUpper(v.String())
+			}
+			if v := opts.Get("body"); v != nil && !goja.IsUndefined(v) && !goja.IsNull(v) {
+				if _, isString := v.Export().(string); isString {
+					req.Body = v.String()
+				} else {
+					encoded, err := codec.encode(v, 0)
+					if err != nil {
+						return nil, fmt.Errorf("fetch: invalid body: %v", err)
+					}
+					req.Body = encoded
+				}
+			}
+			if v := opts.Get("headers"); v != nil && !goja.IsUndefined(v) && !goja.IsNull(v) {
+				headers := v.ToObject(vm)
+				for _, key := range headers.Keys() {
+					req.Headers[key] = headers.Get(key).String()
+				}
+			}
+			if v := opts.Get("timeoutMs"); v != nil && !goja.IsUndefined(v) {
+				if ms := time.Duration(v.ToInteger()) * time.Millisecond; ms > 0 && ms < timeout {
+					timeout = ms
+				}
+			}
+		}
+		if timeout <= 0 {
+			return nil, fmt.Errorf("fetch: script timeout reached")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		resp, err := replay.SendRequestContext(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("fetch: %v", err)
+		}
+		if resp.Error != "" {
+			return nil, fmt.Errorf("fetch: %s", resp.Error)
+		}
+
+		result := vm.NewObject()
+		result.Set("ok", resp.StatusCode >= 200 && resp.StatusCode < 300)
+		result.Set("status", resp.StatusCode)
+		result.Set("statusText", resp.Status)
+		result.Set("headers", resp.Headers)
+		result.Set("body", resp.Body)
+		result.Set("duration", resp.Duration)
+		result.Set("text", func() string { return resp.Body })
+		result.Set("json", func() (goja.Value, error) {
+			return codec.decode(resp.Body)
+		})
+		return result, nil
+	}
+}
+
+// scriptEncodingModule 编解码函数，解码结果按UTF-8文本返回
+func scriptEncodingModule(vm *goja.Runtime) *goja.Object {
+	module := vm.NewObject()
+	module.Set("base64Encode", func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	})
+	module.Set("base64Decode", func(s string) (string, error) {
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			// 兼容省略填充的输入
+			decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+		}
+		return string(decoded), err
+	})
+	module.Set("base64UrlEncode", func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	})
+	module.Set("base64UrlDecode", func(s string) (string, error) {
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+		return string(decoded), err
+	})
+	module.Set("hexEncode", func(s string) string {
+		return hex.EncodeToString([]byte(s))
+	})
+	module.Set("hexDecode", func(s string) (string, error) {
+		decoded, err := hex.DecodeString(s)
+		return string(decoded), err
+	})
+	module.Set("urlEncode", url.QueryEscape)
+	module.Set("urlDecode", url.QueryUnescape)
+	module.Set("pathEncode", url.PathEscape)
+	module.Set("pathDecode", url.PathUnescape)
+	return module
+}
+
+// scriptHashes 支持的哈希算法
+var scriptHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// encodeDigest 按 hex（默认）或 base64 输出摘要
+func encodeDigest(sum []byte, encoding string) (string, error) {
+	switch strings.ToLower(encoding) {
+	case "", "hex":
+		return hex.EncodeToString(sum), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(sum), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(sum), nil
+	default:
+		return "", fmt.Errorf("unknown encoding: %s", encoding)
+	}
+}
+
+// scriptCryptoModule 哈希、HMAC和随机数
+func scriptCryptoModule(vm *goja.Runtime) *goja.Object {
+	module := vm.NewObject()
+	for name, newHash := range scriptHashes {
+		newHash := newHash
+		// crypto.sha256(data, encoding)
+		module.Set(name, func(data, encoding string) (string, error) {
+			h := newHash()
+			h.Write([]byte(data))
+			return encodeDigest(h.Sum(nil), encoding)
+		})
+	}
+	// crypto.hmac(algorithm, key, data, encoding)
+	module.Set("hmac", func(algorithm, key, data, encoding string) (string, error) {
+		newHash, ok := scriptHashes[strings.ToLower(algorithm)]
+		if !ok {
+			return "", fmt.Errorf("unknown hash algorithm: %s", algorithm)
+		}
+		mac := hmac.New(newHash, []byte(key))
+		mac.Write([]byte(data))
+		return encodeDigest(mac.Sum(nil), encoding)
+	})
+	// crypto.randomBytes(n, encoding)
+	module.Set("randomBytes", func(n int, encoding string) (string, error) {
+		if n <= 0 || n > 1024 {
+			return "", fmt.Errorf("randomBytes size must be between 1 and 1024")
+		}
+		buf := make([]byte, n)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		return encodeDigest(buf, encoding)
+	})
+	module.Set("randomUUID", func() (string, error) {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		buf[6] = buf[6]&0x0f | 0x40
+		buf[8] = buf[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:]), nil
+	})
+	return module
+}
+
+// splitJSONPath 将 a.b[0].c 拆分为路径段
+func splitJSONPath(path string) []string {
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	var parts []string
+	for _, part := range strings.Split(path, ".") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// scriptJSONModule JSON辅助函数
+func scriptJSONModule(vm *goja.Runtime, codec *scriptJSONCodec) *goja.Object {
+	module := vm.NewObject()
+	// json.parse(text, fallback)：解析失败时返回fallback而不抛出异常
+	module.Set("parse", func(text string, fallback goja.Value) goja.Value {
+		parsed, err := codec.decode(text)
+		if err != nil {
+			if fallback == nil {
+				return goja.Undefined()
+			}
+			return fallback
+		}
+		return parsed
+	})
+	// json.stringify(value, indent)：indent为缩进空格数
+	module.Set("stringify", codec.encode)
+	// json.get(value, "a.b[0].c", defaultValue)
+	module.Set("get", func(value goja.Value, path string, defaultValue goja.Value) goja.Value {
+		current := value
+		for _, part := range splitJSONPath(path) {
+			if current == nil || goja.IsUndefined(current) || goja.IsNull(current) {
+				break
+			}
+			obj, ok := current.(*goja.Object)
+			if !ok {
+				current = nil
+				break
+			}
+			current = obj.Get(part)
+		}
+		if current == nil || goja.IsUndefined(current) {
+			if defaultValue == nil {
+				return goja.Undefined()
+			}
+			return defaultValue
+		}
+		return current
+	})
+	// json.set(value, "a.b[0].c", newValue)：缺少的中间节点按下一段是否为数字创建数组或对象
+	module.Set("set", func(value *goja.Object, path string, newValue goja.Value) (*goja.Object, error) {
+		parts := splitJSONPath(path)
+		if value == nil || len(parts) == 0 {
+			return nil, fmt.Errorf("json.set requires an object and a path")
+		}
+		current := value
+		for i, part := range parts[:len(parts)-1] {
+			next, ok := current.Get(part).(*goja.Object)
+			if !ok {
+				if _, err := strconv.Atoi(parts[i+1]); err == nil {
+					next = vm.NewArray()
+				} else {
+					next = vm.NewObject()
+				}
+				if err := current.Set(part, next); err != nil {
+					return nil, err
+				}
+			}
+			current = next
+		}
+		return value, current.Set(parts[len(parts)-1], newValue)
+	})
+	return module
+}
+
+// scriptStoreModule 持久化键值存储，值可以是任意可JSON序列化的数据
+func scriptStoreModule(vm *goja.Runtime, codec *scriptJSONCodec, store *scriptStore) *goja.Object {
+	module := vm.NewObject()
+	module.Set("get", func(key string, defaultValue goja.Value) (goja.Value, error) {
+		encoded, exists := store.get(key)
+		if !exists {
+			if defaultValue == nil {
+				return goja.Undefined(), nil
+			}
+			return defaultValue, nil
+		}
+		value, err := codec.decode(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("store: corrupt value for %s: %v", key, err)
+		}
+		return value, nil
+	})
+	module.Set("set", func(key string, value goja.Value) error {
+		if key == "" {
+			return fmt.Errorf("store: key is required")
+		}
+		encoded, err := codec.encode(value, 0)
+		if err != nil {
+			return fmt.Errorf("store: %v", err)
+		}
+		return store.set(key, encoded)
+	})
+	module.Set("has", func(key string) bool {
+		_, exists := store.get(key)
+		return exists
+	})
+	module.Set("delete", store.remove)
+	module.Set("keys", store.keys)
+	module.Set("clear", store.clear)
+	return module
+}
+
+// scriptEnvModule 读取代理进程的环境变量
+func scriptEnvModule(vm *goja.Runtime) *goja.Object {
+	module := vm.NewObject()
+	module.Set("get", func(name string, defaultValue goja.Value) goja.Value {
+		if value, exists := os.LookupEnv(name); exists {
+			return vm.ToValue(value)
+		}
+		if defaultValue == nil {
+			return goja.Undefined()
+		}
+		return defaultValue
+	})
+	module.Set("has", func(name string) bool {
+		_, exists := os.LookupEnv(name)
+		return exists
+	})
+	return module
+}
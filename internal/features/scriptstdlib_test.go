@@ -0,0 +1,173 @@
+package features
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryValueStorage 内存中的脚本键值存储
+type memoryValueStorage struct {
+	values map[string]string
+}
+
+func (m *memoryValueStorage) SaveScriptValue(key, value string) error {
+	m.values[key] = value
+	return nil
+}
+
+func (m *memoryValueStorage) DeleteScriptValue(key string) error {
+	delete(m.values, key)
+	return nil
+}
+
+func (m *memoryValueStorage) GetScriptValues() (map[string]string, error) {
+	return m.values, nil
+}
+
+// memoryScriptStorage 同时实现脚本存储和键值存储
+type memoryScriptStorage struct {
+	memoryValueStorage
+}
+
+func (m *memoryScriptStorage) SaveScript(script *Script) error                  { return nil }
+func (m *memoryScriptStorage) GetScripts() ([]*Script, error)                   { return nil, nil }
+func (m *memoryScriptStorage) DeleteScript(id string) error                     { return nil }
+func (m *memoryScriptStorage) UpdateScriptStatus(id string, enabled bool) error { return nil }
+
+// evalScriptLogs 执行脚本并返回console输出，出错时测试失败
+func evalScriptLogs(t *testing.T, manager *ScriptManager, content string) []string {
+	t.Helper()
+	_, logs, err := runTestScript(t, manager, content)
+	if err != nil {
+		t.Fatalf("script failed: %v\nlogs: %v", err, logs)
+	}
+	return logs
+}
+
+// expectLogs 检查console输出中包含每一项
+func expectLogs(t *testing.T, logs []string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !containsLog(logs, w) {
+			t.Errorf("missing log %q in %v", w, logs)
+		}
+	}
+}
+
+func TestScriptFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(2 * time.Second)
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		fmt.Fprintf(w, `{"method":%q,"token":%q,"body":%q}`, r.Method, r.Header.Get("X-Token"), body)
+	}))
+	defer server.Close()
+
+	manager := NewScriptManager(nil)
+	logs := evalScriptLogs(t, manager, fmt.Sprintf(`
+		var resp = fetch(%q, {method: "post", headers: {"X-Token": "abc"}, body: {a: 1}});
+		var data = resp.json();
+		console.log("status:" + resp.status + " ok:" + resp.ok);
+		console.log("echo:" + data.method + "," + data.token + "," + data.body);
+		console.log("type:" + resp.headers["Content-Type"]);
+	`, server.URL))
+	expectLogs(t, logs, "status:201 ok:true", `echo:POST,abc,{"a":1}`, "type:application/json")
+
+	// 网络错误和超时抛出异常
+	logs = evalScriptLogs(t, manager, fmt.Sprintf(`
+		try { fetch("http://127.0.0.1:1/"); } catch (e) { console.log("refused"); }
+		try { fetch(%q, {timeoutMs: 50}); } catch (e) { console.log("timeout"); }
+	`, server.URL+"/slow"))
+	expectLogs(t, logs, "refused", "timeout")
+}
+
+func TestScriptEncoding(t *testing.T) {
+	logs := evalScriptLogs(t, NewScriptManager(nil), `
+		console.log("b64:" + encoding.base64Encode("hello?") + "," + encoding.base64Decode("aGVsbG8/"));
+		console.log("b64url:" + encoding.base64UrlEncode("hello?") + "," + encoding.base64UrlDecode("aGVsbG8_"));
+		console.log("hex:" + encoding.hexEncode("hi") + "," + encoding.hexDecode("6869"));
+		console.log("url:" + encoding.urlEncode("a b&c") + "," + encoding.urlDecode("a+b%26c"));
+		try { encoding.hexDecode("zz"); } catch (e) { console.log("bad hex"); }
+	`)
+	expectLogs(t, logs, "b64:aGVsbG8/,hello?", "b64url:aGVsbG8_,hello?", "hex:6869,hi", "url:a+b%26c,a b&c", "bad hex")
+}
+
+func TestScriptCrypto(t *testing.T) {
+	logs := evalScriptLogs(t, NewScriptManager(nil), `
+		console.log("md5:" + crypto.md5("abc"));
+		console.log("sha256:" + crypto.sha256("abc"));
+		console.log("sha1b64:" + crypto.sha1("abc", "base64"));
+		console.log("hmac:" + crypto.hmac("sha256", "key", "The quick brown fox jumps over the lazy dog"));
+		console.log("uuid:" + /^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$/.test(crypto.randomUUID()));
+		console.log("random:" + crypto.randomBytes(8).length);
+		try { crypto.hmac("sha3", "k", "d"); } catch (e) { console.log("bad algorithm"); }
+	`)
+	expectLogs(t, logs,
+		"md5:900150983cd24fb0d6963f7d28e17f72",
+		"sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		"sha1b64:qZk+NkcGgWq6PiVxeFDCbJzQ2J0=",
+		"hmac:f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		"uuid:true", "random:16", "bad algorithm")
+}
+
+func TestScriptJSONHelpers(t *testing.T) {
+	logs := evalScriptLogs(t, NewScriptManager(nil), `
+		var data = json.parse('{"user":{"tags":["a","b"]}}');
+		console.log("get:" + json.get(data, "user.tags[1]") + "," + json.get(data, "user.missing.x", "none"));
+		console.log("fallback:" + JSON.stringify(json.parse("not json", {})));
+		json.set(data, "user.items[0].id", 7);
+		console.log("set:" + json.stringify(data));
+		console.log("pretty:" + (json.stringify({a: 1}, 2).indexOf("\n  ") >= 0));
+	`)
+	expectLogs(t, logs, "get:b,none", "fallback:{}", `set:{"user":{"tags":["a","b"],"items":[{"id":7}]}}`, "pretty:true")
+}
+
+func TestScriptStore(t *testing.T) {
+	storage := &memoryScriptStorage{memoryValueStorage{values: map[string]string{}}}
+	manager := NewScriptManager(storage)
+
+	evalScriptLogs(t, manager, `
+		store.set("token", {value: "abc", expires: 10});
+		store.set("count", store.get("count", 0) + 1);
+	`)
+	logs := evalScriptLogs(t, manager, `
+		store.set("count", store.get("count", 0) + 1);
+		console.log("count:" + store.get("count") + " token:" + store.get("token").value);
+		console.log("keys:" + store.keys().join(","));
+		store.delete("token");
+		console.log("has:" + store.has("token"));
+	`)
+	expectLogs(t, logs, "count:2 token:abc", "keys:count,token", "has:false")
+
+	if storage.values["count"] != "2" {
+		t.Errorf("store not persisted: %v", storage.values)
+	}
+
+	// 重新创建管理器后从存储加载
+	logs = evalScriptLogs(t, NewScriptManager(storage), `console.log("reloaded:" + store.get("count")); store.clear(); console.log("cleared:" + store.keys().length);`)
+	expectLogs(t, logs, "reloaded:2", "cleared:0")
+	if len(storage.values) != 0 {
+		t.Errorf("clear not persisted: %v", storage.values)
+	}
+}
+
+func TestScriptEnv(t *testing.T) {
+	t.Setenv("PROXYWOMAN_TEST_SECRET", "s3cret")
+	logs := evalScriptLogs(t, NewScriptManager(nil), `
+		console.log("env:" + env.get("PROXYWOMAN_TEST_SECRET") + "," + env.get("PROXYWOMAN_TEST_MISSING", "default"));
+		console.log("has:" + env.has("PROXYWOMAN_TEST_SECRET") + "," + env.has("PROXYWOMAN_TEST_MISSING"));
+	`)
+	expectLogs(t, logs, "env:s3cret,default", "has:true,false")
+
+	if strings.Contains(strings.Join(logs, ""), "undefined") {
+		t.Errorf("unexpected undefined in %v", logs)
+	}
+}
@@ -0,0 +1,203 @@
+package features
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+// builtinNetworkProfiles 内置网络条件配置，参考常见浏览器开发者工具的预设
+var builtinNetworkProfiles = []*proxycore.NetworkProfile{
+	{ID: "gprs", Name: "GPRS", DownloadKbps: 50, UploadKbps: 20, LatencyMs: 500, FirstByteLatencyMs: 300, JitterMs: 100, BuiltIn: true},
+	{ID: "edge", Name: "EDGE", DownloadKbps: 240, UploadKbps: 200, LatencyMs: 400, FirstByteLatencyMs: 200, JitterMs: 80, BuiltIn: true},
+	{ID: "3g", Name: "3G", DownloadKbps: 780, UploadKbps: 330, LatencyMs: 200, FirstByteLatencyMs: 100, JitterMs: 50, BuiltIn: true},
+	{ID: "4g", Name: "4G", DownloadKbps: 9000, UploadKbps: 9000, LatencyMs: 85, FirstByteLatencyMs: 20, JitterMs: 20, BuiltIn: true},
+	{ID: "lossy-wifi", Name: "Lossy WiFi", DownloadKbps: 5000, UploadKbps: 2000, LatencyMs: 50, FirstByteLatencyMs: 20, JitterMs: 150, FailureRate: 0.05, BuiltIn: true},
+}
+
+// ThrottleRule 网络条件规则：匹配的主机使用指定的网络条件配置
+type ThrottleRule struct {
+	ID          string `json:"id"`
+	HostPattern string `json:"hostPattern"` // 如 api.example.com、*.example.com
+	ProfileID   string `json:"profileId"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// ThrottleManager 网络条件模拟管理器，实现 proxycore.NetworkConditioner。
+// 按主机匹配的规则优先，未匹配时使用全局配置
+type ThrottleManager struct {
+	profiles      map[string]*proxycore.NetworkProfile
+	rules         map[string]*ThrottleRule
+	globalProfile string
+	mutex         sync.RWMutex
+}
+
+// NewThrottleManager 创建网络条件模拟管理器
+func NewThrottleManager() *ThrottleManager {
+	tm := &ThrottleManager{
+		profiles: make(map[string]*proxycore.NetworkProfile),
+		rules:    make(map[string]*ThrottleRule),
+	}
+	for _, profile := range builtinNetworkProfiles {
+		tm.profiles[profile.ID] = profile
+	}
+	return tm
+}
+
+// validateNetworkProfile 检查自定义配置的取值范围
+func validateNetworkProfile(profile *proxycore.NetworkProfile) error {
+	if profile.ID == "" || strings.TrimSpace(profile.Name) == "" {
+		return fmt.Errorf("profile id and name are required")
+	}
+	if profile.DownloadKbps < 0 || profile.UploadKbps < 0 {
+		return fmt.Errorf("bandwidth must not be negative")
+	}
+	if profile.LatencyMs < 0 || profile.FirstByteLatencyMs < 0 || profile.JitterMs < 0 {
+		return fmt.Errorf("latency and jitter must not be negative")
+	}
+	if profile.FailureRate < 0 || profile.FailureRate > 1 {
+		return fmt.Errorf("failure rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// SaveProfile 添加或更新自定义配置，内置配置不可修改
+func (tm *ThrottleManager) SaveProfile(profile *proxycore.NetworkProfile) error {
+	if err := validateNetworkProfile(profile); err != nil {
+		return err
+	}
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if existing, exists := tm.profiles[profile.ID]; exists && existing.BuiltIn {
+		return fmt.Errorf("built-in profile cannot be modified: %s", profile.ID)
+	}
+	// 保存副本，避免调用方之后修改正在使用的配置
+	saved := *profile
+	saved.BuiltIn = false
+	tm.profiles[profile.ID] = &saved
+	return nil
+}
+
+// RemoveProfile 删除自定义配置，仍被全局设置或规则引用时不允许删除
+func (tm *ThrottleManager) RemoveProfile(profileID string) error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	profile, exists := tm.profiles[profileID]
+	if !exists {
+		return fmt.Errorf("profile not found: %s", profileID)
+	}
+	if profile.BuiltIn {
+		return fmt.Errorf("built-in profile cannot be removed: %s", profileID)
+	}
+	if tm.globalProfile == profileID {
+		return fmt.Errorf("profile is used as the global profile: %s", profileID)
+	}
+	for _, rule := range tm.rules {
+		if rule.ProfileID == profileID {
+			return fmt.Errorf("profile is used by rule %s", rule.ID)
+		}
+	}
+	delete(tm.profiles, profileID)
+	return nil
+}
+
+// GetProfiles 获取所有配置，内置配置在前
+func (tm *ThrottleManager) GetProfiles() []*proxycore.NetworkProfile {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	profiles := make([]*proxycore.NetworkProfile, 0, len(tm.profiles))
+	profiles = append(profiles, builtinNetworkProfiles...)
+	custom := make([]*proxycore.NetworkProfile, 0)
+	for _, profile := range tm.profiles {
+		if !profile.BuiltIn {
+			custom = append(custom, profile)
+		}
+	}
+	sort.Slice(custom, func(i, j int) bool { return custom[i].Name < custom[j].Name })
+	return append(profiles, custom...)
+}
+
+// SetGlobalProfile 设置对所有请求生效的配置，profileID为空时关闭全局限制
+func (tm *ThrottleManager) SetGlobalProfile(profileID string) error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if profileID != "" {
+		if _, exists := tm.profiles[profileID]; !exists {
+			return fmt.Errorf("profile not found: %s", profileID)
+		}
+	}
+	tm.globalProfile = profileID
+	return nil
+}
+
+// GetGlobalProfile 获取全局配置ID，未启用时为空
+func (tm *ThrottleManager) GetGlobalProfile() string {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	return tm.globalProfile
+}
+
+// AddRule 添加或更新按主机匹配的规则
+func (tm *ThrottleManager) AddRule(rule *ThrottleRule) error {
+	if strings.TrimSpace(rule.HostPattern) == "" {
+		return fmt.Errorf("host pattern is required")
+	}
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if _, exists := tm.profiles[rule.ProfileID]; !exists {
+		return fmt.Errorf("profile not found: %s", rule.ProfileID)
+	}
+	tm.rules[rule.ID] = rule
+	return nil
+}
+
+// RemoveRule 移除规则
+func (tm *ThrottleManager) RemoveRule(ruleID string) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	delete(tm.rules, ruleID)
+}
+
+// GetAllRules 获取所有规则，按ID排序
+func (tm *ThrottleManager) GetAllRules() []*ThrottleRule {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	rules := make([]*ThrottleRule, 0, len(tm.rules))
+	for _, rule := range tm.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// ProfileFor 为Flow选择网络条件配置：先按主机匹配规则，再使用全局配置，都没有时返回nil
+func (tm *ThrottleManager) ProfileFor(flow *proxycore.Flow) *proxycore.NetworkProfile {
+	for _, rule := range tm.GetAllRules() {
+		if rule.Enabled && matchHost(rule.HostPattern, flow.Domain) {
+			tm.mutex.RLock()
+			profile := tm.profiles[rule.ProfileID]
+			tm.mutex.RUnlock()
+			if profile != nil {
+				return profile
+			}
+		}
+	}
+
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	if tm.globalProfile == "" {
+		return nil
+	}
+	return tm.profiles[tm.globalProfile]
+}
@@ -0,0 +1,53 @@
+package features
+
+import (
+	"testing"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+func TestThrottleProfileSelection(t *testing.T) {
+	tm := NewThrottleManager()
+	flow := &proxycore.Flow{Domain: "api.example.com:443"}
+
+	if profile := tm.ProfileFor(flow); profile != nil {
+		t.Fatalf("expected no profile by default, got %s", profile.Name)
+	}
+
+	if err := tm.SetGlobalProfile("3g"); err != nil {
+		t.Fatalf("SetGlobalProfile failed: %v", err)
+	}
+	if profile := tm.ProfileFor(flow); profile == nil || profile.ID != "3g" {
+		t.Fatalf("expected global 3G profile, got %+v", profile)
+	}
+
+	custom := &proxycore.NetworkProfile{ID: "slow-api", Name: "Slow API", DownloadKbps: 100, LatencyMs: 1000}
+	if err := tm.SaveProfile(custom); err != nil {
+		t.Fatalf("SaveProfile failed: %v", err)
+	}
+	if err := tm.AddRule(&ThrottleRule{ID: "r1", HostPattern: "*.example.com", ProfileID: "slow-api", Enabled: true}); err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+	if profile := tm.ProfileFor(flow); profile == nil || profile.ID != "slow-api" {
+		t.Fatalf("expected host rule to take precedence, got %+v", profile)
+	}
+	if profile := tm.ProfileFor(&proxycore.Flow{Domain: "other.test"}); profile == nil || profile.ID != "3g" {
+		t.Fatalf("expected global profile for unmatched host, got %+v", profile)
+	}
+
+	if err := tm.RemoveProfile("slow-api"); err == nil {
+		t.Error("expected error removing a profile used by a rule")
+	}
+	if err := tm.RemoveProfile("3g"); err == nil {
+		t.Error("expected error removing a built-in profile")
+	}
+	if err := tm.SaveProfile(&proxycore.NetworkProfile{ID: "edge", Name: "Mine"}); err == nil {
+		t.Error("expected error overwriting a built-in profile")
+	}
+	if err := tm.SaveProfile(&proxycore.NetworkProfile{ID: "bad", Name: "Bad", FailureRate: 1.5}); err == nil {
+		t.Error("expected error for failure rate above 1")
+	}
+	if err := tm.AddRule(&ThrottleRule{ID: "r2", HostPattern: "a.test", ProfileID: "missing"}); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
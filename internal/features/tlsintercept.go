@@ -0,0 +1,90 @@
+package features
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// TLS解密模式
+const (
+	TLSInterceptAll     = "all"     // 解密所有HTTPS隧道（默认）
+	TLSInterceptExclude = "exclude" // 匹配的主机不解密，原样转发
+	TLSInterceptInclude = "include" // 只解密匹配的主机
+)
+
+// TLSInterceptManager 在CONNECT时按 host:port 决定是否做中间人解密，实现 proxycore.TLSInterceptionPolicy。
+// 证书固定（pinning）的应用或不关心的主机可以排除，避免握手失败
+type TLSInterceptManager struct {
+	mode  string
+	hosts []string // 主机模式，如 *.apple.com、bank.example.com:443
+	mutex sync.RWMutex
+}
+
+// NewTLSInterceptManager 创建TLS解密管理器
+func NewTLSInterceptManager() *TLSInterceptManager {
+	return &TLSInterceptManager{
+		mode: TLSInterceptAll,
+	}
+}
+
+// SetMode 设置解密模式
+func (tim *TLSInterceptManager) SetMode(mode string) error {
+	if mode != TLSInterceptAll && mode != TLSInterceptExclude && mode != TLSInterceptInclude {
+		return fmt.Errorf("invalid TLS interception mode: %s", mode)
+	}
+
+	tim.mutex.Lock()
+	defer tim.mutex.Unlock()
+	tim.mode = mode
+	return nil
+}
+
+// GetMode 获取解密模式
+func (tim *TLSInterceptManager) GetMode() string {
+	tim.mutex.RLock()
+	defer tim.mutex.RUnlock()
+	return tim.mode
+}
+
+// SetHosts 设置include/exclude模式使用的主机模式列表，忽略空行
+func (tim *TLSInterceptManager) SetHosts(hosts []string) {
+	cleaned := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if host = strings.TrimSpace(host); host != "" {
+			cleaned = append(cleaned, host)
+		}
+	}
+
+	tim.mutex.Lock()
+	defer tim.mutex.Unlock()
+	tim.hosts = cleaned
+}
+
+// GetHosts 获取主机模式列表
+func (tim *TLSInterceptManager) GetHosts() []string {
+	tim.mutex.RLock()
+	defer tim.mutex.RUnlock()
+	return append([]string(nil), tim.hosts...)
+}
+
+// ShouldInterceptTLS 是否对 host:port 做中间人解密
+func (tim *TLSInterceptManager) ShouldInterceptTLS(hostPort string) bool {
+	tim.mutex.RLock()
+	defer tim.mutex.RUnlock()
+
+	if tim.mode == TLSInterceptAll {
+		return true
+	}
+	matched := false
+	for _, pattern := range tim.hosts {
+		if matchHostPort(pattern, hostPort) {
+			matched = true
+			break
+		}
+	}
+	if tim.mode == TLSInterceptInclude {
+		return matched
+	}
+	return !matched
+}
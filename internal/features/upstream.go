@@ -1,10 +1,17 @@
 package features
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -23,6 +30,68 @@ type UpstreamProxy struct {
 	Username    string `json:"username,omitempty"`
 	Password    string `json:"password,omitempty"`
 	Description string `json:"description"`
+	// SkipTLSVerify 不校验目标站点证书（用于会重签证书的企业代理）
+	SkipTLSVerify bool `json:"skipTlsVerify"`
+}
+
+// upstreamLatencySamples 每个上游保留的最近延迟样本数，用于计算分位数
+const upstreamLatencySamples = 1024
+
+// upstreamMedianInterval 样本较多时每隔多少个样本重新计算一次缓存的中位数
+const upstreamMedianInterval = 32
+
+// upstreamStats 上游代理统计
+type upstreamStats struct {
+	requests     int64
+	success      int64
+	errors       int64
+	totalLatency time.Duration
+	latencies    []time.Duration // 最近的成功请求延迟（环形缓冲）
+	nextSample   int
+	p50          float64 // 缓存的延迟中位数（毫秒），供最低延迟策略排序，避免每个请求都排序样本
+}
+
+// addLatency 记录一个延迟样本
+func (s *upstreamStats) addLatency(latency time.Duration) {
+	if len(s.latencies) < upstreamLatencySamples {
+		s.latencies = append(s.latencies, latency)
+		return
+	}
+	s.latencies[s.nextSample] = latency
+	s.nextSample = (s.nextSample + 1) % upstreamLatencySamples
+}
+
+// percentiles 计算延迟分位数（毫秒）
+func (s *upstreamStats) percentiles(ps ...float64) []float64 {
+	result := make([]float64, len(ps))
+	if len(s.latencies) == 0 {
+		return result
+	}
+	sorted := make([]time.Duration, len(s.latencies))
+	copy(sorted, s.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for i, p := range ps {
+		index := int(float64(len(sorted))*p+0.5) - 1
+		if index < 0 {
+			index = 0
+		}
+		if index >= len(sorted) {
+			index = len(sorted) - 1
+		}
+		result[i] = float64(sorted[index].Microseconds()) / 1000
+	}
+	return result
+}
+
+// UpstreamStorage 上游代理和代理组存储接口
+type UpstreamStorage interface {
+	SaveUpstreamProxy(proxy *UpstreamProxy) error
+	GetUpstreamProxies() ([]*UpstreamProxy, error)
+	DeleteUpstreamProxy(id string) error
+	SaveUpstreamGroup(group *UpstreamGroup) error
+	GetUpstreamGroups() ([]*UpstreamGroup, error)
+	DeleteUpstreamGroup(id string) error
 }
 
 // UpstreamManager 上游代理管理器
@@ -30,14 +99,107 @@ type UpstreamManager struct {
 	proxies     map[string]*UpstreamProxy
 	proxiesMutex sync.RWMutex
 	clients     map[string]*http.Client
+	stats       map[string]*upstreamStats
+	statsMutex  sync.Mutex
+
+	// PAC脚本选择上游代理
+	pac          *PACResolver
+	pacClients   map[string]*http.Client
+	pacMutex     sync.RWMutex
+	directClient *http.Client
+
+	// 上游代理组与健康检查
+	groups       map[string]*UpstreamGroup
+	groupsMutex  sync.RWMutex
+	rrCounters   map[string]*uint64
+	health       map[string]*UpstreamHealth
+	healthMutex  sync.RWMutex
+	healthConfig HealthCheckConfig
+	healthStop   chan struct{}
+	storage      UpstreamStorage
+}
+
+// upstreamRoute 一次请求可依次尝试的上游路由
+type upstreamRoute struct {
+	id     string // 统计使用的ID
+	name   string
+	client *http.Client
 }
 
 // NewUpstreamManager 创建上游代理管理器
-func NewUpstreamManager() *UpstreamManager {
-	return &UpstreamManager{
-		proxies: make(map[string]*UpstreamProxy),
-		clients: make(map[string]*http.Client),
+func NewUpstreamManager(storage UpstreamStorage) *UpstreamManager {
+	manager := &UpstreamManager{
+		proxies:    make(map[string]*UpstreamProxy),
+		clients:    make(map[string]*http.Client),
+		stats:      make(map[string]*upstreamStats),
+		pacClients: make(map[string]*http.Client),
+		groups:     make(map[string]*UpstreamGroup),
+		rrCounters: make(map[string]*uint64),
+		health:     make(map[string]*UpstreamHealth),
+		healthConfig: HealthCheckConfig{
+			IntervalSeconds:  30,
+			TimeoutSeconds:   5,
+			FailureThreshold: 3,
+		},
+		directClient: &http.Client{
+			Timeout: 30 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		storage: storage,
 	}
+
+	// 从数据库加载上游代理和代理组
+	manager.loadFromStorage()
+
+	return manager
+}
+
+// loadFromStorage 从存储加载上游代理和代理组，无法使用的配置保留但停用
+func (um *UpstreamManager) loadFromStorage() {
+	if um.storage == nil {
+		return
+	}
+
+	proxies, err := um.storage.GetUpstreamProxies()
+	if err != nil {
+		fmt.Printf("Failed to load upstream proxies from storage: %v\n", err)
+		return
+	}
+	for _, proxy := range proxies {
+		um.proxies[proxy.ID] = proxy
+		client, err := um.loadProxyClient(proxy)
+		if err != nil {
+			fmt.Printf("Upstream proxy %s: %v\n", proxy.ID, err)
+			proxy.Enabled = false
+			continue
+		}
+		um.clients[proxy.ID] = client
+	}
+
+	groups, err := um.storage.GetUpstreamGroups()
+	if err != nil {
+		fmt.Printf("Failed to load upstream groups from storage: %v\n", err)
+		return
+	}
+	for _, group := range groups {
+		if err := validateUpstreamGroup(group); err != nil {
+			fmt.Printf("Upstream group %s: %v\n", group.ID, err)
+			group.Enabled = false
+		}
+		um.groups[group.ID] = group
+		um.rrCounters[group.ID] = new(uint64)
+	}
+}
+
+// loadProxyClient 为从存储加载的上游代理创建HTTP客户端
+func (um *UpstreamManager) loadProxyClient(proxy *UpstreamProxy) (*http.Client, error) {
+	proxyURL, err := url.Parse(proxy.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	return um.createHTTPClient(proxy, proxyURL)
 }
 
 // AddProxy 添加上游代理
@@ -57,6 +219,13 @@ func (um *UpstreamManager) AddProxy(proxy *UpstreamProxy) error {
 		return fmt.Errorf("failed to create HTTP client: %v", err)
 	}
 
+	// 保存到数据库
+	if um.storage != nil {
+		if err := um.storage.SaveUpstreamProxy(proxy); err != nil {
+			return fmt.Errorf("failed to save upstream proxy: %v", err)
+		}
+	}
+
 	um.proxies[proxy.ID] = proxy
 	um.clients[proxy.ID] = client
 
@@ -64,12 +233,28 @@ func (um *UpstreamManager) AddProxy(proxy *UpstreamProxy) error {
 }
 
 // RemoveProxy 移除上游代理
-func (um *UpstreamManager) RemoveProxy(proxyID string) {
+func (um *UpstreamManager) RemoveProxy(proxyID string) error {
 	um.proxiesMutex.Lock()
 	defer um.proxiesMutex.Unlock()
-	
+
+	// 从数据库删除
+	if um.storage != nil {
+		if err := um.storage.DeleteUpstreamProxy(proxyID); err != nil {
+			return fmt.Errorf("failed to delete upstream proxy: %v", err)
+		}
+	}
+
 	delete(um.proxies, proxyID)
 	delete(um.clients, proxyID)
+
+	um.statsMutex.Lock()
+	delete(um.stats, proxyID)
+	um.statsMutex.Unlock()
+
+	um.healthMutex.Lock()
+	delete(um.health, proxyID)
+	um.healthMutex.Unlock()
+	return nil
 }
 
 // UpdateProxy 更新上游代理
@@ -93,6 +278,12 @@ func (um *UpstreamManager) UpdateProxy(proxy *UpstreamProxy) error {
 		return fmt.Errorf("failed to create HTTP client: %v", err)
 	}
 
+	if um.storage != nil {
+		if err := um.storage.SaveUpstreamProxy(proxy); err != nil {
+			return fmt.Errorf("failed to save upstream proxy: %v", err)
+		}
+	}
+
 	um.proxies[proxy.ID] = proxy
 	um.clients[proxy.ID] = client
 
@@ -111,131 +302,474 @@ func (um *UpstreamManager) GetAllProxies() []*UpstreamProxy {
 	return proxies
 }
 
-// MatchProxy 匹配上游代理
+// MatchProxy 匹配上游代理，优先返回健康的上游；匹配的上游都被剔除时仍返回被剔除的上游，
+// 请求经它发送并失败，而不是绕过上游直接连接目标
 func (um *UpstreamManager) MatchProxy(targetURL string) (*UpstreamProxy, *http.Client) {
 	um.proxiesMutex.RLock()
 	defer um.proxiesMutex.RUnlock()
 	
+	var ejected *UpstreamProxy
 	for _, proxy := range um.proxies {
 		if !proxy.Enabled {
 			continue
 		}
 		
 		matched, err := um.matchURL(targetURL, proxy)
-		if err != nil {
+		if err != nil || !matched {
 			continue
 		}
 		
-		if matched {
-			client := um.clients[proxy.ID]
-			return proxy, client
+		if !um.IsHealthy(proxy.ID) {
+			if ejected == nil {
+				ejected = proxy
+			}
+			continue
 		}
+		return proxy, um.clients[proxy.ID]
 	}
 	
+	if ejected != nil {
+		return ejected, um.clients[ejected.ID]
+	}
 	return nil, nil
 }
 
+// LoadPAC 加载PAC脚本（本地文件或本地URL），替换当前PAC配置
+func (um *UpstreamManager) LoadPAC(source string) error {
+	resolver, err := LoadPAC(source)
+	if err != nil {
+		return err
+	}
+	um.SetPAC(resolver)
+	return nil
+}
+
+// SetPAC 设置PAC解析器，nil表示不使用PAC
+func (um *UpstreamManager) SetPAC(resolver *PACResolver) {
+	um.pacMutex.Lock()
+	defer um.pacMutex.Unlock()
+	// 重新加载时丢弃旧脚本的解析结果
+	if um.pac != nil {
+		um.pac.ClearCache()
+	}
+	um.pac = resolver
+	um.pacClients = make(map[string]*http.Client)
+}
+
+// GetPACSource 获取当前PAC脚本来源，未配置时返回空字符串
+func (um *UpstreamManager) GetPACSource() string {
+	um.pacMutex.RLock()
+	defer um.pacMutex.RUnlock()
+	if um.pac == nil {
+		return ""
+	}
+	return um.pac.Source()
+}
+
+// resolveRoutes 获取目标URL的上游路由：代理组优先，其次静态规则，最后按PAC返回的代理链。
+// 返回nil表示直连，由代理服务器正常处理
+func (um *UpstreamManager) resolveRoutes(targetURL string) ([]upstreamRoute, error) {
+	if routes := um.groupRoutes(targetURL); len(routes) > 0 {
+		return routes, nil
+	}
+
+	if proxy, client := um.MatchProxy(targetURL); proxy != nil && client != nil {
+		return []upstreamRoute{{id: proxy.ID, name: proxy.Name, client: client}}, nil
+	}
+
+	um.pacMutex.RLock()
+	resolver := um.pac
+	um.pacMutex.RUnlock()
+	if resolver == nil {
+		return nil, nil
+	}
+
+	chain, err := resolver.FindProxy(targetURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 1 && chain[0].Type == "DIRECT" {
+		return nil, nil
+	}
+
+	routes := make([]upstreamRoute, 0, len(chain))
+	for _, entry := range chain {
+		client, err := um.pacClient(entry)
+		if err != nil {
+			fmt.Printf("Skipping PAC entry %s: %v\n", entry, err)
+			continue
+		}
+		routes = append(routes, upstreamRoute{id: "pac:" + entry.String(), name: entry.String(), client: client})
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("no usable proxy in PAC result for %s", targetURL)
+	}
+	return routes, nil
+}
+
+// pacClient 获取PAC条目对应的HTTP客户端
+func (um *UpstreamManager) pacClient(entry PACProxy) (*http.Client, error) {
+	if entry.Type == "DIRECT" {
+		return um.directClient, nil
+	}
+
+	proxyURLStr := entry.ProxyURL()
+	um.pacMutex.RLock()
+	client, exists := um.pacClients[proxyURLStr]
+	um.pacMutex.RUnlock()
+	if exists {
+		return client, nil
+	}
+
+	proxyURL, err := url.Parse(proxyURLStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	client, err = um.createHTTPClient(&UpstreamProxy{ProxyURL: proxyURLStr}, proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	um.pacMutex.Lock()
+	um.pacClients[proxyURLStr] = client
+	um.pacMutex.Unlock()
+	return client, nil
+}
+
 // matchURL 匹配URL
 func (um *UpstreamManager) matchURL(targetURL string, proxy *UpstreamProxy) (bool, error) {
-	if proxy.IsRegex {
-		regex, err := regexp.Compile(proxy.URLPattern)
+	return matchUpstreamPattern(targetURL, proxy.URLPattern, proxy.IsRegex)
+}
+
+// matchUpstreamPattern 按子串或正则匹配URL
+func matchUpstreamPattern(targetURL, pattern string, isRegex bool) (bool, error) {
+	if isRegex {
+		regex, err := regexp.Compile(pattern)
 		if err != nil {
 			return false, err
 		}
 		return regex.MatchString(targetURL), nil
-	} else {
-		return strings.Contains(targetURL, proxy.URLPattern), nil
 	}
+	return strings.Contains(targetURL, pattern), nil
 }
 
-// createHTTPClient 创建HTTP客户端
+// createHTTPClient 创建HTTP客户端。
+// http/https上游通过Transport.Proxy转发（HTTPS目标自动使用CONNECT），
+// socks5上游通过自定义DialContext完成SOCKS5握手
 func (um *UpstreamManager) createHTTPClient(proxy *UpstreamProxy, proxyURL *url.URL) (*http.Client, error) {
+	username, password := proxy.Username, proxy.Password
+	if username == "" && proxyURL.User != nil {
+		username = proxyURL.User.Username()
+		password, _ = proxyURL.User.Password()
+	}
+
 	transport := &http.Transport{
-		Proxy: http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: proxy.SkipTLSVerify,
+		},
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
 	}
 
-	// 设置认证
-	if proxy.Username != "" && proxy.Password != "" {
-		proxyURL.User = url.UserPassword(proxy.Username, proxy.Password)
+	switch strings.ToLower(proxyURL.Scheme) {
+	case "http", "https":
+		if username != "" {
+			proxyURL.User = url.UserPassword(username, password)
+		}
 		transport.Proxy = http.ProxyURL(proxyURL)
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		transport.DialContext = markUpstreamDialErrors(dialer.DialContext)
+	case "socks5", "socks5h":
+		dialer := &proxycore.SOCKS5Dialer{
+			ProxyAddr: proxyURL.Host,
+			Username:  username,
+			Password:  password,
+		}
+		transport.DialContext = markUpstreamDialErrors(dialer.DialContext)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %s", proxyURL.Scheme)
+	}
+
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy URL has no host: %s", proxy.ProxyURL)
 	}
 
 	client := &http.Client{
 		Transport: transport,
 		Timeout:   30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// 代理不跟随重定向，原样返回给客户端
+			return http.ErrUseLastResponse
+		},
 	}
 
 	return client, nil
 }
 
-// UpstreamInterceptor 上游代理拦截器
-type UpstreamInterceptor struct {
+// recordResult 记录一次经上游代理的请求结果
+func (um *UpstreamManager) recordResult(proxyID string, latency time.Duration, err error) {
+	um.statsMutex.Lock()
+
+	stats, exists := um.stats[proxyID]
+	if !exists {
+		stats = &upstreamStats{}
+		um.stats[proxyID] = stats
+	}
+
+	stats.requests++
+	if err != nil {
+		stats.errors++
+	} else {
+		stats.success++
+		stats.totalLatency += latency
+		stats.addLatency(latency)
+		if len(stats.latencies) < upstreamMedianInterval || stats.success%upstreamMedianInterval == 0 {
+			stats.p50 = stats.percentiles(0.5)[0]
+		}
+	}
+	um.statsMutex.Unlock()
+
+	// 被动健康检查：连续请求失败同样会导致上游被剔除
+	um.updateHealth(proxyID, latency, err, false)
+}
+
+// Transport 实现proxycore.UpstreamSelector：按请求的实际目标（可能已被Map Remote、脚本等改写）选择上游，
+// 返回依次尝试各上游的传输；不使用上游时返回nil，由代理服务器直接连接
+func (um *UpstreamManager) Transport(flow *proxycore.Flow, req *http.Request) (http.RoundTripper, error) {
+	routes, err := um.resolveRoutes(req.URL.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve upstream proxy: %v", err)
+	}
+	if len(routes) == 0 {
+		return nil, nil
+	}
+	return &upstreamTransport{manager: um, flow: flow, routes: routes}, nil
+}
+
+// upstreamTransport 依次尝试代理链中的每个上游：幂等的请求失败时切换到下一个，其他请求只在连接上游失败时切换
+type upstreamTransport struct {
 	manager *UpstreamManager
+	flow    *proxycore.Flow
+	routes  []upstreamRoute
 }
 
-// NewUpstreamInterceptor 创建上游代理拦截器
-func NewUpstreamInterceptor(manager *UpstreamManager) *UpstreamInterceptor {
-	return &UpstreamInterceptor{
-		manager: manager,
+// RoundTrip 实现http.RoundTripper
+func (ut *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var lastErr error
+	for _, route := range ut.routes {
+		attempt := req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attempt.Body = body
+		}
+
+		transport := route.client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		startTime := time.Now()
+		resp, err := transport.RoundTrip(attempt)
+		ut.manager.recordResult(route.id, time.Since(startTime), err)
+		if err != nil {
+			fmt.Printf("Upstream %s failed for %s: %v\n", route.name, req.URL, err)
+			lastErr = err
+			if !canFailover(req, err) {
+				break
+			}
+			continue
+		}
+
+		ut.flow.AddTag("upstream-proxy")
+		ut.flow.AddTag(fmt.Sprintf("upstream-%s", route.name))
+		// 设置标识头
+		resp.Header.Set("X-ProxyWoman-Upstream", route.name)
+		return resp, nil
 	}
+	return nil, fmt.Errorf("upstream proxy request failed: %v", lastErr)
+}
+
+// upstreamDialError 连接上游代理失败，请求还没有发出
+type upstreamDialError struct {
+	err error
 }
 
-// InterceptRequest 拦截请求
-func (ui *UpstreamInterceptor) InterceptRequest(flow *proxycore.Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
-	proxy, client := ui.manager.MatchProxy(flow.URL)
-	if proxy == nil || client == nil {
-		return false, nil // 不使用上游代理，继续正常处理
+func (e *upstreamDialError) Error() string { return e.err.Error() }
+
+func (e *upstreamDialError) Unwrap() error { return e.err }
+
+// markUpstreamDialErrors 包装拨号函数，把连接上游的失败标记为upstreamDialError
+func markUpstreamDialErrors(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, &upstreamDialError{err: err}
+		}
+		return conn, nil
 	}
+}
 
-	// 使用上游代理发送请求
-	flow.AddTag("upstream-proxy")
-	flow.AddTag(fmt.Sprintf("upstream-%s", proxy.Name))
+// canFailover 请求失败后能否换用下一个上游：幂等的方法可以重发；其他方法（如POST）只在连接上游失败、
+// 请求还没有发出时切换，避免同一个请求被服务器处理两次
+func canFailover(req *http.Request, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	var dialErr *upstreamDialError
+	return errors.As(err, &dialErr)
+}
 
-	// 创建新的请求
-	proxyReq, err := http.NewRequest(r.Method, flow.URL, r.Body)
+// DialTunnel 实现proxycore.UpstreamDialer：按与HTTP请求相同的规则（代理组、静态规则、PAC）选择上游，
+// 经上游建立到target的TCP连接，失败时依次尝试下一个上游。不使用上游时返回nil，由代理服务器直接连接
+func (um *UpstreamManager) DialTunnel(ctx context.Context, flow *proxycore.Flow, target string) (net.Conn, error) {
+	routes, err := um.resolveRoutes(tunnelURL(target))
 	if err != nil {
-		return false, fmt.Errorf("failed to create upstream request: %v", err)
+		return nil, fmt.Errorf("failed to resolve upstream proxy: %v", err)
+	}
+	if len(routes) == 0 {
+		return nil, nil
 	}
 
-	// 复制请求头
-	for name, values := range r.Header {
-		for _, value := range values {
-			proxyReq.Header.Add(name, value)
+	var lastErr error
+	for _, route := range routes {
+		startTime := time.Now()
+		conn, err := dialThroughRoute(ctx, route, target)
+		um.recordResult(route.id, time.Since(startTime), err)
+		if err != nil {
+			fmt.Printf("Upstream %s failed to tunnel to %s: %v\n", route.name, target, err)
+			lastErr = err
+			continue
 		}
+
+		flow.AddTag("upstream-proxy")
+		flow.AddTag(fmt.Sprintf("upstream-%s", route.name))
+		return conn, nil
+	}
+	return nil, fmt.Errorf("upstream proxy tunnel failed: %v", lastErr)
+}
+
+// tunnelURL 隧道目标用于匹配上游规则的URL：443端口与解密后的HTTPS请求一致，其他端口按原始TCP
+func tunnelURL(target string) string {
+	host, port, err := net.SplitHostPort(target)
+	if err == nil && port == "443" {
+		return "https://" + host
+	}
+	return "tcp://" + target
+}
+
+// dialThroughRoute 经单个上游连接target：http/https上游发送CONNECT，socks5上游使用SOCKS5握手，
+// PAC的DIRECT条目直接连接
+func dialThroughRoute(ctx context.Context, route upstreamRoute, target string) (net.Conn, error) {
+	transport, ok := route.client.Transport.(*http.Transport)
+	if !ok || transport == nil {
+		dialer := &net.Dialer{Timeout: 30 * time.Second}
+		return dialer.DialContext(ctx, "tcp", target)
+	}
+	if transport.Proxy == nil {
+		return transport.DialContext(ctx, "tcp", target)
 	}
 
-	// 发送请求到上游代理
-	resp, err := client.Do(proxyReq)
+	proxyURL, err := transport.Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: target}})
 	if err != nil {
-		return false, fmt.Errorf("upstream proxy request failed: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return connectThroughHTTPProxy(ctx, transport, proxyURL, target)
+}
 
-	// 复制响应头
-	for name, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(name, value)
+// connectThroughHTTPProxy 向HTTP上游代理发送CONNECT请求，代理返回2xx后连接即为到target的隧道
+func connectThroughHTTPProxy(ctx context.Context, transport *http.Transport, proxyURL *url.URL, target string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		if strings.EqualFold(proxyURL.Scheme, "https") {
+			proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "443")
+		} else {
+			proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
 		}
 	}
 
-	// 设置标识头
-	w.Header().Set("X-ProxyWoman-Upstream", proxy.Name)
+	conn, err := transport.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
 
-	w.WriteHeader(resp.StatusCode)
+	if strings.EqualFold(proxyURL.Scheme, "https") {
+		config := transport.TLSClientConfig.Clone()
+		if config == nil {
+			config = &tls.Config{}
+		}
+		config.ServerName = proxyURL.Hostname()
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with upstream proxy failed: %v", err)
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
 
-	// 复制响应体
-	_, err = w.(http.ResponseWriter).Write([]byte{}) // 这里需要实际读取和写入响应体
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
 	if err != nil {
-		return false, fmt.Errorf("failed to write upstream response: %v", err)
+		conn.Close()
+		return nil, err
 	}
+	// 成功的CONNECT响应之后即为隧道数据，不读取响应体
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		conn.Close()
+		return nil, fmt.Errorf("upstream proxy refused CONNECT: %s", resp.Status)
+	}
+
+	conn.SetDeadline(time.Time{})
+	if reader.Buffered() > 0 {
+		return &tunnelConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// tunnelConn 读取CONNECT响应时多读到的数据留在reader中，先从reader读取
+type tunnelConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
 
-	return true, nil // 请求已通过上游代理处理
+func (c *tunnelConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
 }
 
-// TestUpstreamProxy 测试上游代理连接
+// CloseWrite 半关闭底层连接的写方向，隧道单向结束时另一方向仍可继续传输
+func (c *tunnelConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// TestUpstreamProxy 测试上游代理连接。
+// 配置了健康检查目标时通过上游请求该目标，否则只检查代理地址是否可连接，不访问公网
 func (um *UpstreamManager) TestUpstreamProxy(proxyID string) error {
 	um.proxiesMutex.RLock()
-	_, exists := um.proxies[proxyID]
+	proxy, exists := um.proxies[proxyID]
 	client, clientExists := um.clients[proxyID]
 	um.proxiesMutex.RUnlock()
 
@@ -243,40 +777,40 @@ func (um *UpstreamManager) TestUpstreamProxy(proxyID string) error {
 		return fmt.Errorf("proxy not found: %s", proxyID)
 	}
 
-	// 创建测试请求
-	testURL := "http://httpbin.org/ip"
-	req, err := http.NewRequest("GET", testURL, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create test request: %v", err)
-	}
+	um.healthMutex.RLock()
+	config := um.healthConfig
+	um.healthMutex.RUnlock()
 
-	// 设置较短的超时时间用于测试
-	testClient := &http.Client{
-		Transport: client.Transport,
-		Timeout:   10 * time.Second,
-	}
+	latency, err := um.probe(proxy, client, config)
+	um.updateHealth(proxyID, latency, err, true)
+	return err
+}
 
-	// 发送测试请求
-	resp, err := testClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("test request failed: %v", err)
-	}
-	defer resp.Body.Close()
+// GetProxyStats 获取代理统计信息
+func (um *UpstreamManager) GetProxyStats(proxyID string) map[string]interface{} {
+	um.statsMutex.Lock()
+	defer um.statsMutex.Unlock()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("test request returned status: %d", resp.StatusCode)
+	stats, exists := um.stats[proxyID]
+	if !exists {
+		stats = &upstreamStats{}
 	}
+	healthy := um.IsHealthy(proxyID)
 
-	return nil
-}
+	avgLatency := float64(0)
+	if stats.success > 0 {
+		avgLatency = float64(stats.totalLatency.Microseconds()) / 1000 / float64(stats.success)
+	}
+	p := stats.percentiles(0.5, 0.9, 0.99)
 
-// GetProxyStats 获取代理统计信息
-func (um *UpstreamManager) GetProxyStats(proxyID string) map[string]interface{} {
-	// 这里可以实现代理使用统计
-	// 例如：请求数量、成功率、平均响应时间等
 	return map[string]interface{}{
-		"requests": 0,
-		"success":  0,
-		"errors":   0,
+		"requests":     stats.requests,
+		"success":      stats.success,
+		"errors":       stats.errors,
+		"avgLatencyMs": avgLatency,
+		"p50LatencyMs": p[0],
+		"p90LatencyMs": p[1],
+		"p99LatencyMs": p[2],
+		"healthy":      healthy,
 	}
 }
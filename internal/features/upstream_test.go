@@ -0,0 +1,657 @@
+package features
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ProxyWoman/internal/proxycore"
+)
+
+// newTestHTTPProxy 启动进程内的HTTP上游代理替身，支持绝对URL转发和CONNECT隧道
+func newTestHTTPProxy(t *testing.T, hits *int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+
+		if r.Method == http.MethodConnect {
+			target, err := net.Dial("tcp", r.Host)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			clientConn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				target.Close()
+				return
+			}
+			go pipeAndClose(target, buf)
+			go pipeAndClose(clientConn, target)
+			return
+		}
+
+		outReq, _ := http.NewRequest(r.Method, r.URL.String(), r.Body)
+		outReq.Header = r.Header.Clone()
+		outReq.Header.Del("Proxy-Authorization")
+		resp, err := http.DefaultTransport.RoundTrip(outReq)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for name, values := range resp.Header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("X-Test-Proxy-Auth", r.Header.Get("Proxy-Authorization"))
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestSOCKS5Proxy 启动进程内的SOCKS5上游代理替身，要求用户名/密码认证
+func newTestSOCKS5Proxy(t *testing.T, username, password string, hits *int32) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSOCKS5(conn, username, password, hits)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveTestSOCKS5(conn net.Conn, username, password string, hits *int32) {
+	reader := bufio.NewReader(conn)
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		conn.Close()
+		return
+	}
+	io.ReadFull(reader, make([]byte, header[1]))
+	conn.Write([]byte{0x05, 0x02})
+
+	// RFC 1929 认证
+	reader.ReadByte()
+	ulen, _ := reader.ReadByte()
+	user := make([]byte, ulen)
+	io.ReadFull(reader, user)
+	plen, _ := reader.ReadByte()
+	pass := make([]byte, plen)
+	io.ReadFull(reader, pass)
+	if string(user) != username || string(pass) != password {
+		conn.Write([]byte{0x01, 0x01})
+		conn.Close()
+		return
+	}
+	conn.Write([]byte{0x01, 0x00})
+
+	req := make([]byte, 4)
+	io.ReadFull(reader, req)
+	var host string
+	switch req[3] {
+	case 0x01:
+		addr := make([]byte, 4)
+		io.ReadFull(reader, addr)
+		host = net.IP(addr).String()
+	case 0x03:
+		length, _ := reader.ReadByte()
+		name := make([]byte, length)
+		io.ReadFull(reader, name)
+		host = string(name)
+	}
+	portBytes := make([]byte, 2)
+	io.ReadFull(reader, portBytes)
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portBytes))))
+
+	targetConn, err := net.Dial("tcp", target)
+	if err != nil {
+		conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		conn.Close()
+		return
+	}
+	atomic.AddInt32(hits, 1)
+	conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+
+	go pipeAndClose(targetConn, reader)
+	pipeAndClose(conn, targetConn)
+}
+
+func pipeAndClose(dst net.Conn, src io.Reader) {
+	io.Copy(dst, src)
+	dst.Close()
+}
+
+// runUpstream 经上游管理器选择的传输发送请求，返回响应、响应体和Flow
+func runUpstream(t *testing.T, manager *UpstreamManager, target string) (*http.Response, string, *proxycore.Flow) {
+	t.Helper()
+	resp, body, flow, err := roundTripUpstream(manager, target)
+	if err != nil {
+		t.Fatalf("upstream request: %v", err)
+	}
+	return resp, body, flow
+}
+
+func roundTripUpstream(manager *UpstreamManager, target string) (*http.Response, string, *proxycore.Flow, error) {
+	req, _ := http.NewRequest(http.MethodGet, target, nil)
+	flow := proxycore.NewFlow("flow_test", req)
+	transport, err := manager.Transport(flow, req)
+	if err != nil {
+		return nil, "", flow, err
+	}
+	if transport == nil {
+		return nil, "", flow, fmt.Errorf("expected request to be sent through an upstream proxy")
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, "", flow, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp, string(body), flow, err
+}
+
+func TestUpstreamHTTPProxyCopiesBody(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plain body"))
+	}))
+	defer target.Close()
+
+	var hits int32
+	upstream := newTestHTTPProxy(t, &hits)
+
+	manager := NewUpstreamManager(nil)
+	err := manager.AddProxy(&UpstreamProxy{
+		ID: "http", Name: "corp", ProxyURL: upstream.URL, URLPattern: target.URL,
+		Enabled: true, Username: "alice", Password: "pw",
+	})
+	if err != nil {
+		t.Fatalf("add proxy: %v", err)
+	}
+
+	resp, body, flow := runUpstream(t, manager, target.URL+"/data")
+	if body != "plain body" {
+		t.Errorf("expected upstream body to be copied, got %q", body)
+	}
+	if resp.Header.Get("X-Test-Proxy-Auth") == "" {
+		t.Error("expected Proxy-Authorization to be sent to upstream")
+	}
+	if !flow.HasTag("upstream-corp") {
+		t.Error("expected flow to be tagged with the upstream")
+	}
+	if atomic.LoadInt32(&hits) != 1 {
+		t.Errorf("expected 1 upstream hit, got %d", hits)
+	}
+
+	stats := manager.GetProxyStats("http")
+	if stats["requests"].(int64) != 1 || stats["success"].(int64) != 1 {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+}
+
+func TestUpstreamHTTPSThroughConnect(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure body"))
+	}))
+	defer target.Close()
+
+	var hits int32
+	upstream := newTestHTTPProxy(t, &hits)
+
+	manager := NewUpstreamManager(nil)
+	manager.AddProxy(&UpstreamProxy{
+		ID: "https", Name: "corp", ProxyURL: upstream.URL, URLPattern: target.URL,
+		Enabled: true, SkipTLSVerify: true,
+	})
+
+	_, body, _ := runUpstream(t, manager, target.URL+"/secure")
+	if body != "secure body" {
+		t.Errorf("unexpected body: %q", body)
+	}
+	if atomic.LoadInt32(&hits) != 1 {
+		t.Errorf("expected a single CONNECT to upstream, got %d hits", hits)
+	}
+}
+
+func TestUpstreamSOCKS5WithCredentials(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("via socks"))
+	}))
+	defer target.Close()
+
+	var hits int32
+	socksAddr := newTestSOCKS5Proxy(t, "bob", "secret", &hits)
+
+	manager := NewUpstreamManager(nil)
+	manager.AddProxy(&UpstreamProxy{
+		ID: "socks", Name: "socks", ProxyURL: "socks5://" + socksAddr, URLPattern: target.URL,
+		Enabled: true, Username: "bob", Password: "secret",
+	})
+
+	_, body, _ := runUpstream(t, manager, target.URL+"/s")
+	if body != "via socks" {
+		t.Errorf("unexpected body: %q", body)
+	}
+	if atomic.LoadInt32(&hits) != 1 {
+		t.Errorf("expected 1 SOCKS5 connection, got %d", hits)
+	}
+}
+
+// TestUpstreamRequestsRunThroughInterceptors 经上游的请求同样执行请求和响应拦截器，脚本构造的响应不再经过上游
+func TestUpstreamRequestsRunThroughInterceptors(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("origin"))
+	}))
+	defer target.Close()
+
+	var hits int32
+	upstream := newTestHTTPProxy(t, &hits)
+	manager := NewUpstreamManager(nil)
+	manager.AddProxy(&UpstreamProxy{ID: "http", Name: "corp", ProxyURL: upstream.URL, URLPattern: target.URL, Enabled: true})
+
+	scripts := NewScriptManager(nil)
+	if err := scripts.AddScript(&Script{ID: "s", Name: "s", Type: "both", Enabled: true, Content: `
+		function onRequest(ctx) {
+			if (ctx.request.url.indexOf("/mock") >= 0) return respond(200, "mocked");
+		}
+		function onResponse(ctx) { ctx.response.headers.set("X-Script", "1"); }
+	`}); err != nil {
+		t.Fatal(err)
+	}
+	ps, client, flows := newTestProxy(t, NewScriptInterceptor(scripts))
+	ps.SetUpstreamSelector(manager)
+
+	resp, err := client.Get(target.URL + "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "origin" || resp.Header.Get("X-Script") != "1" || resp.Header.Get("X-ProxyWoman-Upstream") != "corp" {
+		t.Errorf("got %q headers=%v", body, resp.Header)
+	}
+	if flow := <-flows; !flow.HasTag("upstream-corp") || flow.Response == nil {
+		t.Errorf("unexpected flow: tags=%v", flow.Tags)
+	}
+
+	resp, err = client.Get(target.URL + "/mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	<-flows
+	if string(body) != "mocked" {
+		t.Errorf("mocked body = %q", body)
+	}
+	if atomic.LoadInt32(&hits) != 1 {
+		t.Errorf("mocked request must not reach the upstream, hits = %d", hits)
+	}
+}
+
+func TestUpstreamSOCKS5BadCredentialsCountsError(t *testing.T) {
+	var hits int32
+	socksAddr := newTestSOCKS5Proxy(t, "bob", "secret", &hits)
+
+	manager := NewUpstreamManager(nil)
+	manager.AddProxy(&UpstreamProxy{
+		ID: "socks", Name: "socks", ProxyURL: "socks5://" + socksAddr, URLPattern: "example.invalid",
+		Enabled: true, Username: "bob", Password: "wrong",
+	})
+
+	if _, _, _, err := roundTripUpstream(manager, "http://example.invalid/"); err == nil {
+		t.Fatal("expected authentication error")
+	}
+
+	stats := manager.GetProxyStats("socks")
+	if stats["errors"].(int64) != 1 {
+		t.Errorf("expected 1 error, got %v", stats["errors"])
+	}
+}
+
+func TestUpstreamGroupRoundRobin(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+
+	var hitsA, hitsB int32
+	proxyA := newTestHTTPProxy(t, &hitsA)
+	proxyB := newTestHTTPProxy(t, &hitsB)
+
+	manager := NewUpstreamManager(nil)
+	manager.AddProxy(&UpstreamProxy{ID: "a", Name: "a", ProxyURL: proxyA.URL, URLPattern: "unused.invalid", Enabled: true})
+	manager.AddProxy(&UpstreamProxy{ID: "b", Name: "b", ProxyURL: proxyB.URL, URLPattern: "unused.invalid", Enabled: true})
+	if err := manager.AddGroup(&UpstreamGroup{
+		ID: "pool", Name: "pool", URLPattern: target.URL, Enabled: true,
+		Strategy: StrategyRoundRobin, ProxyIDs: []string{"a", "b"},
+	}); err != nil {
+		t.Fatalf("add group: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		runUpstream(t, manager, target.URL+"/rr")
+	}
+	if atomic.LoadInt32(&hitsA) != 2 || atomic.LoadInt32(&hitsB) != 2 {
+		t.Errorf("expected requests to alternate, got a=%d b=%d", hitsA, hitsB)
+	}
+
+	stats := manager.GetProxyStats("a")
+	if stats["requests"].(int64) != 2 || stats["p99LatencyMs"].(float64) <= 0 {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+}
+
+func TestUpstreamGroupLeastLatency(t *testing.T) {
+	manager := NewUpstreamManager(nil)
+	group := &UpstreamGroup{ID: "pool", Strategy: StrategyLeastLatency}
+	routes := func() []upstreamRoute {
+		return []upstreamRoute{{id: "slow"}, {id: "fast"}, {id: "new"}}
+	}
+
+	for i := 0; i < 3*upstreamMedianInterval; i++ {
+		manager.recordResult("slow", 50*time.Millisecond, nil)
+		manager.recordResult("fast", 10*time.Millisecond, nil)
+	}
+	// 尚无样本的上游优先尝试，其余按延迟中位数排序
+	if ordered := manager.orderRoutes(group, routes()); ordered[0].id != "new" || ordered[1].id != "fast" || ordered[2].id != "slow" {
+		t.Fatalf("order = %v", ordered)
+	}
+
+	// 中位数随新样本更新
+	for i := 0; i < 2*upstreamLatencySamples; i++ {
+		manager.recordResult("fast", 90*time.Millisecond, nil)
+	}
+	if ordered := manager.orderRoutes(group, routes()); ordered[1].id != "slow" || ordered[2].id != "fast" {
+		t.Fatalf("order after fast upstream slowed down = %v", ordered)
+	}
+}
+
+func TestUpstreamFailoverDoesNotResendUnsafeRequests(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+
+	// 收到请求后不响应直接断开，请求已经发出
+	var brokenHits, liveHits int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&brokenHits, 1)
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer broken.Close()
+	live := newTestHTTPProxy(t, &liveHits)
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadURL := "http://" + dead.Addr().String()
+	dead.Close()
+
+	manager := NewUpstreamManager(nil)
+	manager.AddProxy(&UpstreamProxy{ID: "broken", Name: "broken", ProxyURL: broken.URL, URLPattern: "unused.invalid", Enabled: true})
+	manager.AddProxy(&UpstreamProxy{ID: "dead", Name: "dead", ProxyURL: deadURL, URLPattern: "unused.invalid", Enabled: true})
+	manager.AddProxy(&UpstreamProxy{ID: "live", Name: "live", ProxyURL: live.URL, URLPattern: "unused.invalid", Enabled: true})
+	group := &UpstreamGroup{
+		ID: "pool", URLPattern: target.URL, Enabled: true,
+		Strategy: StrategyFailover, ProxyIDs: []string{"broken", "live"},
+	}
+	manager.AddGroup(group)
+
+	post := func() error {
+		req, _ := http.NewRequest(http.MethodPost, target.URL+"/orders", strings.NewReader("order"))
+		transport, err := manager.Transport(proxycore.NewFlow("flow_post", req), req)
+		if err != nil {
+			return err
+		}
+		resp, err := transport.RoundTrip(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := post(); err == nil || atomic.LoadInt32(&brokenHits) != 1 || atomic.LoadInt32(&liveHits) != 0 {
+		t.Errorf("POST should not be resent after reaching an upstream: err=%v broken=%d live=%d", err, brokenHits, liveHits)
+	}
+	if resp, _, _ := runUpstream(t, manager, target.URL+"/f"); resp.Header.Get("X-ProxyWoman-Upstream") != "live" {
+		t.Errorf("GET should fail over to live upstream, got %q", resp.Header.Get("X-ProxyWoman-Upstream"))
+	}
+
+	// 连接上游失败时请求还没有发出，POST同样切换到下一个上游
+	group.ProxyIDs = []string{"dead", "live"}
+	manager.UpdateGroup(group)
+	atomic.StoreInt32(&liveHits, 0)
+	if err := post(); err != nil || atomic.LoadInt32(&liveHits) != 1 {
+		t.Errorf("POST should fail over when the upstream is unreachable: err=%v live=%d", err, liveHits)
+	}
+}
+
+func TestUpstreamEjectedProxyIsNotBypassed(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadURL := "http://" + dead.Addr().String()
+	dead.Close()
+
+	manager := NewUpstreamManager(nil)
+	manager.AddProxy(&UpstreamProxy{ID: "dead", Name: "dead", ProxyURL: deadURL, URLPattern: target.URL, Enabled: true})
+	manager.healthConfig = HealthCheckConfig{TimeoutSeconds: 1, FailureThreshold: 1}
+	manager.CheckAllProxies()
+	if manager.IsHealthy("dead") {
+		t.Fatal("expected dead upstream to be ejected")
+	}
+
+	// 被剔除的上游仍然是匹配规则的上游，请求失败而不是直接连接目标
+	req, _ := http.NewRequest(http.MethodGet, target.URL+"/secret", nil)
+	transport, err := manager.Transport(proxycore.NewFlow("flow_ejected", req), req)
+	if err != nil || transport == nil {
+		t.Fatalf("request matching an ejected upstream should not go direct: transport=%v err=%v", transport, err)
+	}
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Error("expected request through the ejected upstream to fail")
+	}
+}
+
+func TestUpstreamGroupFailoverAndHealthCheck(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+
+	var hits int32
+	live := newTestHTTPProxy(t, &hits)
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadURL := "http://" + dead.Addr().String()
+	dead.Close()
+
+	manager := NewUpstreamManager(nil)
+	manager.AddProxy(&UpstreamProxy{ID: "dead", Name: "dead", ProxyURL: deadURL, URLPattern: "unused.invalid", Enabled: true})
+	manager.AddProxy(&UpstreamProxy{ID: "live", Name: "live", ProxyURL: live.URL, URLPattern: "unused.invalid", Enabled: true})
+	manager.AddGroup(&UpstreamGroup{
+		ID: "pool", URLPattern: target.URL, Enabled: true,
+		Strategy: StrategyFailover, ProxyIDs: []string{"dead", "live"},
+	})
+
+	resp, _, _ := runUpstream(t, manager, target.URL+"/f")
+	if resp.Header.Get("X-ProxyWoman-Upstream") != "live" {
+		t.Errorf("expected failover to live upstream, got %q", resp.Header.Get("X-ProxyWoman-Upstream"))
+	}
+
+	// 针对本地目标的健康检查，失败一次即剔除
+	manager.healthConfig = HealthCheckConfig{TargetURL: target.URL, TimeoutSeconds: 2, FailureThreshold: 1}
+	manager.CheckAllProxies()
+	if manager.IsHealthy("dead") || !manager.IsHealthy("live") {
+		t.Fatalf("unexpected health: %+v", manager.GetHealth())
+	}
+	if err := manager.TestUpstreamProxy("live"); err != nil {
+		t.Errorf("expected live upstream to pass test: %v", err)
+	}
+
+	// 被剔除的上游不再被优先尝试
+	before := manager.GetProxyStats("dead")["errors"].(int64)
+	runUpstream(t, manager, target.URL+"/f")
+	if after := manager.GetProxyStats("dead")["errors"].(int64); after != before {
+		t.Errorf("ejected upstream should not be tried first, errors %d -> %d", before, after)
+	}
+}
+
+// TestUpstreamTunnelDialsThroughProxy 不解密的隧道同样按规则经HTTP（CONNECT）或SOCKS5上游建立
+func TestUpstreamTunnelDialsThroughProxy(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go pipeAndClose(conn, conn)
+		}
+	}()
+	target := echo.Addr().String()
+
+	var httpHits, socksHits int32
+	httpUpstream := newTestHTTPProxy(t, &httpHits)
+	socksAddr := newTestSOCKS5Proxy(t, "bob", "secret", &socksHits)
+
+	for _, proxy := range []*UpstreamProxy{
+		{ID: "http", Name: "corp", ProxyURL: httpUpstream.URL, URLPattern: "tcp://" + target, Enabled: true},
+		{ID: "socks", Name: "socks", ProxyURL: "socks5://" + socksAddr, URLPattern: "tcp://" + target, Enabled: true,
+			Username: "bob", Password: "secret"},
+	} {
+		manager := NewUpstreamManager(nil)
+		manager.AddProxy(proxy)
+
+		flow := proxycore.NewTunnelFlow("flow_tunnel", "127.0.0.1:1", target)
+		conn, err := manager.DialTunnel(context.Background(), flow, target)
+		if err != nil || conn == nil {
+			t.Fatalf("%s: expected tunnel through upstream, got conn=%v err=%v", proxy.ID, conn, err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.Write([]byte("PING"))
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "PING" {
+			t.Errorf("%s: unexpected echo %q: %v", proxy.ID, buf, err)
+		}
+		conn.Close()
+
+		if !slices.Contains(flow.Tags, "upstream-"+proxy.Name) {
+			t.Errorf("%s: flow not tagged with upstream: %v", proxy.ID, flow.Tags)
+		}
+		if stats := manager.GetProxyStats(proxy.ID); stats["success"] != int64(1) {
+			t.Errorf("%s: expected one successful tunnel in stats, got %v", proxy.ID, stats)
+		}
+	}
+	if atomic.LoadInt32(&httpHits) != 1 || atomic.LoadInt32(&socksHits) != 1 {
+		t.Errorf("expected one tunnel through each upstream, got http=%d socks=%d", httpHits, socksHits)
+	}
+
+	manager := NewUpstreamManager(nil)
+	conn, err := manager.DialTunnel(context.Background(), proxycore.NewTunnelFlow("flow_direct", "127.0.0.1:1", target), target)
+	if conn != nil || err != nil {
+		t.Errorf("expected direct connection without matching upstream, got conn=%v err=%v", conn, err)
+	}
+}
+
+// memoryUpstreamStorage 内存中的上游代理和代理组存储
+type memoryUpstreamStorage struct {
+	proxies map[string]UpstreamProxy
+	groups  map[string]UpstreamGroup
+}
+
+func (m *memoryUpstreamStorage) SaveUpstreamProxy(proxy *UpstreamProxy) error {
+	m.proxies[proxy.ID] = *proxy
+	return nil
+}
+
+func (m *memoryUpstreamStorage) GetUpstreamProxies() ([]*UpstreamProxy, error) {
+	var proxies []*UpstreamProxy
+	for _, proxy := range m.proxies {
+		proxy := proxy
+		proxies = append(proxies, &proxy)
+	}
+	return proxies, nil
+}
+
+func (m *memoryUpstreamStorage) DeleteUpstreamProxy(id string) error {
+	delete(m.proxies, id)
+	return nil
+}
+
+func (m *memoryUpstreamStorage) SaveUpstreamGroup(group *UpstreamGroup) error {
+	m.groups[group.ID] = *group
+	return nil
+}
+
+func (m *memoryUpstreamStorage) GetUpstreamGroups() ([]*UpstreamGroup, error) {
+	var groups []*UpstreamGroup
+	for _, group := range m.groups {
+		group := group
+		groups = append(groups, &group)
+	}
+	return groups, nil
+}
+
+func (m *memoryUpstreamStorage) DeleteUpstreamGroup(id string) error {
+	delete(m.groups, id)
+	return nil
+}
+
+// TestUpstreamGroupsPersist 代理组及其引用的上游代理重新加载后仍然生效
+func TestUpstreamGroupsPersist(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+
+	var hits int32
+	upstream := newTestHTTPProxy(t, &hits)
+
+	storage := &memoryUpstreamStorage{proxies: make(map[string]UpstreamProxy), groups: make(map[string]UpstreamGroup)}
+	manager := NewUpstreamManager(storage)
+	manager.AddProxy(&UpstreamProxy{ID: "a", Name: "a", ProxyURL: upstream.URL, URLPattern: "unused.example", Enabled: true})
+	manager.AddProxy(&UpstreamProxy{ID: "b", Name: "b", ProxyURL: "http://127.0.0.1:1", Enabled: true})
+	manager.RemoveProxy("b")
+	manager.AddGroup(&UpstreamGroup{ID: "g", Name: "group", URLPattern: target.URL, Enabled: true, ProxyIDs: []string{"a"}})
+	manager.AddGroup(&UpstreamGroup{ID: "old", Name: "old", Enabled: true, ProxyIDs: []string{"a"}})
+	manager.RemoveGroup("old")
+
+	reloaded := NewUpstreamManager(storage)
+	if proxies := reloaded.GetAllProxies(); len(proxies) != 1 || proxies[0].ID != "a" {
+		t.Fatalf("unexpected proxies after reload: %+v", proxies)
+	}
+	if groups := reloaded.GetAllGroups(); len(groups) != 1 || groups[0].ID != "g" || groups[0].Strategy != StrategyFailover {
+		t.Fatalf("unexpected groups after reload: %+v", groups)
+	}
+
+	_, body, flow := runUpstream(t, reloaded, target.URL+"/")
+	if body != "ok" || !flow.HasTag("upstream-a") || atomic.LoadInt32(&hits) != 1 {
+		t.Errorf("expected request through reloaded group: body=%q tags=%v hits=%d", body, flow.Tags, hits)
+	}
+}
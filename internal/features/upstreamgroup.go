@@ -0,0 +1,424 @@
+package features
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 上游代理组负载均衡策略
+const (
+	StrategyRoundRobin   = "round-robin"   // 轮询
+	StrategyLeastLatency = "least-latency" // 最低延迟优先
+	StrategyFailover     = "failover"      // 按配置顺序，前一个失败时切换下一个
+)
+
+// UpstreamGroup 上游代理组，匹配的请求按策略在组内多个上游之间分配，失败时自动切换
+type UpstreamGroup struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	URLPattern  string   `json:"urlPattern"` // 匹配的URL模式，为空时匹配所有请求
+	IsRegex     bool     `json:"isRegex"`
+	Enabled     bool     `json:"enabled"`
+	Strategy    string   `json:"strategy"`
+	ProxyIDs    []string `json:"proxyIds"` // 组内上游代理ID，failover策略按此顺序尝试
+	Description string   `json:"description"`
+}
+
+// HealthCheckConfig 上游代理健康检查配置
+type HealthCheckConfig struct {
+	Enabled bool `json:"enabled"`
+	// TargetURL 通过上游请求的检查目标（建议使用本地或内网地址），为空时只检查代理端口是否可连接
+	TargetURL        string `json:"targetUrl"`
+	IntervalSeconds  int    `json:"intervalSeconds"`
+	TimeoutSeconds   int    `json:"timeoutSeconds"`
+	FailureThreshold int    `json:"failureThreshold"` // 连续失败多少次后剔除
+}
+
+// UpstreamHealth 上游代理健康状态
+type UpstreamHealth struct {
+	ProxyID             string    `json:"proxyId"`
+	Healthy             bool      `json:"healthy"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LastCheck           time.Time `json:"lastCheck"`
+	LastLatencyMs       float64   `json:"lastLatencyMs"`
+	LastError           string    `json:"lastError,omitempty"`
+}
+
+// AddGroup 添加上游代理组
+func (um *UpstreamManager) AddGroup(group *UpstreamGroup) error {
+	if err := validateUpstreamGroup(group); err != nil {
+		return err
+	}
+
+	um.groupsMutex.Lock()
+	defer um.groupsMutex.Unlock()
+
+	if _, exists := um.groups[group.ID]; exists {
+		return fmt.Errorf("group already exists: %s", group.ID)
+	}
+	if um.storage != nil {
+		if err := um.storage.SaveUpstreamGroup(group); err != nil {
+			return fmt.Errorf("failed to save upstream group: %v", err)
+		}
+	}
+	um.groups[group.ID] = group
+	um.rrCounters[group.ID] = new(uint64)
+	return nil
+}
+
+// UpdateGroup 更新上游代理组
+func (um *UpstreamManager) UpdateGroup(group *UpstreamGroup) error {
+	if err := validateUpstreamGroup(group); err != nil {
+		return err
+	}
+
+	um.groupsMutex.Lock()
+	defer um.groupsMutex.Unlock()
+
+	if _, exists := um.groups[group.ID]; !exists {
+		return fmt.Errorf("group not found: %s", group.ID)
+	}
+	if um.storage != nil {
+		if err := um.storage.SaveUpstreamGroup(group); err != nil {
+			return fmt.Errorf("failed to save upstream group: %v", err)
+		}
+	}
+	um.groups[group.ID] = group
+	return nil
+}
+
+// RemoveGroup 删除上游代理组
+func (um *UpstreamManager) RemoveGroup(groupID string) error {
+	um.groupsMutex.Lock()
+	defer um.groupsMutex.Unlock()
+
+	if um.storage != nil {
+		if err := um.storage.DeleteUpstreamGroup(groupID); err != nil {
+			return fmt.Errorf("failed to delete upstream group: %v", err)
+		}
+	}
+	delete(um.groups, groupID)
+	delete(um.rrCounters, groupID)
+	return nil
+}
+
+// GetAllGroups 获取所有上游代理组
+func (um *UpstreamManager) GetAllGroups() []*UpstreamGroup {
+	um.groupsMutex.RLock()
+	defer um.groupsMutex.RUnlock()
+
+	groups := make([]*UpstreamGroup, 0, len(um.groups))
+	for _, group := range um.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups
+}
+
+// validateUpstreamGroup 校验上游代理组配置
+func validateUpstreamGroup(group *UpstreamGroup) error {
+	if group.ID == "" {
+		return fmt.Errorf("group ID is required")
+	}
+	if len(group.ProxyIDs) == 0 {
+		return fmt.Errorf("group %s has no upstream proxies", group.ID)
+	}
+	switch group.Strategy {
+	case "":
+		group.Strategy = StrategyFailover
+	case StrategyRoundRobin, StrategyLeastLatency, StrategyFailover:
+	default:
+		return fmt.Errorf("unknown group strategy: %s", group.Strategy)
+	}
+	if group.IsRegex {
+		if _, err := regexp.Compile(group.URLPattern); err != nil {
+			return fmt.Errorf("invalid URL pattern: %v", err)
+		}
+	}
+	return nil
+}
+
+// groupRoutes 获取匹配的代理组的上游路由。
+// 健康的上游按策略排序在前，被剔除的上游排在最后，仅在其他上游都失败时尝试
+func (um *UpstreamManager) groupRoutes(targetURL string) []upstreamRoute {
+	for _, group := range um.GetAllGroups() {
+		if !group.Enabled {
+			continue
+		}
+		if matched, err := matchUpstreamPattern(targetURL, group.URLPattern, group.IsRegex); err != nil || !matched {
+			continue
+		}
+
+		var healthy, ejected []upstreamRoute
+		um.proxiesMutex.RLock()
+		for _, proxyID := range group.ProxyIDs {
+			proxy, exists := um.proxies[proxyID]
+			client := um.clients[proxyID]
+			if !exists || client == nil || !proxy.Enabled {
+				continue
+			}
+			route := upstreamRoute{id: proxy.ID, name: proxy.Name, client: client}
+			if um.IsHealthy(proxy.ID) {
+				healthy = append(healthy, route)
+			} else {
+				ejected = append(ejected, route)
+			}
+		}
+		um.proxiesMutex.RUnlock()
+
+		if len(healthy)+len(ejected) == 0 {
+			continue
+		}
+		return append(um.orderRoutes(group, healthy), ejected...)
+	}
+	return nil
+}
+
+// orderRoutes 按组策略排列上游路由
+func (um *UpstreamManager) orderRoutes(group *UpstreamGroup, routes []upstreamRoute) []upstreamRoute {
+	if len(routes) < 2 {
+		return routes
+	}
+
+	switch group.Strategy {
+	case StrategyRoundRobin:
+		um.groupsMutex.RLock()
+		counter := um.rrCounters[group.ID]
+		um.groupsMutex.RUnlock()
+		if counter == nil {
+			return routes
+		}
+		start := int((atomic.AddUint64(counter, 1) - 1) % uint64(len(routes)))
+		ordered := make([]upstreamRoute, 0, len(routes))
+		ordered = append(ordered, routes[start:]...)
+		return append(ordered, routes[:start]...)
+
+	case StrategyLeastLatency:
+		latencies := make(map[string]float64, len(routes))
+		um.statsMutex.Lock()
+		for _, route := range routes {
+			// 尚无样本的上游延迟视为0，优先尝试以获得样本
+			if stats, exists := um.stats[route.id]; exists {
+				latencies[route.id] = stats.p50
+			}
+		}
+		um.statsMutex.Unlock()
+		sort.SliceStable(routes, func(i, j int) bool {
+			return latencies[routes[i].id] < latencies[routes[j].id]
+		})
+	}
+	return routes
+}
+
+// IsHealthy 上游代理是否健康，未检查过的上游视为健康
+func (um *UpstreamManager) IsHealthy(proxyID string) bool {
+	um.healthMutex.RLock()
+	defer um.healthMutex.RUnlock()
+
+	health, exists := um.health[proxyID]
+	return !exists || health.Healthy
+}
+
+// GetHealth 获取所有上游代理的健康状态
+func (um *UpstreamManager) GetHealth() []UpstreamHealth {
+	um.healthMutex.RLock()
+	defer um.healthMutex.RUnlock()
+
+	result := make([]UpstreamHealth, 0, len(um.health))
+	for _, health := range um.health {
+		result = append(result, *health)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ProxyID < result[j].ProxyID })
+	return result
+}
+
+// updateHealth 根据一次检查或请求的结果更新健康状态。
+// 连续失败达到阈值时剔除上游，成功一次即恢复。
+// 被动结果（普通请求）只在启用健康检查时参与剔除，以保证被剔除的上游能被主动检查恢复
+func (um *UpstreamManager) updateHealth(proxyID string, latency time.Duration, err error, active bool) {
+	um.proxiesMutex.RLock()
+	_, exists := um.proxies[proxyID]
+	um.proxiesMutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	um.healthMutex.Lock()
+	defer um.healthMutex.Unlock()
+
+	if !active && !um.healthConfig.Enabled {
+		return
+	}
+
+	health, exists := um.health[proxyID]
+	if !exists {
+		health = &UpstreamHealth{ProxyID: proxyID, Healthy: true}
+		um.health[proxyID] = health
+	}
+	if active {
+		health.LastCheck = time.Now()
+	}
+
+	if err != nil {
+		health.ConsecutiveFailures++
+		health.LastError = err.Error()
+		threshold := um.healthConfig.FailureThreshold
+		if threshold <= 0 {
+			threshold = 1
+		}
+		if health.Healthy && health.ConsecutiveFailures >= threshold {
+			health.Healthy = false
+			fmt.Printf("Upstream %s ejected after %d failures: %v\n", proxyID, health.ConsecutiveFailures, err)
+		}
+		return
+	}
+
+	if !health.Healthy {
+		fmt.Printf("Upstream %s is healthy again\n", proxyID)
+	}
+	health.Healthy = true
+	health.ConsecutiveFailures = 0
+	health.LastError = ""
+	health.LastLatencyMs = float64(latency.Microseconds()) / 1000
+}
+
+// SetHealthCheckConfig 设置健康检查配置，启用时（重新）启动周期检查
+func (um *UpstreamManager) SetHealthCheckConfig(config HealthCheckConfig) error {
+	if config.TargetURL != "" {
+		if _, err := url.ParseRequestURI(config.TargetURL); err != nil {
+			return fmt.Errorf("invalid health check target: %v", err)
+		}
+	}
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = 30
+	}
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = 5
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 3
+	}
+
+	um.StopHealthChecks()
+
+	um.healthMutex.Lock()
+	um.healthConfig = config
+	if config.Enabled {
+		stop := make(chan struct{})
+		um.healthStop = stop
+		go um.healthCheckLoop(config, stop)
+	}
+	um.healthMutex.Unlock()
+	return nil
+}
+
+// GetHealthCheckConfig 获取健康检查配置
+func (um *UpstreamManager) GetHealthCheckConfig() HealthCheckConfig {
+	um.healthMutex.RLock()
+	defer um.healthMutex.RUnlock()
+	return um.healthConfig
+}
+
+// StopHealthChecks 停止周期健康检查
+func (um *UpstreamManager) StopHealthChecks() {
+	um.healthMutex.Lock()
+	defer um.healthMutex.Unlock()
+
+	if um.healthStop != nil {
+		close(um.healthStop)
+		um.healthStop = nil
+	}
+}
+
+// healthCheckLoop 周期检查所有启用的上游代理
+func (um *UpstreamManager) healthCheckLoop(config HealthCheckConfig, stop chan struct{}) {
+	ticker := time.NewTicker(time.Duration(config.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	um.CheckAllProxies()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			um.CheckAllProxies()
+		}
+	}
+}
+
+// CheckAllProxies 立即并发检查所有启用的上游代理
+func (um *UpstreamManager) CheckAllProxies() {
+	type target struct {
+		proxy  *UpstreamProxy
+		client *http.Client
+	}
+
+	um.proxiesMutex.RLock()
+	targets := make([]target, 0, len(um.proxies))
+	for id, proxy := range um.proxies {
+		if proxy.Enabled && um.clients[id] != nil {
+			targets = append(targets, target{proxy: proxy, client: um.clients[id]})
+		}
+	}
+	um.proxiesMutex.RUnlock()
+
+	config := um.GetHealthCheckConfig()
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t target) {
+			defer wg.Done()
+			latency, err := um.probe(t.proxy, t.client, config)
+			um.updateHealth(t.proxy.ID, latency, err, true)
+		}(t)
+	}
+	wg.Wait()
+}
+
+// probe 检查单个上游代理：有检查目标时经上游请求目标，否则连接代理端口
+func (um *UpstreamManager) probe(proxy *UpstreamProxy, client *http.Client, config HealthCheckConfig) (time.Duration, error) {
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	startTime := time.Now()
+
+	if config.TargetURL == "" {
+		proxyURL, err := url.Parse(proxy.ProxyURL)
+		if err != nil {
+			return 0, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+		conn, err := net.DialTimeout("tcp", proxyURL.Host, timeout)
+		if err != nil {
+			return 0, fmt.Errorf("proxy unreachable: %v", err)
+		}
+		conn.Close()
+		return time.Since(startTime), nil
+	}
+
+	testClient := &http.Client{
+		Transport:     client.Transport,
+		Timeout:       timeout,
+		CheckRedirect: client.CheckRedirect,
+	}
+	resp, err := testClient.Get(config.TargetURL)
+	if err != nil {
+		return 0, fmt.Errorf("health check request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return 0, fmt.Errorf("health check returned status: %d", resp.StatusCode)
+	}
+	return time.Since(startTime), nil
+}
@@ -0,0 +1,148 @@
+package features
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// urlMatcher 编译后的URL模式，供Map Local、Map Remote等按URL映射的规则共用。
+//
+// 模式有三种写法：
+//   - 正则（isRegex）：捕获组可在目标中以 $1、${1} 或 ${name} 引用
+//   - 通配符：包含 * 的普通模式，整体匹配URL（未写协议时匹配任意协议），每个 * 依次成为一个捕获组
+//   - 普通字符串：URL包含该字符串即匹配
+type urlMatcher struct {
+	pattern  string
+	regex    *regexp.Regexp
+	wildcard bool
+}
+
+// urlMatch URL匹配结果
+type urlMatch struct {
+	groups []string          // groups[0]为整体匹配的文本，其后为各捕获组
+	named  map[string]string // 正则的命名捕获组
+	rest   string            // URL中匹配部分之后的剩余内容
+}
+
+var (
+	urlMatcherCache      = make(map[string]*urlMatcher)
+	urlMatcherCacheMutex sync.RWMutex
+)
+
+// compileURLPattern 编译URL模式，结果按模式缓存
+func compileURLPattern(pattern string, isRegex bool) (*urlMatcher, error) {
+	key := strconv.FormatBool(isRegex) + ":" + pattern
+
+	urlMatcherCacheMutex.RLock()
+	matcher, cached := urlMatcherCache[key]
+	urlMatcherCacheMutex.RUnlock()
+	if cached {
+		return matcher, nil
+	}
+
+	matcher = &urlMatcher{pattern: pattern}
+	switch {
+	case isRegex:
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		matcher.regex = regex
+	case strings.Contains(pattern, "*"):
+		parts := strings.Split(pattern, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		prefix := "^"
+		if !strings.Contains(pattern, "://") {
+			// 未写协议的模式匹配任意协议，如 api.example.com/v2/*
+			prefix = "^(?:[a-zA-Z][a-zA-Z0-9+.-]*://)?"
+		}
+		matcher.regex = regexp.MustCompile(prefix + strings.Join(parts, "(.*)") + "$")
+		matcher.wildcard = true
+	}
+
+	urlMatcherCacheMutex.Lock()
+	urlMatcherCache[key] = matcher
+	urlMatcherCacheMutex.Unlock()
+	return matcher, nil
+}
+
+// match 匹配URL，不匹配时返回nil
+func (m *urlMatcher) match(url string) *urlMatch {
+	if m.regex == nil {
+		index := strings.Index(url, m.pattern)
+		if index < 0 {
+			return nil
+		}
+		return &urlMatch{groups: []string{m.pattern}, rest: url[index+len(m.pattern):]}
+	}
+
+	indexes := m.regex.FindStringSubmatchIndex(url)
+	if indexes == nil {
+		return nil
+	}
+
+	result := &urlMatch{rest: url[indexes[1]:], named: make(map[string]string)}
+	for i := 0; i < len(indexes); i += 2 {
+		group := ""
+		if indexes[i] >= 0 {
+			group = url[indexes[i]:indexes[i+1]]
+		}
+		result.groups = append(result.groups, group)
+	}
+	for i, name := range m.regex.SubexpNames() {
+		if name != "" {
+			result.named[name] = result.groups[i]
+		}
+	}
+	return result
+}
+
+// placeholderPattern 目标中的捕获组引用：$1、${1}、${name}
+var placeholderPattern = regexp.MustCompile(`\$(\d+)|\$\{(\w+)\}`)
+
+// expand 将捕获组代入目标模板。通配符模式下目标中的 * 依次替换为各通配部分。
+// 返回代入后的结果及模板中是否包含引用
+func (m *urlMatch) expand(template string, wildcard bool) (string, bool) {
+	used := false
+	result := placeholderPattern.ReplaceAllStringFunc(template, func(ref string) string {
+		used = true
+		parts := placeholderPattern.FindStringSubmatch(ref)
+		name := parts[1] + parts[2]
+		if index, err := strconv.Atoi(name); err == nil {
+			if index < len(m.groups) {
+				return m.groups[index]
+			}
+			return ""
+		}
+		return m.named[name]
+	})
+
+	if wildcard && strings.Contains(result, "*") {
+		used = true
+		next := 1
+		var builder strings.Builder
+		for _, r := range result {
+			if r == '*' && next < len(m.groups) {
+				builder.WriteString(m.groups[next])
+				next++
+				continue
+			}
+			builder.WriteRune(r)
+		}
+		result = builder.String()
+	}
+	return result, used
+}
+
+// suffix 模板未引用捕获组时追加到目标后的URL部分：
+// 优先使用匹配之后的剩余内容，没有剩余时使用最后一个捕获组
+func (m *urlMatch) suffix() string {
+	if m.rest != "" || len(m.groups) < 2 {
+		return m.rest
+	}
+	return m.groups[len(m.groups)-1]
+}
@@ -67,6 +67,19 @@ func (rd *ResponseDecoder) DecodeResponse(response *FlowResponse) error {
 	return nil
 }
 
+// DecompressBody 按Content-Encoding解压消息体，未压缩时原样返回
+func DecompressBody(body []byte, encoding string) ([]byte, error) {
+	rd := NewResponseDecoder()
+	switch encoding = strings.ToLower(strings.TrimSpace(encoding)); encoding {
+	case "", "identity":
+		return body, nil
+	case "gzip", "deflate", "br":
+		return rd.decompressBody(body, encoding)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
+
 // decompressBody 解压响应体
 func (rd *ResponseDecoder) decompressBody(body []byte, encoding string) ([]byte, error) {
 	switch encoding {
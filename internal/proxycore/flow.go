@@ -1,8 +1,10 @@
 package proxycore
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -15,39 +17,57 @@ type ScriptExecution struct {
 	Error      string    `json:"error,omitempty"`
 	Logs       []string  `json:"logs"`
 	ExecutedAt time.Time `json:"executedAt"`
+	DurationMs float64   `json:"durationMs"`       // 执行耗时（毫秒）
+	Action     string    `json:"action,omitempty"` // "stop"或"respond"：脚本结束了执行链
+}
+
+// BreakpointRecord 断点操作记录
+type BreakpointRecord struct {
+	RuleID   string    `json:"ruleId"`
+	RuleName string    `json:"ruleName"`
+	Phase    string    `json:"phase"`  // "request" or "response"
+	Action   string    `json:"action"` // "resume", "respond", "abort", "delay", "timeout"
+	Edited   bool      `json:"edited"`
+	DelayMs  int       `json:"delayMs,omitempty"`
+	HeldMs   int64     `json:"heldMs"` // 暂停时长
+	At       time.Time `json:"at"`
 }
 
 // Flow 表示一个完整的HTTP请求/响应流
 type Flow struct {
-	ID               string            `json:"id"`
-	URL              string            `json:"url"`
-	Method           string            `json:"method"`
-	StatusCode       int               `json:"statusCode"`
-	Client           string            `json:"client"`
-	Domain           string            `json:"domain"`
-	Path             string            `json:"path"`
-	Scheme           string            `json:"scheme"`
-	StartTime        time.Time         `json:"startTime"`
-	EndTime          time.Time         `json:"endTime"`
-	Duration         time.Duration     `json:"duration"`
-	RequestSize      int64             `json:"requestSize"`
-	ResponseSize     int64             `json:"responseSize"`
-	Request          *FlowRequest      `json:"request"`
-	Response         *FlowResponse     `json:"response"`
-	IsPinned         bool              `json:"isPinned"`
-	IsBlocked        bool              `json:"isBlocked"`
-	ContentType      string            `json:"contentType"`
-	Tags             []string          `json:"tags"`
-	ScriptExecutions []ScriptExecution `json:"scriptExecutions,omitempty"`
+	ID                string             `json:"id"`
+	URL               string             `json:"url"`
+	MappedURL         string             `json:"mappedUrl,omitempty"`      // Map Remote改写后实际请求的URL
+	NetworkProfile    string             `json:"networkProfile,omitempty"` // 应用的网络条件模拟配置
+	Method            string             `json:"method"`
+	StatusCode        int                `json:"statusCode"`
+	Client            string             `json:"client"`
+	Domain            string             `json:"domain"`
+	Path              string             `json:"path"`
+	Scheme            string             `json:"scheme"`
+	StartTime         time.Time          `json:"startTime"`
+	EndTime           time.Time          `json:"endTime"`
+	Duration          time.Duration      `json:"duration"`
+	RequestSize       int64              `json:"requestSize"`
+	ResponseSize      int64              `json:"responseSize"`
+	Request           *FlowRequest       `json:"request"`
+	Response          *FlowResponse      `json:"response"`
+	IsPinned          bool               `json:"isPinned"`
+	IsBlocked         bool               `json:"isBlocked"`
+	ContentType       string             `json:"contentType"`
+	Tags              []string           `json:"tags"`
+	ScriptExecutions  []ScriptExecution  `json:"scriptExecutions,omitempty"`
+	BreakpointActions []BreakpointRecord `json:"breakpointActions,omitempty"`
 }
 
 // FlowRequest 表示HTTP请求
 type FlowRequest struct {
-	Method  string            `json:"method"`
-	URL     string            `json:"url"`
-	Headers map[string]string `json:"headers"`
-	Body    []byte            `json:"body"`
-	Raw     string            `json:"raw"`
+	Method       string            `json:"method"`
+	URL          string            `json:"url"`
+	Headers      map[string]string `json:"headers"`
+	HeaderValues http.Header       `json:"-"` // 全部头部值，Headers只保留每个头部的第一个值
+	Body         []byte            `json:"body"`
+	Raw          string            `json:"raw"`
 }
 
 // FlowResponse 表示HTTP响应
@@ -55,6 +75,7 @@ type FlowResponse struct {
 	StatusCode    int               `json:"statusCode"`
 	Status        string            `json:"status"`
 	Headers       map[string]string `json:"headers"`
+	HeaderValues  http.Header       `json:"-"`             // 全部头部值，Headers只保留每个头部的第一个值
 	Body          []byte            `json:"body"`          // 原始响应体
 	DecodedBody   string            `json:"decodedBody"`   // 解码后的响应体（Base64编码）
 	TextContent   string            `json:"textContent"`   // 文本内容（用于文档类型）
@@ -86,9 +107,10 @@ func NewFlow(id string, req *http.Request) *Flow {
 		StartTime: time.Now(),
 		Tags:      make([]string, 0),
 		Request: &FlowRequest{
-			Method:  req.Method,
-			URL:     req.URL.String(),
-			Headers: make(map[string]string),
+			Method:       req.Method,
+			URL:          req.URL.String(),
+			Headers:      make(map[string]string),
+			HeaderValues: req.Header.Clone(),
 		},
 	}
 
@@ -107,6 +129,84 @@ func NewFlow(id string, req *http.Request) *Flow {
 	return flow
 }
 
+// NewConnectFlow 创建CONNECT请求的Flow对象，用于记录未建立隧道的CONNECT（如被拦截器拒绝）
+func NewConnectFlow(id string, req *http.Request) *Flow {
+	target := req.Host
+	if target == "" {
+		target = req.URL.Host
+	}
+	// 与解密后请求的URL保持一致，省略默认端口
+	connectURL := "https://" + strings.TrimSuffix(target, ":443")
+	flow := &Flow{
+		ID:        id,
+		URL:       connectURL,
+		Method:    http.MethodConnect,
+		Client:    req.RemoteAddr,
+		Domain:    target,
+		Scheme:    "https",
+		StartTime: time.Now(),
+		Tags:      []string{"connect"},
+		Request: &FlowRequest{
+			Method:  http.MethodConnect,
+			URL:     connectURL,
+			Headers: make(map[string]string),
+		},
+	}
+	for name, values := range req.Header {
+		if len(values) > 0 {
+			flow.Request.Headers[name] = values[0]
+		}
+	}
+	return flow
+}
+
+// NewTunnelFlow 创建原始TCP隧道的Flow对象（无法识别为HTTP/TLS的流量）
+func NewTunnelFlow(id, client, target string) *Flow {
+	tunnelURL := "tcp://" + target
+	return &Flow{
+		ID:        id,
+		URL:       tunnelURL,
+		Method:    "TCP",
+		Client:    client,
+		Domain:    target,
+		Scheme:    "tcp",
+		StartTime: time.Now(),
+		Tags:      []string{"raw-tcp"},
+		Request: &FlowRequest{
+			Method:  "TCP",
+			URL:     tunnelURL,
+			Headers: make(map[string]string),
+		},
+	}
+}
+
+// flowTagsKey 请求上下文中Flow标签的键
+type flowTagsKey struct{}
+
+// withFlowTags 在上下文中附加Flow标签，handleHTTP创建Flow时会自动添加
+func withFlowTags(ctx context.Context, tags ...string) context.Context {
+	if len(tags) == 0 {
+		return ctx
+	}
+	tags = append(flowTagsFromContext(ctx), tags...)
+	return context.WithValue(ctx, flowTagsKey{}, tags)
+}
+
+// tunnelKey 请求上下文中标记请求来自隧道的键
+type tunnelKey struct{}
+
+// InTunnel 请求是否来自HTTPS CONNECT或SOCKS5隧道，这类请求在隧道建立前已经过CONNECT拦截器
+func InTunnel(r *http.Request) bool {
+	tunnel, _ := r.Context().Value(tunnelKey{}).(bool)
+	return tunnel
+}
+
+// flowTagsFromContext 获取上下文中附加的Flow标签
+func flowTagsFromContext(ctx context.Context) []string {
+	tags, _ := ctx.Value(flowTagsKey{}).([]string)
+	return append([]string(nil), tags...)
+}
+
 // SetResponse 设置响应信息
 func (f *Flow) SetResponse(resp *http.Response, body []byte) {
 	f.EndTime = time.Now()
@@ -115,10 +215,11 @@ func (f *Flow) SetResponse(resp *http.Response, body []byte) {
 	f.ResponseSize = int64(len(body))
 
 	f.Response = &FlowResponse{
-		StatusCode: resp.StatusCode,
-		Status:     resp.Status,
-		Headers:    make(map[string]string),
-		Body:       body,
+		StatusCode:   resp.StatusCode,
+		Status:       resp.Status,
+		Headers:      make(map[string]string),
+		HeaderValues: resp.Header.Clone(),
+		Body:         body,
 	}
 
 	// 复制响应头
@@ -151,6 +252,16 @@ func (f *Flow) AddTag(tag string) {
 	f.Tags = append(f.Tags, tag)
 }
 
+// HasTag 是否包含标签
+func (f *Flow) HasTag(tag string) bool {
+	for _, existingTag := range f.Tags {
+		if existingTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
 // RemoveTag 移除标签
 func (f *Flow) RemoveTag(tag string) {
 	for i, existingTag := range f.Tags {
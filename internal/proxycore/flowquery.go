@@ -0,0 +1,493 @@
+package proxycore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FlowQuery 编译后的流量查询表达式。
+//
+// 语法：多个条件以空格分隔表示同时满足，支持 or / || 、not / ! 和括号。
+// 条件形如 字段 操作符 值，例如：
+//
+//	method:POST host:api.example.com status:4xx
+//	status>=500 or size>100000
+//	header.X-Debug=1 json.user.id=42 resjson.data.ok=true
+//	!tag:mocked url~"/v[0-9]+/login"
+//
+// 字段：method url host path scheme tag contenttype status size reqsize duration
+// body resbody header.<名称> resheader.<名称> json.<路径> resjson.<路径>；
+// 操作符：`:` 包含（数值字段支持 4xx、200-299 这样的模式）、`=` 等于、`!=` 不等于、
+// `~` 正则、`>` `>=` `<` `<=` 数值比较。不带操作符的单词按URL包含匹配
+type FlowQuery struct {
+	source string
+	root   queryNode
+}
+
+// queryNode 查询语法树节点
+type queryNode interface {
+	match(flow *Flow) bool
+}
+
+type andNode struct{ left, right queryNode }
+type orNode struct{ left, right queryNode }
+type notNode struct{ inner queryNode }
+
+func (n *andNode) match(flow *Flow) bool { return n.left.match(flow) && n.right.match(flow) }
+func (n *orNode) match(flow *Flow) bool  { return n.left.match(flow) || n.right.match(flow) }
+func (n *notNode) match(flow *Flow) bool { return !n.inner.match(flow) }
+
+// termNode 单个条件
+type termNode struct {
+	field string
+	key   string // header/json字段的名称或路径
+	op    string
+	value string
+	regex *regexp.Regexp
+}
+
+// queryTermPattern 条件的格式：字段[.名称]操作符值
+var queryTermPattern = regexp.MustCompile(`^([a-zA-Z]+)(?:\.([^:=!<>~]+))?(!=|>=|<=|:|=|~|>|<)(.*)$`)
+
+// numericQueryFields 数值字段
+var numericQueryFields = map[string]bool{"status": true, "size": true, "reqsize": true, "duration": true}
+
+// knownQueryFields 支持的字段
+var knownQueryFields = map[string]bool{
+	"method": true, "url": true, "host": true, "path": true, "scheme": true, "tag": true, "contenttype": true,
+	"status": true, "size": true, "reqsize": true, "duration": true,
+	"body": true, "resbody": true, "header": true, "resheader": true, "json": true, "resjson": true,
+}
+
+// ParseFlowQuery 解析流量查询表达式
+func ParseFlowQuery(query string) (*FlowQuery, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	parser := &queryParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected %q in query", parser.tokens[parser.pos].text)
+	}
+	return &FlowQuery{source: query, root: root}, nil
+}
+
+// Match 判断Flow是否满足查询
+func (q *FlowQuery) Match(flow *Flow) bool {
+	return q.root.match(flow)
+}
+
+// String 返回原始查询文本
+func (q *FlowQuery) String() string {
+	return q.source
+}
+
+// queryToken 词法单元，quoted表示以引号开头，不作为关键字、括号或条件处理
+type queryToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeQuery 按空白和括号切分查询，引号内的内容保持原样
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	var current strings.Builder
+	inQuote, quoted := false, false
+
+	flush := func() {
+		if current.Len() > 0 || quoted {
+			tokens = append(tokens, queryToken{text: current.String(), quoted: quoted})
+		}
+		current.Reset()
+		quoted = false
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			// 以引号开头的单元整体作为字面值，条件值中的引号只用于包含空白
+			if !inQuote && current.Len() == 0 {
+				quoted = true
+			}
+			inQuote = !inQuote
+		case inQuote:
+			current.WriteRune(r)
+		case unicode.IsSpace(r):
+			flush()
+		case (r == '(' || r == ')') && current.Len() == 0 && !quoted:
+			tokens = append(tokens, queryToken{text: string(r)})
+		case r == ')':
+			// 条件值后紧跟的右括号
+			flush()
+			tokens = append(tokens, queryToken{text: ")"})
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote in query")
+	}
+	flush()
+	return tokens, nil
+}
+
+// queryParser 递归下降解析器
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) isKeyword(token queryToken, keywords ...string) bool {
+	if token.quoted {
+		return false
+	}
+	for _, keyword := range keywords {
+		if strings.EqualFold(token.text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token, ok := p.peek()
+		if !ok || !p.isKeyword(token, "or", "||") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token, ok := p.peek()
+		if !ok || p.isKeyword(token, "or", "||", ")") {
+			return left, nil
+		}
+		if p.isKeyword(token, "and", "&&") {
+			p.pos++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	token, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+
+	switch {
+	case p.isKeyword(token, "not", "!"):
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{inner: inner}, nil
+	case p.isKeyword(token, "("):
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || !p.isKeyword(closing, ")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return inner, nil
+	case p.isKeyword(token, ")"):
+		return nil, fmt.Errorf("unexpected ')' in query")
+	}
+
+	p.pos++
+	if !token.quoted && strings.HasPrefix(token.text, "!") {
+		term, err := parseQueryTerm(token.text[1:], false)
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{inner: term}, nil
+	}
+	return parseQueryTerm(token.text, token.quoted)
+}
+
+// parseQueryTerm 解析单个条件
+func parseQueryTerm(text string, quoted bool) (queryNode, error) {
+	parts := queryTermPattern.FindStringSubmatch(text)
+	if quoted || parts == nil || !knownQueryFields[strings.ToLower(parts[1])] {
+		// 不是已知字段的条件，按URL包含匹配
+		return &termNode{field: "url", op: ":", value: text}, nil
+	}
+
+	term := &termNode{
+		field: strings.ToLower(parts[1]),
+		key:   parts[2],
+		op:    parts[3],
+		value: parts[4],
+	}
+
+	switch term.field {
+	case "header", "resheader", "json", "resjson":
+		if term.key == "" {
+			return nil, fmt.Errorf("%s requires a name, e.g. %s.name", term.field, term.field)
+		}
+	default:
+		if term.key != "" {
+			return nil, fmt.Errorf("field %s does not take a name", term.field)
+		}
+	}
+
+	switch term.op {
+	case "~":
+		regex, err := regexp.Compile(term.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %v", term.value, err)
+		}
+		term.regex = regex
+	case ">", ">=", "<", "<=":
+		if _, err := strconv.ParseFloat(term.value, 64); err != nil {
+			return nil, fmt.Errorf("%s requires a number, got %q", term.op, term.value)
+		}
+	}
+	return term, nil
+}
+
+// match 判断单个条件
+func (t *termNode) match(flow *Flow) bool {
+	value, present := t.lookup(flow)
+	if !present {
+		return t.op == "!="
+	}
+
+	if numericQueryFields[t.field] && t.op == ":" {
+		return matchNumberPattern(value, t.value)
+	}
+
+	switch t.op {
+	case ":":
+		return strings.Contains(strings.ToLower(value), strings.ToLower(t.value))
+	case "=":
+		return value == t.value || (!numericQueryFields[t.field] && strings.EqualFold(value, t.value)) || numbersEqual(value, t.value)
+	case "!=":
+		return !(value == t.value || strings.EqualFold(value, t.value) || numbersEqual(value, t.value))
+	case "~":
+		return t.regex.MatchString(value)
+	}
+
+	left, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+	right, _ := strconv.ParseFloat(t.value, 64)
+	switch t.op {
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	}
+	return false
+}
+
+// lookup 获取条件字段在Flow中的值，present为false表示字段不存在
+func (t *termNode) lookup(flow *Flow) (string, bool) {
+	switch t.field {
+	case "method":
+		return flow.Method, true
+	case "url":
+		return flow.URL, true
+	case "host":
+		return flow.Domain, true
+	case "path":
+		return flow.Path, true
+	case "scheme":
+		return flow.Scheme, true
+	case "contenttype":
+		return flow.ContentType, true
+	case "tag":
+		// 任一标签满足即可
+		for _, tag := range flow.Tags {
+			if (&termNode{field: "method", op: t.op, value: t.value, regex: t.regex}).match(&Flow{Method: tag}) {
+				return tag, true
+			}
+		}
+		return "", false
+	case "status":
+		if flow.StatusCode == 0 {
+			return "", false
+		}
+		return strconv.Itoa(flow.StatusCode), true
+	case "size":
+		if flow.Response == nil {
+			return "", false
+		}
+		return strconv.FormatInt(flow.ResponseSize, 10), true
+	case "reqsize":
+		return strconv.FormatInt(flow.RequestSize, 10), true
+	case "duration":
+		return strconv.FormatInt(flow.Duration.Milliseconds(), 10), true
+	case "body":
+		if flow.Request == nil {
+			return "", false
+		}
+		return string(flow.Request.Body), true
+	case "resbody":
+		if flow.Response == nil {
+			return "", false
+		}
+		return responseText(flow.Response), true
+	case "header":
+		if flow.Request == nil {
+			return "", false
+		}
+		return lookupHeader(flow.Request.Headers, t.key)
+	case "resheader":
+		if flow.Response == nil {
+			return "", false
+		}
+		return lookupHeader(flow.Response.Headers, t.key)
+	case "json":
+		if flow.Request == nil {
+			return "", false
+		}
+		return lookupJSONPath(flow.Request.Body, t.key)
+	case "resjson":
+		if flow.Response == nil {
+			return "", false
+		}
+		return lookupJSONPath([]byte(responseText(flow.Response)), t.key)
+	}
+	return "", false
+}
+
+// lookupHeader 不区分大小写地查找头部
+func lookupHeader(headers map[string]string, name string) (string, bool) {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// responseText 获取解码后的响应文本
+func responseText(resp *FlowResponse) string {
+	if resp.TextContent != "" {
+		return resp.TextContent
+	}
+	if resp.DecodedBody != "" {
+		if decoded, err := base64.StdEncoding.DecodeString(resp.DecodedBody); err == nil {
+			return string(decoded)
+		}
+	}
+	return string(resp.Body)
+}
+
+// lookupJSONPath 按点分路径读取JSON字段，数组使用数字下标
+func lookupJSONPath(body []byte, path string) (string, bool) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "", false
+	}
+
+	for _, part := range strings.Split(path, ".") {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			next, exists := current[part]
+			if !exists {
+				return "", false
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(current) {
+				return "", false
+			}
+			value = current[index]
+		default:
+			return "", false
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case nil:
+		return "null", true
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded), true
+	}
+}
+
+// matchNumberPattern 匹配数值模式：精确值、4xx这样的通配或200-299这样的区间
+func matchNumberPattern(value, pattern string) bool {
+	if from, to, isRange := strings.Cut(pattern, "-"); isRange {
+		number, err1 := strconv.ParseFloat(value, 64)
+		low, err2 := strconv.ParseFloat(from, 64)
+		high, err3 := strconv.ParseFloat(to, 64)
+		return err1 == nil && err2 == nil && err3 == nil && number >= low && number <= high
+	}
+
+	if len(pattern) == len(value) && strings.ContainsAny(pattern, "xX") {
+		for i := range pattern {
+			if pattern[i] != 'x' && pattern[i] != 'X' && pattern[i] != value[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return numbersEqual(value, pattern)
+}
+
+// numbersEqual 两个字符串都是数字且数值相等
+func numbersEqual(a, b string) bool {
+	x, err1 := strconv.ParseFloat(a, 64)
+	y, err2 := strconv.ParseFloat(b, 64)
+	return err1 == nil && err2 == nil && x == y
+}
@@ -0,0 +1,79 @@
+package proxycore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlowQueryMatch(t *testing.T) {
+	flow := &Flow{
+		URL:          "https://api.example.com/v1/login?debug=1",
+		Method:       "POST",
+		Domain:       "api.example.com",
+		Path:         "/v1/login",
+		Scheme:       "https",
+		StatusCode:   503,
+		ResponseSize: 2048,
+		Duration:     1500 * time.Millisecond,
+		Tags:         []string{"map-local"},
+		Request: &FlowRequest{
+			Headers: map[string]string{"X-Debug": "on", "Content-Type": "application/json"},
+			Body:    []byte(`{"user":{"id":42,"roles":["admin","dev"]},"remember":true}`),
+		},
+		Response: &FlowResponse{
+			Headers:     map[string]string{"Content-Type": "application/json"},
+			TextContent: `{"code":7,"message":"Service Unavailable"}`,
+		},
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"method:POST", true},
+		{"method=get", false},
+		{"login", true},
+		{"host:example.com path=/v1/login", true},
+		{"status:5xx", true},
+		{"status:4xx", false},
+		{"status:500-599", true},
+		{"status>=500 size>1000", true},
+		{"size<1000", false},
+		{"duration>1000", true},
+		{"header.x-debug=on", true},
+		{"header.X-Missing=1", false},
+		{"header.X-Missing!=1", true},
+		{"resheader.content-type:json", true},
+		{"json.user.id=42", true},
+		{"json.user.roles.0=admin", true},
+		{"json.remember=true", true},
+		{"json.user.id>100", false},
+		{"resjson.code!=0", true},
+		{`resbody:"service unavailable"`, true},
+		{"tag:map-local", true},
+		{"!tag:map-local", false},
+		{"not method:GET", true},
+		{"method:GET or status:5xx", true},
+		{"method:GET || (status:2xx and size>0)", false},
+		{`url~"/v[0-9]+/login"`, true},
+	}
+
+	for _, tt := range tests {
+		query, err := ParseFlowQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseFlowQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if got := query.Match(flow); got != tt.want {
+			t.Errorf("%q matched %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFlowQueryParseErrors(t *testing.T) {
+	for _, query := range []string{"", "(method:GET", "method:GET)", `url~"("`, "status>abc", "header:x", `body:"open`} {
+		if _, err := ParseFlowQuery(query); err == nil {
+			t.Errorf("ParseFlowQuery(%q) should fail", query)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package proxycore
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -9,6 +12,7 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"ProxyWoman/internal/certmanager"
@@ -24,17 +28,59 @@ type ResponseInterceptor interface {
 	InterceptResponse(flow *Flow, resp *http.Response) (modified *http.Response, err error)
 }
 
+// ConnectInterceptor CONNECT请求拦截器接口，在与客户端建立隧道之前调用。
+// handled为true表示拦截器已自行响应客户端，此时记录该CONNECT的Flow且不再建立隧道
+type ConnectInterceptor interface {
+	InterceptConnect(flow *Flow, w http.ResponseWriter, r *http.Request) (handled bool, err error)
+}
+
+// ResponseWriterWrapper 请求拦截器可选实现的接口：在执行拦截器链之前包装写给客户端的ResponseWriter，
+// 无论响应来自上游还是由拦截器生成都会经过包装，用于在传输层模拟故障。返回nil表示不包装
+type ResponseWriterWrapper interface {
+	WrapResponseWriter(flow *Flow, w http.ResponseWriter, r *http.Request) http.ResponseWriter
+}
+
+// TLSInterceptionPolicy 决定是否对HTTPS隧道做中间人解密，不解密的隧道原样转发
+type TLSInterceptionPolicy interface {
+	ShouldInterceptTLS(hostPort string) bool
+}
+
+// UpstreamSelector 为请求的最后一跳选择传输，例如经上游代理转发并在失败时切换到下一个上游。
+// 在所有请求拦截器之后调用，返回nil表示直接连接目标服务器
+type UpstreamSelector interface {
+	Transport(flow *Flow, req *http.Request) (http.RoundTripper, error)
+}
+
+// UpstreamDialer UpstreamSelector可选实现的接口，为不解密的隧道（TLS直通、SOCKS5原始TCP）建立到目标的连接，
+// 使这些流量同样经过上游代理。返回nil连接且没有错误表示直接连接目标
+type UpstreamDialer interface {
+	DialTunnel(ctx context.Context, flow *Flow, target string) (net.Conn, error)
+}
+
+// ErrAbortConnection 拦截器返回该错误时，代理不返回任何响应而直接断开客户端连接，用于模拟网络故障
+var ErrAbortConnection = errors.New("connection aborted by interceptor")
+
 // ProxyServer 代理服务器
 type ProxyServer struct {
 	port                 int
 	certManager          *certmanager.CertManager
 	requestInterceptors  []RequestInterceptor
 	responseInterceptors []ResponseInterceptor
+	connectInterceptors  []ConnectInterceptor
 	server               *http.Server
 	flows                map[string]*Flow
 	flowsMutex           sync.RWMutex
 	flowHandler          func(*Flow)
+	conditioner          NetworkConditioner
+	tlsPolicy            TLSInterceptionPolicy
+	upstream             UpstreamSelector
 	running              bool
+
+	// SOCKS5 入站监听配置（端口为0表示不启用）
+	socksPort     int
+	socksUsername string
+	socksPassword string
+	socksListener net.Listener
 }
 
 // NewProxyServer 创建新的代理服务器
@@ -59,11 +105,44 @@ func (ps *ProxyServer) AddResponseInterceptor(interceptor ResponseInterceptor) {
 	ps.responseInterceptors = append(ps.responseInterceptors, interceptor)
 }
 
+// AddConnectInterceptor 添加CONNECT请求拦截器
+func (ps *ProxyServer) AddConnectInterceptor(interceptor ConnectInterceptor) {
+	ps.connectInterceptors = append(ps.connectInterceptors, interceptor)
+}
+
 // SetFlowHandler 设置流量处理回调函数
 func (ps *ProxyServer) SetFlowHandler(handler func(*Flow)) {
 	ps.flowHandler = handler
 }
 
+// SetNetworkConditioner 设置网络条件模拟，为nil时不做限制
+func (ps *ProxyServer) SetNetworkConditioner(conditioner NetworkConditioner) {
+	ps.conditioner = conditioner
+}
+
+// SetTLSInterceptionPolicy 设置TLS解密策略，为nil时解密所有HTTPS隧道
+func (ps *ProxyServer) SetTLSInterceptionPolicy(policy TLSInterceptionPolicy) {
+	ps.tlsPolicy = policy
+}
+
+// SetUpstreamSelector 设置请求最后一跳的上游选择，为nil时所有请求直接连接
+func (ps *ProxyServer) SetUpstreamSelector(selector UpstreamSelector) {
+	ps.upstream = selector
+}
+
+// shouldInterceptTLS 是否对目标做中间人解密
+func (ps *ProxyServer) shouldInterceptTLS(hostPort string) bool {
+	return ps.tlsPolicy == nil || ps.tlsPolicy.ShouldInterceptTLS(hostPort)
+}
+
+// EnableSOCKS5 启用SOCKS5入站监听，需在Start之前调用。
+// username为空时不要求认证
+func (ps *ProxyServer) EnableSOCKS5(port int, username, password string) {
+	ps.socksPort = port
+	ps.socksUsername = username
+	ps.socksPassword = password
+}
+
 // Start 启动代理服务器
 func (ps *ProxyServer) Start() error {
 	if ps.running {
@@ -75,6 +154,15 @@ func (ps *ProxyServer) Start() error {
 		Handler: ps,
 	}
 
+	if ps.socksPort > 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", ps.socksPort))
+		if err != nil {
+			return fmt.Errorf("failed to listen for SOCKS5 on port %d: %v", ps.socksPort, err)
+		}
+		ps.socksListener = listener
+		go ps.serveSOCKS5(listener)
+	}
+
 	ps.running = true
 
 	go func() {
@@ -93,6 +181,10 @@ func (ps *ProxyServer) Stop() error {
 	}
 
 	ps.running = false
+	if ps.socksListener != nil {
+		ps.socksListener.Close()
+		ps.socksListener = nil
+	}
 	if ps.server != nil {
 		return ps.server.Close()
 	}
@@ -108,11 +200,40 @@ func (ps *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// HandleRequest 处理已确定目标的HTTP请求（r.URL须为绝对URL），
+// 与正向代理走相同的拦截器链并记录Flow，供反向代理监听等入口使用
+func (ps *ProxyServer) HandleRequest(w http.ResponseWriter, r *http.Request, tags ...string) {
+	ps.handleHTTP(w, r.WithContext(withFlowTags(r.Context(), tags...)))
+}
+
 // handleHTTP 处理普通HTTP请求
 func (ps *ProxyServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
 	// 生成Flow ID
 	flowID := ps.generateFlowID()
 	flow := NewFlow(flowID, r)
+	for _, tag := range flowTagsFromContext(r.Context()) {
+		flow.AddTag(tag)
+	}
+
+	// 网络条件模拟：请求体按上行带宽读取，响应按首字节延迟和下行带宽写出
+	var profile *NetworkProfile
+	if ps.conditioner != nil {
+		profile = ps.conditioner.ProfileFor(flow)
+	}
+	if profile != nil {
+		flow.NetworkProfile = profile.Name
+		if r.Body != nil {
+			r.Body = newThrottledReadCloser(r.Context(), r.Body, profile.UploadKbps)
+		}
+		w = newThrottledResponseWriter(r.Context(), w, profile)
+	}
+	for _, interceptor := range ps.requestInterceptors {
+		if wrapper, ok := interceptor.(ResponseWriterWrapper); ok {
+			if wrapped := wrapper.WrapResponseWriter(flow, w, r); wrapped != nil {
+				w = wrapped
+			}
+		}
+	}
 
 	// 读取请求体
 	if r.Body != nil {
@@ -123,15 +244,31 @@ func (ps *ProxyServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
 		r.Body.Close()
 	}
 
+	if profile != nil {
+		if err := sleepContext(r.Context(), profile.requestLatency()); err != nil {
+			return
+		}
+		if profile.shouldFail() {
+			flow.AddTag("network-failure")
+			ps.abortFlow(flow, w)
+			return
+		}
+	}
+
 	// 执行请求拦截器
 	for _, interceptor := range ps.requestInterceptors {
 		handled, err := interceptor.InterceptRequest(flow, w, r)
+		if errors.Is(err, ErrAbortConnection) {
+			ps.abortFlow(flow, w)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		if handled {
 			// 请求已被拦截器处理，直接返回
+			finishThrottledFlow(flow, profile)
 			ps.addFlow(flow)
 			return
 		}
@@ -148,11 +285,15 @@ func (ps *ProxyServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	proxyReq, err := http.NewRequest(r.Method, targetURL.String(), strings.NewReader(string(flow.Request.Body)))
+	// 请求体以Flow为准（拦截器可能已修改），客户端断开时取消上游请求
+	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL.String(), bytes.NewReader(flow.Request.Body))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if r.Host != "" && r.Host != targetURL.Host {
+		proxyReq.Host = r.Host
+	}
 
 	// 复制请求头
 	for name, values := range r.Header {
@@ -161,10 +302,24 @@ func (ps *ProxyServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 发送请求
+	// 发送请求，配置了上游时经上游选择的传输发出
 	client := &http.Client{
 		Timeout: 30 * time.Second,
 	}
+	if ps.upstream != nil {
+		transport, err := ps.upstream.Transport(flow, proxyReq)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if transport != nil {
+			client.Transport = transport
+			// 经上游时不跟随重定向，原样返回给客户端
+			client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			}
+		}
+	}
 
 	resp, err := client.Do(proxyReq)
 	if err != nil {
@@ -180,11 +335,16 @@ func (ps *ProxyServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 设置响应信息
+	// 设置响应信息，响应体重新包装供响应拦截器读取
 	flow.SetResponse(resp, respBody)
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
 	modifiedResp := resp
 	for _, interceptor := range ps.responseInterceptors {
 		modifiedResp, err = interceptor.InterceptResponse(flow, modifiedResp)
+		if errors.Is(err, ErrAbortConnection) {
+			ps.abortFlow(flow, w)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -216,11 +376,76 @@ func (ps *ProxyServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 存储并通知Flow
+	finishThrottledFlow(flow, profile)
+	ps.addFlow(flow)
+}
+
+// finishThrottledFlow 限速时响应写出耗时较长，以写出完成的时间作为Flow的结束时间
+func finishThrottledFlow(flow *Flow, profile *NetworkProfile) {
+	if profile == nil {
+		return
+	}
+	flow.EndTime = time.Now()
+	flow.Duration = flow.EndTime.Sub(flow.StartTime)
+}
+
+// abortFlow 记录被中止的Flow并断开客户端连接
+func (ps *ProxyServer) abortFlow(flow *Flow, w http.ResponseWriter) {
+	flow.AddTag("aborted")
+	flow.EndTime = time.Now()
+	flow.Duration = flow.EndTime.Sub(flow.StartTime)
 	ps.addFlow(flow)
+	AbortConnection(w)
+}
+
+// AbortConnection 不返回响应直接断开客户端连接：可劫持时以RST关闭底层TCP连接，否则中止当前响应
+func AbortConnection(w http.ResponseWriter) {
+	if hijacker, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hijacker.Hijack(); err == nil {
+			if tcpConn, ok := underlyingConn(conn).(*net.TCPConn); ok {
+				tcpConn.SetLinger(0)
+			}
+			conn.Close()
+			return
+		}
+	}
+	panic(http.ErrAbortHandler)
+}
+
+// underlyingConn 解开TLS和缓冲包装，获取底层连接
+func underlyingConn(conn net.Conn) net.Conn {
+	for {
+		switch c := conn.(type) {
+		case *tls.Conn:
+			conn = c.NetConn()
+		case *bufferedConn:
+			conn = c.Conn
+		default:
+			return conn
+		}
+	}
 }
 
 // handleConnect 处理HTTPS CONNECT请求
 func (ps *ProxyServer) handleConnect(w http.ResponseWriter, r *http.Request) {
+	// 获取目标主机名
+	host := r.Host
+	if !strings.Contains(host, ":") {
+		host += ":443"
+	}
+	intercept := ps.shouldInterceptTLS(host)
+
+	if len(ps.connectInterceptors) > 0 {
+		flow := NewConnectFlow(ps.generateFlowID(), r)
+		if !intercept {
+			// 不解密的隧道没有后续的请求级检查，拦截器需在隧道层做出决定
+			flow.AddTag("ssl-bypass")
+		}
+		if ps.runConnectInterceptors(flow, w, r) {
+			return
+		}
+	}
+
 	// 响应200 OK
 	w.WriteHeader(http.StatusOK)
 
@@ -238,27 +463,63 @@ func (ps *ProxyServer) handleConnect(w http.ResponseWriter, r *http.Request) {
 	}
 	defer clientConn.Close()
 
-	// 获取目标主机名
-	host := r.Host
-	if !strings.Contains(host, ":") {
-		host += ":443"
+	// 不解密的主机原样转发，不签发证书
+	if !intercept {
+		ps.tunnelTCP(clientConn, host, "ssl-bypass")
+		return
+	}
+
+	ps.interceptTLS(clientConn, host)
+}
+
+// runConnectInterceptors 依次执行CONNECT拦截器，返回true表示已响应客户端、不再建立隧道
+func (ps *ProxyServer) runConnectInterceptors(flow *Flow, w http.ResponseWriter, r *http.Request) bool {
+	for _, interceptor := range ps.connectInterceptors {
+		handled, err := interceptor.InterceptConnect(flow, w, r)
+		if errors.Is(err, ErrAbortConnection) {
+			ps.abortFlow(flow, w)
+			return true
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return true
+		}
+		if handled {
+			// 隧道未建立，记录CONNECT本身的Flow
+			if flow.EndTime.IsZero() {
+				flow.EndTime = time.Now()
+				flow.Duration = flow.EndTime.Sub(flow.StartTime)
+			}
+			ps.addFlow(flow)
+			return true
+		}
 	}
+	return false
+}
 
+// interceptTLS 以中间人方式与客户端完成TLS握手，并处理解密后的HTTP流量
+func (ps *ProxyServer) interceptTLS(clientConn net.Conn, host string, tags ...string) {
 	hostname := strings.Split(host, ":")[0]
 
-	// 获取服务器证书
-	cert, err := ps.certManager.GenerateServerCert(hostname)
-	if err != nil {
-		fmt.Printf("Failed to generate certificate for %s: %v\n", hostname, err)
-		return
+	// 获取服务器证书，优先使用客户端SNI（SOCKS5等按IP连接的场景）
+	getCertificate := func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		name := hostname
+		if hello.ServerName != "" {
+			name = hello.ServerName
+		}
+		cert, err := ps.certManager.GenerateServerCert(name)
+		if err != nil {
+			fmt.Printf("Failed to generate certificate for %s: %v\n", name, err)
+		}
+		return cert, err
 	}
 
 	// 创建TLS配置
 	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{*cert},
-		ServerName:   hostname,
-		MinVersion:   tls.VersionTLS12,
-		MaxVersion:   tls.VersionTLS13,
+		GetCertificate: getCertificate,
+		ServerName:     hostname,
+		MinVersion:     tls.VersionTLS12,
+		MaxVersion:     tls.VersionTLS13,
 		CipherSuites: []uint16{
 			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
@@ -273,15 +534,13 @@ func (ps *ProxyServer) handleConnect(w http.ResponseWriter, r *http.Request) {
 	tlsConn := tls.Server(clientConn, tlsConfig)
 	if err := tlsConn.Handshake(); err != nil {
 		fmt.Printf("TLS handshake failed for %s: %v\n", hostname, err)
-		fmt.Printf("Certificate details: Subject=%s, DNSNames=%v\n",
-			cert.Leaf.Subject.CommonName, cert.Leaf.DNSNames)
 		return
 	}
 
 	fmt.Printf("TLS handshake successful for %s\n", hostname)
 
 	// 开始处理HTTPS流量
-	ps.handleHTTPS(tlsConn, host)
+	ps.handleHTTPS(tlsConn, host, tags...)
 }
 
 // addFlow 添加Flow到存储并通知处理器
@@ -388,54 +647,87 @@ func (ps *ProxyServer) GetFlowByID(flowID string) (*Flow, error) {
 }
 
 // handleHTTPS 处理HTTPS流量
-func (ps *ProxyServer) handleHTTPS(tlsConn *tls.Conn, targetHost string) {
-	defer tlsConn.Close()
+func (ps *ProxyServer) handleHTTPS(tlsConn *tls.Conn, targetHost string, tags ...string) {
+	ps.serveConn(tlsConn, "https", targetHost, tags...)
+}
 
-	fmt.Printf("Starting HTTPS handler for %s\n", targetHost)
+// serveConn 在单个连接上提供HTTP服务，并把每个请求交给handleHTTP处理。
+// 连接来自CONNECT或SOCKS5隧道，请求会被标记为InTunnel；tags会添加到该连接产生的每个Flow上
+func (ps *ProxyServer) serveConn(conn net.Conn, scheme, targetHost string, tags ...string) {
+	// 连接被劫持后由劫持方负责关闭
+	var hijacked atomic.Bool
+	defer func() {
+		if !hijacked.Load() {
+			conn.Close()
+		}
+	}()
+
+	fmt.Printf("Starting %s handler for %s\n", strings.ToUpper(scheme), targetHost)
+
+	baseCtx := context.WithValue(withFlowTags(context.Background(), tags...), tunnelKey{}, true)
+	listener := &singleConnListener{conn: conn, closed: make(chan struct{})}
 
-	// 创建HTTP服务器来处理解密后的HTTPS请求
+	// 创建HTTP服务器来处理该连接上的请求
 	server := &http.Server{
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			fmt.Printf("🔍 Received HTTPS request: %s %s from %s\n", r.Method, r.URL.Path, targetHost)
-			fmt.Printf("🔍 Request headers: %v\n", r.Header)
+			fmt.Printf("🔍 Received %s request: %s %s from %s\n", strings.ToUpper(scheme), r.Method, r.URL.Path, targetHost)
 
 			// 设置完整的URL
-			r.URL.Scheme = "https"
-			r.URL.Host = targetHost
+			r.URL.Scheme = scheme
+			r.URL.Host = requestHost(targetHost, r.Host)
 
-			// 处理为普通HTTP请求
-			fmt.Printf("🔍 Calling handleHTTP for HTTPS request\n")
 			ps.handleHTTP(w, r)
-			fmt.Printf("🔍 handleHTTP completed for HTTPS request\n")
 		}),
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
+		// 连接关闭后结束Serve，避免Accept永久阻塞
+		ConnState: func(c net.Conn, state http.ConnState) {
+			if state == http.StateHijacked {
+				hijacked.Store(true)
+			}
+			if state == http.StateClosed || state == http.StateHijacked {
+				listener.Close()
+			}
+		},
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
 
-	// 使用TLS连接处理HTTP请求
-	listener := &singleConnListener{conn: tlsConn}
 	err := server.Serve(listener)
 	if err != nil && err != io.EOF && !strings.Contains(err.Error(), "use of closed network connection") {
-		fmt.Printf("HTTPS server error for %s: %v\n", targetHost, err)
+		fmt.Printf("%s server error for %s: %v\n", strings.ToUpper(scheme), targetHost, err)
 	}
 
-	fmt.Printf("HTTPS handler finished for %s\n", targetHost)
+	fmt.Printf("%s handler finished for %s\n", strings.ToUpper(scheme), targetHost)
+}
+
+// requestHost 确定请求URL中的主机部分。
+// 目标是IP地址（如SOCKS5客户端本地解析）时，使用Host头中的域名以保留虚拟主机信息
+func requestHost(targetHost, hostHeader string) string {
+	host, port, err := net.SplitHostPort(targetHost)
+	if err != nil || net.ParseIP(host) == nil || hostHeader == "" {
+		return targetHost
+	}
+	name := hostHeader
+	if h, _, err := net.SplitHostPort(hostHeader); err == nil {
+		name = h
+	}
+	return net.JoinHostPort(name, port)
 }
 
 // singleConnListener 单连接监听器
 type singleConnListener struct {
-	conn   net.Conn
-	once   sync.Once
-	closed chan struct{}
+	conn      net.Conn
+	once      sync.Once
+	closeOnce sync.Once
+	closed    chan struct{}
 }
 
 func (l *singleConnListener) Accept() (net.Conn, error) {
 	var conn net.Conn
 
 	l.once.Do(func() {
-		if l.closed == nil {
-			l.closed = make(chan struct{})
-		}
 		conn = l.conn
 	})
 
@@ -449,12 +741,9 @@ func (l *singleConnListener) Accept() (net.Conn, error) {
 }
 
 func (l *singleConnListener) Close() error {
-	if l.closed != nil {
+	l.closeOnce.Do(func() {
 		close(l.closed)
-	}
-	if l.conn != nil {
-		return l.conn.Close()
-	}
+	})
 	return nil
 }
 
@@ -0,0 +1,567 @@
+package proxycore
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SOCKS5 协议常量 (RFC 1928 / RFC 1929)
+const (
+	socks5Version          = 0x05
+	socks5AuthVersion      = 0x01
+	socks5AuthNone         = 0x00
+	socks5AuthPassword     = 0x02
+	socks5AuthNoAcceptable = 0xFF
+
+	socks5CmdConnect = 0x01
+
+	socks5AtypIPv4   = 0x01
+	socks5AtypDomain = 0x03
+	socks5AtypIPv6   = 0x04
+
+	socks5RepSuccess             = 0x00
+	socks5RepGeneralFailure      = 0x01
+	socks5RepNotAllowed          = 0x02
+	socks5RepHostUnreachable     = 0x04
+	socks5RepCommandNotSupported = 0x07
+	socks5RepAddrNotSupported    = 0x08
+)
+
+// socksHandshakeTimeout SOCKS5握手超时时间
+const socksHandshakeTimeout = 30 * time.Second
+
+// socksSniffTimeout 协议嗅探等待客户端首包的时间，超时视为服务端先发言的协议
+const socksSniffTimeout = 500 * time.Millisecond
+
+// bufferedConn 带预读缓冲的连接，用于协议嗅探后继续读取已缓冲的数据
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// serveSOCKS5 接受SOCKS5客户端连接
+func (ps *ProxyServer) serveSOCKS5(listener net.Listener) {
+	fmt.Printf("SOCKS5 listener started on %s\n", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				fmt.Printf("SOCKS5 accept error: %v\n", err)
+			}
+			return
+		}
+		go ps.handleSOCKS5Conn(conn)
+	}
+}
+
+// handleSOCKS5Conn 处理单个SOCKS5连接：认证、CONNECT请求，然后按协议分发
+func (ps *ProxyServer) handleSOCKS5Conn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+
+	reader := bufio.NewReader(conn)
+	if err := ps.socks5Negotiate(reader, conn); err != nil {
+		fmt.Printf("SOCKS5 negotiation failed from %s: %v\n", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	target, err := socks5ReadRequest(reader, conn)
+	if err != nil {
+		fmt.Printf("SOCKS5 request failed from %s: %v\n", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	ps.handleSOCKS5Stream(&bufferedConn{Conn: conn, reader: reader}, target)
+}
+
+// socks5Negotiate 协商认证方式，配置了用户名时要求用户名/密码认证
+func (ps *ProxyServer) socks5Negotiate(reader *bufio.Reader, conn net.Conn) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return err
+	}
+	if header[0] != socks5Version {
+		return fmt.Errorf("unsupported SOCKS version: %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, methods); err != nil {
+		return err
+	}
+
+	required := byte(socks5AuthNone)
+	if ps.socksUsername != "" {
+		required = socks5AuthPassword
+	}
+
+	supported := false
+	for _, method := range methods {
+		if method == required {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		conn.Write([]byte{socks5Version, socks5AuthNoAcceptable})
+		return fmt.Errorf("no acceptable authentication method")
+	}
+
+	if _, err := conn.Write([]byte{socks5Version, required}); err != nil {
+		return err
+	}
+
+	if required == socks5AuthPassword {
+		return ps.socks5Authenticate(reader, conn)
+	}
+	return nil
+}
+
+// socks5Authenticate 用户名/密码认证 (RFC 1929)
+func (ps *ProxyServer) socks5Authenticate(reader *bufio.Reader, conn net.Conn) error {
+	version, err := reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version != socks5AuthVersion {
+		return fmt.Errorf("unsupported auth version: %d", version)
+	}
+
+	username, err := readSOCKSString(reader)
+	if err != nil {
+		return err
+	}
+	password, err := readSOCKSString(reader)
+	if err != nil {
+		return err
+	}
+
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(ps.socksUsername)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(ps.socksPassword)) == 1
+	if !userOK || !passOK {
+		conn.Write([]byte{socks5AuthVersion, 0x01})
+		return fmt.Errorf("invalid credentials for user %q", username)
+	}
+
+	_, err = conn.Write([]byte{socks5AuthVersion, 0x00})
+	return err
+}
+
+// socks5ReadRequest 读取客户端请求，只支持CONNECT命令，返回目标地址host:port
+func socks5ReadRequest(reader *bufio.Reader, conn net.Conn) (string, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("unsupported SOCKS version: %d", header[0])
+	}
+
+	var host string
+	switch header[3] {
+	case socks5AtypIPv4:
+		addr := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(reader, addr); err != nil {
+			return "", err
+		}
+		host = net.IP(addr).String()
+	case socks5AtypIPv6:
+		addr := make([]byte, net.IPv6len)
+		if _, err := io.ReadFull(reader, addr); err != nil {
+			return "", err
+		}
+		host = net.IP(addr).String()
+	case socks5AtypDomain:
+		domain, err := readSOCKSString(reader)
+		if err != nil {
+			return "", err
+		}
+		host = domain
+	default:
+		writeSOCKS5Reply(conn, socks5RepAddrNotSupported)
+		return "", fmt.Errorf("unsupported address type: %d", header[3])
+	}
+
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(reader, portBytes); err != nil {
+		return "", err
+	}
+	port := binary.BigEndian.Uint16(portBytes)
+
+	// BIND 和 UDP ASSOCIATE 不支持
+	if header[1] != socks5CmdConnect {
+		writeSOCKS5Reply(conn, socks5RepCommandNotSupported)
+		return "", fmt.Errorf("unsupported command: %d", header[1])
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// readSOCKSString 读取长度前缀的字符串
+func readSOCKSString(reader *bufio.Reader) (string, error) {
+	length, err := reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// writeSOCKS5Reply 写入应答，绑定地址固定为0.0.0.0:0
+func writeSOCKS5Reply(conn net.Conn, rep byte) error {
+	_, err := conn.Write([]byte{socks5Version, rep, 0x00, socks5AtypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// handleSOCKS5Stream 先对目标执行CONNECT拦截器并应答，再嗅探隧道内的协议：
+// TLS走中间人解密，HTTP走handleHTTP，其他按原始TCP转发
+func (ps *ProxyServer) handleSOCKS5Stream(conn *bufferedConn, target string) {
+	if len(ps.connectInterceptors) > 0 {
+		req := &http.Request{
+			Method:     http.MethodConnect,
+			URL:        &url.URL{Host: target},
+			Host:       target,
+			Header:     make(http.Header),
+			RemoteAddr: conn.RemoteAddr().String(),
+		}
+		flow := NewConnectFlow(ps.generateFlowID(), req)
+		flow.AddTag("socks5")
+		if !ps.shouldInterceptTLS(target) {
+			// 与HTTP CONNECT一致：不解密的目标只能在隧道层做出决定
+			flow.AddTag("ssl-bypass")
+		}
+		w := &socksConnectWriter{conn: conn, header: make(http.Header)}
+		if ps.runConnectInterceptors(flow, w, req) {
+			if !w.hijacked {
+				w.WriteHeader(http.StatusInternalServerError)
+				conn.Close()
+			}
+			return
+		}
+	}
+	if err := writeSOCKS5Reply(conn, socks5RepSuccess); err != nil {
+		conn.Close()
+		return
+	}
+
+	switch sniffProtocol(conn) {
+	case "tls":
+		if !ps.shouldInterceptTLS(target) {
+			ps.tunnelTCP(conn, target, "socks5", "ssl-bypass")
+			return
+		}
+		ps.interceptTLS(conn, target, "socks5")
+	case "http":
+		ps.serveConn(conn, "http", target, "socks5")
+	default:
+		ps.tunnelTCP(conn, target, "socks5")
+	}
+}
+
+// socksConnectWriter 让CONNECT拦截器以http.ResponseWriter的方式应答SOCKS5请求：
+// 状态码转换为SOCKS5应答码，响应体丢弃，Hijack交出客户端连接
+type socksConnectWriter struct {
+	conn     *bufferedConn
+	header   http.Header
+	replied  bool
+	hijacked bool
+}
+
+func (w *socksConnectWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *socksConnectWriter) WriteHeader(statusCode int) {
+	if w.replied {
+		return
+	}
+	w.replied = true
+	writeSOCKS5Reply(w.conn, socks5ReplyCode(statusCode))
+}
+
+func (w *socksConnectWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return len(p), nil
+}
+
+func (w *socksConnectWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return w.conn, bufio.NewReadWriter(w.conn.reader, bufio.NewWriter(w.conn)), nil
+}
+
+// socks5ReplyCode 将CONNECT响应的状态码转换为SOCKS5应答码
+func socks5ReplyCode(statusCode int) byte {
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return socks5RepSuccess
+	case statusCode == http.StatusBadGateway || statusCode == http.StatusGatewayTimeout:
+		return socks5RepHostUnreachable
+	case statusCode >= 400 && statusCode < 500:
+		return socks5RepNotAllowed
+	default:
+		return socks5RepGeneralFailure
+	}
+}
+
+// sniffProtocol 根据客户端首包判断协议类型："tls"、"http" 或 "tcp"
+func sniffProtocol(conn *bufferedConn) string {
+	conn.SetReadDeadline(time.Now().Add(socksSniffTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	first, err := conn.reader.Peek(1)
+	if err != nil || len(first) == 0 {
+		return "tcp"
+	}
+
+	// TLS握手记录
+	if first[0] == 0x16 {
+		return "tls"
+	}
+
+	// HTTP请求行以方法名加空格开头
+	for _, method := range []string{"GET ", "POST ", "PUT ", "DELETE ", "HEAD ", "OPTIONS ", "PATCH ", "TRACE "} {
+		prefix, err := conn.reader.Peek(len(method))
+		if err != nil {
+			prefix, _ = conn.reader.Peek(conn.reader.Buffered())
+		}
+		if string(prefix) == method {
+			return "http"
+		}
+	}
+
+	return "tcp"
+}
+
+// tunnelTCP 原样转发TCP流量，并记录为原始TCP Flow
+func (ps *ProxyServer) tunnelTCP(clientConn net.Conn, target string, tags ...string) {
+	defer clientConn.Close()
+
+	flow := NewTunnelFlow(ps.generateFlowID(), clientConn.RemoteAddr().String(), target)
+	for _, tag := range tags {
+		flow.AddTag(tag)
+	}
+
+	serverConn, err := ps.dialTunnel(flow, target)
+	if err != nil {
+		fmt.Printf("Failed to dial tunnel target %s: %v\n", target, err)
+		flow.AddTag("tunnel-error")
+		flow.EndTime = time.Now()
+		flow.Duration = flow.EndTime.Sub(flow.StartTime)
+		ps.addFlow(flow)
+		return
+	}
+	defer serverConn.Close()
+
+	var wg sync.WaitGroup
+	var sent, received int64
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sent, _ = io.Copy(serverConn, clientConn)
+		closeWrite(serverConn)
+	}()
+	go func() {
+		defer wg.Done()
+		received, _ = io.Copy(clientConn, serverConn)
+		closeWrite(clientConn)
+	}()
+	wg.Wait()
+
+	flow.EndTime = time.Now()
+	flow.Duration = flow.EndTime.Sub(flow.StartTime)
+	flow.RequestSize = sent
+	flow.ResponseSize = received
+	ps.addFlow(flow)
+}
+
+// dialTunnel 连接隧道目标：上游选择实现了UpstreamDialer时经上游代理连接，否则直接连接
+func (ps *ProxyServer) dialTunnel(flow *Flow, target string) (net.Conn, error) {
+	if dialer, ok := ps.upstream.(UpstreamDialer); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		conn, err := dialer.DialTunnel(ctx, flow, target)
+		if conn != nil || err != nil {
+			return conn, err
+		}
+	}
+	return net.DialTimeout("tcp", target, 30*time.Second)
+}
+
+// closeWrite 半关闭连接的写方向，让对端读到EOF
+func closeWrite(conn net.Conn) {
+	if bc, ok := conn.(*bufferedConn); ok {
+		conn = bc.Conn
+	}
+	if tc, ok := conn.(interface{ CloseWrite() error }); ok {
+		tc.CloseWrite()
+		return
+	}
+	conn.Close()
+}
+
+// SOCKS5Dialer 通过SOCKS5代理建立TCP连接的拨号器，可用作http.Transport.DialContext。
+// 目标域名交由代理解析（等同socks5h）
+type SOCKS5Dialer struct {
+	ProxyAddr string
+	Username  string
+	Password  string
+	Timeout   time.Duration
+}
+
+// DialContext 连接SOCKS5代理并请求CONNECT到addr
+func (d *SOCKS5Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("socks5: unsupported network %s", network)
+	}
+
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = socksHandshakeTimeout
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", d.ProxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("socks5: failed to connect to proxy %s: %v", d.ProxyAddr, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	if err := d.handshake(conn, addr); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// handshake 完成认证协商和CONNECT请求
+func (d *SOCKS5Dialer) handshake(conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("socks5: invalid target address %s: %v", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("socks5: invalid target port %s", portStr)
+	}
+
+	methods := []byte{socks5AuthNone}
+	if d.Username != "" {
+		methods = []byte{socks5AuthNone, socks5AuthPassword}
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(reader, reply); err != nil {
+		return fmt.Errorf("socks5: failed to read method selection: %v", err)
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected version %d from proxy", reply[0])
+	}
+
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if len(d.Username) > 255 || len(d.Password) > 255 {
+			return fmt.Errorf("socks5: username or password too long")
+		}
+		auth := []byte{socks5AuthVersion, byte(len(d.Username))}
+		auth = append(auth, d.Username...)
+		auth = append(auth, byte(len(d.Password)))
+		auth = append(auth, d.Password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(reader, reply); err != nil {
+			return fmt.Errorf("socks5: failed to read auth reply: %v", err)
+		}
+		if reply[1] != 0x00 {
+			return fmt.Errorf("socks5: authentication rejected by proxy")
+		}
+	default:
+		return fmt.Errorf("socks5: no acceptable authentication method")
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(req, socks5AtypIPv4)
+			req = append(req, ip4...)
+		} else {
+			req = append(req, socks5AtypIPv6)
+			req = append(req, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("socks5: host name too long")
+		}
+		req = append(req, socks5AtypDomain, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return fmt.Errorf("socks5: failed to read connect reply: %v", err)
+	}
+	if header[1] != socks5RepSuccess {
+		return fmt.Errorf("socks5: proxy refused connection to %s (reply %d)", addr, header[1])
+	}
+
+	// 跳过绑定地址
+	var skip int
+	switch header[3] {
+	case socks5AtypIPv4:
+		skip = net.IPv4len + 2
+	case socks5AtypIPv6:
+		skip = net.IPv6len + 2
+	case socks5AtypDomain:
+		length, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		skip = int(length) + 2
+	default:
+		return fmt.Errorf("socks5: unsupported bound address type %d", header[3])
+	}
+	if _, err := io.ReadFull(reader, make([]byte, skip)); err != nil {
+		return err
+	}
+
+	if reader.Buffered() > 0 {
+		return fmt.Errorf("socks5: unexpected data after connect reply")
+	}
+	return nil
+}
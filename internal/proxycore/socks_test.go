@@ -0,0 +1,329 @@
+package proxycore
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestSOCKS5 在随机端口启动SOCKS5监听
+func startTestSOCKS5(t *testing.T, ps *ProxyServer) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go ps.serveSOCKS5(listener)
+	return listener.Addr().String()
+}
+
+// dialSOCKS5 完成SOCKS5握手并请求连接target
+func dialSOCKS5(t *testing.T, proxyAddr, target, username, password string) (net.Conn, byte) {
+	t.Helper()
+	conn, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	method := byte(socks5AuthNone)
+	if username != "" {
+		method = socks5AuthPassword
+	}
+	conn.Write([]byte{socks5Version, 1, method})
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("read method reply: %v", err)
+	}
+	if reply[1] == socks5AuthNoAcceptable {
+		return conn, reply[1]
+	}
+
+	if method == socks5AuthPassword {
+		auth := []byte{socks5AuthVersion, byte(len(username))}
+		auth = append(auth, username...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		conn.Write(auth)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			t.Fatalf("read auth reply: %v", err)
+		}
+		if reply[1] != 0x00 {
+			return conn, reply[1]
+		}
+	}
+
+	host, portStr, _ := net.SplitHostPort(target)
+	port, _ := strconv.Atoi(portStr)
+	req := []byte{socks5Version, socks5CmdConnect, 0x00, socks5AtypDomain, byte(len(host))}
+	req = append(req, host...)
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	conn.Write(req)
+
+	resp := make([]byte, 10)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		t.Fatalf("read connect reply: %v", err)
+	}
+	return conn, resp[1]
+}
+
+func TestSOCKS5HTTPStream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	ps := NewProxyServer(0, nil)
+	ps.EnableSOCKS5(0, "user", "secret")
+	flows := make(chan *Flow, 1)
+	ps.SetFlowHandler(func(flow *Flow) { flows <- flow })
+	proxyAddr := startTestSOCKS5(t, ps)
+
+	target := strings.TrimPrefix(upstream.URL, "http://")
+	conn, rep := dialSOCKS5(t, proxyAddr, target, "user", "secret")
+	defer conn.Close()
+	if rep != socks5RepSuccess {
+		t.Fatalf("expected success reply, got %d", rep)
+	}
+
+	conn.Write([]byte("GET /socks HTTP/1.1\r\nHost: " + target + "\r\nConnection: close\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello /socks" {
+		t.Errorf("unexpected body: %q", body)
+	}
+
+	select {
+	case flow := <-flows:
+		if flow.Scheme != "http" && !strings.HasPrefix(flow.URL, "http://") {
+			t.Errorf("expected http flow, got %s", flow.URL)
+		}
+		hasTag := false
+		for _, tag := range flow.Tags {
+			if tag == "socks5" {
+				hasTag = true
+			}
+		}
+		if !hasTag {
+			t.Errorf("expected socks5 tag, got %v", flow.Tags)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("flow not recorded")
+	}
+}
+
+// tunnelRecorder 记录请求是否被标记为来自隧道
+type tunnelRecorder struct {
+	inTunnel chan bool
+}
+
+func (tr *tunnelRecorder) InterceptRequest(flow *Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
+	tr.inTunnel <- InTunnel(r)
+	return false, nil
+}
+
+func TestSOCKS5RequestsAreInTunnel(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	ps := NewProxyServer(0, nil)
+	recorder := &tunnelRecorder{inTunnel: make(chan bool, 1)}
+	ps.AddRequestInterceptor(recorder)
+	proxyAddr := startTestSOCKS5(t, ps)
+
+	target := strings.TrimPrefix(upstream.URL, "http://")
+	conn, _ := dialSOCKS5(t, proxyAddr, target, "", "")
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: " + target + "\r\nConnection: close\r\n\r\n"))
+	http.ReadResponse(bufio.NewReader(conn), nil)
+	if !<-recorder.inTunnel {
+		t.Error("requests inside a SOCKS5 stream should be marked as tunnelled")
+	}
+
+	// 普通代理请求不在隧道中
+	proxy := httptest.NewServer(ps)
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 5 * time.Second}
+	if resp, err := client.Get(upstream.URL); err == nil {
+		resp.Body.Close()
+	}
+	if <-recorder.inTunnel {
+		t.Error("plain proxy requests should not be marked as tunnelled")
+	}
+}
+
+func TestSOCKS5RejectsBadCredentials(t *testing.T) {
+	ps := NewProxyServer(0, nil)
+	ps.EnableSOCKS5(0, "user", "secret")
+	proxyAddr := startTestSOCKS5(t, ps)
+
+	conn, rep := dialSOCKS5(t, proxyAddr, "127.0.0.1:1", "user", "wrong")
+	defer conn.Close()
+	if rep == 0x00 {
+		t.Fatal("expected authentication failure")
+	}
+}
+
+func TestSOCKS5RawTCPTunnel(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		conn, err := echo.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	ps := NewProxyServer(0, nil)
+	flows := make(chan *Flow, 1)
+	ps.SetFlowHandler(func(flow *Flow) { flows <- flow })
+	proxyAddr := startTestSOCKS5(t, ps)
+
+	conn, rep := dialSOCKS5(t, proxyAddr, echo.Addr().String(), "", "")
+	if rep != socks5RepSuccess {
+		t.Fatalf("expected success reply, got %d", rep)
+	}
+
+	conn.Write([]byte("\x00PING"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read echo: %v", err)
+	}
+	if string(buf) != "\x00PING" {
+		t.Errorf("unexpected echo: %q", buf)
+	}
+	conn.(*net.TCPConn).CloseWrite()
+	io.ReadAll(conn)
+	conn.Close()
+
+	select {
+	case flow := <-flows:
+		if flow.Scheme != "tcp" || flow.RequestSize != 5 || flow.ResponseSize != 5 {
+			t.Errorf("unexpected tunnel flow: scheme=%s sent=%d received=%d", flow.Scheme, flow.RequestSize, flow.ResponseSize)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("tunnel flow not recorded")
+	}
+}
+
+// recordingDialer 记录隧道目标并直接连接的上游选择
+type recordingDialer struct {
+	targets chan string
+}
+
+func (d *recordingDialer) Transport(flow *Flow, req *http.Request) (http.RoundTripper, error) {
+	return nil, nil
+}
+
+func (d *recordingDialer) DialTunnel(ctx context.Context, flow *Flow, target string) (net.Conn, error) {
+	d.targets <- target
+	flow.AddTag("upstream-test")
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", target)
+}
+
+func TestSOCKS5RawTCPTunnelUsesUpstreamDialer(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		conn, err := echo.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	ps := NewProxyServer(0, nil)
+	dialer := &recordingDialer{targets: make(chan string, 1)}
+	ps.SetUpstreamSelector(dialer)
+	flows := make(chan *Flow, 1)
+	ps.SetFlowHandler(func(flow *Flow) { flows <- flow })
+	proxyAddr := startTestSOCKS5(t, ps)
+
+	conn, rep := dialSOCKS5(t, proxyAddr, echo.Addr().String(), "", "")
+	if rep != socks5RepSuccess {
+		t.Fatalf("expected success reply, got %d", rep)
+	}
+	conn.Write([]byte("\x00PING"))
+	io.ReadFull(conn, make([]byte, 5))
+	conn.Close()
+
+	select {
+	case target := <-dialer.targets:
+		if target != echo.Addr().String() {
+			t.Errorf("unexpected tunnel target: %s", target)
+		}
+	default:
+		t.Fatal("tunnel was not dialed through the upstream selector")
+	}
+	select {
+	case flow := <-flows:
+		if !flow.HasTag("upstream-test") {
+			t.Errorf("tunnel flow missing upstream tag: %v", flow.Tags)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("tunnel flow not recorded")
+	}
+}
+
+// blockConnectInterceptor 以403拒绝指定目标的CONNECT
+type blockConnectInterceptor struct {
+	target string
+}
+
+func (b *blockConnectInterceptor) InterceptConnect(flow *Flow, w http.ResponseWriter, r *http.Request) (bool, error) {
+	if r.Host != b.target {
+		return false, nil
+	}
+	flow.IsBlocked = true
+	http.Error(w, "blocked", http.StatusForbidden)
+	flow.StatusCode = http.StatusForbidden
+	return true, nil
+}
+
+func TestSOCKS5RunsConnectInterceptors(t *testing.T) {
+	ps := NewProxyServer(0, nil)
+	flows := make(chan *Flow, 1)
+	ps.SetFlowHandler(func(flow *Flow) { flows <- flow })
+	ps.AddConnectInterceptor(&blockConnectInterceptor{target: "blocked.example:443"})
+	proxyAddr := startTestSOCKS5(t, ps)
+
+	conn, rep := dialSOCKS5(t, proxyAddr, "blocked.example:443", "", "")
+	defer conn.Close()
+	if rep != socks5RepNotAllowed {
+		t.Fatalf("expected not-allowed reply, got %d", rep)
+	}
+
+	select {
+	case flow := <-flows:
+		if flow.Method != http.MethodConnect || !flow.IsBlocked || !flow.HasTag("socks5") {
+			t.Errorf("unexpected connect flow: method=%s blocked=%v tags=%v", flow.Method, flow.IsBlocked, flow.Tags)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("connect flow not recorded")
+	}
+}
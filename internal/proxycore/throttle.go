@@ -0,0 +1,211 @@
+package proxycore
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// NetworkProfile 网络条件配置，用于模拟慢速或不稳定的网络
+type NetworkProfile struct {
+	ID                 string  `json:"id"`
+	Name               string  `json:"name"`
+	DownloadKbps       int     `json:"downloadKbps"`       // 下行带宽（kbit/s），0表示不限
+	UploadKbps         int     `json:"uploadKbps"`         // 上行带宽（kbit/s），0表示不限
+	LatencyMs          int     `json:"latencyMs"`          // 每个请求附加的延迟
+	FirstByteLatencyMs int     `json:"firstByteLatencyMs"` // 响应首字节前附加的延迟
+	JitterMs           int     `json:"jitterMs"`           // 延迟的随机抖动范围（±）
+	FailureRate        float64 `json:"failureRate"`        // 请求失败（连接被重置）的概率，0~1
+	BuiltIn            bool    `json:"builtIn"`
+}
+
+// NetworkConditioner 为Flow选择网络条件配置，返回nil表示不做限制
+type NetworkConditioner interface {
+	ProfileFor(flow *Flow) *NetworkProfile
+}
+
+// requestLatency 本次请求附加的延迟（含抖动）
+func (p *NetworkProfile) requestLatency() time.Duration {
+	return p.jittered(p.LatencyMs)
+}
+
+// firstByteLatency 本次响应首字节前附加的延迟（含抖动）
+func (p *NetworkProfile) firstByteLatency() time.Duration {
+	return p.jittered(p.FirstByteLatencyMs)
+}
+
+// jittered 在基础延迟上叠加 ±JitterMs 的随机抖动，基础延迟为0时不抖动
+func (p *NetworkProfile) jittered(baseMs int) time.Duration {
+	if baseMs <= 0 {
+		return 0
+	}
+	ms := baseMs
+	if p.JitterMs > 0 {
+		ms += rand.Intn(2*p.JitterMs+1) - p.JitterMs
+	}
+	if ms < 0 {
+		ms = 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// shouldFail 按失败率随机决定本次请求是否失败
+func (p *NetworkProfile) shouldFail() bool {
+	return p.FailureRate > 0 && rand.Float64() < p.FailureRate
+}
+
+// sleepContext 等待指定时长，上下文取消时提前返回错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimiter 按固定带宽控制数据传输节奏
+type rateLimiter struct {
+	ctx         context.Context
+	bytesPerSec float64
+	chunkSize   int
+	start       time.Time
+	transferred int64
+}
+
+// newRateLimiter 创建带宽限制器，kbps<=0时返回nil表示不限速
+func newRateLimiter(ctx context.Context, kbps int) *rateLimiter {
+	if kbps <= 0 {
+		return nil
+	}
+	bytesPerSec := float64(kbps) * 1000 / 8
+	// 每块约50ms的数据量，使传输平滑而不是一次性突发
+	chunkSize := int(bytesPerSec / 20)
+	if chunkSize < 512 {
+		chunkSize = 512
+	}
+	return &rateLimiter{ctx: ctx, bytesPerSec: bytesPerSec, chunkSize: chunkSize}
+}
+
+// wait 记录已传输n字节，并等待到该数据量在限定带宽下应完成的时刻
+func (l *rateLimiter) wait(n int) error {
+	if l.start.IsZero() {
+		l.start = time.Now()
+	}
+	l.transferred += int64(n)
+	due := l.start.Add(time.Duration(float64(l.transferred) / l.bytesPerSec * float64(time.Second)))
+	return sleepContext(l.ctx, time.Until(due))
+}
+
+// throttledReadCloser 限速读取的请求体，模拟上行带宽
+type throttledReadCloser struct {
+	io.ReadCloser
+	limiter *rateLimiter
+}
+
+// newThrottledReadCloser 包装请求体，kbps<=0时原样返回
+func newThrottledReadCloser(ctx context.Context, body io.ReadCloser, kbps int) io.ReadCloser {
+	limiter := newRateLimiter(ctx, kbps)
+	if limiter == nil {
+		return body
+	}
+	return &throttledReadCloser{ReadCloser: body, limiter: limiter}
+}
+
+func (t *throttledReadCloser) Read(p []byte) (int, error) {
+	if len(p) > t.limiter.chunkSize {
+		p = p[:t.limiter.chunkSize]
+	}
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.wait(n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// throttledResponseWriter 按网络条件写出响应：首字节前附加延迟，响应体按下行带宽分块写出
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	ctx       context.Context
+	profile   *NetworkProfile
+	limiter   *rateLimiter
+	firstByte bool
+}
+
+// newThrottledResponseWriter 包装响应写入器
+func newThrottledResponseWriter(ctx context.Context, w http.ResponseWriter, profile *NetworkProfile) *throttledResponseWriter {
+	return &throttledResponseWriter{
+		ResponseWriter: w,
+		ctx:            ctx,
+		profile:        profile,
+		limiter:        newRateLimiter(ctx, profile.DownloadKbps),
+	}
+}
+
+// waitFirstByte 首次写出前等待首字节延迟
+func (tw *throttledResponseWriter) waitFirstByte() error {
+	if tw.firstByte {
+		return nil
+	}
+	tw.firstByte = true
+	return sleepContext(tw.ctx, tw.profile.firstByteLatency())
+}
+
+func (tw *throttledResponseWriter) WriteHeader(statusCode int) {
+	tw.waitFirstByte()
+	tw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (tw *throttledResponseWriter) Write(p []byte) (int, error) {
+	if err := tw.waitFirstByte(); err != nil {
+		return 0, err
+	}
+	if tw.limiter == nil {
+		return tw.ResponseWriter.Write(p)
+	}
+
+	written := 0
+	for written < len(p) {
+		end := written + tw.limiter.chunkSize
+		if end > len(p) {
+			end = len(p)
+		}
+		n, err := tw.ResponseWriter.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		// 立即发送本块，避免被缓冲后一次性到达客户端
+		tw.Flush()
+		if err := tw.limiter.wait(n); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Flush 实现 http.Flusher
+func (tw *throttledResponseWriter) Flush() {
+	if flusher, ok := tw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack 实现 http.Hijacker，供AbortConnection断开连接
+func (tw *throttledResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := tw.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
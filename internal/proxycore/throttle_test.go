@@ -0,0 +1,99 @@
+package proxycore
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fixedConditioner struct {
+	profile *NetworkProfile
+}
+
+func (c fixedConditioner) ProfileFor(flow *Flow) *NetworkProfile {
+	return c.profile
+}
+
+// newThrottleTestProxy 启动上游服务器和使用给定网络条件的代理，返回上游地址、经代理的客户端和Flow通道
+func newThrottleTestProxy(t *testing.T, profile *NetworkProfile, body []byte) (string, *http.Client, chan *Flow) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write(body)
+	}))
+	t.Cleanup(upstream.Close)
+
+	flows := make(chan *Flow, 1)
+	ps := NewProxyServer(0, nil)
+	ps.SetNetworkConditioner(fixedConditioner{profile: profile})
+	ps.SetFlowHandler(func(flow *Flow) { flows <- flow })
+	proxy := httptest.NewServer(ps)
+	t.Cleanup(proxy.Close)
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+	return upstream.URL, client, flows
+}
+
+func TestThrottledResponse(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 8000)
+	profile := &NetworkProfile{Name: "slow", DownloadKbps: 320, UploadKbps: 320, LatencyMs: 50, FirstByteLatencyMs: 50}
+	target, client, flows := newThrottleTestProxy(t, profile, body)
+
+	start := time.Now()
+	resp, err := client.Post(target, "text/plain", strings.NewReader(strings.Repeat("y", 4000)))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	elapsed := time.Since(start)
+
+	if !bytes.Equal(got, body) {
+		t.Fatalf("body length = %d, want %d", len(got), len(body))
+	}
+	// 上行 4000B 约0.1s，下行 8000B 约0.2s，再加两段各50ms的延迟
+	if elapsed < 350*time.Millisecond {
+		t.Errorf("throttled request took %v, expected at least 350ms", elapsed)
+	}
+
+	flow := <-flows
+	if flow.NetworkProfile != "slow" {
+		t.Errorf("NetworkProfile = %q, want slow", flow.NetworkProfile)
+	}
+	if flow.Duration < 250*time.Millisecond {
+		t.Errorf("flow duration %v should include the throttled transfer", flow.Duration)
+	}
+}
+
+func TestThrottleFailureRate(t *testing.T) {
+	profile := &NetworkProfile{Name: "broken", FailureRate: 1}
+	target, client, flows := newThrottleTestProxy(t, profile, []byte("ok"))
+
+	if resp, err := client.Get(target); err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected connection failure, got status %d", resp.StatusCode)
+	}
+
+	flow := <-flows
+	if !flow.HasTag("network-failure") {
+		t.Errorf("expected network-failure tag, got %v", flow.Tags)
+	}
+}
+
+func TestNetworkProfileJitter(t *testing.T) {
+	profile := &NetworkProfile{LatencyMs: 100, JitterMs: 30}
+	for i := 0; i < 100; i++ {
+		d := profile.requestLatency()
+		if d < 70*time.Millisecond || d > 130*time.Millisecond {
+			t.Fatalf("latency %v outside jitter range", d)
+		}
+	}
+	if (&NetworkProfile{JitterMs: 30}).requestLatency() != 0 {
+		t.Error("jitter should not apply without base latency")
+	}
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -74,6 +75,17 @@ func (d *Database) initTables() error {
 		return fmt.Errorf("failed to create breakpoint_rules table: %v", err)
 	}
 
+	// 旧版本数据库补充新增的列
+	if err := d.addMissingColumns("breakpoint_rules", []columnDef{
+		{"timeout_seconds", "INTEGER NOT NULL DEFAULT 0"},
+		{"timeout_action", "TEXT NOT NULL DEFAULT ''"},
+		{"condition", "TEXT NOT NULL DEFAULT ''"},
+		{"condition_type", "TEXT NOT NULL DEFAULT ''"},
+		{"hit_count", "INTEGER NOT NULL DEFAULT 0"},
+	}); err != nil {
+		return err
+	}
+
 	// 创建脚本表
 	scriptTableSQL := `
 	CREATE TABLE IF NOT EXISTS scripts (
@@ -91,6 +103,142 @@ func (d *Database) initTables() error {
 		return fmt.Errorf("failed to create scripts table: %v", err)
 	}
 
+	if err := d.addMissingColumns("scripts", []columnDef{
+		{"url_pattern", "TEXT NOT NULL DEFAULT ''"},
+		{"is_regex", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"method", "TEXT NOT NULL DEFAULT ''"},
+		{"sort_order", "INTEGER NOT NULL DEFAULT 0"},
+	}); err != nil {
+		return err
+	}
+
+	// 创建改写规则表，操作列表以JSON保存
+	rewriteTableSQL := `
+	CREATE TABLE IF NOT EXISTS rewrite_rules (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		url_pattern TEXT NOT NULL,
+		is_regex BOOLEAN NOT NULL DEFAULT 0,
+		phase TEXT NOT NULL DEFAULT 'both',
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		operations TEXT NOT NULL DEFAULT '[]',
+		description TEXT,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := d.db.Exec(rewriteTableSQL); err != nil {
+		return fmt.Errorf("failed to create rewrite_rules table: %v", err)
+	}
+
+	// 创建脚本键值存储表，值为JSON
+	scriptStoreTableSQL := `
+	CREATE TABLE IF NOT EXISTS script_store (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := d.db.Exec(scriptStoreTableSQL); err != nil {
+		return fmt.Errorf("failed to create script_store table: %v", err)
+	}
+
+	// 创建上游代理表
+	upstreamProxyTableSQL := `
+	CREATE TABLE IF NOT EXISTS upstream_proxies (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		proxy_url TEXT NOT NULL,
+		url_pattern TEXT NOT NULL DEFAULT '',
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		is_regex BOOLEAN NOT NULL DEFAULT 0,
+		username TEXT NOT NULL DEFAULT '',
+		password TEXT NOT NULL DEFAULT '',
+		skip_tls_verify BOOLEAN NOT NULL DEFAULT 0,
+		description TEXT,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := d.db.Exec(upstreamProxyTableSQL); err != nil {
+		return fmt.Errorf("failed to create upstream_proxies table: %v", err)
+	}
+
+	// 创建上游代理组表，组内上游ID列表以JSON保存
+	upstreamGroupTableSQL := `
+	CREATE TABLE IF NOT EXISTS upstream_groups (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		url_pattern TEXT NOT NULL DEFAULT '',
+		is_regex BOOLEAN NOT NULL DEFAULT 0,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		strategy TEXT NOT NULL DEFAULT '',
+		proxy_ids TEXT NOT NULL DEFAULT '[]',
+		description TEXT,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := d.db.Exec(upstreamGroupTableSQL); err != nil {
+		return fmt.Errorf("failed to create upstream_groups table: %v", err)
+	}
+
+	// 创建反向代理监听器表
+	reverseProxyListenerTableSQL := `
+	CREATE TABLE IF NOT EXISTS reverse_proxy_listeners (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		port INTEGER NOT NULL,
+		tls BOOLEAN NOT NULL DEFAULT 0,
+		cert_file TEXT NOT NULL DEFAULT '',
+		key_file TEXT NOT NULL DEFAULT '',
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		description TEXT,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := d.db.Exec(reverseProxyListenerTableSQL); err != nil {
+		return fmt.Errorf("failed to create reverse_proxy_listeners table: %v", err)
+	}
+
+	return nil
+}
+
+// columnDef 表的列定义
+type columnDef struct {
+	name       string
+	definition string
+}
+
+// addMissingColumns 为已存在的表补充缺少的列
+func (d *Database) addMissingColumns(table string, columns []columnDef) error {
+	rows, err := d.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s table: %v", table, err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to inspect %s table: %v", table, err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for _, column := range columns {
+		if existing[column.name] {
+			continue
+		}
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column.name, column.definition)
+		if _, err := d.db.Exec(query); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %v", table, column.name, err)
+		}
+	}
 	return nil
 }
 
@@ -98,8 +246,8 @@ func (d *Database) initTables() error {
 func (d *Database) SaveBreakpointRule(rule *features.BreakpointRule) error {
 	query := `
 	INSERT OR REPLACE INTO breakpoint_rules 
-	(id, name, url_pattern, method, enabled, is_regex, break_on_request, break_on_response, updated_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+	(id, name, url_pattern, method, enabled, is_regex, break_on_request, break_on_response, timeout_seconds, timeout_action, condition, condition_type, hit_count, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
 
 	_, err := d.db.Exec(query,
 		rule.ID,
@@ -110,6 +258,11 @@ func (d *Database) SaveBreakpointRule(rule *features.BreakpointRule) error {
 		rule.IsRegex,
 		rule.BreakOnRequest,
 		rule.BreakOnResponse,
+		rule.TimeoutSeconds,
+		rule.TimeoutAction,
+		rule.Condition,
+		rule.ConditionType,
+		rule.HitCount,
 	)
 
 	return err
@@ -118,7 +271,7 @@ func (d *Database) SaveBreakpointRule(rule *features.BreakpointRule) error {
 // GetBreakpointRules 获取所有断点规则
 func (d *Database) GetBreakpointRules() ([]*features.BreakpointRule, error) {
 	query := `
-	SELECT id, name, url_pattern, method, enabled, is_regex, break_on_request, break_on_response, created_at, updated_at
+	SELECT id, name, url_pattern, method, enabled, is_regex, break_on_request, break_on_response, timeout_seconds, timeout_action, condition, condition_type, hit_count, created_at, updated_at
 	FROM breakpoint_rules
 	ORDER BY created_at DESC`
 
@@ -142,6 +295,11 @@ func (d *Database) GetBreakpointRules() ([]*features.BreakpointRule, error) {
 			&rule.IsRegex,
 			&rule.BreakOnRequest,
 			&rule.BreakOnResponse,
+			&rule.TimeoutSeconds,
+			&rule.TimeoutAction,
+			&rule.Condition,
+			&rule.ConditionType,
+			&rule.HitCount,
 			&createdAt,
 			&updatedAt,
 		)
@@ -166,8 +324,8 @@ func (d *Database) DeleteBreakpointRule(id string) error {
 func (d *Database) SaveScript(script *features.Script) error {
 	query := `
 	INSERT OR REPLACE INTO scripts 
-	(id, name, content, enabled, type, description, updated_at)
-	VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+	(id, name, content, enabled, type, description, url_pattern, is_regex, method, sort_order, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
 
 	_, err := d.db.Exec(query,
 		script.ID,
@@ -176,6 +334,10 @@ func (d *Database) SaveScript(script *features.Script) error {
 		script.Enabled,
 		script.Type,
 		script.Description,
+		script.URLPattern,
+		script.IsRegex,
+		script.Method,
+		script.Order,
 	)
 
 	return err
@@ -184,9 +346,9 @@ func (d *Database) SaveScript(script *features.Script) error {
 // GetScripts 获取所有脚本
 func (d *Database) GetScripts() ([]*features.Script, error) {
 	query := `
-	SELECT id, name, content, enabled, type, description, created_at, updated_at
+	SELECT id, name, content, enabled, type, description, url_pattern, is_regex, method, sort_order, created_at, updated_at
 	FROM scripts
-	ORDER BY created_at DESC`
+	ORDER BY sort_order, created_at`
 
 	rows, err := d.db.Query(query)
 	if err != nil {
@@ -206,6 +368,10 @@ func (d *Database) GetScripts() ([]*features.Script, error) {
 			&script.Enabled,
 			&script.Type,
 			&script.Description,
+			&script.URLPattern,
+			&script.IsRegex,
+			&script.Method,
+			&script.Order,
 			&createdAt,
 			&updatedAt,
 		)
@@ -247,3 +413,324 @@ func (d *Database) UpdateScriptStatus(id string, enabled bool) error {
 	_, err := d.db.Exec(query, enabled, id)
 	return err
 }
+
+// SaveRewriteRule 保存改写规则
+func (d *Database) SaveRewriteRule(rule *features.RewriteRule) error {
+	operations, err := json.Marshal(rule.Operations)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT OR REPLACE INTO rewrite_rules 
+	(id, name, url_pattern, is_regex, phase, enabled, operations, description, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+
+	_, err = d.db.Exec(query,
+		rule.ID,
+		rule.Name,
+		rule.URLPattern,
+		rule.IsRegex,
+		rule.Phase,
+		rule.Enabled,
+		string(operations),
+		rule.Description,
+	)
+
+	return err
+}
+
+// GetRewriteRules 获取所有改写规则
+func (d *Database) GetRewriteRules() ([]*features.RewriteRule, error) {
+	query := `
+	SELECT id, name, url_pattern, is_regex, phase, enabled, operations, COALESCE(description, '')
+	FROM rewrite_rules
+	ORDER BY created_at`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*features.RewriteRule
+	for rows.Next() {
+		rule := &features.RewriteRule{}
+		var operations string
+
+		err := rows.Scan(
+			&rule.ID,
+			&rule.Name,
+			&rule.URLPattern,
+			&rule.IsRegex,
+			&rule.Phase,
+			&rule.Enabled,
+			&operations,
+			&rule.Description,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(operations), &rule.Operations); err != nil {
+			return nil, fmt.Errorf("invalid operations for rewrite rule %s: %v", rule.ID, err)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// DeleteRewriteRule 删除改写规则
+func (d *Database) DeleteRewriteRule(id string) error {
+	query := `DELETE FROM rewrite_rules WHERE id = ?`
+	_, err := d.db.Exec(query, id)
+	return err
+}
+
+// SaveScriptValue 保存脚本键值
+func (d *Database) SaveScriptValue(key, value string) error {
+	query := `
+	INSERT OR REPLACE INTO script_store (key, value, updated_at)
+	VALUES (?, ?, CURRENT_TIMESTAMP)`
+	_, err := d.db.Exec(query, key, value)
+	return err
+}
+
+// DeleteScriptValue 删除脚本键值
+func (d *Database) DeleteScriptValue(key string) error {
+	query := `DELETE FROM script_store WHERE key = ?`
+	_, err := d.db.Exec(query, key)
+	return err
+}
+
+// GetScriptValues 获取所有脚本键值
+func (d *Database) GetScriptValues() (map[string]string, error) {
+	rows, err := d.db.Query(`SELECT key, value FROM script_store`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, rows.Err()
+}
+
+// SaveUpstreamProxy 保存上游代理
+func (d *Database) SaveUpstreamProxy(proxy *features.UpstreamProxy) error {
+	query := `
+	INSERT OR REPLACE INTO upstream_proxies
+	(id, name, proxy_url, url_pattern, enabled, is_regex, username, password, skip_tls_verify, description, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+		COALESCE((SELECT created_at FROM upstream_proxies WHERE id = ?), CURRENT_TIMESTAMP), CURRENT_TIMESTAMP)`
+
+	_, err := d.db.Exec(query,
+		proxy.ID,
+		proxy.Name,
+		proxy.ProxyURL,
+		proxy.URLPattern,
+		proxy.Enabled,
+		proxy.IsRegex,
+		proxy.Username,
+		proxy.Password,
+		proxy.SkipTLSVerify,
+		proxy.Description,
+		proxy.ID,
+	)
+
+	return err
+}
+
+// GetUpstreamProxies 获取所有上游代理
+func (d *Database) GetUpstreamProxies() ([]*features.UpstreamProxy, error) {
+	query := `
+	SELECT id, name, proxy_url, url_pattern, enabled, is_regex, username, password, skip_tls_verify, COALESCE(description, '')
+	FROM upstream_proxies
+	ORDER BY created_at`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var proxies []*features.UpstreamProxy
+	for rows.Next() {
+		proxy := &features.UpstreamProxy{}
+		err := rows.Scan(
+			&proxy.ID,
+			&proxy.Name,
+			&proxy.ProxyURL,
+			&proxy.URLPattern,
+			&proxy.Enabled,
+			&proxy.IsRegex,
+			&proxy.Username,
+			&proxy.Password,
+			&proxy.SkipTLSVerify,
+			&proxy.Description,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		proxies = append(proxies, proxy)
+	}
+
+	return proxies, nil
+}
+
+// DeleteUpstreamProxy 删除上游代理
+func (d *Database) DeleteUpstreamProxy(id string) error {
+	query := `DELETE FROM upstream_proxies WHERE id = ?`
+	_, err := d.db.Exec(query, id)
+	return err
+}
+
+// SaveUpstreamGroup 保存上游代理组
+func (d *Database) SaveUpstreamGroup(group *features.UpstreamGroup) error {
+	proxyIDs, err := json.Marshal(group.ProxyIDs)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT OR REPLACE INTO upstream_groups
+	(id, name, url_pattern, is_regex, enabled, strategy, proxy_ids, description, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?,
+		COALESCE((SELECT created_at FROM upstream_groups WHERE id = ?), CURRENT_TIMESTAMP), CURRENT_TIMESTAMP)`
+
+	_, err = d.db.Exec(query,
+		group.ID,
+		group.Name,
+		group.URLPattern,
+		group.IsRegex,
+		group.Enabled,
+		group.Strategy,
+		string(proxyIDs),
+		group.Description,
+		group.ID,
+	)
+
+	return err
+}
+
+// GetUpstreamGroups 获取所有上游代理组
+func (d *Database) GetUpstreamGroups() ([]*features.UpstreamGroup, error) {
+	query := `
+	SELECT id, name, url_pattern, is_regex, enabled, strategy, proxy_ids, COALESCE(description, '')
+	FROM upstream_groups
+	ORDER BY created_at`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*features.UpstreamGroup
+	for rows.Next() {
+		group := &features.UpstreamGroup{}
+		var proxyIDs string
+
+		err := rows.Scan(
+			&group.ID,
+			&group.Name,
+			&group.URLPattern,
+			&group.IsRegex,
+			&group.Enabled,
+			&group.Strategy,
+			&proxyIDs,
+			&group.Description,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(proxyIDs), &group.ProxyIDs); err != nil {
+			return nil, fmt.Errorf("invalid proxy IDs for upstream group %s: %v", group.ID, err)
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// DeleteUpstreamGroup 删除上游代理组
+func (d *Database) DeleteUpstreamGroup(id string) error {
+	query := `DELETE FROM upstream_groups WHERE id = ?`
+	_, err := d.db.Exec(query, id)
+	return err
+}
+
+// SaveReverseProxyListener 保存反向代理监听器
+func (d *Database) SaveReverseProxyListener(listener *features.ReverseProxyListener) error {
+	query := `
+	INSERT OR REPLACE INTO reverse_proxy_listeners
+	(id, name, port, tls, cert_file, key_file, enabled, description, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?,
+		COALESCE((SELECT created_at FROM reverse_proxy_listeners WHERE id = ?), CURRENT_TIMESTAMP), CURRENT_TIMESTAMP)`
+
+	_, err := d.db.Exec(query,
+		listener.ID,
+		listener.Name,
+		listener.Port,
+		listener.TLS,
+		listener.CertFile,
+		listener.KeyFile,
+		listener.Enabled,
+		listener.Description,
+		listener.ID,
+	)
+
+	return err
+}
+
+// GetReverseProxyListeners 获取所有反向代理监听器
+func (d *Database) GetReverseProxyListeners() ([]*features.ReverseProxyListener, error) {
+	query := `
+	SELECT id, name, port, tls, cert_file, key_file, enabled, COALESCE(description, '')
+	FROM reverse_proxy_listeners
+	ORDER BY created_at`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var listeners []*features.ReverseProxyListener
+	for rows.Next() {
+		listener := &features.ReverseProxyListener{}
+		err := rows.Scan(
+			&listener.ID,
+			&listener.Name,
+			&listener.Port,
+			&listener.TLS,
+			&listener.CertFile,
+			&listener.KeyFile,
+			&listener.Enabled,
+			&listener.Description,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+// DeleteReverseProxyListener 删除反向代理监听器
+func (d *Database) DeleteReverseProxyListener(id string) error {
+	query := `DELETE FROM reverse_proxy_listeners WHERE id = ?`
+	_, err := d.db.Exec(query, id)
+	return err
+}